@@ -1,19 +1,25 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/fs"
 	"net"
-	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"syscall"
 	"time"
 
+	"seetong-dvr/internal/catalog"
+	"seetong-dvr/internal/config"
 	"seetong-dvr/internal/seetong"
 	"seetong-dvr/internal/server"
 
@@ -24,51 +30,292 @@ import (
 var staticFS embed.FS
 
 func main() {
-	port := flag.Int("port", 8000, "Server port")
+	configPath := flag.String("config", config.DefaultPath(), "Config file path")
+	port := flag.Int("port", config.DefaultPort, "Server port")
+	host := flag.String("host", "", "Listen host (default all interfaces)")
 	dvrPath := flag.String("path", "", "DVR base path (optional, can be set via web UI)")
+	timezone := flag.String("timezone", config.DefaultTimezone, "Display timezone")
+	cacheDir := flag.String("cache-dir", "", "Index cache directory (default ./.index_cache)")
+	storageURL := flag.String("storage-url", "", "Read the DVR path from this HTTP base URL with range requests")
+	logFormat := flag.String("log-format", config.DefaultLogFormat, "Log format: text or json")
+	authToken := flag.String("auth-token", "", "Require this bearer token for /api requests")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file, serve HTTPS with -tls-key")
+	tlsKey := flag.String("tls-key", "", "TLS private key file")
+	tlsSelfSigned := flag.Bool("tls-selfsigned", false, "Serve HTTPS with a self-signed certificate kept in the config directory")
+	workers := flag.Int("workers", 0, "Cache build workers (default 2, max 4)")
+	scanWorkers := flag.Int("scan-workers", 0, "VPS scan workers per file (default 2, max 4)")
+	cacheDays := flag.Int("cache-days", 0, "Build the cache only for the newest N days at startup, older dates on demand (0 builds all)")
+	cacheOrder := flag.String("cache-order", server.CacheOrderNewest, "Cache build order: newest, oldest or index (TRec file number)")
 	debug := flag.Bool("debug", false, "Enable debug logging")
 	noBrowser := flag.Bool("no-browser", false, "Don't open browser automatically")
+	minTimestamp := flag.Int64("min-timestamp", seetong.MinValidTimestamp, "Minimum valid Unix timestamp")
+	rawTimestamps := flag.Bool("raw-timestamps", false, "Disable the timestamp floor, for cameras with unset clocks")
+	compactIndex := flag.Bool("compact-index", false, "Keep frame indices compressed in memory (less memory, more CPU)")
+	indexSearchSize := flag.Int64("index-search-size", seetong.DefaultIndexSearchSize, "Initial bytes searched for the frame index, grown to end of file if not found")
+	indexResync := flag.Bool("index-resync", false, "Skip corrupt frame index entries and keep parsing instead of stopping")
+	compressCache := flag.Bool("compress-cache", false, "Write frame index and VPS caches compressed on disk (smaller, decoded on load)")
+	readOnly := flag.Bool("read-only", false, "Write no files: parse indexes in memory only, don't save config or bookmarks")
+	decryptXORKey := flag.String("decrypt-xor-key", "", "Hex XOR key for firmware that scrambles frame payloads")
+	readRetries := flag.Int("read-retries", config.DefaultReadRetries, "Read attempts on transient I/O errors")
+	retryBackoff := flag.Int("retry-backoff-ms", config.DefaultRetryBackoff, "Initial backoff between read retries in ms")
+	dumpFile := flag.String("dump-file", "", "Print a JSON diagnostic report for a TRec file and exit")
+	exportCatalog := flag.String("export-catalog", "", "Write the recording catalog to a SQLite database and exit")
+	archiveTo := flag.String("archive-to", "", "Keep copying completed TRec files from the DVR path into this archive directory")
+	corsOrigins := flag.String("cors-origins", config.DefaultCorsOrigins, "Allowed CORS origins, comma-separated")
 	flag.Parse()
 
-	// 设置日志级别
+	// 配置优先级：命令行参数 > 环境变量 > 配置文件 > 默认值
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Printf("警告: 无法读取配置文件 %s: %v\n", *configPath, err)
+	}
+	cfg.ApplyEnv()
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.Port = *port
+		case "host":
+			cfg.Host = *host
+		case "path":
+			cfg.DVRPath = *dvrPath
+		case "timezone":
+			cfg.Timezone = *timezone
+		case "cache-dir":
+			cfg.CacheDir = *cacheDir
+		case "storage-url":
+			cfg.StorageURL = *storageURL
+		case "log-format":
+			cfg.LogFormat = *logFormat
+		case "auth-token":
+			cfg.AuthToken = *authToken
+		case "tls-cert":
+			cfg.TLSCert = *tlsCert
+		case "tls-key":
+			cfg.TLSKey = *tlsKey
+		case "tls-selfsigned":
+			cfg.TLSSelfSigned = *tlsSelfSigned
+		case "workers":
+			cfg.Workers = *workers
+		case "scan-workers":
+			cfg.ScanWorkers = *scanWorkers
+		case "cache-order":
+			cfg.CacheOrder = *cacheOrder
+		case "cache-days":
+			cfg.CacheDays = *cacheDays
+		case "min-timestamp":
+			cfg.MinTimestamp = *minTimestamp
+		case "raw-timestamps":
+			cfg.RawTimestamps = *rawTimestamps
+		case "compact-index":
+			cfg.CompactIndex = *compactIndex
+		case "index-search-size":
+			cfg.IndexSearchSize = *indexSearchSize
+		case "index-resync":
+			cfg.IndexResync = *indexResync
+		case "compress-cache":
+			cfg.CompressCache = *compressCache
+		case "read-only":
+			cfg.ReadOnly = *readOnly
+		case "decrypt-xor-key":
+			cfg.DecryptXORKey = *decryptXORKey
+		case "read-retries":
+			cfg.ReadRetries = *readRetries
+		case "retry-backoff-ms":
+			cfg.RetryBackoffMs = *retryBackoff
+		case "cors-origins":
+			cfg.CorsOrigins = config.SplitList(*corsOrigins)
+		}
+	})
+	cfg.DVRPath = config.NormalizeDVRPath(cfg.DVRPath)
+	cfgStore := config.NewStore(*configPath, cfg)
+
+	// 设置日志
+	seetong.SetLogFormat(cfg.LogFormat)
 	if *debug {
 		seetong.SetDebugMode(true)
 	}
 
+	seetong.SetMinValidTimestamp(cfg.MinTimestamp)
+	seetong.SetRawTimestampMode(cfg.RawTimestamps)
+	seetong.SetCompactFrameIndex(cfg.CompactIndex)
+	seetong.SetIndexSearchSize(cfg.IndexSearchSize)
+	seetong.SetIndexResync(cfg.IndexResync)
+	seetong.SetCompressedCache(cfg.CompressCache)
+	seetong.SetReadOnly(cfg.ReadOnly)
+	seetong.SetFramePoolMaxSize(cfg.FramePoolMaxKB * 1024)
+	seetong.SetMaxFrameSize(int64(cfg.MaxFrameSizeKB) * 1024)
+	seetong.SetVPSScanWorkers(cfg.ScanWorkers)
+	if cfg.DecryptXORKey != "" {
+		key, err := hex.DecodeString(strings.TrimPrefix(cfg.DecryptXORKey, "0x"))
+		if err == nil {
+			var d *seetong.XORDecryptor
+			if d, err = seetong.NewXORDecryptor(key); err == nil {
+				seetong.SetFrameDecryptor(d)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: -decrypt-xor-key: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	seetong.SetReadRetry(cfg.ReadRetries, time.Duration(cfg.RetryBackoffMs)*time.Millisecond)
+	seetong.SetCacheDir(seetong.CacheDirOutside(cfg.CacheDir, cfg.DVRPath))
+	if _, err := seetong.MigrateCacheDir(); err != nil {
+		seetong.LogWarn("缓存目录版本检查失败", "dir", seetong.GetCacheDir(), "error", err)
+	}
+	if cfg.StorageURL != "" {
+		st, err := seetong.NewHTTPStorage(cfg.StorageURL, cfg.DVRPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: -storage-url: %v\n", err)
+			os.Exit(1)
+		}
+		seetong.SetStorage(st)
+	}
+
+	// 诊断模式：输出单个 TRec 文件的报告后退出
+	if *dumpFile != "" {
+		dump, err := seetong.DumpTRecFile(*dumpFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(dump)
+		return
+	}
+
+	// 导出模式：构建全部段落的缓存，将目录写入 SQLite 后退出
+	if *exportCatalog != "" {
+		if cfg.DVRPath == "" {
+			fmt.Fprintln(os.Stderr, "错误: -export-catalog 需要 -path 或配置的 DVR 路径")
+			os.Exit(1)
+		}
+		dvr := server.NewDVRServer(cfg.DVRPath)
+		dvr.SetWorkers(cfg.Workers)
+		dvr.SetCacheOrder(cfg.CacheOrder)
+		if err := dvr.Load(); err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 无法加载 DVR 数据: %v\n", err)
+			os.Exit(1)
+		}
+		dvr.BuildVPSCache()
+		summary, err := catalog.Export(dvr.GetStorage(), cfg.DVRPath, *exportCatalog)
+		dvr.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 导出失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ 已导出 %d 个文件、%d 个段落、%d 条统计到 %s\n",
+			summary.Files, summary.Segments, summary.Stats, *exportCatalog)
+		return
+	}
+
+	// 归档模式：持续将写完的 TRec 文件复制到归档目录并构建缓存，直到收到退出信号
+	if *archiveTo != "" {
+		if cfg.DVRPath == "" {
+			fmt.Fprintln(os.Stderr, "错误: -archive-to 需要 -path 或配置的 DVR 路径")
+			os.Exit(1)
+		}
+		if cfg.ReadOnly {
+			fmt.Fprintln(os.Stderr, "错误: -archive-to 需要写入归档目录，不能与只读模式同时使用")
+			os.Exit(1)
+		}
+		archiver, err := seetong.NewArchiver(cfg.DVRPath, *archiveTo)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 无法打开归档目录: %v\n", err)
+			os.Exit(1)
+		}
+		archiver.SetWorkers(cfg.Workers)
+		if cfg.CacheDir == "" {
+			seetong.SetCacheDir(seetong.ArchiveCacheDir(*archiveTo))
+			if _, err := seetong.MigrateCacheDir(); err != nil {
+				seetong.LogWarn("缓存目录版本检查失败", "dir", seetong.GetCacheDir(), "error", err)
+			}
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		fmt.Printf("归档 %s 到 %s（已归档 %d 个文件），按 Ctrl+C 停止\n", cfg.DVRPath, *archiveTo, len(archiver.Files()))
+		archiver.Run(ctx, func(result seetong.ArchiveResult) {
+			if result.Copied > 0 || result.Pending > 0 {
+				fmt.Printf("✓ 本次归档 %d 个文件，构建 %d 个段落缓存，%d 个待归档\n", result.Copied, result.Cached, result.Pending)
+			}
+		})
+		fmt.Println("\n归档已停止")
+		return
+	}
+
+	// HTTPS：指定的证书优先，否则按需生成自签名证书
+	certFile, keyFile := cfg.TLSCert, cfg.TLSKey
+	if (certFile == "") != (keyFile == "") {
+		fmt.Fprintln(os.Stderr, "错误: -tls-cert 和 -tls-key 需要同时指定")
+		os.Exit(1)
+	}
+	if certFile == "" && cfg.TLSSelfSigned {
+		if cfg.ReadOnly {
+			fmt.Fprintln(os.Stderr, "错误: -tls-selfsigned 需要在配置目录写入证书，只读模式下请使用 -tls-cert 和 -tls-key")
+			os.Exit(1)
+		}
+		certFile, keyFile, err = ensureSelfSignedCert(filepath.Dir(*configPath))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 无法生成自签名证书: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	scheme := "http"
+	if certFile != "" {
+		scheme = "https"
+	}
+
 	// 查找可用端口
-	actualPort := findAvailablePort(*port)
+	actualPort := findAvailablePort(cfg.Port)
 
 	fmt.Println("============================================================")
 	fmt.Println("天视通 DVR Web 播放器")
 	fmt.Println("============================================================")
-	if *dvrPath != "" {
-		fmt.Printf("DVR 路径: %s\n", *dvrPath)
+	if cfg.DVRPath != "" {
+		fmt.Printf("DVR 路径: %s\n", cfg.DVRPath)
+	}
+	fmt.Printf("配置文件: %s\n", *configPath)
+	fmt.Printf("监听地址: %s://localhost:%d\n", scheme, actualPort)
+	if certFile != "" {
+		fmt.Printf("TLS 证书: %s\n", certFile)
+		if fp := certFingerprint(certFile); fp != "" {
+			fmt.Printf("证书指纹: SHA256 %s\n", fp)
+		}
 	}
-	fmt.Printf("监听地址: http://localhost:%d\n", actualPort)
 	fmt.Println("============================================================")
 
 	// 创建 DVR 服务器
-	dvr := server.NewDVRServer(*dvrPath)
+	dvr := server.NewDVRServer(cfg.DVRPath)
 	defer dvr.Close()
+	if err := dvr.SetTimezone(cfg.Timezone); err != nil {
+		fmt.Printf("警告: 无效的时区 %s，使用默认时区\n", cfg.Timezone)
+	}
+	dvr.SetWorkers(cfg.Workers)
+	dvr.SetCacheOrder(cfg.CacheOrder)
+	dvr.SetCacheDays(cfg.CacheDays)
+	if cfg.DVRPath != "" {
+		if err := dvr.Load(); err != nil {
+			fmt.Printf("警告: 无法加载 DVR 数据: %v\n", err)
+		} else {
+			go dvr.BuildVPSCache()
+		}
+	}
 
 	// 创建 Iris 应用
 	app := iris.New()
 	app.Logger().SetLevel("warn")
 
 	// CORS
-	app.UseRouter(func(ctx iris.Context) {
-		ctx.Header("Access-Control-Allow-Origin", "*")
-		ctx.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		ctx.Header("Access-Control-Allow-Headers", "Content-Type")
-		if ctx.Method() == "OPTIONS" {
-			ctx.StatusCode(204)
-			return
-		}
-		ctx.Next()
-	})
+	app.UseRouter(server.CORS(cfg.CorsOrigins))
+
+	// API 访问令牌
+	if cfg.AuthToken != "" {
+		app.UseRouter(server.TokenAuth(cfg.AuthToken))
+	}
 
 	// 注册 API 路由
-	handlers := server.NewHandlers(dvr)
+	handlers := server.NewHandlers(dvr, cfgStore)
 	server.RegisterRoutes(app, handlers)
 
 	// 嵌入的静态文件
@@ -76,10 +323,7 @@ func main() {
 	if err != nil {
 		fmt.Printf("警告: 无法加载嵌入的静态文件: %v\n", err)
 	} else {
-		app.HandleDir("/", http.FS(staticSub), iris.DirOptions{
-			IndexName: "index.html",
-			SPA:       true,
-		})
+		server.RegisterSPA(app, staticSub)
 		fmt.Println("静态文件: 嵌入模式")
 	}
 
@@ -96,13 +340,19 @@ func main() {
 	if !*noBrowser {
 		go func() {
 			time.Sleep(500 * time.Millisecond)
-			openBrowser(fmt.Sprintf("http://localhost:%d", actualPort))
+			openBrowser(fmt.Sprintf("%s://localhost:%d", scheme, actualPort))
 		}()
 	}
 
 	// 启动服务器
-	fmt.Printf("\n服务器已启动: http://localhost:%d\n", actualPort)
-	if err := app.Listen(fmt.Sprintf(":%d", actualPort)); err != nil {
+	fmt.Printf("\n服务器已启动: %s://localhost:%d\n", scheme, actualPort)
+	addr := fmt.Sprintf("%s:%d", cfg.Host, actualPort)
+	if certFile != "" {
+		err = app.Run(iris.TLS(addr, certFile, keyFile))
+	} else {
+		err = app.Listen(addr)
+	}
+	if err != nil {
 		fmt.Printf("服务器错误: %v\n", err)
 	}
 }
@@ -0,0 +1,120 @@
+// Package catalog 将录像目录导出为只读 SQLite 数据库，便于用外部工具做报表和搜索
+package catalog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"seetong-dvr/internal/seetong"
+)
+
+// 表结构
+const (
+	filesSchema = `CREATE TABLE files (
+	file_index INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	size INTEGER,
+	mtime INTEGER
+)`
+	segmentsSchema = `CREATE TABLE segments (
+	file_index INTEGER NOT NULL,
+	channel INTEGER NOT NULL,
+	start_time INTEGER NOT NULL,
+	end_time INTEGER NOT NULL,
+	duration INTEGER NOT NULL,
+	frame_count INTEGER NOT NULL,
+	cached INTEGER NOT NULL
+)`
+	segmentStatsSchema = `CREATE TABLE segment_stats (
+	file_index INTEGER NOT NULL,
+	channel INTEGER NOT NULL,
+	frame_channel INTEGER NOT NULL,
+	frames INTEGER NOT NULL,
+	i_frames INTEGER NOT NULL,
+	p_frames INTEGER NOT NULL,
+	avg_gop_length REAL,
+	max_gop_length INTEGER,
+	total_bytes INTEGER NOT NULL,
+	duration_sec REAL,
+	avg_bitrate REAL,
+	peak_bitrate REAL
+)`
+)
+
+// Summary 导出结果
+type Summary struct {
+	Files    int
+	Segments int
+	Stats    int
+}
+
+// Export 将已加载存储的文件、段落和段落统计写入 path
+// 统计来自帧索引缓存，调用前应先构建缓存（未缓存的段落只有 segments 行，cached=0）。
+// 已存在的 path 会被覆盖
+func Export(storage *seetong.TPSStorage, dvrPath, path string) (Summary, error) {
+	var summary Summary
+	if storage == nil || !storage.IsLoaded() {
+		return summary, fmt.Errorf("存储未加载")
+	}
+
+	db := &sqliteDB{}
+	files := db.createTable("files", filesSchema)
+	segments := db.createTable("segments", segmentsSchema)
+	stats := db.createTable("segment_stats", segmentStatsSchema)
+
+	segs := append([]seetong.SegmentRecord(nil), storage.GetSegments()...) // 不改变存储中的顺序
+	sort.Slice(segs, func(i, j int) bool { return segs[i].FileIndex < segs[j].FileIndex })
+
+	seen := make(map[int]bool)
+	for _, seg := range segs {
+		if !seen[seg.FileIndex] {
+			seen[seg.FileIndex] = true
+			path := storage.RecFilePath(seg.FileIndex)
+			name := filepath.Base(path)
+			if rel, err := filepath.Rel(dvrPath, path); err == nil {
+				name = filepath.ToSlash(rel) // 子目录来源的文件带相对路径
+			}
+			if info, err := seetong.CurrentStorage().Stat(path); err == nil {
+				files.insert(seg.FileIndex, name, info.Size(), info.ModTime().Unix())
+			} else {
+				files.insert(seg.FileIndex, name, nil, nil)
+			}
+		}
+
+		cached := storage.GetCachedSegment(seg.FileIndex)
+		segments.insert(seg.FileIndex, seg.Channel, seg.StartTime, seg.EndTime,
+			seg.EndTime-seg.StartTime, seg.FrameCount, cached != nil)
+		if cached == nil {
+			continue
+		}
+
+		channels := make([]uint32, 0, len(cached.VideoStats))
+		for ch := range cached.VideoStats {
+			channels = append(channels, ch)
+		}
+		sort.Slice(channels, func(i, j int) bool { return channels[i] < channels[j] })
+		for _, ch := range channels {
+			st := cached.VideoStats[ch]
+			stats.insert(seg.FileIndex, seg.Channel, ch, st.Frames, st.IFrames, st.PFrames,
+				st.AvgGOPLength, st.MaxGOPLength, st.TotalBytes, st.DurationSec, st.AvgBitrate, st.PeakBitrate)
+		}
+	}
+
+	// 先写临时文件再重命名，避免中途失败留下半个数据库
+	tmp := path + ".tmp"
+	if err := db.Write(tmp); err != nil {
+		os.Remove(tmp)
+		return summary, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return summary, err
+	}
+
+	summary.Files = len(files.rows)
+	summary.Segments = len(segments.rows)
+	summary.Stats = len(stats.rows)
+	return summary, nil
+}
@@ -0,0 +1,350 @@
+package catalog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+)
+
+// ============================================================================
+// 最小 SQLite 数据库写入器
+// ============================================================================
+//
+// 只支持一次性写入由 rowid 表组成的新数据库（无索引、无溢出页），
+// 生成的文件可以被任何 SQLite 客户端只读打开。格式参考 https://www.sqlite.org/fileformat.html
+
+const (
+	sqlitePageSize   = 4096
+	sqliteHeaderSize = 100
+	sqliteVersion    = 3045000 // 写入文件头的 SQLITE_VERSION_NUMBER
+
+	pageTypeInteriorTable = 0x05
+	pageTypeLeafTable     = 0x0D
+
+	// 表 B 树叶子单元不溢出时的最大负载（usable size - 35）
+	maxLocalPayload = sqlitePageSize - 35
+)
+
+// sqliteTable 待写入的表
+type sqliteTable struct {
+	name   string
+	schema string // CREATE TABLE 语句
+	rows   [][]interface{}
+}
+
+// sqliteDB 内存中的数据库，Write 时一次性生成文件
+type sqliteDB struct {
+	tables []*sqliteTable
+}
+
+// createTable 添加一张表，列值支持 nil、整数、float64、string 和 bool
+func (db *sqliteDB) createTable(name, schema string) *sqliteTable {
+	t := &sqliteTable{name: name, schema: schema}
+	db.tables = append(db.tables, t)
+	return t
+}
+
+func (t *sqliteTable) insert(values ...interface{}) {
+	t.rows = append(t.rows, values)
+}
+
+// btreeCell 表 B 树单元
+type btreeCell struct {
+	rowid int64
+	data  []byte
+}
+
+// pageWriter 按页号顺序分配页面
+type pageWriter struct {
+	pages [][]byte // pages[0] 为第 1 页
+}
+
+func (w *pageWriter) alloc() (int, []byte) {
+	page := make([]byte, sqlitePageSize)
+	w.pages = append(w.pages, page)
+	return len(w.pages), page
+}
+
+// Write 将数据库写入 path（覆盖已有文件）
+func (db *sqliteDB) Write(path string) error {
+	w := &pageWriter{}
+	_, page1 := w.alloc() // 第 1 页：文件头 + sqlite_master
+
+	var master []btreeCell
+	for i, t := range db.tables {
+		cells := make([]btreeCell, len(t.rows))
+		for j, row := range t.rows {
+			rowid := int64(j + 1)
+			record, err := encodeRecord(row)
+			if err != nil {
+				return fmt.Errorf("%s 第 %d 行: %w", t.name, j+1, err)
+			}
+			cells[j] = btreeCell{rowid: rowid, data: leafCell(rowid, record)}
+		}
+		root, err := w.writeBTree(cells)
+		if err != nil {
+			return fmt.Errorf("%s: %w", t.name, err)
+		}
+
+		record, err := encodeRecord([]interface{}{"table", t.name, t.name, root, t.schema})
+		if err != nil {
+			return err
+		}
+		master = append(master, btreeCell{rowid: int64(i + 1), data: leafCell(int64(i+1), record)})
+	}
+
+	if !fitsLeaf(master, sqliteHeaderSize) {
+		return fmt.Errorf("sqlite_master 超出第一页")
+	}
+	writeLeaf(page1, sqliteHeaderSize, master)
+	writeFileHeader(page1, len(w.pages))
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	for _, page := range w.pages {
+		if _, err := f.Write(page); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// writeBTree 自底向上构建表 B 树，返回根页号
+func (w *pageWriter) writeBTree(cells []btreeCell) (int, error) {
+	for _, c := range cells {
+		if len(c.data) > maxLocalPayload {
+			return 0, fmt.Errorf("行 %d 过大 (%d 字节)，不支持溢出页", c.rowid, len(c.data))
+		}
+	}
+
+	// 叶子层
+	type child struct {
+		page     int
+		maxRowid int64
+	}
+	var level []child
+	for start := 0; start < len(cells) || len(level) == 0; {
+		end := start
+		for end < len(cells) && fitsLeaf(cells[start:end+1], 0) {
+			end++
+		}
+		pageNo, page := w.alloc()
+		writeLeaf(page, 0, cells[start:end])
+		var maxRowid int64
+		if end > start {
+			maxRowid = cells[end-1].rowid
+		}
+		level = append(level, child{pageNo, maxRowid})
+		start = end
+	}
+
+	// 内部层：除最后一个子页外每个子页一个单元，最后一个子页作为最右指针
+	for len(level) > 1 {
+		var next []child
+		for start := 0; start < len(level); {
+			end := start + 1 // [start, end) 为本页的子页，最后一个是最右指针
+			size := 12
+			for end < len(level) {
+				cellSize := 4 + varintLen(uint64(level[end-1].maxRowid)) + 2
+				if size+cellSize > sqlitePageSize {
+					break
+				}
+				size += cellSize
+				end++
+			}
+
+			pageNo, page := w.alloc()
+			var interior []btreeCell
+			for _, c := range level[start : end-1] {
+				cell := make([]byte, 4, 13)
+				binary.BigEndian.PutUint32(cell, uint32(c.page))
+				cell = appendVarint(cell, uint64(c.maxRowid))
+				interior = append(interior, btreeCell{data: cell})
+			}
+			writeInterior(page, interior, level[end-1].page)
+			next = append(next, child{pageNo, level[end-1].maxRowid})
+			start = end
+		}
+		level = next
+	}
+	return level[0].page, nil
+}
+
+// fitsLeaf 判断单元能否放进一个叶子页（offset 为 B 树头在页内的位置）
+func fitsLeaf(cells []btreeCell, offset int) bool {
+	size := offset + 8
+	for _, c := range cells {
+		size += len(c.data) + 2
+	}
+	return size <= sqlitePageSize
+}
+
+// writeLeaf 写入叶子页：页头、单元指针数组，单元从页尾向前排列
+func writeLeaf(page []byte, offset int, cells []btreeCell) {
+	writeCells(page, offset, pageTypeLeafTable, 8, cells)
+}
+
+// writeInterior 写入内部页
+func writeInterior(page []byte, cells []btreeCell, rightMost int) {
+	writeCells(page, 0, pageTypeInteriorTable, 12, cells)
+	binary.BigEndian.PutUint32(page[8:12], uint32(rightMost))
+}
+
+func writeCells(page []byte, offset int, pageType byte, headerSize int, cells []btreeCell) {
+	content := sqlitePageSize
+	ptr := offset + headerSize
+	for _, c := range cells {
+		content -= len(c.data)
+		copy(page[content:], c.data)
+		binary.BigEndian.PutUint16(page[ptr:], uint16(content))
+		ptr += 2
+	}
+
+	page[offset] = pageType
+	binary.BigEndian.PutUint16(page[offset+1:], 0) // 无空闲块
+	binary.BigEndian.PutUint16(page[offset+3:], uint16(len(cells)))
+	binary.BigEndian.PutUint16(page[offset+5:], uint16(content%65536)) // 65536 记为 0
+	page[offset+7] = 0                                                 // 碎片字节数
+}
+
+// writeFileHeader 写入 100 字节文件头
+func writeFileHeader(page []byte, pageCount int) {
+	copy(page, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(page[16:], sqlitePageSize)
+	page[18] = 1                             // 写版本（回滚日志）
+	page[19] = 1                             // 读版本
+	page[20] = 0                             // 每页保留字节
+	page[21] = 64                            // 最大嵌入负载比例
+	page[22] = 32                            // 最小嵌入负载比例
+	page[23] = 32                            // 叶子负载比例
+	binary.BigEndian.PutUint32(page[24:], 1) // 文件修改计数
+	binary.BigEndian.PutUint32(page[28:], uint32(pageCount))
+	binary.BigEndian.PutUint32(page[40:], 1) // schema cookie
+	binary.BigEndian.PutUint32(page[44:], 4) // schema 格式
+	binary.BigEndian.PutUint32(page[56:], 1) // UTF-8
+	binary.BigEndian.PutUint32(page[92:], 1) // version-valid-for，与修改计数一致时页数有效
+	binary.BigEndian.PutUint32(page[96:], sqliteVersion)
+}
+
+// leafCell 表叶子单元：负载长度、rowid、记录
+func leafCell(rowid int64, record []byte) []byte {
+	cell := appendVarint(nil, uint64(len(record)))
+	cell = appendVarint(cell, uint64(rowid))
+	return append(cell, record...)
+}
+
+// encodeRecord 按 SQLite 记录格式编码一行
+func encodeRecord(values []interface{}) ([]byte, error) {
+	var types []uint64
+	var body []byte
+	for _, v := range values {
+		switch x := v.(type) {
+		case nil:
+			types = append(types, 0)
+		case bool:
+			if x {
+				types = append(types, 9)
+			} else {
+				types = append(types, 8)
+			}
+		case int:
+			t, b := encodeInt(int64(x))
+			types, body = append(types, t), append(body, b...)
+		case int64:
+			t, b := encodeInt(x)
+			types, body = append(types, t), append(body, b...)
+		case uint32:
+			t, b := encodeInt(int64(x))
+			types, body = append(types, t), append(body, b...)
+		case float64:
+			var b [8]byte
+			binary.BigEndian.PutUint64(b[:], math.Float64bits(x))
+			types, body = append(types, 7), append(body, b[:]...)
+		case string:
+			types, body = append(types, uint64(len(x))*2+13), append(body, x...)
+		default:
+			return nil, fmt.Errorf("不支持的列类型 %T", v)
+		}
+	}
+
+	headerLen := 0
+	for _, t := range types {
+		headerLen += varintLen(t)
+	}
+	// 头部长度包含自身的 varint
+	total := headerLen + 1
+	if varintLen(uint64(total)) > 1 {
+		total = headerLen + varintLen(uint64(headerLen+2))
+	}
+
+	record := appendVarint(nil, uint64(total))
+	for _, t := range types {
+		record = appendVarint(record, t)
+	}
+	return append(record, body...), nil
+}
+
+// encodeInt 选择最短的整数存储类型（0 和 1 使用 schema 格式 4 的常量类型）
+func encodeInt(v int64) (uint64, []byte) {
+	switch {
+	case v == 0:
+		return 8, nil
+	case v == 1:
+		return 9, nil
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		return 1, []byte{byte(v)}
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		return 2, binary.BigEndian.AppendUint16(nil, uint16(v))
+	case v >= -1<<23 && v < 1<<23:
+		return 3, []byte{byte(v >> 16), byte(v >> 8), byte(v)}
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		return 4, binary.BigEndian.AppendUint32(nil, uint32(v))
+	case v >= -1<<47 && v < 1<<47:
+		b := binary.BigEndian.AppendUint64(nil, uint64(v))
+		return 5, b[2:]
+	default:
+		return 6, binary.BigEndian.AppendUint64(nil, uint64(v))
+	}
+}
+
+// appendVarint SQLite 变长整数（大端，每字节 7 位，第 9 字节使用全部 8 位）
+func appendVarint(b []byte, v uint64) []byte {
+	if v > 0x00FFFFFFFFFFFFFF {
+		var buf [9]byte
+		buf[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(v&0x7F) | 0x80
+			v >>= 7
+		}
+		return append(b, buf[:]...)
+	}
+
+	var buf [8]byte
+	n := 0
+	for {
+		buf[n] = byte(v & 0x7F)
+		n++
+		v >>= 7
+		if v == 0 {
+			break
+		}
+	}
+	for i := n - 1; i >= 0; i-- {
+		c := buf[i]
+		if i > 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+// varintLen 变长整数编码后的字节数
+func varintLen(v uint64) int {
+	return len(appendVarint(nil, v))
+}
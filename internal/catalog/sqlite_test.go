@@ -0,0 +1,104 @@
+package catalog
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sqlite3 用 sqlite3 命令行只读打开 path 执行 sql，没有 sqlite3 时跳过测试
+func sqlite3(t *testing.T, path, sql string) string {
+	t.Helper()
+	bin, err := exec.LookPath("sqlite3")
+	if err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	out, err := exec.Command(bin, "-readonly", path, sql).CombinedOutput()
+	if err != nil {
+		t.Fatalf("sqlite3 %q: %v\n%s", sql, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// bigRowValue 第 j 行的整数列：覆盖 0/1 常量和 1 到 8 字节的各种整数类型
+func bigRowValue(j int) int64 {
+	switch {
+	case j == 3:
+		return 1 << 62
+	case j%5 == 0:
+		return int64(j % 3)
+	case j%7 == 0:
+		return int64(-j)
+	case j%11 == 0:
+		return int64(j) << 24
+	default:
+		return int64(j)*1000003 - 1<<33
+	}
+}
+
+func TestSQLiteWriteMultiPage(t *testing.T) {
+	const rows = 40000 // 叶子页超过一个内部页能容纳的数量，B 树有两层内部页
+	db := &sqliteDB{}
+	big := db.createTable("big", "CREATE TABLE big (n INTEGER, f REAL, s TEXT, b INTEGER, z)")
+	var sumN int64
+	var sumF float64
+	var sumLen, sumB int
+	for j := 1; j <= rows; j++ {
+		s := fmt.Sprintf("段落-%06d-%s", j, strings.Repeat("x", j%40))
+		big.insert(bigRowValue(j), float64(j)/4, s, j%2 == 0, nil)
+		sumN += bigRowValue(j)
+		sumF += float64(j) / 4
+		sumLen += len([]rune(s))
+		if j%2 == 0 {
+			sumB++
+		}
+	}
+
+	// 单行接近叶子页的最大负载
+	large := db.createTable("large", "CREATE TABLE large (s TEXT)")
+	large.insert(strings.Repeat("L", maxLocalPayload-16))
+
+	// 130 列的记录头超过 127 字节，头部长度需要两字节 varint
+	var columns, values []string
+	var row []interface{}
+	for i := 0; i < 130; i++ {
+		columns = append(columns, fmt.Sprintf("c%d INTEGER", i))
+		values = append(values, fmt.Sprint(i*3))
+		row = append(row, i*3)
+	}
+	wide := db.createTable("wide", "CREATE TABLE wide ("+strings.Join(columns, ", ")+")")
+	wide.insert(row...)
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	if err := db.Write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := sqlite3(t, path, "PRAGMA integrity_check;"); got != "ok" {
+		t.Fatalf("integrity_check: %s", got)
+	}
+	if got := sqlite3(t, path, "PRAGMA page_count;"); got == "1" {
+		t.Fatal("database has a single page")
+	}
+
+	got := sqlite3(t, path, "SELECT count(*), sum(n), printf('%.2f', sum(f)), sum(b), count(z), sum(length(s)) FROM big;")
+	if want := fmt.Sprintf("%d|%d|%.2f|%d|0|%d", rows, sumN, sumF, sumB, sumLen); got != want {
+		t.Fatalf("big aggregates %s, want %s", got, want)
+	}
+	for _, j := range []int{1, 2, 3, 5, 7, 11, 20000, rows} {
+		got := sqlite3(t, path, fmt.Sprintf("SELECT n, s, typeof(b) FROM big WHERE rowid = %d;", j))
+		want := fmt.Sprintf("%d|段落-%06d-%s|integer", bigRowValue(j), j, strings.Repeat("x", j%40))
+		if got != want {
+			t.Fatalf("row %d: %s, want %s", j, got, want)
+		}
+	}
+
+	if got := sqlite3(t, path, "SELECT length(s) FROM large;"); got != fmt.Sprint(maxLocalPayload-16) {
+		t.Fatalf("large row length %s, want %d", got, maxLocalPayload-16)
+	}
+	if got := sqlite3(t, path, "SELECT c0, c1, c128, c129 FROM wide;"); got != strings.Join([]string{values[0], values[1], values[128], values[129]}, "|") {
+		t.Fatalf("wide row %q", got)
+	}
+}
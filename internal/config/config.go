@@ -0,0 +1,443 @@
+// Package config 统一配置管理
+//
+// 配置来源优先级：命令行参数 > 环境变量 > 配置文件 > 默认值。
+// 配置文件为 JSON 格式，Web 界面修改的存储路径和时区会写回配置文件。
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 默认值
+const (
+	DefaultPort         = 8000
+	DefaultTimezone     = "Asia/Shanghai"
+	DefaultLogFormat    = "text"
+	DefaultMinTimestamp = 1577836800 // 2020-01-01
+	DefaultFileName     = "config.json"
+	DefaultReadRetries  = 3
+	DefaultRetryBackoff = 50   // 毫秒
+	DefaultDriveTimeout = 3000 // 毫秒
+	DefaultCorsOrigins  = "*"
+	DefaultMaxStreams   = 32
+	DefaultMaxPerClient = 4
+	DefaultMaxSpeed     = 16
+	DefaultReconnectTTL = 60   // 秒
+	DefaultAVSyncMs     = 200  // 毫秒
+	DefaultPaceMaxLagMs = 1000 // 毫秒
+	DefaultFramePoolKB  = 1024
+)
+
+// Config 服务器配置
+type Config struct {
+	Port          int    `json:"port"`
+	Host          string `json:"host"`
+	DVRPath       string `json:"dvrPath"`
+	Timezone      string `json:"timezone"`
+	CacheDir      string `json:"cacheDir,omitempty"`
+	StorageURL    string `json:"storageUrl,omitempty"` // 通过 HTTP Range 请求读取 DVRPath 下的文件，为空时读取本地文件
+	LogFormat     string `json:"logFormat"`
+	AuthToken     string `json:"authToken,omitempty"`
+	TLSCert       string `json:"tlsCert,omitempty"` // 证书和私钥文件，都设置时使用 HTTPS
+	TLSKey        string `json:"tlsKey,omitempty"`
+	TLSSelfSigned bool   `json:"tlsSelfSigned,omitempty"` // 未设置证书时在配置目录生成自签名证书
+	Workers       int    `json:"workers,omitempty"`
+	ScanWorkers   int    `json:"scanWorkers,omitempty"`
+	CacheOrder    string `json:"cacheOrder,omitempty"` // 缓存构建顺序：newest（默认）、oldest、index
+	CacheDays     int    `json:"cacheDays,omitempty"`  // 初始只缓存最近 N 天的录像（0 全部），其余按需构建
+	MinTimestamp  int64  `json:"minTimestamp"`
+	RawTimestamps bool   `json:"rawTimestamps,omitempty"`
+	CompactIndex  bool   `json:"compactIndex,omitempty"`  // 内存中压缩保存帧索引
+	CompressCache bool   `json:"compressCache,omitempty"` // 磁盘缓存使用压缩格式
+	ReadOnly      bool   `json:"readOnly,omitempty"`      // 不写入任何文件：不使用缓存目录，配置和书签不保存
+
+	// 帧索引初始搜索窗口（字节），0 使用默认值 7MB
+	IndexSearchSize int64    `json:"indexSearchSize,omitempty"`
+	IndexResync     bool     `json:"indexResync,omitempty"` // 帧索引遇到损坏条目时跳过并继续解析
+	PathHistory     []string `json:"pathHistory,omitempty"`
+
+	// 通道显示名称，键为段落通道号或 "audio"，未配置时使用 "Camera N" / "Audio"
+	ChannelLabels map[string]string `json:"channelLabels,omitempty"`
+
+	// 通道类型（video/audio/hidden），键为段落通道号或 "audio"
+	// 未指定通道时日期和录像列表只包含 video 通道；未配置时音频通道号（3）为 audio，其余为 video
+	ChannelKinds map[string]string `json:"channelKinds,omitempty"`
+
+	// /quickplay 和 playLatest 未指定通道时优先播放的段落通道，0 表示播放所有通道中最新的录像
+	DefaultChannel int `json:"defaultChannel,omitempty"`
+
+	// 参与复用的最大帧读取缓冲（KB），0 表示每次读取都新分配
+	FramePoolMaxKB int `json:"framePoolMaxKb"`
+
+	// 单帧大小上限（KB），超过的帧索引条目视为损坏并丢弃，0 使用默认值 8MB
+	MaxFrameSizeKB int `json:"maxFrameSizeKb,omitempty"`
+
+	// 帧负载 XOR 密钥（十六进制），用于加扰帧数据的固件，为空时不解密
+	DecryptXORKey string `json:"decryptXorKey,omitempty"`
+
+	// 读取重试（USB 介质瞬时 IO 错误）
+	ReadRetries    int `json:"readRetries"`
+	RetryBackoffMs int `json:"retryBackoffMs"`
+
+	// 驱动器扫描（/api/v1/drives），根目录为空时使用平台默认值
+	DriveScanRoots     []string `json:"driveScanRoots,omitempty"`
+	DriveScanTimeoutMs int      `json:"driveScanTimeoutMs"`
+
+	// 允许的跨域来源，"*" 表示任意来源（不允许携带凭据）
+	CorsOrigins []string `json:"corsOrigins"`
+
+	// WebSocket 流资源限制，0 表示不限制
+	MaxStreams          int     `json:"maxStreams"`
+	MaxStreamsPerClient int     `json:"maxStreamsPerClient"`
+	MaxSpeed            float64 `json:"maxSpeed"`
+
+	// WebSocket 断线重连令牌的保留时间（秒），0 表示不发放令牌
+	ReconnectTTLSec int `json:"reconnectTtlSec"`
+
+	// WebSocket 读写缓冲（KB），0 使用默认值（读 1KB、写 64KB）；局域网播放高码率录像时可以加大写缓冲
+	WSReadBufferKB  int `json:"wsReadBufferKb,omitempty"`
+	WSWriteBufferKB int `json:"wsWriteBufferKb,omitempty"`
+
+	// 与客户端协商 permessage-deflate，只压缩 JSON 控制消息，视频和音频帧（已压缩）原样发送
+	WSCompression bool `json:"wsCompression,omitempty"`
+
+	// 回放时音视频漂移的告警阈值（毫秒，0 表示不检测）；
+	// AVSyncCorrect 启用后丢弃落后的音频帧、推迟超前的音频帧
+	AVSyncThresholdMs int  `json:"avSyncThresholdMs"`
+	AVSyncCorrect     bool `json:"avSyncCorrect,omitempty"`
+
+	// 回放发送落后于计划时间不超过该值（毫秒）时立即发送追赶，超过时从当前帧重新计时
+	PaceMaxLagMs int `json:"paceMaxLagMs"`
+}
+
+// Default 返回默认配置
+func Default() *Config {
+	return &Config{
+		Port:         DefaultPort,
+		Timezone:     DefaultTimezone,
+		LogFormat:    DefaultLogFormat,
+		MinTimestamp: DefaultMinTimestamp,
+
+		FramePoolMaxKB: DefaultFramePoolKB,
+
+		ReadRetries:    DefaultReadRetries,
+		RetryBackoffMs: DefaultRetryBackoff,
+
+		DriveScanTimeoutMs: DefaultDriveTimeout,
+		CorsOrigins:        SplitList(DefaultCorsOrigins),
+
+		MaxStreams:          DefaultMaxStreams,
+		MaxStreamsPerClient: DefaultMaxPerClient,
+		MaxSpeed:            DefaultMaxSpeed,
+
+		ReconnectTTLSec: DefaultReconnectTTL,
+
+		AVSyncThresholdMs: DefaultAVSyncMs,
+		PaceMaxLagMs:      DefaultPaceMaxLagMs,
+	}
+}
+
+// DefaultPath 返回默认配置文件路径（用户配置目录下）
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return DefaultFileName
+	}
+	return filepath.Join(dir, "seetong-dvr", DefaultFileName)
+}
+
+// Load 从配置文件加载配置（叠加在默认值之上）
+// 文件不存在时返回默认配置
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	// Windows 记事本保存的 UTF-8 文件带 BOM，json 无法解析
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// Save 将配置写入文件
+func (c *Config) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// 先写临时文件再重命名，避免写入中断导致配置损坏
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// ApplyEnv 使用环境变量覆盖配置
+func (c *Config) ApplyEnv() {
+	if v, err := strconv.Atoi(os.Getenv("SEETONG_PORT")); err == nil {
+		c.Port = v
+	}
+	if v := os.Getenv("SEETONG_HOST"); v != "" {
+		c.Host = v
+	}
+	if v := os.Getenv("SEETONG_DVR_PATH"); v != "" {
+		c.DVRPath = v
+	}
+	if v := os.Getenv("SEETONG_TIMEZONE"); v != "" {
+		c.Timezone = v
+	}
+	if v := os.Getenv("SEETONG_CACHE_DIR"); v != "" {
+		c.CacheDir = v
+	}
+	if v := os.Getenv("SEETONG_STORAGE_URL"); v != "" {
+		c.StorageURL = v
+	}
+	if v := os.Getenv("SEETONG_LOG_FORMAT"); v != "" {
+		c.LogFormat = v
+	}
+	if v := os.Getenv("SEETONG_AUTH_TOKEN"); v != "" {
+		c.AuthToken = v
+	}
+	if v := os.Getenv("SEETONG_TLS_CERT"); v != "" {
+		c.TLSCert = v
+	}
+	if v := os.Getenv("SEETONG_TLS_KEY"); v != "" {
+		c.TLSKey = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("SEETONG_TLS_SELF_SIGNED")); err == nil {
+		c.TLSSelfSigned = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("SEETONG_WORKERS")); err == nil {
+		c.Workers = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("SEETONG_SCAN_WORKERS")); err == nil {
+		c.ScanWorkers = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("SEETONG_CACHE_DAYS")); err == nil {
+		c.CacheDays = v
+	}
+	if v := os.Getenv("SEETONG_CACHE_ORDER"); v != "" {
+		c.CacheOrder = v
+	}
+	if v, err := strconv.ParseInt(os.Getenv("SEETONG_MIN_TIMESTAMP"), 10, 64); err == nil {
+		c.MinTimestamp = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("SEETONG_RAW_TIMESTAMPS")); err == nil {
+		c.RawTimestamps = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("SEETONG_COMPACT_INDEX")); err == nil {
+		c.CompactIndex = v
+	}
+	if v, err := strconv.ParseInt(os.Getenv("SEETONG_INDEX_SEARCH_SIZE"), 0, 64); err == nil {
+		c.IndexSearchSize = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("SEETONG_INDEX_RESYNC")); err == nil {
+		c.IndexResync = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("SEETONG_COMPRESS_CACHE")); err == nil {
+		c.CompressCache = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("SEETONG_READ_ONLY")); err == nil {
+		c.ReadOnly = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("SEETONG_FRAME_POOL_MAX_KB")); err == nil {
+		c.FramePoolMaxKB = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("SEETONG_MAX_FRAME_SIZE_KB")); err == nil {
+		c.MaxFrameSizeKB = v
+	}
+	if v := os.Getenv("SEETONG_DECRYPT_XOR_KEY"); v != "" {
+		c.DecryptXORKey = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("SEETONG_READ_RETRIES")); err == nil {
+		c.ReadRetries = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("SEETONG_RETRY_BACKOFF_MS")); err == nil {
+		c.RetryBackoffMs = v
+	}
+	if v := os.Getenv("SEETONG_DRIVE_SCAN_ROOTS"); v != "" {
+		c.DriveScanRoots = filepath.SplitList(v)
+	}
+	if v, err := strconv.Atoi(os.Getenv("SEETONG_DRIVE_SCAN_TIMEOUT_MS")); err == nil {
+		c.DriveScanTimeoutMs = v
+	}
+	if v := os.Getenv("SEETONG_CHANNEL_LABELS"); v != "" {
+		c.ChannelLabels = SplitMap(v)
+	}
+	if v := os.Getenv("SEETONG_CHANNEL_KINDS"); v != "" {
+		c.ChannelKinds = SplitMap(v)
+	}
+	if v, err := strconv.Atoi(os.Getenv("SEETONG_DEFAULT_CHANNEL")); err == nil {
+		c.DefaultChannel = v
+	}
+	if v := os.Getenv("SEETONG_CORS_ORIGINS"); v != "" {
+		c.CorsOrigins = SplitList(v)
+	}
+	if v, err := strconv.Atoi(os.Getenv("SEETONG_MAX_STREAMS")); err == nil {
+		c.MaxStreams = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("SEETONG_MAX_STREAMS_PER_CLIENT")); err == nil {
+		c.MaxStreamsPerClient = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("SEETONG_MAX_SPEED"), 64); err == nil {
+		c.MaxSpeed = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("SEETONG_RECONNECT_TTL_SEC")); err == nil {
+		c.ReconnectTTLSec = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("SEETONG_WS_READ_BUFFER_KB")); err == nil {
+		c.WSReadBufferKB = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("SEETONG_WS_WRITE_BUFFER_KB")); err == nil {
+		c.WSWriteBufferKB = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("SEETONG_WS_COMPRESSION")); err == nil {
+		c.WSCompression = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("SEETONG_AV_SYNC_THRESHOLD_MS")); err == nil {
+		c.AVSyncThresholdMs = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("SEETONG_AV_SYNC_CORRECT")); err == nil {
+		c.AVSyncCorrect = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("SEETONG_PACE_MAX_LAG_MS")); err == nil {
+		c.PaceMaxLagMs = v
+	}
+}
+
+// indexFileName 主索引文件名
+var indexFileName = regexp.MustCompile(`(?i)^TIndex\d{2}\.tps$`)
+
+// NormalizeDVRPath 清理用户输入的 DVR 路径，中文等非 ASCII 字符保持不变
+// 去掉 BOM/零宽字符、首尾空白（包括全角空格）和成对的引号（Windows 资源管理器“复制文件地址”带双引号），
+// 指向主索引文件（TIndex00.tps、TIndex01.tps……）本身时改为其所在目录
+func NormalizeDVRPath(p string) string {
+	p = strings.Map(func(r rune) rune {
+		switch r {
+		case '\uFEFF', '\u200B', '\u200C', '\u200D', '\u2060':
+			return -1
+		}
+		return r
+	}, p)
+	p = strings.TrimSpace(p)
+	for _, q := range [][2]string{{`"`, `"`}, {"'", "'"}, {"“", "”"}} {
+		if len(p) > len(q[0])+len(q[1]) && strings.HasPrefix(p, q[0]) && strings.HasSuffix(p, q[1]) {
+			p = strings.TrimSpace(p[len(q[0]) : len(p)-len(q[1])])
+			break
+		}
+	}
+	if p == "" {
+		return ""
+	}
+	if indexFileName.MatchString(filepath.Base(p)) {
+		p = filepath.Dir(p)
+	}
+	return filepath.Clean(p)
+}
+
+// SplitList 拆分逗号分隔的列表，去掉空白和空项
+func SplitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// SplitMap 拆分逗号分隔的 key=value 列表，没有 "=" 的项被忽略
+func SplitMap(s string) map[string]string {
+	m := make(map[string]string)
+	for _, item := range SplitList(s) {
+		if k, v, ok := strings.Cut(item, "="); ok && strings.TrimSpace(k) != "" {
+			m[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return m
+}
+
+// ============================================================================
+// 运行时配置存储
+// ============================================================================
+
+// Store 运行时配置存储（线程安全）
+// 运行时配置包含命令行和环境变量的覆盖值，持久化时只写回修改的字段，
+// 避免把一次性的命令行参数固化到配置文件中
+type Store struct {
+	path string // 配置文件路径，为空时不持久化
+	cfg  Config
+	mu   sync.RWMutex
+}
+
+// NewStore 创建配置存储
+func NewStore(path string, cfg *Config) *Store {
+	return &Store{path: path, cfg: *cfg}
+}
+
+// Path 返回配置文件路径
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Get 返回当前配置的副本
+func (s *Store) Get() Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cfg := s.cfg
+	cfg.PathHistory = append([]string(nil), s.cfg.PathHistory...)
+	cfg.DriveScanRoots = append([]string(nil), s.cfg.DriveScanRoots...)
+	cfg.CorsOrigins = append([]string(nil), s.cfg.CorsOrigins...)
+	if s.cfg.ChannelLabels != nil {
+		cfg.ChannelLabels = make(map[string]string, len(s.cfg.ChannelLabels))
+		for k, v := range s.cfg.ChannelLabels {
+			cfg.ChannelLabels[k] = v
+		}
+	}
+	if s.cfg.ChannelKinds != nil {
+		cfg.ChannelKinds = make(map[string]string, len(s.cfg.ChannelKinds))
+		for k, v := range s.cfg.ChannelKinds {
+			cfg.ChannelKinds[k] = v
+		}
+	}
+	return cfg
+}
+
+// Update 修改运行时配置并写回配置文件（只读模式下只修改运行时配置）
+func (s *Store) Update(fn func(c *Config)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.cfg)
+
+	if s.path == "" || s.cfg.ReadOnly {
+		return nil
+	}
+	fileCfg, err := Load(s.path)
+	if err != nil {
+		return err
+	}
+	fn(fileCfg)
+	return fileCfg.Save(s.path)
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeDVRPath(t *testing.T) {
+	dir := filepath.Join(string(filepath.Separator)+"mnt", "录像", "Stream")
+	for _, tc := range []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"CJK directory", dir, dir},
+		{"trailing separator", dir + string(filepath.Separator), dir},
+		{"Explorer copy-as-path quotes", `"` + dir + `"`, dir},
+		{"single quotes", "'" + dir + "'", dir},
+		{"full-width quotes", "“" + dir + "”", dir},
+		{"BOM and zero-width space", "\uFEFF" + dir + "\u200B", dir},
+		{"full-width spaces", "\u3000" + dir + "\u3000", dir},
+		{"index file itself", filepath.Join(dir, "TIndex00.tps"), dir},
+		{"second index file, lower case", filepath.Join(dir, "tindex01.tps"), dir},
+		{"recording file is not an index", filepath.Join(dir, "TRec000000.tps"), filepath.Join(dir, "TRec000000.tps")},
+		{"empty", "  ", ""},
+	} {
+		if got := NormalizeDVRPath(tc.in); got != tc.want {
+			t.Errorf("%s: NormalizeDVRPath(%q) = %q, want %q", tc.name, tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestLoadConfigWithBOM(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := "\xef\xbb\xbf" + `{"dvrPath": "D:\\录像\\Stream", "port": 9000}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DVRPath != `D:\录像\Stream` || cfg.Port != 9000 {
+		t.Fatalf("loaded dvrPath %q port %d", cfg.DVRPath, cfg.Port)
+	}
+	if cfg.Timezone != Default().Timezone {
+		t.Fatalf("timezone %q, want the default %q", cfg.Timezone, Default().Timezone)
+	}
+}
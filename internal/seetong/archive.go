@@ -0,0 +1,470 @@
+package seetong
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// 归档正在录像的 DVR
+// ============================================================================
+
+// 归档目录中每个已写完的 TRec 文件一个子目录（<开始时间 UTC>_TRecXXXXXX），
+// 其中是 TRec 文件的副本和只保留该文件条目的 TIndex00.tps，整个归档目录可以直接作为
+// DVR 路径加载（每个子目录一个来源）。DVR 循环覆盖同一个 TRec 文件后开始时间不同，
+// 新的录像归档到另一个子目录，旧的副本保留。
+// 正在写入的文件（写入位置）和最近仍在修改的文件不复制；复制先写入 .part 文件，
+// 中断后从已写入的长度继续，大小与源文件一致且复制期间源文件未被修改才重命名为正式文件。
+// 归档完成的文件记录在 archive.json 中，重新启动时跳过
+
+const (
+	// ArchiveManifestName 归档目录中记录已归档文件的清单
+	ArchiveManifestName = "archive.json"
+
+	// ArchivePollInterval 检查新写完的 TRec 文件的间隔
+	ArchivePollInterval = 30 * time.Second
+
+	// archiveSettleTime 文件最后修改后至少经过这么久才视为已写完（设备可能还在补写帧索引）
+	archiveSettleTime = 60 * time.Second
+
+	// archiveCopyChunk 复制时每次读取的字节数
+	archiveCopyChunk = 1 << 20
+
+	archivePartSuffix = ".part"
+)
+
+// errArchiveSourceChanged 复制期间源文件被修改（设备回到该文件重新写入）
+var errArchiveSourceChanged = errors.New("source file changed while copying")
+
+// ArchiveEntry 一个已归档的 TRec 文件
+type ArchiveEntry struct {
+	Dir           string `json:"dir"`    // 归档目录中的子目录名
+	File          string `json:"file"`   // TRec 文件名
+	Source        string `json:"source"` // 源文件路径
+	Channel       int    `json:"channel"`
+	StartTime     int64  `json:"startTime"`
+	EndTime       int64  `json:"endTime"`
+	Size          int64  `json:"size"`
+	SourceModTime int64  `json:"sourceModTime"` // 源文件的修改时间（副本保留相同的修改时间）
+	ArchivedAt    int64  `json:"archivedAt"`
+}
+
+// ArchiveManifest 归档清单
+type ArchiveManifest struct {
+	Source string         `json:"source"` // 源 DVR 路径
+	Files  []ArchiveEntry `json:"files"`
+}
+
+// ArchiveResult 一次同步的结果
+type ArchiveResult struct {
+	Copied  int // 本次归档的文件数
+	Pending int // 已写完但尚未归档的文件数（复制失败或源文件仍在修改）
+	Cached  int // 本次构建缓存的段落数
+}
+
+// IsArchiveDir dir 是否为归档目录（包含 archive.json）
+func IsArchiveDir(dir string) bool {
+	if dir == "" {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(dir, ArchiveManifestName))
+	return err == nil && !info.IsDir()
+}
+
+// ArchiveCacheDir 归档目录默认的缓存目录
+func ArchiveCacheDir(dir string) string {
+	return filepath.Join(dir, ".index_cache")
+}
+
+// Archiver 将 DVR 中写完的 TRec 文件复制到本地归档目录
+type Archiver struct {
+	dvrPath string
+	dir     string
+	workers int
+
+	manifest ArchiveManifest
+	archived map[string]bool // 已归档的子目录名
+}
+
+// NewArchiver 创建归档器，读取 dir 中已有的清单（不存在时创建目录和空清单）
+// 读取源文件经过当前存储后端，dir 中的文件始终使用本地文件系统
+func NewArchiver(dvrPath, dir string) (*Archiver, error) {
+	if IsReadOnly() {
+		return nil, ErrReadOnly
+	}
+	if isWithin(dir, dvrPath) || isWithin(dvrPath, dir) {
+		return nil, fmt.Errorf("归档目录不能与 DVR 路径重叠: %s", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	a := &Archiver{dvrPath: dvrPath, dir: dir, archived: make(map[string]bool)}
+	data, err := os.ReadFile(filepath.Join(dir, ArchiveManifestName))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		a.manifest.Source = dvrPath
+		if err := a.saveManifest(); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, &a.manifest); err != nil {
+			return nil, fmt.Errorf("%s: %w", ArchiveManifestName, err)
+		}
+		for _, entry := range a.manifest.Files {
+			a.archived[entry.Dir] = true
+		}
+	}
+	SetStorage(localOverlay{Storage: CurrentStorage(), dir: dir})
+	return a, nil
+}
+
+// SetWorkers 设置构建归档缓存的线程数（0 使用默认值）
+func (a *Archiver) SetWorkers(n int) {
+	a.workers = n
+}
+
+// Files 已归档的文件
+func (a *Archiver) Files() []ArchiveEntry {
+	return a.manifest.Files
+}
+
+// Run 立即同步一次，之后每隔 ArchivePollInterval 同步，直到 ctx 取消
+// 加载索引失败（例如设备暂时不可访问）时记录警告，下一次继续
+func (a *Archiver) Run(ctx context.Context, onSync func(ArchiveResult)) error {
+	ticker := time.NewTicker(ArchivePollInterval)
+	defer ticker.Stop()
+	for {
+		result, err := a.Sync(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			LogWarn("归档同步失败", "dvrPath", a.dvrPath, "error", err)
+		} else if onSync != nil {
+			onSync(result)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync 重新读取 DVR 的索引，复制写入位置以外、已写完且尚未归档的 TRec 文件，并构建其缓存
+func (a *Archiver) Sync(ctx context.Context) (ArchiveResult, error) {
+	var result ArchiveResult
+	storage := NewTPSStorage(a.dvrPath)
+	if err := storage.Load(); err != nil {
+		return result, err
+	}
+	head := storage.WriteHead()
+
+	var copied []string
+	for _, seg := range storage.SegmentsByTime(false) {
+		if ctx.Err() != nil {
+			break
+		}
+		if seg.FileIndex == head {
+			continue
+		}
+		src := storage.GetRecFile(seg.FileIndex)
+		if src == "" {
+			continue
+		}
+		name := archiveDirName(seg, src)
+		if a.archived[name] && a.verifyArchived(name, src) {
+			continue
+		}
+		info, err := statFile(src)
+		if err != nil || time.Since(info.ModTime()) < archiveSettleTime {
+			result.Pending++
+			continue
+		}
+
+		entry, err := a.archiveFile(ctx, storage, seg, src, name, info)
+		if err != nil {
+			if ctx.Err() == nil {
+				LogWarn("归档文件失败", "file", src, "error", err)
+			}
+			result.Pending++
+			continue
+		}
+		result.Copied++
+		copied = append(copied, filepath.Join(a.dir, entry.Dir, entry.File))
+		LogInfo("已归档", "file", src, "dir", entry.Dir, "size", entry.Size)
+	}
+
+	if len(copied) > 0 && ctx.Err() == nil {
+		result.Cached = a.buildCache(ctx, copied)
+	}
+	return result, nil
+}
+
+// archiveDirName 归档子目录名：段落开始时间（UTC）和 TRec 文件名
+func archiveDirName(seg SegmentRecord, src string) string {
+	start := time.Unix(seg.StartTime, 0).UTC().Format("20060102-150405")
+	return start + "_" + strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+}
+
+// verifyArchived 清单中的副本是否仍然存在且大小一致
+func (a *Archiver) verifyArchived(name, src string) bool {
+	for _, entry := range a.manifest.Files {
+		if entry.Dir != name {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(a.dir, entry.Dir, entry.File))
+		if err == nil && info.Size() == entry.Size {
+			return true
+		}
+		LogWarn("归档副本缺失或大小不符，重新复制", "dir", entry.Dir, "file", entry.File)
+	}
+	return false
+}
+
+// archiveFile 复制一个 TRec 文件和只含其条目的 TIndex，并写入清单
+// 上次中断时已重命名为正式文件、大小正确的副本不再复制
+func (a *Archiver) archiveFile(ctx context.Context, storage *TPSStorage, seg SegmentRecord, src, name string, info fs.FileInfo) (ArchiveEntry, error) {
+	entry := ArchiveEntry{
+		Dir:           name,
+		File:          filepath.Base(src),
+		Source:        src,
+		Channel:       seg.Channel,
+		StartTime:     seg.StartTime,
+		EndTime:       seg.EndTime,
+		Size:          info.Size(),
+		SourceModTime: info.ModTime().Unix(),
+	}
+	dstDir := filepath.Join(a.dir, name)
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return entry, err
+	}
+	dst := filepath.Join(dstDir, entry.File)
+	if existing, err := os.Stat(dst); err != nil || existing.Size() != entry.Size {
+		if err := copyArchiveFile(ctx, src, dst, info); err != nil {
+			return entry, err
+		}
+	}
+	if err := writeArchiveTIndex(storage, seg, filepath.Join(dstDir, "TIndex00.tps")); err != nil {
+		return entry, err
+	}
+
+	entry.ArchivedAt = time.Now().Unix()
+	a.manifest.Files = append(removeArchiveEntry(a.manifest.Files, name), entry)
+	a.archived[name] = true
+	return entry, a.saveManifest()
+}
+
+// removeArchiveEntry 去掉清单中子目录为 name 的记录（重新复制的文件）
+func removeArchiveEntry(entries []ArchiveEntry, name string) []ArchiveEntry {
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.Dir != name {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
+
+// copyArchiveFile 将 src 复制到 dst：写入 dst.part（已有内容时从其末尾继续），
+// 校验大小和源文件的修改时间后保留源文件的修改时间并重命名
+func copyArchiveFile(ctx context.Context, src, dst string, info fs.FileInfo) error {
+	part := dst + archivePartSuffix
+	out, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	partInfo, err := out.Stat()
+	if err != nil {
+		return err
+	}
+	offset := partInfo.Size()
+	if offset > info.Size() {
+		if err := out.Truncate(0); err != nil {
+			return err
+		}
+		offset = 0
+	}
+	if offset > 0 {
+		LogInfo("继续复制", "file", src, "offset", offset)
+	}
+
+	in, err := openFile(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	buf := make([]byte, archiveCopyChunk)
+	for offset < info.Size() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		chunk := buf
+		if rest := info.Size() - offset; rest < int64(len(chunk)) {
+			chunk = chunk[:rest]
+		}
+		if err := readFull(in, chunk, offset); err != nil {
+			return err
+		}
+		if _, err := out.WriteAt(chunk, offset); err != nil {
+			return err
+		}
+		offset += int64(len(chunk))
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+
+	// 大小与开始复制时的源文件一致，且源文件此后未被修改
+	written, err := out.Stat()
+	if err != nil {
+		return err
+	}
+	if written.Size() != info.Size() {
+		return fmt.Errorf("copied %d bytes, source has %d", written.Size(), info.Size())
+	}
+	now, err := statFile(src)
+	if err != nil {
+		return err
+	}
+	if now.Size() != info.Size() || !now.ModTime().Equal(info.ModTime()) {
+		out.Close()
+		os.Remove(part)
+		return errArchiveSourceChanged
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Chtimes(part, info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	return os.Rename(part, dst)
+}
+
+// writeArchiveTIndex 复制记录了 seg 的主索引，其他文件的条目通道字节置 0（解析时跳过），
+// 使归档子目录只包含已复制的 TRec 文件
+func writeArchiveTIndex(storage *TPSStorage, seg SegmentRecord, dst string) error {
+	number := seg.FileIndex % SourceFileStride
+	sources := storage.Sources()
+	n := seg.FileIndex / SourceFileStride
+	if n >= len(sources) {
+		return fmt.Errorf("no index source for file %d", seg.FileIndex)
+	}
+
+	// 同一目录有多个主索引时以文件名靠后、且仍记录着该段落的为准（与加载时相同）
+	indexFiles := sources[n].IndexFiles
+	for i := len(indexFiles) - 1; i >= 0; i-- {
+		segs, _, _, err := ParseTIndex(indexFiles[i])
+		if err != nil {
+			continue
+		}
+		for _, s := range segs {
+			if s.FileIndex != number || s.StartTime != seg.StartTime {
+				continue
+			}
+			data, err := readIndexFile(indexFiles[i])
+			if err != nil {
+				return err
+			}
+			for pos := 0; pos < tindexEntrySlots(int64(len(data))); pos++ {
+				if pos != number {
+					data[SegmentIndexOffset+pos*EntrySize+4] = 0
+				}
+			}
+			tmp := dst + ".tmp"
+			if err := os.WriteFile(tmp, data, 0644); err != nil {
+				return err
+			}
+			return os.Rename(tmp, dst)
+		}
+	}
+	return fmt.Errorf("index entry for file %d changed", seg.FileIndex)
+}
+
+// readIndexFile 通过存储后端读取整个主索引文件
+func readIndexFile(path string) ([]byte, error) {
+	info, err := statFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data := make([]byte, info.Size())
+	if err := readFull(f, data, 0); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// buildCache 加载归档目录并构建新复制文件的段落缓存
+func (a *Archiver) buildCache(ctx context.Context, copied []string) int {
+	archive := NewTPSStorage(a.dir)
+	if err := archive.Load(); err != nil {
+		LogWarn("加载归档目录失败", "dir", a.dir, "error", err)
+		return 0
+	}
+	paths := make(map[string]bool, len(copied))
+	for _, path := range copied {
+		paths[path] = true
+	}
+	var indices []int
+	for _, seg := range archive.GetSegments() {
+		if paths[archive.RecFilePath(seg.FileIndex)] {
+			indices = append(indices, seg.FileIndex)
+		}
+	}
+	defer archive.Close()
+	return archive.BuildCacheWithWorkersContext(ctx, indices, nil, a.workers)
+}
+
+// saveManifest 写入清单（先写临时文件再重命名）
+func (a *Archiver) saveManifest() error {
+	data, err := json.MarshalIndent(a.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(a.dir, ArchiveManifestName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// localOverlay 归档目录中的文件使用本地文件系统，其余经过原来的存储后端
+// （源 DVR 使用 HTTP 存储时，构建归档缓存仍需读取本地副本）
+type localOverlay struct {
+	Storage
+	dir string
+}
+
+func (o localOverlay) backend(name string) Storage {
+	if isWithin(name, o.dir) {
+		return OSStorage{}
+	}
+	return o.Storage
+}
+
+// Open 打开文件
+func (o localOverlay) Open(name string) (File, error) { return o.backend(name).Open(name) }
+
+// Stat 文件信息
+func (o localOverlay) Stat(name string) (fs.FileInfo, error) { return o.backend(name).Stat(name) }
+
+// ReadDir 列举目录
+func (o localOverlay) ReadDir(name string) ([]fs.DirEntry, error) {
+	return o.backend(name).ReadDir(name)
+}
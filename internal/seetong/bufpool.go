@@ -0,0 +1,103 @@
+package seetong
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// ============================================================================
+// 帧缓冲池
+// ============================================================================
+
+// 缓冲大小分级：音频帧和 P 帧落在前两级，I 帧通常在 64KB-256KB
+var frameBufferClasses = [...]int{4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20}
+
+var frameBufferPools [len(frameBufferClasses)]sync.Pool
+
+// 参与复用的最大缓冲大小，超过时直接分配
+var framePoolMaxSize atomic.Int64
+
+// DefaultFramePoolMaxSize 默认的最大池化缓冲大小
+const DefaultFramePoolMaxSize = 1 << 20
+
+func init() {
+	framePoolMaxSize.Store(DefaultFramePoolMaxSize)
+}
+
+// SetFramePoolMaxSize 设置参与复用的最大帧缓冲（字节），0 表示不使用缓冲池
+func SetFramePoolMaxSize(size int) {
+	if size < 0 {
+		size = 0
+	}
+	framePoolMaxSize.Store(int64(size))
+}
+
+// frameBufferClass 返回能容纳 size 字节的最小分级，不参与复用时返回 -1
+func frameBufferClass(size int) int {
+	if int64(size) > framePoolMaxSize.Load() {
+		return -1
+	}
+	for i, c := range frameBufferClasses {
+		if size <= c {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetFrameBuffer 从缓冲池取长度为 size 的缓冲，用完后通过 PutFrameBuffer 归还
+func GetFrameBuffer(size int) []byte {
+	class := frameBufferClass(size)
+	if class < 0 {
+		return make([]byte, size)
+	}
+	if p, ok := frameBufferPools[class].Get().(*[]byte); ok {
+		return (*p)[:size]
+	}
+	return make([]byte, size, frameBufferClasses[class])
+}
+
+// PutFrameBuffer 归还缓冲，之后不能再使用 buf 及其任何子切片
+// 容量不是分级大小的缓冲（例如 ReadFrame 返回的数据）会被忽略
+func PutFrameBuffer(buf []byte) {
+	class := frameBufferClass(cap(buf))
+	if class < 0 || cap(buf) != frameBufferClasses[class] {
+		return
+	}
+	buf = buf[:0]
+	frameBufferPools[class].Put(&buf)
+}
+
+// ReadFrameInto 读取单帧数据到 dst（复用已打开的文件句柄）
+// dst 容量不足时归还 dst 并从缓冲池取新缓冲；返回的切片取代 dst，
+// 调用方发送完成后用 PutFrameBuffer 归还（或作为下一次调用的 dst 继续复用）。
+// 返回的数据在归还前有效，跨 goroutine 保留时需要复制
+func (s *TPSStorage) ReadFrameInto(fileIndex int, frame FrameIndexRecord, dst []byte) ([]byte, error) {
+	return s.ReadFrameIntoContext(context.Background(), fileIndex, frame, dst)
+}
+
+// ReadFrameIntoContext 与 ReadFrameInto 相同，ctx 取消后停止重试和分块读取并返回 ctx.Err()
+func (s *TPSStorage) ReadFrameIntoContext(ctx context.Context, fileIndex int, frame FrameIndexRecord, dst []byte) ([]byte, error) {
+	if err := checkFrameSize(frame); err != nil {
+		return dst, err
+	}
+	r, err := s.getReader(fileIndex)
+	if err != nil {
+		return dst, err
+	}
+
+	size := int(frame.FrameSize)
+	if cap(dst) < size {
+		PutFrameBuffer(dst)
+		dst = GetFrameBuffer(size)
+	}
+	dst = dst[:size]
+	if err := readFullContext(ctx, r, dst, int64(frame.FileOffset)); err != nil {
+		return dst, err
+	}
+	if err := decryptFrame(dst, frame); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
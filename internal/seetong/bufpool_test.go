@@ -0,0 +1,81 @@
+package seetong
+
+import (
+	"bytes"
+	"testing"
+)
+
+// openFixtureStorage 加载只有一个 TRec 文件的 DVR
+func openFixtureStorage(t testing.TB, f *trecFixture) *TPSStorage {
+	t.Helper()
+	dir, _ := writeDVRFixture(t, f)
+	s := NewTPSStorage(dir)
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestReadFrameIntoReusesBuffer(t *testing.T) {
+	f := newTRecFixture(4, 25)
+	s := openFixtureStorage(t, f)
+
+	var buf []byte
+	for i, frame := range f.Frames {
+		data, err := s.ReadFrameInto(0, frame, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, f.Data[i]) {
+			t.Fatalf("frame %d: data differs", i)
+		}
+		if cap(buf) >= len(data) && &buf[:1][0] != &data[:1][0] {
+			t.Fatalf("frame %d: a large enough dst was not reused", i)
+		}
+		buf = data
+	}
+	PutFrameBuffer(buf)
+}
+
+// benchmarkFrames 录像的全部帧：I 帧约 3KB，P 帧和音频帧不到 1KB
+func benchmarkFrames(b *testing.B) (*TPSStorage, *trecFixture) {
+	f := newTRecFixture(8, 25)
+	s := openFixtureStorage(b, f)
+	var total int64
+	for _, frame := range f.Frames {
+		total += int64(frame.FrameSize)
+	}
+	b.SetBytes(total)
+	b.ReportAllocs()
+	b.ResetTimer()
+	return s, f
+}
+
+// BenchmarkReadFrameCached 每帧分配新的缓冲
+func BenchmarkReadFrameCached(b *testing.B) {
+	s, f := benchmarkFrames(b)
+	for i := 0; i < b.N; i++ {
+		for _, frame := range f.Frames {
+			if _, err := s.ReadFrameCached(0, frame); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkReadFrameInto 发送完成后缓冲作为下一帧的 dst 复用
+func BenchmarkReadFrameInto(b *testing.B) {
+	s, f := benchmarkFrames(b)
+	var buf []byte
+	for i := 0; i < b.N; i++ {
+		for _, frame := range f.Frames {
+			data, err := s.ReadFrameInto(0, frame, buf)
+			if err != nil {
+				b.Fatal(err)
+			}
+			buf = data
+		}
+	}
+	PutFrameBuffer(buf)
+}
@@ -3,9 +3,11 @@ package seetong
 import (
 	"crypto/md5"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime/debug"
 	"sync"
 	"syscall"
 	"unsafe"
@@ -16,29 +18,37 @@ import (
 // ============================================================================
 
 // 缓存文件格式:
-// Header (32 bytes):
+// Header (40 bytes):
 //   Magic (4): "SIDX"
-//   Version (4): 1
+//   Version (4): 5
 //   RecordCount (4): N
 //   FileHash (16): MD5
-//   Reserved (4)
+//   IndexStride (4): TRec 帧索引条目大小（44 或 48）
+//   IndexStart (8): TRec 帧索引的文件偏移
 // Records (N * RecordSize bytes each) - 与 FrameIndexRecord 内存布局一致
 
 const (
-	CacheMagic      = "SIDX"
-	CacheVersion    = 2 // 版本 2: 使用与 FrameIndexRecord 相同的布局
+	CacheMagic   = "SIDX"
+	CacheVersion = 5 // 版本 2: 使用与 FrameIndexRecord 相同的布局；版本 3: header 记录索引位置；版本 4: 记录包含保留字节；版本 5: 帧类型按帧数据校正
+	// CacheHeaderSize VPS 缓存的 header 大小
 	CacheHeaderSize = 32
+	// FrameIndexCacheHeaderSize 帧索引缓存的 header 大小（在 VPS 缓存 header 之后记录索引布局）
+	FrameIndexCacheHeaderSize = 40
+
+	cacheStrideOffset     = 28 // header 中条目大小的偏移
+	cacheIndexStartOffset = 32 // header 中索引文件偏移的偏移
 )
 
 // FrameIndexRecord 的内存大小 (需要与 lib.go 中的定义保持一致)
-// FrameType(4) + Channel(4) + FrameSeq(4) + FileOffset(4) + FrameSize(4) + TimestampUs(8) + UnixTs(4) + padding(4) = 36
-// 但由于 Go 对齐规则，实际为 40 字节
+// FrameType(4) + Channel(4) + FrameSeq(4) + FileOffset(4) + FrameSize(4) + TimestampUs(8) + UnixTs(4) + Reserved(8) = 40
+// 但由于 Go 对齐规则（TimestampUs 前和结构末尾各 4 字节填充），实际为 48 字节
 var frameIndexRecordSize = int(unsafe.Sizeof(FrameIndexRecord{}))
 
 // MmapCache mmap 索引缓存 - 零拷贝
 type MmapCache struct {
 	data    []byte             // mmap 原始数据
 	count   int                // 记录数量
+	Layout  IndexLayout        // 原始文件的帧索引位置和条目大小
 	Records []FrameIndexRecord // 直接指向 mmap 的切片，零拷贝！
 }
 
@@ -47,12 +57,84 @@ var (
 	cacheDirMu sync.Mutex
 )
 
-// SetCacheDir 设置缓存目录
+// ErrStaleCache 缓存文件与当前格式版本或录像文件不匹配
+// 返回此错误时过期的缓存文件已被删除，重新解析后会写入新缓存
+var ErrStaleCache = errors.New("stale cache")
+
+// ErrMappingFault 访问 mmap 内存时底层文件已不可读（如缓存目录所在的 U 盘被拔出）
+// 访问失效的映射会触发 SIGBUS，guardMmap 将其转换为此错误
+var ErrMappingFault = errors.New("mmap region no longer readable")
+
+// guardMmap 执行访问 mmap 内存的 fn，把内存访问错误转换为 ErrMappingFault
+// SetPanicOnFault 只对当前 goroutine 生效，fn 中不能启动新的 goroutine 访问映射
+func guardMmap(fn func()) (err error) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			if fault, ok := r.(interface{ Addr() uintptr }); ok {
+				err = fmt.Errorf("%w (addr %#x)", ErrMappingFault, fault.Addr())
+				return
+			}
+			panic(r)
+		}
+	}()
+	fn()
+	return nil
+}
+
+// discardStaleCache 删除无法使用的缓存文件
+// 否则文件一直"存在"，之后每次加载都会先读取失败再重新解析
+func discardStaleCache(cachePath, reason string) error {
+	if err := os.Remove(cachePath); err != nil && !os.IsNotExist(err) {
+		LogWarn("删除过期缓存失败", "file", filepath.Base(cachePath), "reason", reason, "error", err)
+	} else {
+		LogInfo("已删除过期缓存", "file", filepath.Base(cachePath), "reason", reason)
+	}
+	return fmt.Errorf("%w: %s", ErrStaleCache, reason)
+}
+
+// writeCacheFile 通过 mmap 写入 size 字节的缓存文件
+// 先写临时文件再重命名：写入中断不会留下半个缓存，已 mmap 的旧缓存也不会被截断
+func writeCacheFile(cachePath string, size int, fill func(data []byte)) error {
+	if IsReadOnly() {
+		return ErrReadOnly
+	}
+	tmpPath := cachePath + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	err = f.Truncate(int64(size))
+	if err == nil {
+		var data []byte
+		data, err = syscall.Mmap(int(f.Fd()), 0, size,
+			syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+		if err == nil {
+			fill(data)
+			err = syscall.Munmap(data)
+		}
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, cachePath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+	return err
+}
+
+// SetCacheDir 设置缓存目录（只读模式下不创建目录）
 func SetCacheDir(dir string) {
 	cacheDirMu.Lock()
 	defer cacheDirMu.Unlock()
 	cacheDir = dir
-	os.MkdirAll(dir, 0755)
+	if !IsReadOnly() {
+		os.MkdirAll(dir, 0755)
+	}
 }
 
 // GetCacheDir 获取缓存目录
@@ -60,13 +142,10 @@ func GetCacheDir() string {
 	cacheDirMu.Lock()
 	defer cacheDirMu.Unlock()
 	if cacheDir == "" {
-		// 默认使用工作目录下的 .index_cache
-		wd, err := os.Getwd()
-		if err != nil {
-			wd = "."
+		cacheDir = defaultCacheDir()
+		if !IsReadOnly() {
+			os.MkdirAll(cacheDir, 0755)
 		}
-		cacheDir = filepath.Join(wd, ".index_cache")
-		os.MkdirAll(cacheDir, 0755)
 	}
 	return cacheDir
 }
@@ -77,12 +156,12 @@ func GetCacheDir() string {
 func getFileHash(filePath string) [16]byte {
 	var hash [16]byte
 
-	info, err := os.Stat(filePath)
+	info, err := statFile(filePath)
 	if err != nil {
 		return hash
 	}
 
-	f, err := os.Open(filePath)
+	f, err := openFile(filePath)
 	if err != nil {
 		return hash
 	}
@@ -90,7 +169,7 @@ func getFileHash(filePath string) [16]byte {
 
 	// 只读取头部 4KB（包含文件头和部分索引，足够区分不同文件）
 	buf := make([]byte, 4096)
-	n, _ := f.Read(buf)
+	n, _ := f.ReadAt(buf, 0)
 
 	h := md5.New()
 	h.Write([]byte(filepath.Base(filePath)))                    // 文件名
@@ -100,10 +179,25 @@ func getFileHash(filePath string) [16]byte {
 	return hash
 }
 
+// FileCacheKey 录像文件的缓存键，文件内容或修改时间变化后随之改变
+// 供服务端为派生数据（如缩略图）命名缓存文件
+func FileCacheKey(recFilePath string) string {
+	return fmt.Sprintf("%x", getFileHash(recFilePath))
+}
+
 // getCachePath 获取缓存文件路径
+// 帧索引内容依赖时间戳下限和是否跳过损坏条目，非默认设置时使用独立的缓存文件
 func getCachePath(recFilePath string) string {
-	hash := getFileHash(recFilePath)
-	return filepath.Join(GetCacheDir(), fmt.Sprintf("%x.sidx", hash))
+	name := fmt.Sprintf("%x", getFileHash(recFilePath))
+	if IsRawTimestampMode() {
+		name += "-raw"
+	} else if floor := GetMinValidTimestamp(); floor != MinValidTimestamp {
+		name += fmt.Sprintf("-t%d", floor)
+	}
+	if IsIndexResync() {
+		name += "-resync"
+	}
+	return filepath.Join(GetCacheDir(), name+".sidx")
 }
 
 // CacheExists 检查缓存是否存在且有效
@@ -114,12 +208,13 @@ func CacheExists(recFilePath string) bool {
 		return false
 	}
 	// 至少要有 header
-	return info.Size() >= CacheHeaderSize
+	return info.Size() >= FrameIndexCacheHeaderSize
 }
 
 // SaveMmapCache 保存帧索引到缓存文件
-// 直接按 FrameIndexRecord 的内存布局写入，便于后续 mmap 零拷贝读取
-func SaveMmapCache(recFilePath string, records []FrameIndexRecord) error {
+// 直接按 FrameIndexRecord 的内存布局写入，便于后续 mmap 零拷贝读取；
+// layout 为解析时找到的索引位置和条目大小，重新解析同一文件时直接使用
+func SaveMmapCache(recFilePath string, records []FrameIndexRecord, layout IndexLayout) error {
 	if len(records) == 0 {
 		return nil
 	}
@@ -127,38 +222,18 @@ func SaveMmapCache(recFilePath string, records []FrameIndexRecord) error {
 	cachePath := getCachePath(recFilePath)
 	fileHash := getFileHash(recFilePath)
 
-	totalSize := CacheHeaderSize + len(records)*frameIndexRecordSize
-
-	f, err := os.Create(cachePath)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	if err := f.Truncate(int64(totalSize)); err != nil {
-		return err
-	}
-
-	// mmap 写入
-	data, err := syscall.Mmap(int(f.Fd()), 0, totalSize,
-		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
-	if err != nil {
-		return err
-	}
-	defer syscall.Munmap(data)
+	totalSize := FrameIndexCacheHeaderSize + len(records)*frameIndexRecordSize
 
-	// 写入 header
-	copy(data[0:4], CacheMagic)
-	binary.LittleEndian.PutUint32(data[4:8], CacheVersion)
-	binary.LittleEndian.PutUint32(data[8:12], uint32(len(records)))
-	copy(data[12:28], fileHash[:])
+	return writeCacheFile(cachePath, totalSize, func(data []byte) {
+		// 写入 header
+		putCacheHeader(data, CacheMagic, CacheVersion, len(records), fileHash)
+		putHeaderLayout(data, layout)
 
-	// 直接拷贝整个 records 切片的内存到 mmap
-	// 这是写入时唯一的拷贝，读取时零拷贝
-	recordsBytes := unsafe.Slice((*byte)(unsafe.Pointer(&records[0])), len(records)*frameIndexRecordSize)
-	copy(data[CacheHeaderSize:], recordsBytes)
-
-	return nil
+		// 直接拷贝整个 records 切片的内存到 mmap
+		// 这是写入时唯一的拷贝，读取时零拷贝
+		recordsBytes := unsafe.Slice((*byte)(unsafe.Pointer(&records[0])), len(records)*frameIndexRecordSize)
+		copy(data[FrameIndexCacheHeaderSize:], recordsBytes)
+	})
 }
 
 // LoadMmapCache 从缓存加载帧索引 - 零拷贝！
@@ -180,9 +255,9 @@ func LoadMmapCache(recFilePath string) (*MmapCache, error) {
 		return nil, err
 	}
 
-	if info.Size() < CacheHeaderSize {
+	if info.Size() < FrameIndexCacheHeaderSize {
 		f.Close()
-		return nil, fmt.Errorf("cache file too small")
+		return nil, discardStaleCache(cachePath, "cache file too small")
 	}
 
 	// mmap 只读
@@ -196,45 +271,108 @@ func LoadMmapCache(recFilePath string) (*MmapCache, error) {
 	// mmap 完成后可以关闭 fd
 	f.Close()
 
+	// 读取 header，缓存文件所在存储已断开时访问映射会出错
+	var magic string
+	var version uint32
+	var count int
+	var layout IndexLayout
+	if err := guardMmap(func() {
+		magic = string(data[0:4])
+		version = binary.LittleEndian.Uint32(data[4:8])
+		count = int(binary.LittleEndian.Uint32(data[8:12]))
+		layout = headerLayout(data)
+	}); err != nil {
+		syscall.Munmap(data)
+		return nil, err
+	}
+
 	// 验证 magic
-	if string(data[0:4]) != CacheMagic {
+	if magic != CacheMagic {
 		syscall.Munmap(data)
-		return nil, fmt.Errorf("invalid cache magic")
+		return nil, discardStaleCache(cachePath, "invalid cache magic")
 	}
 
 	// 验证版本
-	version := binary.LittleEndian.Uint32(data[4:8])
 	if version != CacheVersion {
 		syscall.Munmap(data)
-		return nil, fmt.Errorf("cache version mismatch: got %d, want %d", version, CacheVersion)
+		return nil, discardStaleCache(cachePath, fmt.Sprintf("cache version mismatch: got %d, want %d", version, CacheVersion))
 	}
 
-	count := int(binary.LittleEndian.Uint32(data[8:12]))
-
 	// 不再验证原始文件 hash - 信任本地缓存，避免读取 U 盘
 	// 缓存路径已经包含了文件 hash，如果文件变化会生成新的缓存路径
 
 	// 验证大小
-	expectedSize := CacheHeaderSize + count*frameIndexRecordSize
+	expectedSize := FrameIndexCacheHeaderSize + count*frameIndexRecordSize
 	if int(info.Size()) < expectedSize {
 		syscall.Munmap(data)
-		return nil, fmt.Errorf("cache file truncated")
+		return nil, discardStaleCache(cachePath, "cache file truncated")
 	}
 
 	cache := &MmapCache{
-		data:  data,
-		count: count,
+		data:   data,
+		count:  count,
+		Layout: layout,
 	}
 
 	// 零拷贝：直接将 mmap 内存解释为 []FrameIndexRecord
+	// header 为 8 字节的倍数，记录满足 FrameIndexRecord 的对齐要求
 	if count > 0 {
-		ptr := unsafe.Pointer(&data[CacheHeaderSize])
+		ptr := unsafe.Pointer(&data[FrameIndexCacheHeaderSize])
 		cache.Records = unsafe.Slice((*FrameIndexRecord)(ptr), count)
 	}
 
 	return cache, nil
 }
 
+// putHeaderLayout 在帧索引缓存 header 中写入索引布局
+func putHeaderLayout(header []byte, layout IndexLayout) {
+	binary.LittleEndian.PutUint32(header[cacheStrideOffset:cacheIndexStartOffset], uint32(layout.Stride))
+	binary.LittleEndian.PutUint64(header[cacheIndexStartOffset:FrameIndexCacheHeaderSize], uint64(layout.Start))
+}
+
+// headerLayout 读取帧索引缓存 header 中的索引布局
+func headerLayout(header []byte) IndexLayout {
+	layout := IndexLayout{
+		Start:  int64(binary.LittleEndian.Uint64(header[cacheIndexStartOffset:FrameIndexCacheHeaderSize])),
+		Stride: int(binary.LittleEndian.Uint32(header[cacheStrideOffset:cacheIndexStartOffset])),
+	}
+	if layout.Stride != TRecFrameIndexSizeWide {
+		layout.Stride = TRecFrameIndexSize
+	}
+	return layout
+}
+
+// cachedIndexLayout 从同一录像文件已有的缓存中读取索引布局，没有时返回零值（需要搜索和检测）
+// 不同时间戳下限的缓存共享文件 hash 前缀，切换下限重新解析时可以沿用
+func cachedIndexLayout(recFilePath string) IndexLayout {
+	if IsReadOnly() {
+		return IndexLayout{}
+	}
+	hash := getFileHash(recFilePath)
+	// 压缩缓存（.sidxz）的 header 布局相同
+	paths, _ := filepath.Glob(filepath.Join(GetCacheDir(), fmt.Sprintf("%x*.sidx", hash)))
+	compressed, _ := filepath.Glob(filepath.Join(GetCacheDir(), fmt.Sprintf("%x*.sidxz", hash)))
+	for _, path := range append(paths, compressed...) {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		header := make([]byte, FrameIndexCacheHeaderSize)
+		n, _ := f.Read(header)
+		f.Close()
+		if n < FrameIndexCacheHeaderSize {
+			continue
+		}
+		magic, version := string(header[0:4]), binary.LittleEndian.Uint32(header[4:8])
+		if !(magic == CacheMagic && version == CacheVersion) &&
+			!(magic == CompressedCacheMagic && version == CompressedCacheVersion) {
+			continue
+		}
+		return headerLayout(header)
+	}
+	return IndexLayout{}
+}
+
 // Close 释放 mmap
 func (c *MmapCache) Close() {
 	if c.data != nil {
@@ -254,38 +392,27 @@ func (c *MmapCache) Count() int {
 // 带缓存的帧索引解析
 // ============================================================================
 
-// ParseTRecFrameIndexWithCache 解析 TRec 文件帧索引（带 mmap 缓存）
-// 首次解析后缓存到磁盘，后续直接 mmap 零拷贝读取
+// ParseTRecFrameIndexWithCache 解析 TRec 文件帧索引（带磁盘缓存）
+// 首次解析后缓存到磁盘，后续直接 mmap 零拷贝读取（压缩缓存模式下解码读取）
 func ParseTRecFrameIndexWithCache(recFilePath string) ([]FrameIndexRecord, error) {
-	// 尝试从 mmap 缓存加载
-	if CacheExists(recFilePath) {
-		cache, err := LoadMmapCache(recFilePath)
-		if err == nil {
-			// 注意：这里返回的是 mmap 内存的切片视图
-			// 调用者使用完后应该考虑 cache 的生命周期
-			// 但由于我们在 buildSegmentCache 中会复制到 CachedSegmentInfo
-			// 所以这里可以安全地复制一份
-			records := make([]FrameIndexRecord, cache.Count())
-			copy(records, cache.Records)
-			cache.Close()
-			LogDebug("MmapCache 加载", "file", filepath.Base(recFilePath), "count", len(records))
-			return records, nil
-		}
-		// 缓存无效，继续解析原始文件
+	// 尝试从缓存加载
+	if records, _, ok := loadFrameIndexCache(recFilePath); ok {
+		LogDebug("帧索引缓存 加载", "file", filepath.Base(recFilePath), "count", len(records))
+		return records, nil
 	}
 
 	// 解析原始文件
-	records, err := ParseTRecFrameIndex(recFilePath)
+	records, layout, err := parseTRecFrameIndex(recFilePath, cachedIndexLayout(recFilePath))
 	if err != nil {
 		return nil, err
 	}
 
-	// 保存到缓存
-	if len(records) > 0 {
-		if err := SaveMmapCache(recFilePath, records); err != nil {
-			LogWarn("MmapCache 保存失败", "error", err)
+	// 保存到缓存（只读模式下只保存在内存中）
+	if len(records) > 0 && !IsReadOnly() {
+		if err := saveFrameIndexCache(recFilePath, records, layout); err != nil {
+			LogWarn("帧索引缓存 保存失败", "error", err)
 		} else {
-			LogDebug("MmapCache 保存", "file", filepath.Base(recFilePath), "count", len(records))
+			LogDebug("帧索引缓存 保存", "file", filepath.Base(recFilePath), "count", len(records))
 		}
 	}
 
@@ -331,8 +458,8 @@ func (m *GlobalMmapManager) GetOrLoad(recFilePath string) ([]FrameIndexRecord, e
 		return cache.Records, nil
 	}
 
-	// 尝试从 mmap 缓存加载
-	if CacheExists(recFilePath) {
+	// 尝试从 mmap 缓存加载（只读模式下不使用缓存文件，保存也会失败并回退到内存中的 records）
+	if !IsReadOnly() && CacheExists(recFilePath) {
 		cache, err := LoadMmapCache(recFilePath)
 		if err == nil {
 			m.caches[recFilePath] = cache
@@ -342,14 +469,14 @@ func (m *GlobalMmapManager) GetOrLoad(recFilePath string) ([]FrameIndexRecord, e
 	}
 
 	// 解析原始文件并缓存
-	records, err := ParseTRecFrameIndex(recFilePath)
+	records, layout, err := parseTRecFrameIndex(recFilePath, cachedIndexLayout(recFilePath))
 	if err != nil {
 		return nil, err
 	}
 
 	// 保存到磁盘缓存
 	if len(records) > 0 {
-		if err := SaveMmapCache(recFilePath, records); err == nil {
+		if err := SaveMmapCache(recFilePath, records, layout); err == nil {
 			// 重新加载为 mmap
 			cache, err := LoadMmapCache(recFilePath)
 			if err == nil {
@@ -374,6 +501,16 @@ func (m *GlobalMmapManager) Close() {
 	m.caches = make(map[string]*MmapCache)
 }
 
+// Evict 关闭并移除单个缓存，访问映射出错（ErrMappingFault）后调用，下次 GetOrLoad 重新加载
+func (m *GlobalMmapManager) Evict(recFilePath string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cache, ok := m.caches[recFilePath]; ok {
+		cache.Close()
+		delete(m.caches, recFilePath)
+	}
+}
+
 // Stats 返回统计信息
 func (m *GlobalMmapManager) Stats() (int, int) {
 	m.mu.RLock()
@@ -391,13 +528,15 @@ func (m *GlobalMmapManager) Stats() (int, int) {
 
 const (
 	VPSCacheMagic   = "VPOS"
-	VPSCacheVersion = 1
+	VPSCacheVersion = 2 // 版本 2: 只接受完整的 VPS NAL 头，旧版本可能包含音频数据中的误匹配
 )
 
 // getVPSCachePath 获取 VPS 缓存文件路径
+// 扫描结果依赖解密设置，设置了解密器时文件名带有解密器的 CacheKey
 func getVPSCachePath(recFilePath string) string {
 	hash := getFileHash(recFilePath)
-	return filepath.Join(GetCacheDir(), fmt.Sprintf("%x.vpos", hash))
+	suffix, _ := decryptorCacheKey()
+	return filepath.Join(GetCacheDir(), fmt.Sprintf("%x%s.vpos", hash, suffix))
 }
 
 // SaveVPSCache 保存 VPS 位置到缓存
@@ -412,35 +551,15 @@ func SaveVPSCache(recFilePath string, positions []int) error {
 	// Header (32) + positions (N * 4 bytes)
 	totalSize := CacheHeaderSize + len(positions)*4
 
-	f, err := os.Create(cachePath)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	if err := f.Truncate(int64(totalSize)); err != nil {
-		return err
-	}
-
-	data, err := syscall.Mmap(int(f.Fd()), 0, totalSize,
-		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
-	if err != nil {
-		return err
-	}
-	defer syscall.Munmap(data)
-
-	// Header
-	copy(data[0:4], VPSCacheMagic)
-	binary.LittleEndian.PutUint32(data[4:8], VPSCacheVersion)
-	binary.LittleEndian.PutUint32(data[8:12], uint32(len(positions)))
-	copy(data[12:28], fileHash[:])
+	return writeCacheFile(cachePath, totalSize, func(data []byte) {
+		// Header
+		putCacheHeader(data, VPSCacheMagic, VPSCacheVersion, len(positions), fileHash)
 
-	// Positions
-	for i, pos := range positions {
-		binary.LittleEndian.PutUint32(data[CacheHeaderSize+i*4:], uint32(pos))
-	}
-
-	return nil
+		// Positions
+		for i, pos := range positions {
+			binary.LittleEndian.PutUint32(data[CacheHeaderSize+i*4:], uint32(pos))
+		}
+	})
 }
 
 // LoadVPSCache 从缓存加载 VPS 位置
@@ -453,7 +572,7 @@ func LoadVPSCache(recFilePath string) ([]int, error) {
 	}
 
 	if info.Size() < CacheHeaderSize {
-		return nil, fmt.Errorf("vps cache too small")
+		return nil, discardStaleCache(cachePath, "vps cache too small")
 	}
 
 	f, err := os.Open(cachePath)
@@ -469,15 +588,22 @@ func LoadVPSCache(recFilePath string) ([]int, error) {
 	}
 	defer syscall.Munmap(data)
 
+	// 复制整个文件后再解析，之后不再访问映射；缓存存储断开时返回 ErrMappingFault
+	mapped := data
+	data = make([]byte, len(mapped))
+	if err := guardMmap(func() { copy(data, mapped) }); err != nil {
+		return nil, err
+	}
+
 	// 验证 magic
 	if string(data[0:4]) != VPSCacheMagic {
-		return nil, fmt.Errorf("invalid vps cache magic")
+		return nil, discardStaleCache(cachePath, "invalid vps cache magic")
 	}
 
 	// 验证版本
 	version := binary.LittleEndian.Uint32(data[4:8])
 	if version != VPSCacheVersion {
-		return nil, fmt.Errorf("vps cache version mismatch")
+		return nil, discardStaleCache(cachePath, fmt.Sprintf("vps cache version mismatch: got %d, want %d", version, VPSCacheVersion))
 	}
 
 	count := int(binary.LittleEndian.Uint32(data[8:12]))
@@ -487,13 +613,13 @@ func LoadVPSCache(recFilePath string) ([]int, error) {
 	copy(storedHash[:], data[12:28])
 	currentHash := getFileHash(recFilePath)
 	if storedHash != currentHash {
-		return nil, fmt.Errorf("vps cache hash mismatch")
+		return nil, discardStaleCache(cachePath, "vps cache hash mismatch")
 	}
 
 	// 验证大小
 	expectedSize := CacheHeaderSize + count*4
 	if int(info.Size()) < expectedSize {
-		return nil, fmt.Errorf("vps cache truncated")
+		return nil, discardStaleCache(cachePath, "vps cache truncated")
 	}
 
 	// 读取 positions
@@ -518,12 +644,9 @@ func VPSCacheExists(recFilePath string) bool {
 // ScanVPSPositionsWithCache 扫描 VPS 位置（带缓存）
 func ScanVPSPositionsWithCache(recFilePath string) ([]int, error) {
 	// 尝试从缓存加载
-	if VPSCacheExists(recFilePath) {
-		positions, err := LoadVPSCache(recFilePath)
-		if err == nil {
-			LogDebug("VPS缓存 加载", "file", filepath.Base(recFilePath), "count", len(positions))
-			return positions, nil
-		}
+	if positions, ok := loadVPSCache(recFilePath); ok {
+		LogDebug("VPS缓存 加载", "file", filepath.Base(recFilePath), "count", len(positions))
+		return positions, nil
 	}
 
 	// 扫描原始文件
@@ -532,9 +655,9 @@ func ScanVPSPositionsWithCache(recFilePath string) ([]int, error) {
 		return nil, err
 	}
 
-	// 保存到缓存
-	if len(positions) > 0 {
-		if err := SaveVPSCache(recFilePath, positions); err != nil {
+	// 保存到缓存（只读模式下只保存在内存中）
+	if len(positions) > 0 && !IsReadOnly() {
+		if err := saveVPSCache(recFilePath, positions); err != nil {
 			LogWarn("VPS缓存 保存失败", "error", err)
 		} else {
 			LogDebug("VPS缓存 保存", "file", filepath.Base(recFilePath), "count", len(positions))
@@ -0,0 +1,164 @@
+package seetong
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// patchCacheFile 修改缓存文件 offset 处的 4 字节
+func patchCacheFile(t *testing.T, path string, offset int, value uint32) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint32(data[offset:], value)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// cacheFileVersion 缓存文件 header 中的版本
+func cacheFileVersion(t *testing.T, path string) uint32 {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return binary.LittleEndian.Uint32(data[4:8])
+}
+
+func TestStaleCacheRegenerated(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		path    func(string) string
+		offset  int
+		value   uint32
+		load    func(string) error
+		rebuild func(string) (string, error) // 重新生成缓存，返回结果用于与首次生成比较
+		version uint32
+	}{
+		{
+			name: "frame index version", path: getCachePath, offset: 4, value: CacheVersion - 1,
+			load: func(p string) error {
+				c, err := LoadMmapCache(p)
+				if c != nil {
+					c.Close()
+				}
+				return err
+			},
+			rebuild: func(p string) (string, error) { r, err := ParseTRecFrameIndexWithCache(p); return fmt.Sprint(r), err },
+			version: CacheVersion,
+		},
+		{
+			name: "vps version", path: getVPSCachePath, offset: 4, value: VPSCacheVersion + 1,
+			load:    func(p string) error { _, err := LoadVPSCache(p); return err },
+			rebuild: func(p string) (string, error) { r, err := ScanVPSPositionsWithCache(p); return fmt.Sprint(r), err },
+			version: VPSCacheVersion,
+		},
+		{
+			name: "vps file hash", path: getVPSCachePath, offset: 12, value: 0xDEADBEEF,
+			load:    func(p string) error { _, err := LoadVPSCache(p); return err },
+			rebuild: func(p string) (string, error) { r, err := ScanVPSPositionsWithCache(p); return fmt.Sprint(r), err },
+			version: VPSCacheVersion,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			useTempCacheDir(t)
+			recFile := newTRecFixture(4, 10).write(t, filepath.Join(t.TempDir(), "TRec000000.tps"))
+			want, err := tc.rebuild(recFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cachePath := tc.path(recFile)
+			patchCacheFile(t, cachePath, tc.offset, tc.value)
+
+			if err := tc.load(recFile); !errors.Is(err, ErrStaleCache) {
+				t.Fatalf("loading the stale cache: %v, want ErrStaleCache", err)
+			}
+			if _, err := os.Stat(cachePath); !os.IsNotExist(err) {
+				t.Fatalf("stale cache was not deleted: %v", err)
+			}
+
+			got, err := tc.rebuild(recFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Fatal("regenerated cache differs from the original")
+			}
+			if v := cacheFileVersion(t, cachePath); v != tc.version {
+				t.Fatalf("regenerated cache version %d, want %d", v, tc.version)
+			}
+			if err := tc.load(recFile); err != nil {
+				t.Fatalf("loading the regenerated cache: %v", err)
+			}
+		})
+	}
+}
+
+// TestCJKDVRPath 录像目录含中文时能加载索引，缓存文件名只取决于文件名、修改时间和文件头
+func TestCJKDVRPath(t *testing.T) {
+	cache := useTempCacheDir(t)
+	f := newTRecFixture(4, 10)
+	dir := filepath.Join(t.TempDir(), "录像", "Stream")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	recFile := f.write(t, filepath.Join(dir, "TRec000000.tps"))
+	writeTIndexFixture(t, filepath.Join(dir, "TIndex00.tps"), []SegmentRecord{f.segment(0)}, 1, 4)
+
+	s := NewTPSStorage(dir)
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got := s.GetRecFile(0); got != recFile {
+		t.Fatalf("GetRecFile(0) = %q, want %q", got, recFile)
+	}
+	if n := s.BuildCache([]int{0}, nil); n != 1 {
+		t.Fatalf("BuildCache built %d segments, want 1", n)
+	}
+	if got := len(s.GetFrameIndex(0)); got != len(f.Frames) {
+		t.Fatalf("frame index has %d entries, want %d", got, len(f.Frames))
+	}
+
+	cachePath := getCachePath(recFile)
+	if filepath.Dir(cachePath) != cache {
+		t.Fatalf("cache file %q is outside the cache directory %q", cachePath, cache)
+	}
+	for _, c := range filepath.Base(cachePath) {
+		if c > 0x7F {
+			t.Fatalf("cache file name %q is not ASCII", filepath.Base(cachePath))
+		}
+	}
+	if _, err := os.Stat(cachePath); err != nil {
+		t.Fatalf("frame index cache was not written: %v", err)
+	}
+	if again := getCachePath(recFile); again != cachePath {
+		t.Fatalf("cache path changed between calls: %q, %q", cachePath, again)
+	}
+
+	// 同一文件放在 ASCII 目录下（修改时间相同）得到同一个缓存文件
+	info, err := os.Stat(recFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ascii := f.write(t, filepath.Join(t.TempDir(), "TRec000000.tps"))
+	if err := os.Chtimes(ascii, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if got := getCachePath(ascii); got != cachePath {
+		t.Fatalf("cache path depends on the directory: %q, want %q", got, cachePath)
+	}
+
+	c, err := LoadMmapCache(recFile)
+	if err != nil {
+		t.Fatalf("reusing the cache: %v", err)
+	}
+	c.Close()
+}
@@ -0,0 +1,140 @@
+package seetong
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// 缓存目录格式版本
+// ============================================================================
+
+// 每个缓存文件的 header 带有自己的格式版本，版本不符的文件在加载时删除并重新解析。
+// 缓存目录另外记录一个整体版本（version.json）：启动时与当前版本比较，不一致时一次性删除
+// 目录中全部索引缓存，避免旧版本写入的文件在新版本下被误读，也不必等到逐个加载时才发现
+
+// CacheFormatVersion 缓存目录的整体格式版本
+// 缓存内容的含义变化而文件 header 无法区分时（例如解析规则变化）加一，使所有缓存失效
+const CacheFormatVersion = 1
+
+// cacheVersionFile 缓存目录中记录格式版本的文件
+const cacheVersionFile = "version.json"
+
+// indexCacheExts 索引缓存文件的扩展名（迁移时删除），联系表等派生图片不受影响
+var indexCacheExts = []string{".sidx", ".sidxz", ".vpos", ".vposz", ".tmp"}
+
+// cacheVersionInfo version.json 的内容
+type cacheVersionInfo struct {
+	FormatVersion int            `json:"formatVersion"`
+	Formats       map[string]int `json:"formats"` // 各缓存文件格式的 header 版本
+	WrittenAt     time.Time      `json:"writtenAt"`
+}
+
+// currentCacheVersion 当前代码写入的缓存版本
+func currentCacheVersion() cacheVersionInfo {
+	return cacheVersionInfo{
+		FormatVersion: CacheFormatVersion,
+		Formats: map[string]int{
+			"sidx":  CacheVersion,
+			"sidxz": CompressedCacheVersion,
+			"vpos":  VPSCacheVersion,
+			"vposz": CompressedVPSCacheVersion,
+		},
+	}
+}
+
+// compatible 两个版本写入的缓存是否可以互相使用
+func (v cacheVersionInfo) compatible(other cacheVersionInfo) bool {
+	if v.FormatVersion != other.FormatVersion || len(v.Formats) != len(other.Formats) {
+		return false
+	}
+	for name, version := range v.Formats {
+		if other.Formats[name] != version {
+			return false
+		}
+	}
+	return true
+}
+
+// MigrateCacheDir 检查缓存目录的格式版本，与当前版本不兼容时删除所有索引缓存并写入新的 version.json
+// 没有 version.json 的目录（首次使用或早期版本写入）保留现有文件，由各文件 header 的版本检查处理。
+// 只读模式下不检查。返回删除的文件数
+func MigrateCacheDir() (int, error) {
+	if IsReadOnly() {
+		return 0, nil
+	}
+	dir := GetCacheDir()
+	path := filepath.Join(dir, cacheVersionFile)
+	current := currentCacheVersion()
+
+	removed := 0
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		var stored cacheVersionInfo
+		if json.Unmarshal(data, &stored) == nil && stored.compatible(current) {
+			return 0, nil
+		}
+		removed, err = removeIndexCaches(dir)
+		LogInfo("缓存格式版本变化，已删除旧缓存",
+			"dir", dir,
+			"from", stored.FormatVersion,
+			"fromFormats", stored.Formats,
+			"to", current.FormatVersion,
+			"toFormats", current.Formats,
+			"removed", removed)
+		if err != nil {
+			return removed, err
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return 0, err
+	}
+
+	current.WrittenAt = time.Now().UTC()
+	out, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return removed, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, out, 0644); err != nil {
+		return removed, err
+	}
+	return removed, os.Rename(tmp, path)
+}
+
+// removeIndexCaches 删除目录中的索引缓存文件，返回删除的文件数和第一个删除失败的错误
+func removeIndexCaches(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	var firstErr error
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == cacheVersionFile || !isIndexCacheFile(entry.Name()) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		removed++
+	}
+	return removed, firstErr
+}
+
+// isIndexCacheFile 文件名是否为索引缓存
+func isIndexCacheFile(name string) bool {
+	for _, ext := range indexCacheExts {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,280 @@
+package seetong
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// ============================================================================
+// 压缩磁盘缓存
+// ============================================================================
+
+// 压缩缓存文件格式与 .sidx/.vpos 使用相同的 header，magic 不同：
+//   .sidxz: "SIDZ"，记录按 CompressFrameIndex 的 varint 差值格式存储
+//   .vposz: "VPOZ"，位置存为与上一个位置的 varint 差值
+// 压缩缓存不能 mmap 零拷贝读取，加载时需要解码到堆内存，
+// 适合缓存目录放在小容量存储上的场景，默认仍使用零拷贝格式
+
+const (
+	CompressedCacheMagic      = "SIDZ"
+	CompressedCacheVersion    = 4 // 版本 2: header 记录索引位置；版本 3: 记录包含保留字节；版本 4: 帧类型按帧数据校正
+	CompressedVPSCacheMagic   = "VPOZ"
+	CompressedVPSCacheVersion = 2 // 版本 2: 只接受完整的 VPS NAL 头
+
+	compressedRecordMinSize = 8 // 每条记录 8 个字段，每个 varint 至少 1 字节
+)
+
+var compressedCache atomic.Bool
+
+// SetCompressedCache 设置是否以压缩格式写入磁盘缓存
+// 切换后已有的另一种格式缓存在下次加载时转换，不需要重新解析录像文件
+func SetCompressedCache(enabled bool) {
+	compressedCache.Store(enabled)
+}
+
+// IsCompressedCache 是否以压缩格式写入磁盘缓存
+func IsCompressedCache() bool {
+	return compressedCache.Load()
+}
+
+// getCompressedCachePath 压缩帧索引缓存路径，与 getCachePath 一一对应
+func getCompressedCachePath(recFilePath string) string {
+	return getCachePath(recFilePath) + "z"
+}
+
+// getCompressedVPSCachePath 压缩 VPS 缓存路径
+func getCompressedVPSCachePath(recFilePath string) string {
+	return getVPSCachePath(recFilePath) + "z"
+}
+
+// putCacheHeader 写入缓存 header
+func putCacheHeader(data []byte, magic string, version uint32, count int, hash [16]byte) {
+	copy(data[0:4], magic)
+	binary.LittleEndian.PutUint32(data[4:8], version)
+	binary.LittleEndian.PutUint32(data[8:12], uint32(count))
+	copy(data[12:28], hash[:])
+}
+
+// readCacheHeader 读取整个缓存文件并校验 magic 和版本，返回 header、记录数和 header 之后的数据
+func readCacheHeader(cachePath, magic string, version uint32, headerSize int) ([]byte, int, []byte, error) {
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if len(data) < headerSize {
+		return nil, 0, nil, discardStaleCache(cachePath, "cache file too small")
+	}
+	if string(data[0:4]) != magic {
+		return nil, 0, nil, discardStaleCache(cachePath, "invalid cache magic")
+	}
+	if got := binary.LittleEndian.Uint32(data[4:8]); got != version {
+		return nil, 0, nil, discardStaleCache(cachePath, fmt.Sprintf("cache version mismatch: got %d, want %d", got, version))
+	}
+	count := int(binary.LittleEndian.Uint32(data[8:12]))
+	return data[:headerSize], count, data[headerSize:], nil
+}
+
+// SaveCompressedCache 以压缩格式保存帧索引缓存
+func SaveCompressedCache(recFilePath string, records []FrameIndexRecord, layout IndexLayout) error {
+	if len(records) == 0 {
+		return nil
+	}
+	body := CompressFrameIndex(records).data
+	hash := getFileHash(recFilePath)
+	return writeCacheFile(getCompressedCachePath(recFilePath), FrameIndexCacheHeaderSize+len(body), func(data []byte) {
+		putCacheHeader(data, CompressedCacheMagic, CompressedCacheVersion, len(records), hash)
+		putHeaderLayout(data, layout)
+		copy(data[FrameIndexCacheHeaderSize:], body)
+	})
+}
+
+// LoadCompressedCache 加载压缩格式的帧索引缓存，返回记录和原始文件的索引布局
+// 与 LoadMmapCache 一样信任缓存路径中的文件 hash，不读取录像文件
+func LoadCompressedCache(recFilePath string) ([]FrameIndexRecord, IndexLayout, error) {
+	cachePath := getCompressedCachePath(recFilePath)
+	header, count, body, err := readCacheHeader(cachePath, CompressedCacheMagic, CompressedCacheVersion, FrameIndexCacheHeaderSize)
+	if err != nil {
+		return nil, IndexLayout{}, err
+	}
+	if count > len(body)/compressedRecordMinSize {
+		return nil, IndexLayout{}, discardStaleCache(cachePath, "cache file truncated")
+	}
+	records, ok := decodeFrameIndex(count, body)
+	if !ok {
+		return nil, IndexLayout{}, discardStaleCache(cachePath, "cache file truncated")
+	}
+	return records, headerLayout(header), nil
+}
+
+// SaveCompressedVPSCache 以压缩格式保存 VPS 位置
+func SaveCompressedVPSCache(recFilePath string, positions []int) error {
+	if len(positions) == 0 {
+		return nil
+	}
+	body := make([]byte, 0, len(positions)*3)
+	var buf [binary.MaxVarintLen64]byte
+	prev := 0
+	for _, pos := range positions {
+		body = append(body, buf[:binary.PutVarint(buf[:], int64(pos-prev))]...)
+		prev = pos
+	}
+	hash := getFileHash(recFilePath)
+	return writeCacheFile(getCompressedVPSCachePath(recFilePath), CacheHeaderSize+len(body), func(data []byte) {
+		putCacheHeader(data, CompressedVPSCacheMagic, CompressedVPSCacheVersion, len(positions), hash)
+		copy(data[CacheHeaderSize:], body)
+	})
+}
+
+// LoadCompressedVPSCache 加载压缩格式的 VPS 位置，与 LoadVPSCache 一样校验文件 hash
+func LoadCompressedVPSCache(recFilePath string) ([]int, error) {
+	cachePath := getCompressedVPSCachePath(recFilePath)
+	header, count, body, err := readCacheHeader(cachePath, CompressedVPSCacheMagic, CompressedVPSCacheVersion, CacheHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+	var storedHash [16]byte
+	copy(storedHash[:], header[12:28])
+	if storedHash != getFileHash(recFilePath) {
+		return nil, discardStaleCache(cachePath, "vps cache hash mismatch")
+	}
+	if count > len(body) {
+		return nil, discardStaleCache(cachePath, "vps cache truncated")
+	}
+
+	positions := make([]int, count)
+	prev := 0
+	for i := range positions {
+		delta, n := binary.Varint(body)
+		if n <= 0 {
+			return nil, discardStaleCache(cachePath, "vps cache truncated")
+		}
+		body = body[n:]
+		prev += int(delta)
+		positions[i] = prev
+	}
+	return positions, nil
+}
+
+// loadFrameIndexCache 按当前格式加载帧索引缓存，返回记录和索引布局
+// 当前格式不存在时尝试另一种格式，成功后转换为当前格式并删除旧文件
+func loadFrameIndexCache(recFilePath string) ([]FrameIndexRecord, IndexLayout, bool) {
+	if IsReadOnly() {
+		return nil, IndexLayout{}, false
+	}
+	compressed := IsCompressedCache()
+	for _, fromCompressed := range []bool{compressed, !compressed} {
+		records, layout, path, err := loadFrameIndexCacheFormat(recFilePath, fromCompressed)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				// 缓存无效（过期的缓存文件已删除），尝试另一种格式或重新解析
+				LogDebug("帧索引缓存无效", "file", filepath.Base(recFilePath), "error", err)
+			}
+			continue
+		}
+		if fromCompressed != compressed {
+			if err := saveFrameIndexCache(recFilePath, records, layout); err != nil {
+				LogWarn("帧索引缓存格式转换失败", "file", filepath.Base(recFilePath), "error", err)
+			} else {
+				os.Remove(path)
+				LogDebug("帧索引缓存格式转换", "file", filepath.Base(recFilePath), "compressed", compressed)
+			}
+		}
+		return records, layout, true
+	}
+	return nil, IndexLayout{}, false
+}
+
+// loadFrameIndexCacheFormat 加载指定格式的帧索引缓存，返回的记录不引用 mmap 内存
+func loadFrameIndexCacheFormat(recFilePath string, compressed bool) ([]FrameIndexRecord, IndexLayout, string, error) {
+	if compressed {
+		records, layout, err := LoadCompressedCache(recFilePath)
+		return records, layout, getCompressedCachePath(recFilePath), err
+	}
+	if !CacheExists(recFilePath) {
+		return nil, IndexLayout{}, "", os.ErrNotExist
+	}
+	cache, err := LoadMmapCache(recFilePath)
+	if err != nil {
+		return nil, IndexLayout{}, "", err
+	}
+	// 注意：cache.Records 是 mmap 内存的切片视图，关闭前复制一份
+	records := make([]FrameIndexRecord, cache.Count())
+	err = guardMmap(func() { copy(records, cache.Records) })
+	layout := cache.Layout
+	cache.Close()
+	if err != nil {
+		return nil, IndexLayout{}, "", err
+	}
+	return records, layout, getCachePath(recFilePath), nil
+}
+
+// saveFrameIndexCache 按当前格式保存帧索引缓存
+func saveFrameIndexCache(recFilePath string, records []FrameIndexRecord, layout IndexLayout) error {
+	if IsCompressedCache() {
+		return SaveCompressedCache(recFilePath, records, layout)
+	}
+	return SaveMmapCache(recFilePath, records, layout)
+}
+
+// loadVPSCache 按当前格式加载 VPS 缓存，另一种格式的缓存加载后转换为当前格式
+func loadVPSCache(recFilePath string) ([]int, bool) {
+	if _, ok := decryptorCacheKey(); IsReadOnly() || !ok {
+		return nil, false
+	}
+	compressed := IsCompressedCache()
+	for _, fromCompressed := range []bool{compressed, !compressed} {
+		var positions []int
+		var path string
+		var err error
+		if fromCompressed {
+			path = getCompressedVPSCachePath(recFilePath)
+			positions, err = LoadCompressedVPSCache(recFilePath)
+		} else {
+			path = getVPSCachePath(recFilePath)
+			if !VPSCacheExists(recFilePath) {
+				continue
+			}
+			positions, err = LoadVPSCache(recFilePath)
+		}
+		if err != nil {
+			continue
+		}
+		if fromCompressed != compressed {
+			if err := saveVPSCache(recFilePath, positions); err != nil {
+				LogWarn("VPS缓存 格式转换失败", "file", filepath.Base(recFilePath), "error", err)
+			} else {
+				os.Remove(path)
+			}
+		}
+		return positions, true
+	}
+	return nil, false
+}
+
+// saveVPSCache 按当前格式保存 VPS 缓存
+func saveVPSCache(recFilePath string, positions []int) error {
+	if _, ok := decryptorCacheKey(); !ok {
+		return nil // 解密器无法区分密钥，不写磁盘缓存
+	}
+	if IsCompressedCache() {
+		return SaveCompressedVPSCache(recFilePath, positions)
+	}
+	return SaveVPSCache(recFilePath, positions)
+}
+
+// CacheDirUsage 缓存目录（含子目录）占用的字节数和文件数
+func CacheDirUsage() (int64, int) {
+	var size int64
+	var files int
+	filepath.Walk(GetCacheDir(), func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+			files++
+		}
+		return nil
+	})
+	return size, files
+}
@@ -0,0 +1,155 @@
+package seetong
+
+import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+)
+
+// ============================================================================
+// 压缩帧索引
+// ============================================================================
+
+// 压缩模式下保留解码结果的文件数（正在播放/查询的文件反复访问时不必重复解码）
+const compactDecodeCacheSize = 4
+
+var compactFrameIndex atomic.Bool
+
+// SetCompactFrameIndex 设置是否在内存中压缩保存帧索引
+// 适合段落很多的大容量存储：以访问时解码的 CPU 开销换取内存
+func SetCompactFrameIndex(enabled bool) {
+	compactFrameIndex.Store(enabled)
+}
+
+// CompactFrameIndex 压缩的帧索引
+// 每条记录按 varint 编码，FrameSeq/FileOffset/TimestampUs/UnixTs 存为与上一条的差值
+// （zigzag，帧索引按时间排序时基本单调，差值通常只占 1-3 字节），
+// 保留字节按小端 uint64 存为 varint（通常为 0，只占 1 字节），典型记录从 48 字节压缩到约 13 字节
+type CompactFrameIndex struct {
+	count int
+	data  []byte
+}
+
+// CompressFrameIndex 压缩帧索引
+func CompressFrameIndex(records []FrameIndexRecord) *CompactFrameIndex {
+	data := make([]byte, 0, len(records)*13)
+	var buf [binary.MaxVarintLen64]byte
+	putU := func(v uint64) { data = append(data, buf[:binary.PutUvarint(buf[:], v)]...) }
+	putS := func(v int64) { data = append(data, buf[:binary.PutVarint(buf[:], v)]...) }
+
+	var prev FrameIndexRecord
+	for _, r := range records {
+		putU(uint64(r.FrameType))
+		putU(uint64(r.Channel))
+		putS(int64(r.FrameSeq) - int64(prev.FrameSeq))
+		putS(int64(r.FileOffset) - int64(prev.FileOffset))
+		putU(uint64(r.FrameSize))
+		putS(int64(r.TimestampUs - prev.TimestampUs))
+		putS(int64(r.UnixTs) - int64(prev.UnixTs))
+		putU(binary.LittleEndian.Uint64(r.Reserved[:]))
+		prev = r
+	}
+
+	return &CompactFrameIndex{
+		count: len(records),
+		data:  append([]byte(nil), data...), // 去掉多余容量
+	}
+}
+
+// Len 记录数
+func (c *CompactFrameIndex) Len() int {
+	return c.count
+}
+
+// Size 压缩后的字节数
+func (c *CompactFrameIndex) Size() int {
+	return len(c.data)
+}
+
+// Records 解码全部记录
+func (c *CompactFrameIndex) Records() []FrameIndexRecord {
+	records, _ := decodeFrameIndex(c.count, c.data)
+	return records
+}
+
+// decodeFrameIndex 解码 count 条压缩记录，数据不完整（如损坏的磁盘缓存）时返回 false
+func decodeFrameIndex(count int, data []byte) ([]FrameIndexRecord, bool) {
+	records := make([]FrameIndexRecord, count)
+	ok := true
+	getU := func() uint64 {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			ok = false
+			return 0
+		}
+		data = data[n:]
+		return v
+	}
+	getS := func() int64 {
+		v, n := binary.Varint(data)
+		if n <= 0 {
+			ok = false
+			return 0
+		}
+		data = data[n:]
+		return v
+	}
+
+	var prev FrameIndexRecord
+	for i := range records {
+		r := FrameIndexRecord{
+			FrameType:   uint32(getU()),
+			Channel:     uint32(getU()),
+			FrameSeq:    uint32(int64(prev.FrameSeq) + getS()),
+			FileOffset:  uint32(int64(prev.FileOffset) + getS()),
+			FrameSize:   uint32(getU()),
+			TimestampUs: prev.TimestampUs + uint64(getS()),
+			UnixTs:      uint32(int64(prev.UnixTs) + getS()),
+		}
+		binary.LittleEndian.PutUint64(r.Reserved[:], getU())
+		if !ok {
+			return nil, false
+		}
+		records[i] = r
+		prev = r
+	}
+	return records, true
+}
+
+// compactDecodeCache 最近解码的帧索引
+type compactDecodeCache struct {
+	mu      sync.Mutex
+	entries []decodedFrameIndex // 最近使用的在末尾
+}
+
+type decodedFrameIndex struct {
+	src     *CompactFrameIndex
+	records []FrameIndexRecord
+}
+
+// get 返回解码结果，未命中时解码并淘汰最久未用的条目
+func (d *compactDecodeCache) get(c *CompactFrameIndex) []FrameIndexRecord {
+	if c == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	for i, e := range d.entries {
+		if e.src == c {
+			d.entries = append(append(d.entries[:i:i], d.entries[i+1:]...), e)
+			d.mu.Unlock()
+			return e.records
+		}
+	}
+	d.mu.Unlock()
+
+	records := c.Records()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.entries) >= compactDecodeCacheSize {
+		d.entries = append(d.entries[:0:0], d.entries[1:]...)
+	}
+	d.entries = append(d.entries, decodedFrameIndex{src: c, records: records})
+	return records
+}
@@ -0,0 +1,100 @@
+package seetong
+
+import (
+	"math/rand"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// compactTestRecords 按时间排序的帧索引：两路视频和音频交错，FileOffset 不单调（排序后两路视频的偏移交替前后），
+// 帧序号和 Unix 时间有回退，部分记录带保留字节
+func compactTestRecords(n int) []FrameIndexRecord {
+	rng := rand.New(rand.NewSource(1))
+	records := make([]FrameIndexRecord, n)
+	offset := uint32(0x200)
+	for i := range records {
+		r := FrameIndexRecord{
+			FrameType:   FrameTypeP,
+			Channel:     []uint32{ChannelVideo1, ChannelAudio, ChannelVideo2}[i%3],
+			FrameSeq:    uint32(i) ^ 1,
+			FileOffset:  offset,
+			FrameSize:   uint32(300 + rng.Intn(60000)),
+			TimestampUs: uint64(i) * 13333,
+			UnixTs:      uint32(fixtureUnixTs + i/75),
+		}
+		if i%50 == 0 {
+			r.FrameType = FrameTypeI
+		}
+		if i%7 == 0 {
+			r.Reserved = [8]byte{1, 2, 3, 4, 5, 6, 7, byte(i)}
+		}
+		if i%3 == 2 {
+			r.FileOffset -= uint32(rng.Intn(5000)) // 比上一条记录靠前
+			r.UnixTs--
+		}
+		records[i] = r
+		offset += r.FrameSize
+	}
+	return records
+}
+
+func TestCompressFrameIndexRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 1000} {
+		records := compactTestRecords(n)
+		c := CompressFrameIndex(records)
+		if c.Len() != n {
+			t.Fatalf("n=%d: Len() = %d", n, c.Len())
+		}
+		got, ok := decodeFrameIndex(c.count, c.data)
+		if !ok || !reflect.DeepEqual(got, records) {
+			t.Fatalf("n=%d: decoded records differ (ok=%v)", n, ok)
+		}
+		if n > 0 && c.Size() >= n*frameIndexRecordSize {
+			t.Fatalf("n=%d: compressed to %d bytes, no smaller than %d", n, c.Size(), n*frameIndexRecordSize)
+		}
+	}
+}
+
+func TestDecodeFrameIndexTruncated(t *testing.T) {
+	c := CompressFrameIndex(compactTestRecords(100))
+	for _, size := range []int{0, 1, c.Size() / 2, c.Size() - 1} {
+		if records, ok := decodeFrameIndex(c.count, c.data[:size]); ok || records != nil {
+			t.Fatalf("truncated to %d of %d bytes: ok=%v, %d records", size, c.Size(), ok, len(records))
+		}
+	}
+	// 记录数多于数据中的记录
+	if _, ok := decodeFrameIndex(c.count+1, c.data); ok {
+		t.Fatal("decoding one record past the data succeeded")
+	}
+}
+
+// BenchmarkCompactFrameIndexMemory 每个文件 10 万条记录时压缩前后的堆内存
+func BenchmarkCompactFrameIndexMemory(b *testing.B) {
+	records := compactTestRecords(100000)
+	heap := func() uint64 {
+		var m runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&m)
+		return m.HeapAlloc
+	}
+
+	b.Run("slice", func(b *testing.B) {
+		var keep [][]FrameIndexRecord
+		before := heap()
+		for i := 0; i < b.N; i++ {
+			keep = append(keep, append([]FrameIndexRecord(nil), records...))
+		}
+		b.ReportMetric(float64(heap()-before)/float64(b.N), "heap-bytes/file")
+		runtime.KeepAlive(keep)
+	})
+	b.Run("compact", func(b *testing.B) {
+		var keep []*CompactFrameIndex
+		before := heap()
+		for i := 0; i < b.N; i++ {
+			keep = append(keep, CompressFrameIndex(records))
+		}
+		b.ReportMetric(float64(heap()-before)/float64(b.N), "heap-bytes/file")
+		runtime.KeepAlive(keep)
+	})
+}
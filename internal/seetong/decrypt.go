@@ -0,0 +1,174 @@
+package seetong
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync/atomic"
+)
+
+// ============================================================================
+// 帧数据解密
+// ============================================================================
+
+// 部分企业版固件对帧负载做 XOR 或 AES 加扰，帧索引仍为明文。设置 FrameDecryptor 后
+// ReadFrame / ReadFrameCached / ReadFrameInto 读出的帧、视频流读取器和视频头读取的原始字节
+// 在返回前原地解密；未设置时不做任何处理。
+// 流读取器和 VPS 扫描按帧索引确定每段字节所属的帧，不在任何帧内的字节（文件头、帧之间的空隙）不解密。
+// VPS 缓存的内容随解密设置变化，缓存文件名包含解密器的 CacheKey；没有实现 CacheKeyer 的解密器
+// 无法区分密钥，不使用 VPS 磁盘缓存
+
+// FrameDecryptor 帧负载解密器
+type FrameDecryptor interface {
+	// DecryptFrame 原地解密 frame 负载中从 offset 开始的 len(data) 字节
+	// （整帧读取时 offset 为 0；流读取器按块读取时一帧可能分多次解密）
+	DecryptFrame(data []byte, frame FrameIndexRecord, offset int) error
+}
+
+// CacheKeyer FrameDecryptor 可选实现的接口：CacheKey 标识解密结果依赖的设置（如密钥），
+// 不同设置必须返回不同的值，只能包含文件名可用的字符
+type CacheKeyer interface {
+	CacheKey() string
+}
+
+// decryptorHolder 包装接口值，使 atomic.Pointer 可以存储
+type decryptorHolder struct {
+	d FrameDecryptor
+}
+
+var frameDecryptor atomic.Pointer[decryptorHolder]
+
+// SetFrameDecryptor 设置帧负载解密器，nil 关闭解密
+// 应在加载 DVR 之前调用；缩略图等由帧数据生成的缓存不会随之更新
+func SetFrameDecryptor(d FrameDecryptor) {
+	if d == nil {
+		frameDecryptor.Store(nil)
+		return
+	}
+	frameDecryptor.Store(&decryptorHolder{d: d})
+}
+
+// GetFrameDecryptor 当前的帧负载解密器，未设置时返回 nil
+func GetFrameDecryptor() FrameDecryptor {
+	if h := frameDecryptor.Load(); h != nil {
+		return h.d
+	}
+	return nil
+}
+
+// decryptorCacheKey 当前解密设置在 VPS 缓存文件名中的后缀，未设置解密器时为空
+// 解密器没有实现 CacheKeyer 时 ok 为 false，不能使用磁盘缓存
+func decryptorCacheKey() (suffix string, ok bool) {
+	d := GetFrameDecryptor()
+	if d == nil {
+		return "", true
+	}
+	if k, isKeyer := d.(CacheKeyer); isKeyer {
+		return "-" + k.CacheKey(), true
+	}
+	return "", false
+}
+
+// decryptFrame 解密整帧数据，未设置解密器时直接返回
+func decryptFrame(data []byte, frame FrameIndexRecord) error {
+	h := frameDecryptor.Load()
+	if h == nil {
+		return nil
+	}
+	return h.d.DecryptFrame(data, frame, 0)
+}
+
+// decryptRange 解密从文件偏移 pos 开始的原始字节中落在帧负载内的部分
+// frames 按 FileOffset 升序；重叠的帧（重复的索引条目）只解密一次
+func decryptRange(d FrameDecryptor, frames []FrameIndexRecord, data []byte, pos int64) error {
+	end := pos + int64(len(data))
+	i := sort.Search(len(frames), func(i int) bool {
+		return int64(frames[i].FileOffset)+int64(frames[i].FrameSize) > pos
+	})
+	done := pos // 已解密到的文件偏移
+	for ; i < len(frames) && int64(frames[i].FileOffset) < end; i++ {
+		frame := frames[i]
+		from := max(done, int64(frame.FileOffset))
+		to := min(end, int64(frame.FileOffset)+int64(frame.FrameSize))
+		if from >= to {
+			continue
+		}
+		if err := d.DecryptFrame(data[from-pos:to-pos], frame, int(from-int64(frame.FileOffset))); err != nil {
+			return err
+		}
+		done = to
+	}
+	return nil
+}
+
+// decryptionFrames 未设置解密器时返回 nil，否则返回文件的帧索引（按 FileOffset 升序，不含超大帧）
+// 段落未缓存时解析帧索引
+func (s *TPSStorage) decryptionFrames(fileIndex int) []FrameIndexRecord {
+	if GetFrameDecryptor() == nil {
+		return nil
+	}
+	records := s.GetFrameIndex(fileIndex)
+	if records == nil {
+		recFile := s.GetRecFile(fileIndex)
+		if recFile == "" {
+			return nil
+		}
+		return fileDecryptionFrames(recFile)
+	}
+	return sortDecryptionFrames(records)
+}
+
+// fileDecryptionFrames 解析 recFilePath 的帧索引，返回 decryptRange 使用的帧（按 FileOffset 升序，不含超大帧）
+// 帧索引无法读取时返回 nil
+func fileDecryptionFrames(recFilePath string) []FrameIndexRecord {
+	records, err := ParseTRecFrameIndexWithCache(recFilePath)
+	if err != nil {
+		LogWarn("无法读取帧索引，帧数据不解密", "file", recFilePath, "error", err)
+		return nil
+	}
+	return sortDecryptionFrames(records)
+}
+
+// sortDecryptionFrames 去掉超大帧并按 FileOffset 排序（返回新切片）
+func sortDecryptionFrames(records []FrameIndexRecord) []FrameIndexRecord {
+	frames := make([]FrameIndexRecord, 0, len(records))
+	for _, r := range records {
+		if !isOversizedFrame(r) {
+			frames = append(frames, r)
+		}
+	}
+	sort.Slice(frames, func(i, j int) bool { return frames[i].FileOffset < frames[j].FileOffset })
+	return frames
+}
+
+// XORDecryptor 按帧循环 XOR 密钥：帧负载的第 i 个字节与 key[i%len(key)] 异或
+type XORDecryptor struct {
+	key []byte
+}
+
+// NewXORDecryptor 创建 XOR 解密器，key 不能为空
+func NewXORDecryptor(key []byte) (*XORDecryptor, error) {
+	if len(key) == 0 {
+		return nil, errors.New("empty XOR key")
+	}
+	return &XORDecryptor{key: append([]byte(nil), key...)}, nil
+}
+
+// CacheKey 密钥的摘要，不同密钥的 VPS 缓存互不混用
+func (x *XORDecryptor) CacheKey() string {
+	sum := sha256.Sum256(x.key)
+	return "xor" + hex.EncodeToString(sum[:8])
+}
+
+// DecryptFrame 原地解密
+func (x *XORDecryptor) DecryptFrame(data []byte, frame FrameIndexRecord, offset int) error {
+	k := offset % len(x.key)
+	for i := range data {
+		data[i] ^= x.key[k]
+		if k++; k == len(x.key) {
+			k = 0
+		}
+	}
+	return nil
+}
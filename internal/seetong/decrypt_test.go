@@ -0,0 +1,100 @@
+package seetong
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// scrambledFixture 帧负载按 key 循环异或后的合成录像
+func scrambledFixture(key []byte) *trecFixture {
+	f := newTRecFixture(4, 10)
+	for i, data := range f.Data {
+		scrambled := append([]byte(nil), data...)
+		for j := range scrambled {
+			scrambled[j] ^= key[j%len(key)]
+		}
+		f.Data[i] = scrambled
+	}
+	return f
+}
+
+// passthroughDecryptor 不实现 CacheKeyer 的解密器
+type passthroughDecryptor struct{}
+
+func (passthroughDecryptor) DecryptFrame(data []byte, frame FrameIndexRecord, offset int) error {
+	return nil
+}
+
+// cacheFiles 缓存目录中扩展名为 ext 的文件
+func cacheFiles(t *testing.T, ext string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(GetCacheDir(), "*"+ext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestVPSScanDecryptsFrames(t *testing.T) {
+	useTempCacheDir(t)
+	key := []byte{0xA5, 0x5A, 0x3C}
+	f := scrambledFixture(key)
+	s := openFixtureStorage(t, f)
+	recFile := s.GetRecFile(0)
+	var want []int
+	for _, r := range f.Frames {
+		if r.IsIFrame() {
+			want = append(want, int(r.FileOffset))
+		}
+	}
+
+	if got, err := ScanVPSPositions(recFile); err != nil || len(got) != 0 {
+		t.Fatalf("scan without a decryptor found %v (%v) in scrambled data", got, err)
+	}
+
+	xor, err := NewXORDecryptor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetFrameDecryptor(xor)
+	defer SetFrameDecryptor(nil)
+	got, err := ScanVPSPositionsWithCache(recFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("VPS at %v, want %v", got, want)
+	}
+	data, err := s.ReadFrame(0, f.Frames[0])
+	if err != nil || !bytes.Equal(data, fixtureIFrame(3000, 0)) {
+		t.Fatalf("first frame not decrypted (%v)", err)
+	}
+
+	// 缓存文件名随密钥变化
+	keyed := getVPSCachePath(recFile)
+	if _, err := os.Stat(keyed); err != nil {
+		t.Fatalf("no VPS cache for the key: %v", err)
+	}
+	other, _ := NewXORDecryptor([]byte{1, 2, 3})
+	SetFrameDecryptor(other)
+	if getVPSCachePath(recFile) == keyed {
+		t.Fatal("different XOR keys share a VPS cache file")
+	}
+	SetFrameDecryptor(nil)
+	if getVPSCachePath(recFile) == keyed {
+		t.Fatal("the decrypted scan shares the plain VPS cache file")
+	}
+
+	// 无法区分密钥的解密器不读写磁盘缓存
+	SetFrameDecryptor(passthroughDecryptor{})
+	before := len(cacheFiles(t, ".vpos"))
+	if got, err := ScanVPSPositionsWithCache(recFile); err != nil || len(got) != 0 {
+		t.Fatalf("scan with the passthrough decryptor found %v (%v)", got, err)
+	}
+	if after := len(cacheFiles(t, ".vpos")); after != before {
+		t.Fatalf("%d VPS cache files after scanning without a cache key, want %d", after, before)
+	}
+}
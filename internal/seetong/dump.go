@@ -0,0 +1,158 @@
+package seetong
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+)
+
+// ============================================================================
+// TRec 文件诊断
+// ============================================================================
+
+// TRecDump 单个 TRec 文件的诊断报告
+// 只包含索引统计，不包含录像数据，便于用户在问题报告中附带
+type TRecDump struct {
+	File             string         `json:"file"`
+	FileSize         int64          `json:"fileSize"`
+	FrameIndexOffset int64          `json:"frameIndexOffset"` // 未找到帧索引时为 -1
+	EntrySize        int            `json:"entrySize"`        // 帧索引条目大小（44 或 48）
+	EntryCount       int            `json:"entryCount"`
+	ValidCount       int            `json:"validCount"` // 通过时间戳和通道过滤的记录数
+	Channels         map[uint32]int `json:"channels"`
+	FrameTypes       map[uint32]int `json:"frameTypes"`
+	FirstTimestamp   int64          `json:"firstTimestamp"`
+	LastTimestamp    int64          `json:"lastTimestamp"`
+	FirstTimestampUs uint64         `json:"firstTimestampUs"`
+	LastTimestampUs  uint64         `json:"lastTimestampUs"`
+	TimestampRuns    int            `json:"timestampRuns"`
+	IFrameCount      int            `json:"iFrameCount"`
+	VPSCount         int            `json:"vpsCount"`
+	ReservedNonZero  int            `json:"reservedNonZero"`          // 保留字节不全为 0 的有效记录数
+	ReservedSample   string         `json:"reservedSample,omitempty"` // 第一条非零保留字节（十六进制）
+	FrameTypeCheck   FrameTypeCheck `json:"frameTypeCheck"`           // 帧类型与帧数据的抽样核对（不改写报告中的统计）
+	Anomalies        []string       `json:"anomalies"`
+}
+
+// DumpTRecFile 生成 TRec 文件诊断报告
+func DumpTRecFile(recFilePath string) (*TRecDump, error) {
+	info, err := statFile(recFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	layout, entries, err := ReadTRecFrameIndexLayout(recFilePath, cachedIndexLayout(recFilePath))
+	if err != nil {
+		return nil, err
+	}
+
+	dump := &TRecDump{
+		File:             filepath.Base(recFilePath),
+		FileSize:         info.Size(),
+		FrameIndexOffset: layout.Start,
+		EntrySize:        layout.Stride,
+		EntryCount:       len(entries),
+		Channels:         make(map[uint32]int),
+		FrameTypes:       make(map[uint32]int),
+		Anomalies:        []string{},
+	}
+	anomaly := func(format string, args ...interface{}) {
+		dump.Anomalies = append(dump.Anomalies, fmt.Sprintf(format, args...))
+	}
+
+	if info.Size() != TRecFileSize {
+		anomaly("文件大小 %d 不是标准的 %d 字节", info.Size(), TRecFileSize)
+	}
+	if layout.Start < 0 {
+		anomaly("未找到帧索引 (magic 0x%08X)", TRecFrameIndexMagic)
+	}
+
+	var valid []FrameIndexRecord
+	invalidTs, unknownChannel, outOfBounds, emptyFrames := 0, 0, 0, 0
+	for _, r := range entries {
+		dump.Channels[r.Channel]++
+		dump.FrameTypes[r.FrameType]++
+
+		switch {
+		case r.Channel != ChannelVideo1 && r.Channel != ChannelAudio && r.Channel != ChannelVideo2:
+			unknownChannel++
+			continue
+		case !isValidTimestamp(int64(r.UnixTs)):
+			invalidTs++
+			continue
+		}
+		valid = append(valid, r)
+
+		if r.FrameSize == 0 {
+			emptyFrames++
+		} else if int64(r.FileOffset)+int64(r.FrameSize) > TRecIndexRegionStart {
+			outOfBounds++
+		}
+		if r.Channel != ChannelAudio && r.FrameType == FrameTypeI {
+			dump.IFrameCount++
+		}
+		if r.Reserved != [8]byte{} {
+			if dump.ReservedNonZero == 0 {
+				dump.ReservedSample = hex.EncodeToString(r.Reserved[:])
+			}
+			dump.ReservedNonZero++
+		}
+
+		ts := int64(r.UnixTs)
+		if dump.FirstTimestamp == 0 || ts < dump.FirstTimestamp {
+			dump.FirstTimestamp = ts
+		}
+		if ts > dump.LastTimestamp {
+			dump.LastTimestamp = ts
+		}
+		if dump.FirstTimestampUs == 0 || r.TimestampUs < dump.FirstTimestampUs {
+			dump.FirstTimestampUs = r.TimestampUs
+		}
+		if r.TimestampUs > dump.LastTimestampUs {
+			dump.LastTimestampUs = r.TimestampUs
+		}
+	}
+	dump.ValidCount = len(valid)
+	dump.TimestampRuns = len(splitMonotonicRuns(valid))
+
+	if unknownChannel > 0 {
+		anomaly("%d 条记录通道未知", unknownChannel)
+	}
+	if invalidTs > 0 {
+		anomaly("%d 条记录时间戳无效", invalidTs)
+	}
+	if emptyFrames > 0 {
+		anomaly("%d 帧大小为 0", emptyFrames)
+	}
+	if outOfBounds > 0 {
+		anomaly("%d 帧超出数据区域", outOfBounds)
+	}
+	if dump.TimestampRuns > 1 {
+		anomaly("时间戳重置 %d 次", dump.TimestampRuns-1)
+	}
+
+	dump.FrameTypeCheck = checkFrameTypes(recFilePath, valid)
+	if n := dump.FrameTypeCheck.Mismatches; n > 0 {
+		anomaly("%d/%d 个抽样帧的帧类型与帧数据不一致", n, dump.FrameTypeCheck.Sampled)
+	}
+	for from, to := range dump.FrameTypeCheck.Remapped {
+		anomaly("帧类型 %d 的帧数据实际为 %s，解析时改写为 %d", from, map[bool]string{true: "I 帧", false: "P 帧"}[to == FrameTypeI], to)
+	}
+
+	vpsPositions, err := ScanVPSPositions(recFilePath)
+	if err != nil {
+		anomaly("VPS 扫描失败: %v", err)
+	}
+	dump.VPSCount = len(vpsPositions)
+
+	switch {
+	case len(valid) > 0 && dump.IFrameCount == 0:
+		anomaly("帧索引中没有 I 帧")
+	case dump.VPSCount == 0:
+		anomaly("数据区域中没有找到 VPS")
+	case dump.VPSCount != dump.IFrameCount:
+		anomaly("VPS 数量 (%d) 与 I 帧数量 (%d) 不一致", dump.VPSCount, dump.IFrameCount)
+	}
+
+	return dump, nil
+}
@@ -0,0 +1,227 @@
+package seetong
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ============================================================================
+// 测试用的合成录像
+// ============================================================================
+
+// 测试不依赖真实的 DVR 数据：TRec 文件按设备的布局写成 256MB 稀疏文件（帧数据和帧索引之外全是空洞），
+// TIndex00.tps 只写文件头和段落条目
+
+// fixtureUnixTs 合成录像第一帧的 Unix 时间（2023-11-14 22:13:20 UTC）
+const fixtureUnixTs = 1700000000
+
+// fixtureHeaderSize 合成 TRec 文件第一帧之前的文件头大小
+const fixtureHeaderSize = 0x200
+
+// fixtureNal 起始码 + 两字节 NAL 头 + size 字节负载；负载不含 0x00，不会出现起始码
+func fixtureNal(startCode []byte, nalType, size, seed int) []byte {
+	nal := append([]byte(nil), startCode...)
+	nal = append(nal, byte(nalType<<1), 0x01)
+	for i := 0; i < size; i++ {
+		nal = append(nal, byte(0x10+(i*7+seed)%0xE0))
+	}
+	return nal
+}
+
+// fixtureIFrame VPS/SPS/PPS 和 IDR 组成的 I 帧，IDR 负载为 size 字节
+func fixtureIFrame(size, seed int) []byte {
+	return fixtureIFrameWith(NalStartCode4, size, seed)
+}
+
+// fixtureIFrameWith 与 fixtureIFrame 相同，NAL 使用 startCode
+func fixtureIFrameWith(startCode []byte, size, seed int) []byte {
+	var data []byte
+	data = append(data, fixtureNal(startCode, NalVPS, 20, seed)...)
+	data = append(data, fixtureNal(startCode, NalSPS, 30, seed)...)
+	data = append(data, fixtureNal(startCode, NalPPS, 6, seed)...)
+	return append(data, fixtureNal(startCode, NalIDRWRadl, size, seed)...)
+}
+
+// fixturePFrame 单个 TRAIL_R 的 P 帧
+func fixturePFrame(size, seed int) []byte {
+	return fixturePFrameWith(NalStartCode4, size, seed)
+}
+
+// fixturePFrameWith 与 fixturePFrame 相同，NAL 使用 startCode
+func fixturePFrameWith(startCode []byte, size, seed int) []byte {
+	return fixtureNal(startCode, NalTrailR, size, seed)
+}
+
+// fixtureAudioFrame G.711 音频帧（不含起始码）
+func fixtureAudioFrame(size, seed int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(0xD5 ^ (i+seed)%0x20)
+	}
+	return data
+}
+
+// trecFixture 合成的 TRec 文件内容
+type trecFixture struct {
+	Header     []byte
+	Frames     []FrameIndexRecord // 按写入顺序，即帧索引中的顺序
+	Data       [][]byte           // 与 Frames 一一对应
+	IndexStart int64              // 帧索引的文件偏移，0 为 TRecIndexRegionStart
+	Stride     int                // 条目大小，0 为 44
+}
+
+// newTRecFixture 生成 gops 个 GOP 的录像：每个 GOP 一个 I 帧和 framesPerGOP-1 个 P 帧，
+// 每帧视频之后一帧音频，视频 25fps；帧数据从文件头之后连续存放
+func newTRecFixture(gops, framesPerGOP int) *trecFixture {
+	return newTRecFixtureWith(NalStartCode4, gops, framesPerGOP)
+}
+
+// newTRecFixtureWith 与 newTRecFixture 相同，视频 NAL 使用 startCode（部分固件写 3 字节起始码）
+func newTRecFixtureWith(startCode []byte, gops, framesPerGOP int) *trecFixture {
+	f := &trecFixture{Header: make([]byte, fixtureHeaderSize)}
+	copy(f.Header, "TREC-FIXTURE")
+	for i := 0; i < gops*framesPerGOP; i++ {
+		tsUs := uint64(i) * 40000
+		unix := uint32(fixtureUnixTs + i/25)
+		if i%framesPerGOP == 0 {
+			f.add(FrameIndexRecord{FrameType: FrameTypeI, Channel: ChannelVideo1, TimestampUs: tsUs, UnixTs: unix}, fixtureIFrameWith(startCode, 3000+i%5*100, i))
+		} else {
+			f.add(FrameIndexRecord{FrameType: FrameTypeP, Channel: ChannelVideo1, TimestampUs: tsUs, UnixTs: unix}, fixturePFrameWith(startCode, 400+i%7*30, i))
+		}
+		f.add(FrameIndexRecord{Channel: ChannelAudio, TimestampUs: tsUs, UnixTs: unix}, fixtureAudioFrame(320, i))
+	}
+	return f
+}
+
+// add 在已有帧之后追加一帧，FileOffset、FrameSize 和 FrameSeq 按位置计算
+func (f *trecFixture) add(r FrameIndexRecord, data []byte) {
+	offset := int64(len(f.Header))
+	if n := len(f.Frames); n > 0 {
+		offset = int64(f.Frames[n-1].FileOffset) + int64(f.Frames[n-1].FrameSize)
+	}
+	r.FileOffset = uint32(offset)
+	r.FrameSize = uint32(len(data))
+	r.FrameSeq = uint32(len(f.Frames))
+	f.Frames = append(f.Frames, r)
+	f.Data = append(f.Data, data)
+}
+
+// indexStart 帧索引的文件偏移
+func (f *trecFixture) indexStart() int64 {
+	if f.IndexStart > 0 {
+		return f.IndexStart
+	}
+	return TRecIndexRegionStart
+}
+
+// stride 帧索引条目大小
+func (f *trecFixture) stride() int {
+	if f.Stride > 0 {
+		return f.Stride
+	}
+	return TRecFrameIndexSize
+}
+
+// entryOffset 第 i 条帧索引条目的文件偏移
+func (f *trecFixture) entryOffset(i int) int64 {
+	return f.indexStart() + int64(i*f.stride())
+}
+
+// index 编码的帧索引；48 字节条目末尾的 4 字节填充为 0
+func (f *trecFixture) index() []byte {
+	stride := f.stride()
+	data := make([]byte, len(f.Frames)*stride)
+	for i, r := range f.Frames {
+		encodeFrameIndexRecord(data[i*stride:], r)
+	}
+	return data
+}
+
+// write 把录像写到 path：256MB 稀疏文件，文件头、帧数据和帧索引写在各自的偏移
+func (f *trecFixture) write(t testing.TB, path string) string {
+	t.Helper()
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if err := out.Truncate(TRecFileSize); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := out.WriteAt(f.Header, 0); err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range f.Frames {
+		if _, err := out.WriteAt(f.Data[i], int64(r.FileOffset)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := out.WriteAt(f.index(), f.indexStart()); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fixtureSegment 合成录像对应的段落（开始、结束时间取首末帧的 UnixTs）
+func (f *trecFixture) segment(fileIndex int) SegmentRecord {
+	return SegmentRecord{
+		FileIndex:  fileIndex,
+		Channel:    1,
+		StartTime:  int64(f.Frames[0].UnixTs),
+		EndTime:    int64(f.Frames[len(f.Frames)-1].UnixTs) + 1,
+		FrameCount: len(f.Frames),
+	}
+}
+
+// putTIndexEntry 在主索引条目 entry 中写入段落
+func putTIndexEntry(entry []byte, seg SegmentRecord) {
+	entry[4] = byte(seg.Channel)
+	binary.LittleEndian.PutUint16(entry[6:8], uint16(seg.FrameCount))
+	binary.LittleEndian.PutUint32(entry[8:12], uint32(seg.StartTime))
+	binary.LittleEndian.PutUint32(entry[12:16], uint32(seg.EndTime))
+}
+
+// writeTIndexFixture 写主索引：文件头的条目数为 headerEntries，文件容纳 slots 个条目，
+// 段落写在各自 FileIndex 对应的条目，其余条目为零（无效）
+func writeTIndexFixture(t testing.TB, path string, segments []SegmentRecord, headerEntries uint32, slots int) string {
+	t.Helper()
+	data := make([]byte, SegmentIndexOffset+slots*EntrySize)
+	binary.LittleEndian.PutUint32(data[0:4], TPSIndexMagic)
+	binary.LittleEndian.PutUint32(data[0x10:0x14], uint32(len(segments)))
+	binary.LittleEndian.PutUint32(data[0x14:0x18], headerEntries)
+	for _, seg := range segments {
+		off := SegmentIndexOffset + seg.FileIndex*EntrySize
+		putTIndexEntry(data[off:off+EntrySize], seg)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeDVRFixture 在临时目录写一个只有一个 TRec 文件的 DVR，返回目录和 TRec 文件路径
+func writeDVRFixture(t testing.TB, f *trecFixture) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	recFile := f.write(t, filepath.Join(dir, "TRec000000.tps"))
+	writeTIndexFixture(t, filepath.Join(dir, "TIndex00.tps"), []SegmentRecord{f.segment(0)}, 1, 4)
+	return dir, recFile
+}
+
+// useTempCacheDir 测试期间把缓存目录换成临时目录
+func useTempCacheDir(t testing.TB) string {
+	t.Helper()
+	dir := t.TempDir()
+	cacheDirMu.Lock()
+	old := cacheDir
+	cacheDirMu.Unlock()
+	SetCacheDir(dir)
+	t.Cleanup(func() {
+		cacheDirMu.Lock()
+		cacheDir = old
+		cacheDirMu.Unlock()
+	})
+	return dir
+}
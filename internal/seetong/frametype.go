@@ -0,0 +1,152 @@
+package seetong
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// ============================================================================
+// 帧类型校正
+// ============================================================================
+
+// 帧索引的 FrameType 来自设备，本项目按 FrameTypeI=1 / FrameTypeP=3 理解。
+// 个别固件的编号不同（例如 I/P 对调），此时按 I 帧定位的 seek 会落在 P 帧上，
+// 解码器在下一个 I 帧之前只能显示灰屏。解析时对每种帧类型取值抽样读取帧数据，
+// 按实际的 NAL 类型（VPS/IRAP 或 TRAIL）判断该取值代表 I 帧还是 P 帧，必要时改写整个文件的 FrameType
+
+const (
+	frameTypeSamples   = 16   // 每种帧类型取值最多抽样的帧数
+	frameTypeProbeSize = 1024 // 每帧读取的字节数，足够覆盖 VPS/SPS/PPS 和第一个 VCL NAL 的头
+)
+
+// IsIFrame 帧索引记录是否为视频 I 帧（本项目判断 I 帧的唯一依据）
+func (r FrameIndexRecord) IsIFrame() bool {
+	return r.Channel != ChannelAudio && r.FrameType == FrameTypeI
+}
+
+// FrameTypeCheck 帧类型抽样校验的结果
+type FrameTypeCheck struct {
+	Sampled    int               `json:"sampled"`
+	Mismatches int               `json:"mismatches"`         // 帧数据与 FrameType 不一致的抽样帧数
+	Remapped   map[uint32]uint32 `json:"remapped,omitempty"` // 改写的帧类型取值（原值 -> 新值）
+}
+
+// isKeyframeData 帧数据是否以关键帧开始：第一个 VCL NAL 之前出现 VPS，或第一个 VCL NAL 为 IRAP
+// 数据中没有可识别的 NAL 时 ok 为 false
+func isKeyframeData(data []byte) (key, ok bool) {
+	for _, nal := range ParseNalUnits(data) {
+		switch {
+		case nal.NalType == NalVPS:
+			return true, true
+		case nal.NalType >= 16 && nal.NalType <= 23: // BLA/IDR/CRA
+			return true, true
+		case nal.NalType < 16:
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// checkFrameTypes 抽样读取帧数据，核对每种视频帧类型取值代表的是 I 帧还是 P 帧
+// 返回校验结果；多数抽样帧与当前理解相反的取值记入 Remapped
+func checkFrameTypes(recFilePath string, records []FrameIndexRecord) FrameTypeCheck {
+	check := FrameTypeCheck{}
+	byType := make(map[uint32][]int)
+	for i, r := range records {
+		if r.Channel != ChannelAudio && r.FrameSize > 0 {
+			byType[r.FrameType] = append(byType[r.FrameType], i)
+		}
+	}
+	if len(byType) == 0 {
+		return check
+	}
+
+	f, err := OpenRecFile(recFilePath)
+	if err != nil {
+		return check
+	}
+	defer f.Close()
+
+	types := make([]uint32, 0, len(byType))
+	for t := range byType {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	buf := make([]byte, frameTypeProbeSize)
+	for _, t := range types {
+		indices := byType[t]
+		step := len(indices)/frameTypeSamples + 1
+		keys, probed := 0, 0
+		for j := 0; j < len(indices); j += step {
+			r := records[indices[j]]
+			n := int(r.FrameSize)
+			if n > len(buf) {
+				n = len(buf)
+			}
+			if err := readFull(f, buf[:n], int64(r.FileOffset)); err != nil {
+				continue
+			}
+			if err := decryptFrame(buf[:n], r); err != nil {
+				continue
+			}
+			key, ok := isKeyframeData(buf[:n])
+			if !ok {
+				continue
+			}
+			probed++
+			if key {
+				keys++
+			}
+			if key != r.IsIFrame() {
+				check.Mismatches++
+				LogDebug("帧类型与帧数据不一致",
+					"file", filepath.Base(recFilePath),
+					"offset", r.FileOffset,
+					"frameType", r.FrameType,
+					"keyframeData", key)
+			}
+		}
+		check.Sampled += probed
+		if probed == 0 {
+			continue
+		}
+
+		// 多数抽样帧的实际类型决定该取值的含义
+		want := uint32(FrameTypeP)
+		if keys*2 > probed {
+			want = FrameTypeI
+		}
+		if (t == FrameTypeI) != (want == FrameTypeI) {
+			if check.Remapped == nil {
+				check.Remapped = make(map[uint32]uint32)
+			}
+			check.Remapped[t] = want
+		}
+	}
+	return check
+}
+
+// normalizeFrameTypes 校验并按需改写帧类型，使 FrameTypeI 总是表示 I 帧
+func normalizeFrameTypes(recFilePath string, records []FrameIndexRecord) FrameTypeCheck {
+	check := checkFrameTypes(recFilePath, records)
+	if check.Mismatches > 0 {
+		LogWarn("帧类型与帧数据不一致",
+			"file", filepath.Base(recFilePath),
+			"sampled", check.Sampled,
+			"mismatches", check.Mismatches,
+			"remapped", check.Remapped)
+	}
+	if len(check.Remapped) == 0 {
+		return check
+	}
+	for i := range records {
+		if records[i].Channel == ChannelAudio {
+			continue
+		}
+		if t, ok := check.Remapped[records[i].FrameType]; ok {
+			records[i].FrameType = t
+		}
+	}
+	return check
+}
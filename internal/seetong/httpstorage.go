@@ -0,0 +1,238 @@
+package seetong
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// HTTP 存储后端
+// ============================================================================
+
+// HTTPStorage 通过 HTTP Range 请求读取录像文件（概念验证）
+// 把 root 目录映射到 baseURL：root/TRec000000.tps 读取 baseURL/TRec000000.tps。
+// Stat 使用 HEAD（Content-Length、Last-Modified），ReadAt 使用 Range GET，
+// ReadDir 解析目录页中的链接（nginx autoindex、python -m http.server 等）
+type HTTPStorage struct {
+	base   *url.URL
+	root   string
+	client *http.Client
+}
+
+// httpStorageTimeout 单个 HTTP 请求的超时
+const httpStorageTimeout = 30 * time.Second
+
+// NewHTTPStorage 创建 HTTP 存储后端，root 一般为配置的 DVR 路径
+func NewHTTPStorage(baseURL, root string) (*HTTPStorage, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("不支持的存储地址: %s", baseURL)
+	}
+	if root == "" {
+		return nil, fmt.Errorf("HTTP 存储需要指定映射的 DVR 路径")
+	}
+	return &HTTPStorage{
+		base:   u,
+		root:   filepath.Clean(root),
+		client: &http.Client{Timeout: httpStorageTimeout},
+	}, nil
+}
+
+// resolve 把本地路径转换为 URL，不在 root 之下的路径视为不存在
+func (s *HTTPStorage) resolve(op, name string) (string, error) {
+	rel, err := filepath.Rel(s.root, filepath.Clean(name))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	u := *s.base
+	u.Path = path.Join("/", u.Path, filepath.ToSlash(rel))
+	if rel == "." {
+		u.Path += "/"
+	}
+	return u.String(), nil
+}
+
+// statusError 把 HTTP 状态码转换为错误，404 对应 fs.ErrNotExist
+func statusError(op, name string, resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("HTTP %s", resp.Status)}
+}
+
+// Stat 通过 HEAD 请求获取文件大小和修改时间
+func (s *HTTPStorage) Stat(name string) (fs.FileInfo, error) {
+	target, err := s.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Head(target)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("stat", name, resp)
+	}
+
+	info := &httpFileInfo{
+		name: filepath.Base(name),
+		size: resp.ContentLength,
+		dir:  strings.HasSuffix(target, "/"),
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.modTime = t
+	}
+	return info, nil
+}
+
+// Open 打开远程文件，文件大小在打开时确定
+func (s *HTTPStorage) Open(name string) (File, error) {
+	info, err := s.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	target, _ := s.resolve("open", name)
+	return &httpFile{storage: s, name: name, url: target, size: info.Size()}, nil
+}
+
+// hrefPattern 目录页中的链接
+var hrefPattern = regexp.MustCompile(`(?i)href="([^"?#]+)"`)
+
+// ReadDir 解析目录页中的相对链接，以 / 结尾的链接为子目录
+// 返回的条目不含文件大小，需要时逐个 Stat
+func (s *HTTPStorage) ReadDir(name string) ([]fs.DirEntry, error) {
+	target, err := s.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(target, "/") {
+		target += "/"
+	}
+	resp, err := s.client.Get(target)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("readdir", name, resp)
+	}
+	page, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	seen := make(map[string]bool)
+	var entries []fs.DirEntry
+	for _, m := range hrefPattern.FindAllSubmatch(page, -1) {
+		link, err := url.PathUnescape(string(m[1]))
+		if err != nil || strings.Contains(link, "://") || strings.HasPrefix(link, "/") {
+			continue
+		}
+		dir := strings.HasSuffix(link, "/")
+		link = strings.TrimSuffix(link, "/")
+		if link == "" || link == "." || link == ".." || strings.Contains(link, "/") || seen[link] {
+			continue
+		}
+		seen[link] = true
+		entries = append(entries, fs.FileInfoToDirEntry(&httpFileInfo{name: link, dir: dir}))
+	}
+	return entries, nil
+}
+
+// httpFile 远程文件，每次 ReadAt 发送一个 Range 请求
+type httpFile struct {
+	storage *HTTPStorage
+	name    string
+	url     string
+	size    int64
+}
+
+// ReadAt 读取 [off, off+len(p))，超出文件末尾的部分返回 io.EOF
+// 服务器忽略 Range 返回整个文件时跳过 off 之前的数据
+func (f *httpFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if off >= f.size {
+		return 0, io.EOF
+	}
+	want := int64(len(p))
+	if off+want > f.size {
+		want = f.size - off
+	}
+	if want == 0 {
+		return 0, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, f.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", "bytes="+strconv.FormatInt(off, 10)+"-"+strconv.FormatInt(off+want-1, 10))
+	resp, err := f.storage.client.Do(req)
+	if err != nil {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		if _, err := io.CopyN(io.Discard, resp.Body, off); err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.name, Err: err}
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		return 0, io.EOF
+	default:
+		return 0, statusError("read", f.name, resp)
+	}
+
+	n, err := io.ReadFull(resp.Body, p[:want])
+	if err != nil {
+		return n, &fs.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	if want < int64(len(p)) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Close 远程文件没有需要释放的连接
+func (f *httpFile) Close() error { return nil }
+
+// httpFileInfo 远程文件信息
+type httpFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i *httpFileInfo) Name() string       { return i.name }
+func (i *httpFileInfo) Size() int64        { return i.size }
+func (i *httpFileInfo) ModTime() time.Time { return i.modTime }
+func (i *httpFileInfo) IsDir() bool        { return i.dir }
+func (i *httpFileInfo) Sys() any           { return nil }
+
+func (i *httpFileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
@@ -0,0 +1,277 @@
+package seetong
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// byFileOffset 按 FileOffset 排序的副本（解析结果按时间排序，视频和音频帧的时间相同）
+func byFileOffset(records []FrameIndexRecord) []FrameIndexRecord {
+	sorted := append([]FrameIndexRecord(nil), records...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].FileOffset < sorted[j].FileOffset })
+	return sorted
+}
+
+// checkFrameIndex 比较解析出的帧索引与合成录像的帧
+func checkFrameIndex(t *testing.T, got, want []FrameIndexRecord) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("parsed %d records, want %d", len(got), len(want))
+	}
+	got, want = byFileOffset(got), byFileOffset(want)
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Fatalf("record %d: %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFrameIndexStride(t *testing.T) {
+	for _, stride := range []int{TRecFrameIndexSize, TRecFrameIndexSizeWide} {
+		t.Run(fmt.Sprint(stride), func(t *testing.T) {
+			useTempCacheDir(t)
+			f := newTRecFixture(4, 10)
+			f.Stride = stride
+			recFile := f.write(t, filepath.Join(t.TempDir(), "TRec000000.tps"))
+
+			want := IndexLayout{Start: TRecIndexRegionStart, Stride: stride}
+			layout, raw, err := ReadTRecFrameIndexLayout(recFile, IndexLayout{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if layout != want {
+				t.Fatalf("layout %+v, want %+v", layout, want)
+			}
+			if !reflect.DeepEqual(raw, f.Frames) {
+				t.Fatalf("raw index has %d records, want the %d written", len(raw), len(f.Frames))
+			}
+
+			records, err := ParseTRecFrameIndexWithCache(recFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkFrameIndex(t, records, f.Frames)
+
+			header, err := os.ReadFile(getCachePath(recFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := binary.LittleEndian.Uint32(header[cacheStrideOffset:]); got != uint32(stride) {
+				t.Fatalf("cache header stride %d, want %d", got, stride)
+			}
+			if got := headerLayout(header); got != want {
+				t.Fatalf("cache header layout %+v, want %+v", got, want)
+			}
+			if got := cachedIndexLayout(recFile); got != want {
+				t.Fatalf("cached layout %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestFrameIndexBeyondSearchWindow(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		searchSize int64
+		offset     int64 // 索引相对 TRecIndexRegionStart 的偏移
+	}{
+		{"just past the default window", 0, DefaultIndexSearchSize + 16},
+		{"magic across the window boundary", 0, DefaultIndexSearchSize - 2},
+		{"after several doublings", 1 << 20, 5<<20 + 44},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			useTempCacheDir(t)
+			if tc.searchSize > 0 {
+				SetIndexSearchSize(tc.searchSize)
+				defer SetIndexSearchSize(0)
+			}
+			f := newTRecFixture(4, 10)
+			f.IndexStart = TRecIndexRegionStart + tc.offset
+			recFile := f.write(t, filepath.Join(t.TempDir(), "TRec000000.tps"))
+
+			records, err := ParseTRecFrameIndexWithCache(recFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkFrameIndex(t, records, f.Frames)
+			want := IndexLayout{Start: f.IndexStart, Stride: TRecFrameIndexSize}
+			if got := cachedIndexLayout(recFile); got != want {
+				t.Fatalf("cached layout %+v, want %+v", got, want)
+			}
+
+			// 按缓存的布局重新解析时不再搜索：没有任何搜索窗口大小的读取
+			st := &countingStorage{minRead: int(getIndexSearchSize()), maxRead: 1 << 40}
+			SetStorage(st)
+			defer SetStorage(nil)
+			records, layout, err := parseTRecFrameIndex(recFile, cachedIndexLayout(recFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkFrameIndex(t, records, f.Frames)
+			if layout != want {
+				t.Fatalf("re-parse layout %+v, want %+v", layout, want)
+			}
+			if st.peak.Load() > 0 {
+				t.Fatal("re-parsing with the cached layout searched for the index")
+			}
+		})
+	}
+}
+
+// corruptFile 用 0xAA 覆盖 path 中 [off, off+n)（模拟坏扇区）
+func corruptFile(t *testing.T, path string, off int64, n int) {
+	t.Helper()
+	out, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	garbage := make([]byte, n)
+	for i := range garbage {
+		garbage[i] = 0xAA
+	}
+	if _, err := out.WriteAt(garbage, off); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFrameIndexResync(t *testing.T) {
+	f := newTRecFixture(10, 25) // 500 条
+	for _, tc := range []struct {
+		name    string
+		resync  bool
+		corrupt []int // 损坏的条目（整条覆盖）
+		sector  bool  // 从第一个损坏条目开始覆盖 512 字节
+		want    int   // 解析到的条目数
+	}{
+		{"single corrupt entry", true, []int{250}, false, 499},
+		{"bad sector", true, []int{250}, true, 500 - 12}, // 512 字节覆盖第 250 到 261 条
+		{"resync disabled", false, []int{250}, false, 250},
+		// 第 17 处损坏超过 maxIndexResyncs，之后的条目被忽略
+		{"resync cap", true, func() []int {
+			var entries []int
+			for i := 0; i <= maxIndexResyncs; i++ {
+				entries = append(entries, 100+i*20)
+			}
+			return entries
+		}(), false, 100 + maxIndexResyncs*20 - maxIndexResyncs},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			useTempCacheDir(t)
+			SetIndexResync(tc.resync)
+			defer SetIndexResync(false)
+			recFile := f.write(t, filepath.Join(t.TempDir(), "TRec000000.tps"))
+			lost := make(map[uint32]bool)
+			for _, i := range tc.corrupt {
+				if tc.sector {
+					corruptFile(t, recFile, f.entryOffset(i), 512)
+					for j := i; f.entryOffset(j) < f.entryOffset(i)+512; j++ {
+						lost[f.Frames[j].FrameSeq] = true
+					}
+				} else {
+					corruptFile(t, recFile, f.entryOffset(i), f.stride())
+					lost[f.Frames[i].FrameSeq] = true
+				}
+			}
+
+			_, raw, err := ReadTRecFrameIndexRaw(recFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(raw) != tc.want {
+				t.Fatalf("read %d entries, want %d", len(raw), tc.want)
+			}
+			var want []FrameIndexRecord
+			for _, r := range f.Frames {
+				if !lost[r.FrameSeq] && len(want) < tc.want {
+					want = append(want, r)
+				}
+			}
+			if !reflect.DeepEqual(raw, want) {
+				t.Fatal("recovered entries differ from the written ones")
+			}
+
+			records, err := ParseTRecFrameIndex(recFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkFrameIndex(t, records, want)
+		})
+	}
+}
+
+// resetFixture 第 reset 条之后（按文件顺序）的条目时间基回退一天，模拟设备时钟中途重置
+func resetFixture(reset int) *trecFixture {
+	f := newTRecFixture(10, 25) // 500 条，10 秒
+	for i := reset; i < len(f.Frames); i++ {
+		f.Frames[i].UnixTs -= 86400
+	}
+	return f
+}
+
+func TestFrameIndexTimestampReset(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		reset     int
+		keepFirst bool // 保留重置之前的时间段
+	}{
+		{"reset after most frames", 300, true},
+		{"reset after few frames", 100, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			useTempCacheDir(t)
+			f := resetFixture(tc.reset)
+			recFile := f.write(t, filepath.Join(t.TempDir(), "TRec000000.tps"))
+
+			_, raw, err := ReadTRecFrameIndexRaw(recFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			runs := splitMonotonicRuns(raw)
+			if len(runs) != 2 || len(runs[0]) != tc.reset || len(runs[1]) != len(raw)-tc.reset {
+				var sizes []int
+				for _, run := range runs {
+					sizes = append(sizes, len(run))
+				}
+				t.Fatalf("runs of %v entries, want [%d %d]", sizes, tc.reset, len(raw)-tc.reset)
+			}
+
+			want, dropped := f.Frames[tc.reset:], tc.reset
+			if tc.keepFirst {
+				want, dropped = f.Frames[:tc.reset], len(f.Frames)-tc.reset
+			}
+			if got := dominantRun(runs); !reflect.DeepEqual(got, want) {
+				t.Fatalf("dominant run has %d entries starting at %d, want the %d entries starting at %d",
+					len(got), got[0].FrameSeq, len(want), want[0].FrameSeq)
+			}
+
+			records, err := ParseTRecFrameIndex(recFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(f.Frames) - len(records); n != dropped {
+				t.Fatalf("dropped %d records, want %d", n, dropped)
+			}
+			checkFrameIndex(t, records, want)
+		})
+	}
+}
+
+func TestSplitMonotonicRunsToleratesSmallRegressions(t *testing.T) {
+	f := newTRecFixture(4, 25)
+	// 回退不超过 TimestampResetThreshold 时不切分（B 帧、时钟微调）
+	f.Frames[52].UnixTs -= TimestampResetThreshold
+	if runs := splitMonotonicRuns(f.Frames); len(runs) != 1 {
+		t.Fatalf("%d runs after a %ds regression, want 1", len(runs), TimestampResetThreshold)
+	}
+	// 超过阈值时从该条目开始新的时间段
+	f.Frames[52].UnixTs--
+	if runs := splitMonotonicRuns(f.Frames); len(runs) != 2 || len(runs[0]) != 52 {
+		t.Fatalf("%d runs after a %ds regression, want 2 split at entry 52", len(runs), TimestampResetThreshold+1)
+	}
+}
@@ -0,0 +1,145 @@
+package seetong
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// ============================================================================
+// TRec 文件字节布局
+// ============================================================================
+
+// ByteRange 文件中的字节范围 [Start, End)
+type ByteRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// TRecIndexLayout 帧索引的位置和条目格式
+type TRecIndexLayout struct {
+	Magic       string    `json:"magic"`       // 每个条目开头的 magic（十六进制）
+	SearchStart int64     `json:"searchStart"` // 从这里开始搜索首个条目
+	Offset      int64     `json:"offset"`      // 首个条目的文件偏移，未找到时为 -1
+	EntrySize   int       `json:"entrySize"`   // 条目大小（44 或 48）
+	EntryCount  int       `json:"entryCount"`  // 读到的条目数（含通道未知、时间戳无效的条目）
+	Entries     ByteRange `json:"entries"`     // 条目连续存放时占用的范围（跳过损坏条目时实际更靠后）
+}
+
+// TRecDataLayout 帧数据区域
+type TRecDataLayout struct {
+	Region     ByteRange `json:"region"`     // 帧数据可以使用的范围（文件开头到索引区域）
+	HeaderSize int64     `json:"headerSize"` // 第一帧之前的字节数（文件头），没有帧时为 0
+	Used       ByteRange `json:"used"`       // 第一帧开始到最后一帧结束，没有帧时为 0-0
+	FrameBytes int64     `json:"frameBytes"` // 帧大小之和
+	Frames     int       `json:"frames"`     // 有效帧数（已知通道、时间戳有效、不超过数据区域）
+}
+
+// TRecVPSCoverage VPS 扫描的范围和结果
+type TRecVPSCoverage struct {
+	Scanned        ByteRange `json:"scanned"` // 扫描的范围（整个数据区域）
+	Count          int       `json:"count"`
+	First          int64     `json:"first"` // 第一个 VPS 的起始码位置，没有时为 -1
+	Last           int64     `json:"last"`
+	IFrames        int       `json:"iFrames"`        // 视频 I 帧数
+	IFramesWithVPS int       `json:"iFramesWithVPS"` // 帧数据以 VPS 开头的 I 帧数
+	Error          string    `json:"error,omitempty"`
+}
+
+// TRecLayout TRec 文件的字节布局，-dump-file 报告中与偏移有关部分的机器可读版本
+type TRecLayout struct {
+	File        string                    `json:"file"`
+	FileSize    int64                     `json:"fileSize"`
+	IndexRegion ByteRange                 `json:"indexRegion"` // 索引区域（到 256MB 文件末尾）
+	FrameIndex  TRecIndexLayout           `json:"frameIndex"`
+	Data        TRecDataLayout            `json:"data"`
+	Channels    map[uint32]int            `json:"channels"`   // 每个通道的条目数
+	FrameTypes  map[uint32]map[uint32]int `json:"frameTypes"` // 每个通道中每种帧类型的条目数
+	VPS         TRecVPSCoverage           `json:"vps"`
+}
+
+// DescribeTRecLayout 读取 TRec 文件的字节布局
+// 帧索引按缓存中记录的布局读取，VPS 位置优先使用缓存
+func DescribeTRecLayout(recFilePath string) (*TRecLayout, error) {
+	info, err := statFile(recFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	index, entries, err := ReadTRecFrameIndexLayout(recFilePath, cachedIndexLayout(recFilePath))
+	if err != nil {
+		return nil, err
+	}
+
+	layout := &TRecLayout{
+		File:        filepath.Base(recFilePath),
+		FileSize:    info.Size(),
+		IndexRegion: ByteRange{Start: TRecIndexRegionStart, End: TRecFileSize},
+		FrameIndex: TRecIndexLayout{
+			Magic:       fmt.Sprintf("0x%08X", TRecFrameIndexMagic),
+			SearchStart: TRecIndexRegionStart,
+			Offset:      index.Start,
+			EntrySize:   index.Stride,
+			EntryCount:  len(entries),
+		},
+		Data:       TRecDataLayout{Region: ByteRange{Start: 0, End: TRecIndexRegionStart}},
+		Channels:   make(map[uint32]int),
+		FrameTypes: make(map[uint32]map[uint32]int),
+		VPS: TRecVPSCoverage{
+			Scanned: ByteRange{Start: 0, End: TRecIndexRegionStart},
+			First:   -1,
+			Last:    -1,
+		},
+	}
+	if index.Start >= 0 {
+		layout.FrameIndex.Entries = ByteRange{Start: index.Start, End: index.Start + int64(len(entries)*index.Stride)}
+	}
+
+	iFrameOffsets := make(map[int64]bool)
+	for _, r := range entries {
+		layout.Channels[r.Channel]++
+		if layout.FrameTypes[r.Channel] == nil {
+			layout.FrameTypes[r.Channel] = make(map[uint32]int)
+		}
+		layout.FrameTypes[r.Channel][r.FrameType]++
+
+		if r.Channel != ChannelVideo1 && r.Channel != ChannelAudio && r.Channel != ChannelVideo2 {
+			continue
+		}
+		start, end := int64(r.FileOffset), int64(r.FileOffset)+int64(r.FrameSize)
+		if !isValidTimestamp(int64(r.UnixTs)) || r.FrameSize == 0 || end > TRecIndexRegionStart {
+			continue
+		}
+		data := &layout.Data
+		if data.Frames == 0 || start < data.Used.Start {
+			data.Used.Start = start
+		}
+		data.Used.End = max(data.Used.End, end)
+		data.FrameBytes += int64(r.FrameSize)
+		data.Frames++
+		if r.Channel != ChannelAudio && r.FrameType == FrameTypeI {
+			layout.VPS.IFrames++
+			iFrameOffsets[start] = true
+		}
+	}
+	if layout.Data.Frames > 0 {
+		layout.Data.HeaderSize = layout.Data.Used.Start
+	}
+
+	positions, err := ScanVPSPositionsWithCache(recFilePath)
+	if err != nil {
+		layout.VPS.Error = err.Error()
+	}
+	sort.Ints(positions)
+	layout.VPS.Count = len(positions)
+	if len(positions) > 0 {
+		layout.VPS.First, layout.VPS.Last = int64(positions[0]), int64(positions[len(positions)-1])
+	}
+	for _, pos := range positions {
+		if iFrameOffsets[int64(pos)] {
+			layout.VPS.IFramesWithVPS++
+		}
+	}
+
+	return layout, nil
+}
@@ -5,14 +5,20 @@
 package seetong
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -32,20 +38,135 @@ const (
 	TRecIndexRegionStart   = 0x0F900000 // 索引区域起始
 	TRecFrameIndexMagic    = 0x4C3D2E1F
 	TRecFrameIndexSize     = 44
+	TRecFrameIndexSizeWide = 48 // 部分固件版本的索引条目按 16 字节对齐到 48 字节
+
+	// 从 TRecIndexRegionStart 开始搜索帧索引 magic 的初始窗口，未找到时窗口逐步扩大到文件末尾
+	DefaultIndexSearchSize = 0x700000
+
+	// 单帧大小上限（字节），超过的帧索引条目视为损坏
+	DefaultMaxFrameSize = 8 << 20
 
 	// 通道定义
 	ChannelVideo1 = 2
 	ChannelAudio  = 3
 	ChannelVideo2 = 258
 
-	// 帧类型
+	// 帧类型（帧索引记录的 FrameType，只对视频通道有意义，音频按通道区分）
+	// 与 WebSocket 二进制帧的帧类型字节（按 NAL 类型得出）是两套编号；
+	// 编号不同的固件在解析时按帧数据校正，判断 I 帧统一用 FrameIndexRecord.IsIFrame
 	FrameTypeI = 1
 	FrameTypeP = 3
 
 	// 有效时间戳下限：2020-01-01
 	MinValidTimestamp = 1577836800
+
+	// 时间戳回退超过该秒数视为时钟重置（断电等导致）
+	TimestampResetThreshold = 60
+)
+
+// 帧索引初始搜索窗口（可配置）
+var indexSearchSize atomic.Int64
+
+// SetIndexSearchSize 设置帧索引初始搜索窗口的字节数，0 使用默认值
+func SetIndexSearchSize(size int64) {
+	indexSearchSize.Store(size)
+}
+
+// 帧索引中断后的重新同步
+const (
+	indexResyncWindow = 64 * 1024 // 每次从损坏条目向后查找下一条目的字节数
+	maxIndexResyncs   = 16        // 每个文件最多跳过的损坏位置数，避免在大片损坏的区域中反复查找
 )
 
+var indexResync atomic.Bool
+
+// SetIndexResync 设置帧索引遇到损坏条目时是否跳过并继续解析
+// 关闭时（默认）在第一个 magic 不符的条目处停止，之后还有有效条目时只记录警告
+func SetIndexResync(enabled bool) {
+	indexResync.Store(enabled)
+}
+
+// IsIndexResync 帧索引遇到损坏条目时是否跳过并继续解析
+func IsIndexResync() bool {
+	return indexResync.Load()
+}
+
+func getIndexSearchSize() int64 {
+	if size := indexSearchSize.Load(); size > 0 {
+		return size
+	}
+	return DefaultIndexSearchSize
+}
+
+// 单帧大小上限（可配置）
+var maxFrameSize atomic.Int64
+
+// SetMaxFrameSize 设置单帧大小上限（字节），0 使用默认值
+// 损坏的帧索引条目可能给出数百 MB 的 FrameSize，解析时丢弃这些条目，读取时拒绝分配
+func SetMaxFrameSize(size int64) {
+	maxFrameSize.Store(size)
+}
+
+// GetMaxFrameSize 获取单帧大小上限
+func GetMaxFrameSize() int64 {
+	if size := maxFrameSize.Load(); size > 0 {
+		return size
+	}
+	return DefaultMaxFrameSize
+}
+
+// isOversizedFrame 帧大小是否超过上限
+func isOversizedFrame(r FrameIndexRecord) bool {
+	return int64(r.FrameSize) > GetMaxFrameSize()
+}
+
+// checkFrameSize 读取前检查帧大小，超过上限时返回 ErrFrameTooLarge 而不分配缓冲
+func checkFrameSize(frame FrameIndexRecord) error {
+	if isOversizedFrame(frame) {
+		return fmt.Errorf("%w: %d bytes at offset 0x%X (limit %d)", ErrFrameTooLarge, frame.FrameSize, frame.FileOffset, GetMaxFrameSize())
+	}
+	return nil
+}
+
+// 时间戳下限（可配置），raw 模式下完全禁用下限
+var (
+	minValidTimestamp atomic.Int64
+	rawTimestampMode  atomic.Bool
+)
+
+func init() {
+	minValidTimestamp.Store(MinValidTimestamp)
+}
+
+// SetMinValidTimestamp 设置有效时间戳下限（Unix 秒）
+func SetMinValidTimestamp(ts int64) {
+	minValidTimestamp.Store(ts)
+}
+
+// GetMinValidTimestamp 获取有效时间戳下限
+func GetMinValidTimestamp() int64 {
+	return minValidTimestamp.Load()
+}
+
+// SetRawTimestampMode 设置 raw 模式
+// 启用后不再按时间戳下限过滤，RTC 未设置（1970 年附近）的录像按 TimestampUs 顺序浏览
+func SetRawTimestampMode(enabled bool) {
+	rawTimestampMode.Store(enabled)
+}
+
+// IsRawTimestampMode 是否 raw 模式
+func IsRawTimestampMode() bool {
+	return rawTimestampMode.Load()
+}
+
+// isValidTimestamp 判断时间戳是否高于配置的下限
+func isValidTimestamp(ts int64) bool {
+	if rawTimestampMode.Load() {
+		return true
+	}
+	return ts > minValidTimestamp.Load()
+}
+
 // NAL 类型
 const (
 	NalTrailN    = 0  // P帧 (非参考)
@@ -55,6 +176,9 @@ const (
 	NalVPS       = 32 // 视频参数集
 	NalSPS       = 33 // 序列参数集
 	NalPPS       = 34 // 图像参数集
+	NalAUD       = 35 // 访问单元分隔符
+	NalSEIPrefix = 39 // SEI (前缀)
+	NalSEISuffix = 40 // SEI (后缀)
 )
 
 // NAL 起始码
@@ -64,6 +188,13 @@ var (
 	VPSPattern    = []byte{0x00, 0x00, 0x00, 0x01, 0x40}
 )
 
+// 存储层错误，调用方可用 errors.Is 判断
+var (
+	ErrRecFileNotFound = errors.New("rec file not found")
+	ErrInvalidFormat   = errors.New("invalid format")
+	ErrFrameTooLarge   = fmt.Errorf("%w: frame size exceeds limit", ErrInvalidFormat)
+)
+
 // ============================================================================
 // 数据结构定义
 // ============================================================================
@@ -77,6 +208,7 @@ type FrameIndexRecord struct {
 	FrameSize   uint32
 	TimestampUs uint64
 	UnixTs      uint32
+	Reserved    [8]byte // 条目的第 36-44 字节，含义未知（部分固件可能是 CRC 或亚秒时间），原样保留
 }
 
 // SegmentRecord 段落索引记录
@@ -102,6 +234,15 @@ type CachedSegmentInfo struct {
 	FrameIndex   []FrameIndexRecord
 	VPSPositions []VPSPosition // VPS 位置及其精确时间
 	AudioFrames  []FrameIndexRecord
+	VideoStats   map[uint32]*VideoStats // 按帧通道统计的 GOP 和码率
+
+	// 首/末视频帧的 Unix 微秒时间（首条记录的 UnixTs 加 TimestampUs 增量，与播放时的帧时间一致），没有视频帧时为 0
+	StartUs int64
+	EndUs   int64
+
+	// 压缩模式（SetCompactFrameIndex）下 FrameIndex/AudioFrames 为 nil，记录保存在这里
+	compactFrames *CompactFrameIndex
+	compactAudio  *CompactFrameIndex
 }
 
 // VPSPosition VPS 位置和时间
@@ -134,60 +275,92 @@ func IsKeyframe(nalType int) bool {
 	return nalType == NalIDRWRadl || nalType == NalIDRNLP
 }
 
+// IsSubLayerNonReference 判断是否为非参考帧（可安全丢弃）
+// HEVC 中 0~14 的偶数类型（TRAIL_N/TSA_N/STSA_N/RADL_N/RASL_N 等）不被其他帧参考
+func IsSubLayerNonReference(nalType int) bool {
+	return nalType <= 14 && nalType%2 == 0
+}
+
 // IsHeader 判断是否为头部 NAL
 func IsHeader(nalType int) bool {
 	return nalType == NalVPS || nalType == NalSPS || nalType == NalPPS
 }
 
 // ParseNalUnits 解析数据中的所有 NAL 单元
+// 用 bytes.Index 跳到下一个 00 00 01，前一字节为 0 时按 4 字节起始码处理；
+// 防竞争字节 00 00 03 不会被当作起始码。最后 4 字节内的起始码不计
 func ParseNalUnits(data []byte) []NalUnit {
 	var results []NalUnit
-	pos := 0
-
-	for pos < len(data)-4 {
-		var startLen int
-		if bytes.Equal(data[pos:pos+4], NalStartCode4) {
-			startLen = 4
-		} else if pos+3 <= len(data) && bytes.Equal(data[pos:pos+3], NalStartCode3) {
-			startLen = 3
-		} else {
-			pos++
-			continue
-		}
+	limit := len(data) - 4
 
-		start := pos
-		nalBytePos := start + startLen
-		if nalBytePos >= len(data) {
-			break
-		}
-		nalType := (int(data[nalBytePos]) >> 1) & 0x3F
+	start, startLen := nextStartCode(data, 0, limit)
+	for start >= 0 {
+		nalType := (int(data[start+startLen]) >> 1) & 0x3F
 
-		// 查找下一个起始码
-		nextPos := pos + startLen
-		for nextPos < len(data)-4 {
-			if bytes.Equal(data[nextPos:nextPos+4], NalStartCode4) {
-				break
-			}
-			if nextPos+3 <= len(data) && bytes.Equal(data[nextPos:nextPos+3], NalStartCode3) {
-				break
-			}
-			nextPos++
-		}
-		if nextPos >= len(data)-4 {
-			nextPos = len(data)
+		next, nextLen := nextStartCode(data, start+startLen, limit)
+		end := next
+		if next < 0 {
+			end = len(data)
 		}
 
 		results = append(results, NalUnit{
 			Offset:  start,
-			Size:    nextPos - start,
+			Size:    end - start,
 			NalType: nalType,
 		})
-		pos = nextPos
+		start, startLen = next, nextLen
 	}
 
 	return results
 }
 
+// nextStartCode 查找 from 之后第一个起始码的位置和长度（3 或 4），位置不小于 limit 时返回 -1
+func nextStartCode(data []byte, from, limit int) (int, int) {
+	if from >= limit {
+		return -1, 0
+	}
+	i := bytes.Index(data[from:], NalStartCode3)
+	if i < 0 {
+		return -1, 0
+	}
+	pos, n := from+i, 3
+	if pos > from && data[pos-1] == 0 {
+		pos, n = pos-1, 4
+	}
+	if pos >= limit {
+		return -1, 0
+	}
+	return pos, n
+}
+
+// NalTypeName 返回 NAL 类型的可读名称
+func NalTypeName(nalType int) string {
+	switch nalType {
+	case NalTrailN:
+		return "TRAIL_N"
+	case NalTrailR:
+		return "TRAIL_R"
+	case NalIDRWRadl:
+		return "IDR_W_RADL"
+	case NalIDRNLP:
+		return "IDR_N_LP"
+	case NalVPS:
+		return "VPS"
+	case NalSPS:
+		return "SPS"
+	case NalPPS:
+		return "PPS"
+	case NalAUD:
+		return "AUD"
+	case NalSEIPrefix:
+		return "SEI_PREFIX"
+	case NalSEISuffix:
+		return "SEI_SUFFIX"
+	default:
+		return fmt.Sprintf("NAL_%d", nalType)
+	}
+}
+
 // StripStartCode 去掉 NAL 起始码
 func StripStartCode(data []byte) []byte {
 	if len(data) >= 4 && bytes.Equal(data[:4], NalStartCode4) {
@@ -261,17 +434,23 @@ done:
 // ============================================================================
 
 // CalculatePreciseTime 根据字节偏移计算精确时间戳
+// 结束时间不晚于开始时间的段落（时钟异常）返回开始时间；偏移超出数据区域时按区域边界计算
 func CalculatePreciseTime(seg *SegmentRecord, byteOffset int) int64 {
 	if TRecIndexRegionStart <= 0 {
 		return seg.StartTime
 	}
 
 	duration := seg.EndTime - seg.StartTime
+	if duration <= 0 {
+		return seg.StartTime
+	}
+	byteOffset = min(max(byteOffset, 0), TRecIndexRegionStart)
 	timeOffset := float64(byteOffset) / float64(TRecIndexRegionStart) * float64(duration)
 	return seg.StartTime + int64(timeOffset)
 }
 
 // CalculatePreciseTimeFromIFrames 根据 I 帧列表计算目标偏移的精确时间
+// 相邻两个 I 帧的时间倒退（摄像机时钟跳变）时不做插值，返回前一个 I 帧的时间
 func CalculatePreciseTimeFromIFrames(iFrames []VPSPosition, targetOffset int, seg *SegmentRecord) int64 {
 	if len(iFrames) == 0 {
 		return seg.StartTime
@@ -312,6 +491,9 @@ func CalculatePreciseTimeFromIFrames(iFrames []VPSPosition, targetOffset int, se
 	}
 
 	timeRange := nextFrame.Time - prevFrame.Time
+	if timeRange <= 0 {
+		return prevFrame.Time
+	}
 	byteOffsetInRange := targetOffset - prevFrame.Offset
 
 	timeOffset := float64(byteOffsetInRange) / float64(byteRange) * float64(timeRange)
@@ -322,210 +504,612 @@ func CalculatePreciseTimeFromIFrames(iFrames []VPSPosition, targetOffset int, se
 // TRec 帧索引解析
 // ============================================================================
 
-// ParseTRecFrameIndex 解析 TRec 文件中的帧索引
-func ParseTRecFrameIndex(recFilePath string) ([]FrameIndexRecord, error) {
-	f, err := os.Open(recFilePath)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
+// IndexLayout TRec 帧索引的位置和条目大小，解析后记录在帧索引缓存中
+// 重新解析同一文件时直接使用，不再搜索和检测；零值表示未知
+type IndexLayout struct {
+	Start  int64 // 第一条记录的文件偏移
+	Stride int   // 条目大小（44 或 48）
+}
 
-	// 搜索帧索引起始位置
-	magicBytes := make([]byte, 4)
-	binary.LittleEndian.PutUint32(magicBytes, TRecFrameIndexMagic)
+// ReadTRecFrameIndexRaw 读取 TRec 文件的原始帧索引（不过滤、不排序）
+// 返回索引起始偏移，未找到索引时偏移为 -1
+func ReadTRecFrameIndexRaw(recFilePath string) (int64, []FrameIndexRecord, error) {
+	layout, records, err := ReadTRecFrameIndexLayout(recFilePath, IndexLayout{})
+	return layout.Start, records, err
+}
 
-	_, err = f.Seek(TRecIndexRegionStart, 0)
+// ReadTRecFrameIndexLayout 按已知布局读取原始帧索引，返回实际使用的布局
+// hint.Start 处不是帧索引 magic 时重新搜索；hint.Stride 为 0 时根据前几条记录自动检测。
+// 未找到索引时返回的 Start 为 -1
+func ReadTRecFrameIndexLayout(recFilePath string, hint IndexLayout) (IndexLayout, []FrameIndexRecord, error) {
+	var records []FrameIndexRecord
+	layout, err := readTRecFrameIndexStream(recFilePath, hint, func(r FrameIndexRecord) bool {
+		records = append(records, r)
+		return true
+	})
 	if err != nil {
-		return nil, err
+		return layout, nil, err
 	}
+	return layout, records, nil
+}
 
-	searchData := make([]byte, 0x700000)
-	n, err := f.Read(searchData)
-	if err != nil && err != io.EOF {
-		return nil, err
-	}
-	searchData = searchData[:n]
+// ReadTRecFrameIndexEntries 按缓存中记录的布局读取原始帧索引（文件顺序，不丢弃时间戳重置的条目、不排序）
+// 完整性检查用它查看解析时被过滤或排序掩盖的时间戳回退
+func ReadTRecFrameIndexEntries(recFilePath string) ([]FrameIndexRecord, error) {
+	_, entries, err := ReadTRecFrameIndexLayout(recFilePath, cachedIndexLayout(recFilePath))
+	return entries, err
+}
 
-	idx := bytes.Index(searchData, magicBytes)
-	if idx == -1 {
-		return nil, nil
+// readTRecFrameIndexStream 按文件顺序逐条读取原始帧索引并调用 fn，fn 返回 false 时停止读取
+// 布局的确定方式与 ReadTRecFrameIndexLayout 相同
+func readTRecFrameIndexStream(recFilePath string, hint IndexLayout, fn func(FrameIndexRecord) bool) (IndexLayout, error) {
+	layout := IndexLayout{Start: -1}
+	f, err := openFile(recFilePath)
+	if err != nil {
+		return layout, err
 	}
+	defer f.Close()
 
-	indexStart := int64(TRecIndexRegionStart + idx)
-	_, err = f.Seek(indexStart, 0)
-	if err != nil {
-		return nil, err
+	indexStart := int64(-1)
+	if hint.Start > 0 && hasFrameIndexMagic(f, hint.Start) {
+		indexStart = hint.Start
+	} else if indexStart, err = findFrameIndexStart(f, recFilePath); err != nil || indexStart < 0 {
+		return layout, err
 	}
 
-	var records []FrameIndexRecord
-	buf := make([]byte, TRecFrameIndexSize)
+	stride := hint.Stride
+	if stride != TRecFrameIndexSize && stride != TRecFrameIndexSizeWide {
+		probe := make([]byte, (strideProbeRecords+1)*TRecFrameIndexSizeWide)
+		n, err := f.ReadAt(probe, indexStart)
+		if err != nil && err != io.EOF {
+			return layout, err
+		}
+		stride = detectTRecIndexStride(probe[:n], 0)
+	}
+	layout = IndexLayout{Start: indexStart, Stride: stride}
 
+	// 按块读取，不再每条记录一次系统调用
+	r := bufio.NewReaderSize(io.NewSectionReader(f, indexStart, math.MaxInt64-indexStart), 64*1024)
+	buf := make([]byte, stride)
+	pos := indexStart
+	resyncs, skipped := 0, int64(0)
 	for {
-		n, err := f.Read(buf)
-		if err != nil || n < TRecFrameIndexSize {
+		if _, err := io.ReadFull(r, buf); err != nil {
 			break
 		}
 
+		// magic 不符通常是索引结束；之后不远处还有条目时是中间的条目损坏（如坏扇区），
+		// 重新同步模式下跳到下一个条目继续解析，否则之后的帧全部丢失
 		magic := binary.LittleEndian.Uint32(buf[0:4])
 		if magic != TRecFrameIndexMagic {
+			next := findNextFrameIndexEntry(f, pos, stride)
+			if next < 0 {
+				break
+			}
+			if !IsIndexResync() || resyncs >= maxIndexResyncs {
+				LogWarn("帧索引在损坏的条目处中断，之后的条目被忽略",
+					"file", filepath.Base(recFilePath),
+					"offset", pos,
+					"nextEntry", next,
+					"resync", IsIndexResync(),
+					"resyncs", resyncs)
+				break
+			}
+			LogDebug("帧索引跳过损坏的条目", "file", filepath.Base(recFilePath), "offset", pos, "skipped", next-pos)
+			resyncs++
+			skipped += next - pos
+			pos = next
+			r.Reset(io.NewSectionReader(f, pos, math.MaxInt64-pos))
+			continue
+		}
+		pos += int64(stride)
+
+		if !fn(decodeFrameIndexRecord(buf)) {
 			break
 		}
+	}
+	if resyncs > 0 {
+		LogWarn("帧索引中有损坏的条目，已跳过",
+			"file", filepath.Base(recFilePath),
+			"resyncs", resyncs,
+			"skippedBytes", skipped)
+	}
 
-		frameType := binary.LittleEndian.Uint32(buf[4:8])
-		channel := binary.LittleEndian.Uint32(buf[8:12])
-		frameSeq := binary.LittleEndian.Uint32(buf[12:16])
-		fileOffset := binary.LittleEndian.Uint32(buf[16:20])
-		frameSize := binary.LittleEndian.Uint32(buf[20:24])
-		timestampUs := binary.LittleEndian.Uint64(buf[24:32])
-		unixTs := binary.LittleEndian.Uint32(buf[32:36])
-
-		if unixTs > MinValidTimestamp && (channel == ChannelVideo1 || channel == ChannelAudio || channel == ChannelVideo2) {
-			records = append(records, FrameIndexRecord{
-				FrameType:   frameType,
-				Channel:     channel,
-				FrameSeq:    frameSeq,
-				FileOffset:  fileOffset,
-				FrameSize:   frameSize,
-				TimestampUs: timestampUs,
-				UnixTs:      unixTs,
-			})
+	return layout, nil
+}
+
+// findNextFrameIndexEntry 在 pos 之后 indexResyncWindow 字节内查找下一条帧索引条目，未找到时返回 -1
+// 条目之后一个条目大小处也必须是 magic，避免把录像数据中偶然出现的 magic 当作条目
+func findNextFrameIndexEntry(f io.ReaderAt, pos int64, stride int) int64 {
+	data := make([]byte, indexResyncWindow+stride+4)
+	n, err := f.ReadAt(data, pos+1)
+	if err != nil && err != io.EOF {
+		return -1
+	}
+	data = data[:n]
+	magicBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(magicBytes, TRecFrameIndexMagic)
+	for off := 0; off < indexResyncWindow; {
+		idx := bytes.Index(data[off:], magicBytes)
+		if idx < 0 {
+			return -1
+		}
+		off += idx
+		if off >= indexResyncWindow {
+			return -1
+		}
+		if confirm := off + stride; confirm+4 <= len(data) && bytes.Equal(data[confirm:confirm+4], magicBytes) {
+			return pos + 1 + int64(off)
+		}
+		off++
+	}
+	return -1
+}
+
+// decodeFrameIndexRecord 解码一条帧索引条目（含 magic）
+// 48 字节条目只是在末尾多了填充，前 44 字节布局相同
+func decodeFrameIndexRecord(buf []byte) FrameIndexRecord {
+	record := FrameIndexRecord{
+		FrameType:   binary.LittleEndian.Uint32(buf[4:8]),
+		Channel:     binary.LittleEndian.Uint32(buf[8:12]),
+		FrameSeq:    binary.LittleEndian.Uint32(buf[12:16]),
+		FileOffset:  binary.LittleEndian.Uint32(buf[16:20]),
+		FrameSize:   binary.LittleEndian.Uint32(buf[20:24]),
+		TimestampUs: binary.LittleEndian.Uint64(buf[24:32]),
+		UnixTs:      binary.LittleEndian.Uint32(buf[32:36]),
+	}
+	copy(record.Reserved[:], buf[36:44])
+	return record
+}
+
+// encodeFrameIndexRecord 按 44 字节布局编码一条帧索引条目（decodeFrameIndexRecord 的逆操作）
+func encodeFrameIndexRecord(buf []byte, r FrameIndexRecord) {
+	binary.LittleEndian.PutUint32(buf[0:4], TRecFrameIndexMagic)
+	binary.LittleEndian.PutUint32(buf[4:8], r.FrameType)
+	binary.LittleEndian.PutUint32(buf[8:12], r.Channel)
+	binary.LittleEndian.PutUint32(buf[12:16], r.FrameSeq)
+	binary.LittleEndian.PutUint32(buf[16:20], r.FileOffset)
+	binary.LittleEndian.PutUint32(buf[20:24], r.FrameSize)
+	binary.LittleEndian.PutUint64(buf[24:32], r.TimestampUs)
+	binary.LittleEndian.PutUint32(buf[32:36], r.UnixTs)
+	copy(buf[36:44], r.Reserved[:])
+}
+
+// hasFrameIndexMagic offset 处是否为帧索引 magic
+func hasFrameIndexMagic(f io.ReaderAt, offset int64) bool {
+	var buf [4]byte
+	if _, err := f.ReadAt(buf[:], offset); err != nil {
+		return false
+	}
+	return binary.LittleEndian.Uint32(buf[:]) == TRecFrameIndexMagic
+}
+
+// findFrameIndexStart 从 TRecIndexRegionStart 开始搜索帧索引 magic，返回其文件偏移，未找到时返回 -1
+// 先搜索初始窗口，未找到时窗口每次加倍继续向后搜索，直到文件末尾
+// （部分固件的索引位于默认 7MB 窗口之后）
+func findFrameIndexStart(f io.ReaderAt, name string) (int64, error) {
+	magicBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(magicBytes, TRecFrameIndexMagic)
+
+	pos, window := int64(TRecIndexRegionStart), getIndexSearchSize()
+	for {
+		searchData := make([]byte, window)
+		n, err := f.ReadAt(searchData, pos)
+		if err != nil && err != io.EOF {
+			return -1, err
+		}
+		if idx := bytes.Index(searchData[:n], magicBytes); idx >= 0 {
+			if pos > TRecIndexRegionStart {
+				LogDebug("帧索引位于初始搜索窗口之后", "file", filepath.Base(name), "offset", pos+int64(idx))
+			}
+			return pos + int64(idx), nil
+		}
+		if int64(n) < window {
+			return -1, nil // 已到文件末尾
+		}
+		// 保留 3 字节重叠，避免 magic 跨越两个窗口
+		pos += window - int64(len(magicBytes)-1)
+		window *= 2
+	}
+}
+
+// 检测条目大小时最多比较的记录数
+const strideProbeRecords = 8
+
+// detectTRecIndexStride 根据 magic 在首条记录之后重复出现的间隔判断条目大小
+// 分别按 44 和 48 字节数连续命中 magic 的记录数，取较多者；都不命中（只有一条记录）时按 44 处理
+func detectTRecIndexStride(data []byte, first int) int {
+	best, bestHits := TRecFrameIndexSize, 0
+	for _, stride := range []int{TRecFrameIndexSize, TRecFrameIndexSizeWide} {
+		hits := 0
+		for i := 1; i <= strideProbeRecords; i++ {
+			off := first + i*stride
+			if off+4 > len(data) || binary.LittleEndian.Uint32(data[off:off+4]) != TRecFrameIndexMagic {
+				break
+			}
+			hits++
+		}
+		if hits > bestHits {
+			best, bestHits = stride, hits
+		}
+	}
+	return best
+}
+
+// ParseTRecFrameIndex 解析 TRec 文件中的帧索引
+func ParseTRecFrameIndex(recFilePath string) ([]FrameIndexRecord, error) {
+	records, _, err := parseTRecFrameIndex(recFilePath, IndexLayout{})
+	return records, err
+}
+
+// ParseTRecFrameIndexStream 边读取边回调 TRec 文件中的有效帧索引记录，fn 返回 false 时停止
+// 记录按文件顺序（写入顺序）回调，不排序，也不做时间戳重置检测；
+// 只需要前几条记录（如第一个 I 帧）时不必等待整个索引解析完成
+func ParseTRecFrameIndexStream(recFilePath string, fn func(FrameIndexRecord) bool) error {
+	_, err := readTRecFrameIndexStream(recFilePath, IndexLayout{}, func(r FrameIndexRecord) bool {
+		if !isIndexedFrame(r) {
+			return true
+		}
+		return fn(r)
+	})
+	return err
+}
+
+// isIndexedFrame 时间戳有效、属于视频或音频通道且大小不超过上限的记录
+func isIndexedFrame(r FrameIndexRecord) bool {
+	return isValidTimestamp(int64(r.UnixTs)) && (r.Channel == ChannelVideo1 || r.Channel == ChannelAudio || r.Channel == ChannelVideo2) &&
+		!isOversizedFrame(r)
+}
+
+// parseTRecFrameIndex 按已知布局解析帧索引（零值时搜索和检测）
+// 返回过滤、排序后的记录和实际使用的布局
+func parseTRecFrameIndex(recFilePath string, hint IndexLayout) ([]FrameIndexRecord, IndexLayout, error) {
+	var records []FrameIndexRecord
+	oversized := 0
+	layout, err := readTRecFrameIndexStream(recFilePath, hint, func(r FrameIndexRecord) bool {
+		switch {
+		case isIndexedFrame(r):
+			records = append(records, r)
+		case isOversizedFrame(r):
+			oversized++
 		}
+		return true
+	})
+	if err != nil {
+		return nil, layout, err
+	}
+	if layout.Stride == TRecFrameIndexSizeWide {
+		LogDebug("帧索引条目为 48 字节", "file", filepath.Base(recFilePath))
+	}
+	if oversized > 0 {
+		LogWarn("帧索引中有超过大小上限的条目，已丢弃",
+			"file", filepath.Base(recFilePath),
+			"rejected", oversized,
+			"limit", GetMaxFrameSize())
 	}
 
+	// 检测时间戳重置，只保留主时间基
+	runs := splitMonotonicRuns(records)
+	if len(runs) > 1 {
+		dominant := dominantRun(runs)
+		LogWarn("帧索引时间戳重置",
+			"file", filepath.Base(recFilePath),
+			"runs", len(runs),
+			"kept", len(dominant),
+			"dropped", len(records)-len(dominant))
+		records = dominant
+	}
+
+	normalizeFrameTypes(recFilePath, records)
+
 	// 按时间正序排列
 	sort.Slice(records, func(i, j int) bool {
 		return records[i].TimestampUs < records[j].TimestampUs
 	})
 
-	return records, nil
+	return records, layout, nil
+}
+
+// splitMonotonicRuns 按文件顺序将帧索引切分为时间单调的若干段
+// UnixTs 回退超过 TimestampResetThreshold 秒即视为新的时间基
+func splitMonotonicRuns(records []FrameIndexRecord) [][]FrameIndexRecord {
+	if len(records) == 0 {
+		return nil
+	}
+
+	var runs [][]FrameIndexRecord
+	runStart := 0
+	maxTs := records[0].UnixTs
+
+	for i := 1; i < len(records); i++ {
+		ts := records[i].UnixTs
+		if ts+TimestampResetThreshold < maxTs {
+			runs = append(runs, records[runStart:i])
+			runStart = i
+			maxTs = ts
+			continue
+		}
+		if ts > maxTs {
+			maxTs = ts
+		}
+	}
+	runs = append(runs, records[runStart:])
+
+	return runs
+}
+
+// dominantRun 返回记录数最多的时间段
+func dominantRun(runs [][]FrameIndexRecord) []FrameIndexRecord {
+	best := runs[0]
+	for _, run := range runs[1:] {
+		if len(run) > len(best) {
+			best = run
+		}
+	}
+	return best
+}
+
+// VPS 扫描并发数（0 使用默认值）
+var vpsScanWorkers atomic.Int32
+
+// SetVPSScanWorkers 设置单个文件 VPS 扫描的并发数
+func SetVPSScanWorkers(workers int) {
+	vpsScanWorkers.Store(int32(workers))
+}
+
+// maxScanReaders 所有 VPS 扫描合计同时读取的块数
+const maxScanReaders = 4
+
+// vpsScanSlots 所有 VPS 扫描共享的读取配额
+// 缓存构建的每个工作线程各自扫描一个文件，各扫描的块读取在这里排队，
+// 同时读取的块数不超过 maxScanReaders，而不是缓存线程数 × 扫描线程数
+var vpsScanSlots = make(chan struct{}, maxScanReaders)
+
+// normalizeWorkers 规范化线程数
+// 默认 2 个线程（USB/机械硬盘优化），最多 4 个，不超过任务数
+func normalizeWorkers(workers, total int) int {
+	if workers <= 0 {
+		workers = 2
+	}
+	if workers > 4 {
+		workers = 4 // 限制最大并发数，避免 IO 瓶颈
+	}
+	if workers > total {
+		workers = total
+	}
+	return workers
 }
 
 // ScanVPSPositions 扫描文件中所有 VPS 位置（只扫描数据区域）
 func ScanVPSPositions(filePath string) ([]int, error) {
-	f, err := os.Open(filePath)
+	return ScanVPSPositionsWithWorkers(filePath, int(vpsScanWorkers.Load()))
+}
+
+// ScanVPSPositionsWithWorkers 并行扫描 VPS 位置（指定线程数）
+// VPS 的 NAL 头必须是 0x40 0x01（forbidden_zero_bit、nuh_layer_id 为 0，nuh_temporal_id_plus1 为 1），
+// 同时支持 3 字节和 4 字节起始码，
+// 返回起始码的位置（4 字节起始码返回前导 0x00 的位置）
+//
+// 数据区域按 4MB 分块，每块向前多读 1 字节、向后多读 5 字节以覆盖跨块的 VPS，
+// 匹配只归属于其位置所在的块，因此块边界处不会重复或遗漏。
+// 块读取占用 vpsScanSlots，多个文件同时扫描时合计不超过 maxScanReaders 个读取。
+// 设置了解密器时按帧索引解密每块中的帧负载后再搜索
+func ScanVPSPositionsWithWorkers(filePath string, workers int) ([]int, error) {
+	f, err := openFile(filePath)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
+	decryptor := GetFrameDecryptor()
+	var frames []FrameIndexRecord
+	if decryptor != nil {
+		frames = fileDecryptionFrames(filePath)
+	}
+
 	// 只扫描数据区域 (0 ~ TRecIndexRegionStart)
-	scanSize := TRecIndexRegionStart
+	const scanSize = TRecIndexRegionStart
+	const chunkSize = 4 * 1024 * 1024 // 4MB chunks，更好的缓存利用
+	const lookBehind = 1
+	const lookAhead = 5 // 3 字节起始码 + 两字节 NAL 头
+
+	numChunks := (scanSize + chunkSize - 1) / chunkSize
+	workers = normalizeWorkers(workers, numChunks)
+
+	chunkChan := make(chan int, numChunks)
+	for i := 0; i < numChunks; i++ {
+		chunkChan <- i
+	}
+	close(chunkChan)
+
+	// 每块的结果单独保存，按块顺序拼接即为有序结果
+	chunkResults := make([][]int, numChunks)
+	var firstErr error
+	var errOnce sync.Once
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, lookBehind+chunkSize+lookAhead)
+			for i := range chunkChan {
+				offset := i * chunkSize
+				readSize := chunkSize
+				if offset+readSize > scanSize {
+					readSize = scanSize - offset
+				}
+
+				readStart := offset
+				if readStart > 0 {
+					readStart -= lookBehind
+				}
+				readEnd := offset + readSize + lookAhead
+				if readEnd > scanSize {
+					readEnd = scanSize
+				}
+
+				vpsScanSlots <- struct{}{}
+				n, err := f.ReadAt(buf[:readEnd-readStart], int64(readStart))
+				<-vpsScanSlots
+				if err != nil && err != io.EOF {
+					errOnce.Do(func() { firstErr = err })
+					continue
+				}
+				if decryptor != nil {
+					if err := decryptRange(decryptor, frames, buf[:n], int64(readStart)); err != nil {
+						errOnce.Do(func() { firstErr = err })
+						continue
+					}
+				}
+				chunkResults[i] = findVPSInChunk(buf[:n], readStart, offset, offset+readSize)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
 
 	var vpsPositions []int
-	chunkSize := 4 * 1024 * 1024 // 4MB chunks，更好的缓存利用
-	chunk := make([]byte, chunkSize+4) // +4 用于跨边界检测
-	offset := 0
-
-	for offset < scanSize {
-		readSize := chunkSize
-		if offset+readSize > scanSize {
-			readSize = scanSize - offset
-		}
+	for _, positions := range chunkResults {
+		vpsPositions = append(vpsPositions, positions...)
+	}
+	return vpsPositions, nil
+}
 
-		// 多读 4 字节用于跨边界检测
-		extraRead := 4
-		if offset+readSize+extraRead > scanSize {
-			extraRead = 0
+// vpsNalHeader 基础层 VPS 的 NAL 头
+var vpsNalHeader = [2]byte{NalVPS << 1, 0x01}
+
+// findVPSInChunk 在数据块中查找 VPS 起始码位置
+// data 从文件偏移 base 开始，只返回位于 [rangeStart, rangeEnd) 的位置；
+// 只按类型匹配时 G.711 负载中偶然出现的 00 00 01 4x/41 也会被当作 VPS，因此比较完整的两字节 NAL 头
+func findVPSInChunk(data []byte, base, rangeStart, rangeEnd int) []int {
+	var positions []int
+	for pos := 0; pos < len(data); {
+		idx := bytes.Index(data[pos:], NalStartCode3)
+		if idx == -1 {
+			break
 		}
+		q := pos + idx
+		pos = q + 1 // 移动到下一个可能的位置
 
-		f.Seek(int64(offset), 0)
-		n, err := f.Read(chunk[:readSize+extraRead])
-		if err != nil && err != io.EOF {
-			return nil, err
-		}
-		if n == 0 {
+		nalBytePos := q + len(NalStartCode3)
+		if nalBytePos+1 >= len(data) {
 			break
 		}
-
-		// 在当前块中搜索 VPS 模式
-		searchEnd := n
-		if extraRead > 0 {
-			searchEnd = readSize // 不搜索额外读取的部分，留给下次
+		if data[nalBytePos] != vpsNalHeader[0] || data[nalBytePos+1] != vpsNalHeader[1] {
+			continue
 		}
 
-		for pos := 0; pos < searchEnd; {
-			idx := bytes.Index(chunk[pos:searchEnd+4], VPSPattern)
-			if idx == -1 {
-				break
-			}
-			actualPos := offset + pos + idx
-			if actualPos < TRecIndexRegionStart {
-				vpsPositions = append(vpsPositions, actualPos)
-			}
-			pos += idx + 1 // 移动到下一个可能的位置
+		start := q
+		if q > 0 && data[q-1] == 0x00 {
+			start = q - 1 // 4 字节起始码
+		}
+		actualPos := base + start
+		if actualPos >= rangeEnd {
+			break
+		}
+		if actualPos >= rangeStart {
+			positions = append(positions, actualPos)
 		}
-
-		offset += readSize
 	}
-
-	return vpsPositions, nil
+	return positions
 }
 
 // ============================================================================
 // TIndex00.tps 解析
 // ============================================================================
 
+// maxTIndexEntries 主索引最多读取的条目数（64MB），文件大小异常时避免读取整个文件
+const maxTIndexEntries = 1 << 20
+
+// tindexEntrySlots 大小为 size 的主索引能容纳的条目数
+// 条目数只由文件大小决定，文件头中的 entryCount 可能为 0 或远大于实际（损坏），不用于限制读取
+func tindexEntrySlots(size int64) int {
+	if size <= SegmentIndexOffset {
+		return 0
+	}
+	return int(min((size-SegmentIndexOffset)/EntrySize, maxTIndexEntries))
+}
+
+// parseTIndexEntry 解析第 fileIndex 个条目，通道为 0 / 0xFE 或时间范围无效时返回 false
+func parseTIndexEntry(entry []byte, fileIndex int) (SegmentRecord, bool) {
+	channel := int(entry[4])
+	startTime := int64(binary.LittleEndian.Uint32(entry[8:12]))
+	endTime := int64(binary.LittleEndian.Uint32(entry[12:16]))
+	if channel == 0 || channel == 0xFE || !isValidTimestamp(startTime) || endTime <= startTime {
+		return SegmentRecord{}, false
+	}
+	return SegmentRecord{
+		FileIndex:  fileIndex,
+		Channel:    channel,
+		StartTime:  startTime,
+		EndTime:    endTime,
+		FrameCount: int(binary.LittleEndian.Uint16(entry[6:8])),
+	}, true
+}
+
 // ParseTIndex 解析 TIndex00.tps 主索引文件
+// 读取文件能容纳的全部条目并逐条校验，不依赖文件头中的条目数；
+// 文件头的条目数为 0 或超出文件大小时返回最后一个有效条目之后的条目数
 func ParseTIndex(indexPath string) ([]SegmentRecord, int, int, error) {
-	f, err := os.Open(indexPath)
+	info, err := statFile(indexPath)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	f, err := openFile(indexPath)
 	if err != nil {
 		return nil, 0, 0, err
 	}
 	defer f.Close()
 
 	// 读取文件头
-	var magic uint32
-	if err := binary.Read(f, binary.LittleEndian, &magic); err != nil {
+	header := make([]byte, 0x18)
+	if err := readFull(f, header, 0); err != nil {
 		return nil, 0, 0, err
 	}
-	if magic != TPSIndexMagic {
-		return nil, 0, 0, fmt.Errorf("invalid magic: %08X", magic)
+	if magic := binary.LittleEndian.Uint32(header[0:4]); magic != TPSIndexMagic {
+		return nil, 0, 0, fmt.Errorf("%w: magic %08X", ErrInvalidFormat, magic)
 	}
+	fileCount := binary.LittleEndian.Uint32(header[0x10:0x14])
+	entryCount := int(binary.LittleEndian.Uint32(header[0x14:0x18]))
+	slots := tindexEntrySlots(info.Size())
 
-	f.Seek(0x10, 0)
-	var fileCount, entryCount uint32
-	binary.Read(f, binary.LittleEndian, &fileCount)
-	binary.Read(f, binary.LittleEndian, &entryCount)
-
-	// 读取段落索引
-	f.Seek(SegmentIndexOffset, 0)
+	// 读取段落索引（按块读取，网络存储上不必每条记录一次请求）
+	r := bufio.NewReaderSize(io.NewSectionReader(f, SegmentIndexOffset, int64(slots)*EntrySize), 64*1024)
 
 	var segments []SegmentRecord
-	segmentIndex := 0
 	entryData := make([]byte, EntrySize)
-
-	for i := 0; i < int(entryCount)+20; i++ {
-		n, err := f.Read(entryData)
-		if err != nil || n < EntrySize {
+	for i := 0; i < slots; i++ {
+		if _, err := io.ReadFull(r, entryData); err != nil {
 			break
 		}
-
-		channel := int(entryData[4])
-		frameCount := int(binary.LittleEndian.Uint16(entryData[6:8]))
-		startTime := int64(binary.LittleEndian.Uint32(entryData[8:12]))
-		endTime := int64(binary.LittleEndian.Uint32(entryData[12:16]))
-
-		// 过滤无效记录
-		if channel == 0 || channel == 0xFE {
-			segmentIndex++
-			continue
-		}
-		if startTime < MinValidTimestamp || endTime <= startTime {
-			segmentIndex++
-			continue
+		if seg, ok := parseTIndexEntry(entryData, i); ok {
+			segments = append(segments, seg)
 		}
-
-		segments = append(segments, SegmentRecord{
-			FileIndex:  segmentIndex,
-			Channel:    channel,
-			StartTime:  startTime,
-			EndTime:    endTime,
-			FrameCount: frameCount,
-		})
-		segmentIndex++
 	}
 
-	return segments, int(fileCount), int(entryCount), nil
+	if entryCount <= 0 || entryCount > slots {
+		used := 0
+		if len(segments) > 0 {
+			used = segments[len(segments)-1].FileIndex + 1
+		}
+		LogWarn("主索引文件头的条目数无效，按逐条校验的结果计算",
+			"file", filepath.Base(indexPath),
+			"headerEntries", entryCount,
+			"slots", slots,
+			"entries", used)
+		entryCount = used
+	} else if n := len(segments); n > 0 && segments[n-1].FileIndex >= entryCount {
+		LogDebug("主索引在文件头的条目数之后还有有效条目",
+			"file", filepath.Base(indexPath),
+			"headerEntries", entryCount,
+			"lastEntry", segments[n-1].FileIndex)
+	}
+
+	return segments, int(fileCount), entryCount, nil
 }
 
 // ============================================================================
@@ -534,7 +1118,7 @@ func ParseTIndex(indexPath string) ([]SegmentRecord, int, int, error) {
 
 // VideoStreamReader 视频流读取器
 type VideoStreamReader struct {
-	f              *os.File
+	f              *RecFileReader
 	streamPos      int64
 	buffer         []byte
 	bufferStartPos int64
@@ -546,10 +1130,21 @@ type VideoStreamReader struct {
 	seg            *SegmentRecord
 	frameOffsets   []VPSPosition
 	usePreciseTime bool
+
+	// 取消读取（SetContext 设置，nil 时不可取消）
+	ctx context.Context
+
+	// 已输出的最大精确时间（毫秒），I 帧时间倒退时输出的时间戳保持不变而不回退；SeekTo 后重新开始
+	lastPreciseMs   int64
+	timeRegressions int
+
+	// 帧负载解密（CreateStreamReader 在设置了解密器时填入），frames 按 FileOffset 升序
+	decryptor FrameDecryptor
+	frames    []FrameIndexRecord
 }
 
 // NewVideoStreamReader 创建视频流读取器
-func NewVideoStreamReader(f *os.File, startPos int64, startTimeMs int64,
+func NewVideoStreamReader(f *RecFileReader, startPos int64, startTimeMs int64,
 	seg *SegmentRecord, frameOffsets []VPSPosition) *VideoStreamReader {
 	return &VideoStreamReader{
 		f:              f,
@@ -568,6 +1163,25 @@ func (r *VideoStreamReader) SetFPS(fps float64) {
 	r.frameIntervalMs = int64(1000 / fps)
 }
 
+// SetContext 设置读取的 context，取消后 ReadNextNals 停止重试并返回空结果
+// （而不是把缓冲中不完整的 NAL 当作文件结束输出）
+func (r *VideoStreamReader) SetContext(ctx context.Context) {
+	r.ctx = ctx
+}
+
+// readAt 按 SetContext 设置的 context 读取
+func (r *VideoStreamReader) readAt(p []byte, off int64) (int, error) {
+	if r.ctx == nil {
+		return r.f.ReadAt(p, off)
+	}
+	return r.f.ReadAtContext(r.ctx, p, off)
+}
+
+// cancelled 读取是否已被取消
+func (r *VideoStreamReader) cancelled() bool {
+	return r.ctx != nil && r.ctx.Err() != nil
+}
+
 const (
 	chunkSize     = 64 * 1024  // 64KB
 	minBufferSize = 256 * 1024 // 256KB
@@ -578,12 +1192,17 @@ func (r *VideoStreamReader) fillBuffer() bool {
 		return true
 	}
 
-	r.f.Seek(r.streamPos, 0)
 	chunk := make([]byte, chunkSize)
-	n, err := r.f.Read(chunk)
-	if err != nil || n == 0 {
+	n, _ := r.readAt(chunk, r.streamPos)
+	if n == 0 {
 		return false
 	}
+	if r.decryptor != nil {
+		if err := decryptRange(r.decryptor, r.frames, chunk[:n], r.streamPos); err != nil {
+			LogWarn("帧数据解密失败", "offset", r.streamPos, "error", err)
+			return false
+		}
+	}
 
 	if len(r.buffer) == 0 {
 		r.bufferStartPos = r.streamPos
@@ -599,8 +1218,21 @@ func (r *VideoStreamReader) getPreciseTimeMs(nalFileOffset int64) int64 {
 		return r.currentTimeMs
 	}
 
-	preciseTime := CalculatePreciseTimeFromIFrames(r.frameOffsets, int(nalFileOffset), r.seg)
-	return preciseTime * 1000
+	preciseMs := CalculatePreciseTimeFromIFrames(r.frameOffsets, int(nalFileOffset), r.seg) * 1000
+	if preciseMs < r.lastPreciseMs {
+		// 同一读取器中 NAL 的文件偏移只增不减，时间倒退说明 I 帧时间异常
+		if r.timeRegressions == 0 {
+			LogWarn("精确时间倒退，保持上一帧的时间",
+				"segment", r.seg.FileIndex,
+				"offset", nalFileOffset,
+				"timeMs", preciseMs,
+				"lastTimeMs", r.lastPreciseMs)
+		}
+		r.timeRegressions++
+		return r.lastPreciseMs
+	}
+	r.lastPreciseMs = preciseMs
+	return preciseMs
 }
 
 // NalResult NAL 读取结果
@@ -609,14 +1241,19 @@ type NalResult struct {
 	NalType    int
 	TimestampMs int64
 	FileOffset int64
+	Size       int // 含起始码，FileOffset+Size 为下一个 NAL 的位置
 }
 
 // ReadNextNals 读取下一批 NAL 单元
+// 最后一个 NAL 在读到下一个起始码之前可能不完整，暂不输出；文件结束时作为最后一批输出
 func (r *VideoStreamReader) ReadNextNals() []NalResult {
 	maxAttempts := 10
 	for attempt := 0; attempt < maxAttempts; attempt++ {
 		if !r.fillBuffer() {
-			return nil
+			if r.cancelled() {
+				return nil
+			}
+			return r.flushRemaining()
 		}
 
 		nalUnits := ParseNalUnits(r.buffer)
@@ -625,28 +1262,7 @@ func (r *VideoStreamReader) ReadNextNals() []NalResult {
 
 			// 发送除最后一个之外的所有 NAL
 			for i := 0; i < len(nalUnits)-1; i++ {
-				nal := nalUnits[i]
-				nalData := StripStartCode(r.buffer[nal.Offset : nal.Offset+nal.Size])
-				nalFileOffset := r.bufferStartPos + int64(nal.Offset)
-
-				var timestampMs int64
-				if r.usePreciseTime && IsVideoFrame(nal.NalType) {
-					timestampMs = r.getPreciseTimeMs(nalFileOffset)
-				} else {
-					timestampMs = r.currentTimeMs
-				}
-
-				results = append(results, NalResult{
-					Data:       nalData,
-					NalType:    nal.NalType,
-					TimestampMs: timestampMs,
-					FileOffset: nalFileOffset,
-				})
-
-				if IsVideoFrame(nal.NalType) {
-					r.frameCount++
-					r.currentTimeMs += r.frameIntervalMs
-				}
+				results = append(results, r.nalResult(nalUnits[i]))
 			}
 
 			// 移除已处理的数据
@@ -661,11 +1277,13 @@ func (r *VideoStreamReader) ReadNextNals() []NalResult {
 			r.buffer = r.buffer[:0]
 		} else if len(nalUnits) == 1 {
 			// 读取更多数据
-			r.f.Seek(r.streamPos, 0)
 			chunk := make([]byte, chunkSize*4)
-			n, _ := r.f.Read(chunk)
+			n, _ := r.readAt(chunk, r.streamPos)
 			if n == 0 {
-				return nil
+				if r.cancelled() {
+					return nil
+				}
+				return r.flushRemaining()
 			}
 			r.buffer = append(r.buffer, chunk[:n]...)
 			r.streamPos += int64(n)
@@ -675,8 +1293,50 @@ func (r *VideoStreamReader) ReadNextNals() []NalResult {
 	return nil
 }
 
+// flushRemaining 文件结束时输出缓冲中剩余的 NAL（没有后续起始码，延伸到数据末尾）
+// 否则段落的最后一帧永远等不到下一个起始码而被丢弃
+func (r *VideoStreamReader) flushRemaining() []NalResult {
+	nalUnits := ParseNalUnits(r.buffer)
+	var results []NalResult
+	for _, nal := range nalUnits {
+		results = append(results, r.nalResult(nal))
+	}
+	r.bufferStartPos += int64(len(r.buffer))
+	r.buffer = r.buffer[:0]
+	return results
+}
+
+// nalResult 构造缓冲中一个 NAL 的读取结果，视频帧推进当前时间
+func (r *VideoStreamReader) nalResult(nal NalUnit) NalResult {
+	nalData := StripStartCode(r.buffer[nal.Offset : nal.Offset+nal.Size])
+	nalFileOffset := r.bufferStartPos + int64(nal.Offset)
+
+	var timestampMs int64
+	if r.usePreciseTime && IsVideoFrame(nal.NalType) {
+		timestampMs = r.getPreciseTimeMs(nalFileOffset)
+	} else {
+		timestampMs = r.currentTimeMs
+	}
+
+	if IsVideoFrame(nal.NalType) {
+		r.frameCount++
+		r.currentTimeMs += r.frameIntervalMs
+	}
+
+	return NalResult{
+		Data:        nalData,
+		NalType:     nal.NalType,
+		TimestampMs: timestampMs,
+		FileOffset:  nalFileOffset,
+		Size:        nal.Size,
+	}
+}
+
 // Close 关闭读取器
 func (r *VideoStreamReader) Close() {
+	if r.timeRegressions > 0 {
+		LogWarn("精确时间倒退的 NAL 已按上一帧的时间输出", "segment", r.seg.FileIndex, "count", r.timeRegressions)
+	}
 	if r.f != nil {
 		r.f.Close()
 	}
@@ -687,6 +1347,25 @@ func (r *VideoStreamReader) GetStreamPos() int64 {
 	return r.streamPos
 }
 
+// SeekTo 将读取器定位到 byteOffset，下一次 ReadNextNals 从该位置开始
+// 目标位于已缓冲的数据内时保留缓冲，否则清空后从新位置重新读取；timeMs 为新位置的时间
+func (r *VideoStreamReader) SeekTo(byteOffset int64, timeMs int64) error {
+	if byteOffset < 0 || byteOffset >= TRecIndexRegionStart {
+		return fmt.Errorf("偏移超出数据区域: %d", byteOffset)
+	}
+
+	if byteOffset >= r.bufferStartPos && byteOffset < r.bufferStartPos+int64(len(r.buffer)) {
+		r.buffer = r.buffer[byteOffset-r.bufferStartPos:]
+	} else {
+		r.buffer = r.buffer[:0]
+		r.streamPos = byteOffset
+	}
+	r.bufferStartPos = byteOffset
+	r.currentTimeMs = timeMs
+	r.lastPreciseMs = 0
+	return nil
+}
+
 // ============================================================================
 // TPS 存储管理器
 // ============================================================================
@@ -694,6 +1373,7 @@ func (r *VideoStreamReader) GetStreamPos() int64 {
 // TPSStorage TPS 存储管理器
 type TPSStorage struct {
 	dvrPath    string
+	sources    []IndexSource // 主索引所在的来源目录，下标为 FileIndex / SourceFileStride
 	segments   []SegmentRecord
 	fileCount  int
 	entryCount int
@@ -705,9 +1385,17 @@ type TPSStorage struct {
 
 	// 缓存构建状态
 	cacheBuilding  bool
+	cacheCancelled bool // 最近一次构建被取消
 	cacheProgress  int
 	cacheTotal     int
 	cacheCurrent   int
+
+	// 已打开的录像文件句柄（ReadFrameCached 使用）
+	readers   map[int]*RecFileReader
+	readersMu sync.Mutex
+
+	// 压缩模式下最近解码的帧索引
+	decoded compactDecodeCache
 }
 
 // NewTPSStorage 创建 TPS 存储管理器
@@ -715,27 +1403,33 @@ func NewTPSStorage(dvrPath string) *TPSStorage {
 	return &TPSStorage{
 		dvrPath:        dvrPath,
 		cachedSegments: make(map[int]*CachedSegmentInfo),
+		readers:        make(map[int]*RecFileReader),
 	}
 }
 
 // Load 加载主索引
 func (s *TPSStorage) Load() error {
-	indexPath := filepath.Join(s.dvrPath, "TIndex00.tps")
-	if _, err := os.Stat(indexPath); os.IsNotExist(err) {
-		return fmt.Errorf("索引文件不存在: %s", indexPath)
+	sources, err := FindIndexSources(s.dvrPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		indexPath := filepath.Join(s.dvrPath, "TIndex00.tps")
+		return fmt.Errorf("索引文件不存在: %s: %w", indexPath, os.ErrNotExist)
+	}
+	if err != nil {
+		return fmt.Errorf("加载索引失败: %w", err)
 	}
 
-	segments, fileCount, entryCount, err := ParseTIndex(indexPath)
+	segments, fileCount, entryCount, err := loadIndexSources(sources)
 	if err != nil {
-		return fmt.Errorf("加载索引失败: %v", err)
+		return fmt.Errorf("加载索引失败: %w", err)
 	}
 
+	s.sources = sources
 	s.segments = segments
 	s.fileCount = fileCount
 	s.entryCount = entryCount
 	s.loaded = true
 
-	LogInfo("已加载段落索引", "count", len(segments))
+	LogInfo("已加载段落索引", "count", len(segments), "indexFiles", len(s.IndexFiles()), "sources", len(sources))
 	return nil
 }
 
@@ -749,6 +1443,33 @@ func (s *TPSStorage) GetSegments() []SegmentRecord {
 	return s.segments
 }
 
+// DVR 按文件编号循环写入：写满最后一个 TRec 文件后回到 TRec000000 覆盖最旧的录像，
+// 磁盘写满后文件编号不再代表时间顺序。TIndex 头中当前写入文件的字段位置未知，
+// 写入位置由段落结束时间确定
+
+// WriteHead 最近写入的 TRec 文件编号（结束时间最晚的段落），没有段落时返回 -1
+func (s *TPSStorage) WriteHead() int {
+	head, latest := -1, int64(0)
+	for _, seg := range s.segments {
+		if seg.EndTime > latest {
+			head, latest = seg.FileIndex, seg.EndTime
+		}
+	}
+	return head
+}
+
+// SegmentsByTime 按开始时间排序的段落副本（不受循环覆盖影响），newestFirst 时从最新开始
+func (s *TPSStorage) SegmentsByTime(newestFirst bool) []SegmentRecord {
+	segments := append([]SegmentRecord(nil), s.segments...)
+	sort.SliceStable(segments, func(i, j int) bool {
+		if newestFirst {
+			return segments[i].StartTime > segments[j].StartTime
+		}
+		return segments[i].StartTime < segments[j].StartTime
+	})
+	return segments
+}
+
 // ==================== 缓存管理 ====================
 
 // BuildCache 构建段落缓存（多线程并行）
@@ -759,6 +1480,12 @@ func (s *TPSStorage) BuildCache(fileIndices []int, progressCallback func(current
 // BuildCacheWithWorkers 构建段落缓存（指定线程数）
 // workers=0 时使用 CPU 核心数
 func (s *TPSStorage) BuildCacheWithWorkers(fileIndices []int, progressCallback func(current, total, fileIndex int), workers int) int {
+	return s.BuildCacheWithWorkersContext(context.Background(), fileIndices, progressCallback, workers)
+}
+
+// BuildCacheWithWorkersContext 与 BuildCacheWithWorkers 相同，ctx 取消后不再开始新的段落
+// 正在构建的段落完成后工作线程退出，已缓存的段落保留；返回缓存成功的段落数
+func (s *TPSStorage) BuildCacheWithWorkersContext(ctx context.Context, fileIndices []int, progressCallback func(current, total, fileIndex int), workers int) int {
 	if !s.loaded {
 		return 0
 	}
@@ -787,21 +1514,14 @@ func (s *TPSStorage) BuildCacheWithWorkers(fileIndices []int, progressCallback f
 
 	// 默认使用 2 个线程（USB/机械硬盘优化）
 	// 过多并发在 IO 密集型场景反而更慢
-	if workers <= 0 {
-		workers = 2
-	}
-	if workers > 4 {
-		workers = 4 // 限制最大并发数，避免 IO 瓶颈
-	}
-	if workers > total {
-		workers = total
-	}
+	workers = normalizeWorkers(workers, total)
 
 	LogInfo("缓存构建: 启动", "workers", workers, "segments", total)
 	buildStart := time.Now()
 
 	s.mu.Lock()
 	s.cacheBuilding = true
+	s.cacheCancelled = false
 	s.cacheTotal = total
 	s.cacheCurrent = 0
 	s.cacheProgress = 0
@@ -818,10 +1538,11 @@ func (s *TPSStorage) BuildCacheWithWorkers(fileIndices []int, progressCallback f
 	}
 	close(workChan)
 
-	// 结果收集
+	// 结果收集（skipped 为取消后未构建的段落）
 	type result struct {
 		fileIndex int
 		info      *CachedSegmentInfo
+		skipped   bool
 	}
 	resultChan := make(chan result, total)
 
@@ -832,6 +1553,10 @@ func (s *TPSStorage) BuildCacheWithWorkers(fileIndices []int, progressCallback f
 		go func() {
 			defer wg.Done()
 			for work := range workChan {
+				if ctx.Err() != nil {
+					resultChan <- result{fileIndex: work.seg.FileIndex, skipped: true}
+					continue
+				}
 				cachedInfo, err := s.buildSegmentCache(work.seg)
 				if err == nil && cachedInfo != nil {
 					resultChan <- result{fileIndex: work.seg.FileIndex, info: cachedInfo}
@@ -852,6 +1577,9 @@ func (s *TPSStorage) BuildCacheWithWorkers(fileIndices []int, progressCallback f
 	cachedCount := 0
 	processed := 0
 	for res := range resultChan {
+		if res.skipped {
+			continue
+		}
 		processed++
 		if res.info != nil {
 			s.mu.Lock()
@@ -870,12 +1598,20 @@ func (s *TPSStorage) BuildCacheWithWorkers(fileIndices []int, progressCallback f
 		}
 	}
 
+	cancelled := ctx.Err() != nil
 	s.mu.Lock()
 	s.cacheBuilding = false
-	s.cacheProgress = 100
+	s.cacheCancelled = cancelled
+	if !cancelled {
+		s.cacheProgress = 100
+	}
 	s.mu.Unlock()
 
 	buildTime := time.Since(buildStart)
+	if cancelled {
+		LogInfo("缓存构建: 已取消", "cached", cachedCount, "processed", processed, "total", total)
+		return cachedCount
+	}
 	LogInfo("缓存构建: 完成",
 		"cached", cachedCount, "total", total,
 		"duration", buildTime.Round(time.Millisecond),
@@ -889,7 +1625,7 @@ func (s *TPSStorage) buildSegmentCache(seg *SegmentRecord) (*CachedSegmentInfo,
 
 	recFile := s.GetRecFile(seg.FileIndex)
 	if recFile == "" {
-		return nil, fmt.Errorf("rec file not found")
+		return nil, ErrRecFileNotFound
 	}
 
 	// 加载帧索引（带 mmap 缓存）
@@ -933,6 +1669,11 @@ func (s *TPSStorage) buildSegmentCache(seg *SegmentRecord) (*CachedSegmentInfo,
 	}
 	vpsTime := time.Since(startVPS)
 
+	if len(vpsPositions) == 0 {
+		LogWarn("未找到 VPS，精确时间回退到帧索引 I 帧/线性插值",
+			"segment", seg.FileIndex, "file", filepath.Base(recFile))
+	}
+
 	totalTime := time.Since(startTotal)
 	LogDebug("段落缓存构建",
 		"segment", seg.FileIndex,
@@ -944,12 +1685,20 @@ func (s *TPSStorage) buildSegmentCache(seg *SegmentRecord) (*CachedSegmentInfo,
 		"t_vps", vpsTime.Round(time.Millisecond),
 		"t_total", totalTime.Round(time.Millisecond))
 
-	return &CachedSegmentInfo{
+	info := &CachedSegmentInfo{
 		Segment:      seg,
 		FrameIndex:   frameIndex,
 		VPSPositions: vpsPositions,
 		AudioFrames:  audioFrames,
-	}, nil
+		VideoStats:   ComputeVideoStats(frameIndex),
+	}
+	info.StartUs, info.EndUs = videoTimeRangeUs(frameIndex)
+	if compactFrameIndex.Load() {
+		info.compactFrames = CompressFrameIndex(frameIndex)
+		info.compactAudio = CompressFrameIndex(audioFrames)
+		info.FrameIndex, info.AudioFrames = nil, nil
+	}
+	return info, nil
 }
 
 func (s *TPSStorage) findAudioTimeForOffset(audioFrames []FrameIndexRecord, targetOffset int, seg *SegmentRecord) int64 {
@@ -981,6 +1730,7 @@ func (s *TPSStorage) GetCacheStatus() map[string]interface{} {
 
 	return map[string]interface{}{
 		"building":           s.cacheBuilding,
+		"cancelled":          s.cacheCancelled,
 		"progress":           s.cacheProgress,
 		"total_segments":     len(s.segments),
 		"cached_segments":    len(s.cachedSegments),
@@ -1021,17 +1771,35 @@ func (s *TPSStorage) GetAudioFrames(fileIndex int) []FrameIndexRecord {
 	defer s.mu.RUnlock()
 
 	if cached, ok := s.cachedSegments[fileIndex]; ok {
+		if cached.compactAudio != nil {
+			return s.decoded.get(cached.compactAudio)
+		}
 		return cached.AudioFrames
 	}
 	return nil
 }
 
+// HasAudio 已缓存段落是否包含音频帧（不解码压缩索引）
+func (s *TPSStorage) HasAudio(fileIndex int) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cached, ok := s.cachedSegments[fileIndex]
+	if !ok {
+		return false
+	}
+	if cached.compactAudio != nil {
+		return cached.compactAudio.Len() > 0
+	}
+	return len(cached.AudioFrames) > 0
+}
+
 // ==================== 基础查询 ====================
 
-// GetRecFile 获取录像文件路径
+// GetRecFile 获取录像文件路径，文件不存在时返回空字符串
 func (s *TPSStorage) GetRecFile(fileIndex int) string {
-	filepath := filepath.Join(s.dvrPath, fmt.Sprintf("TRec%06d.tps", fileIndex))
-	if _, err := os.Stat(filepath); os.IsNotExist(err) {
+	filepath := s.RecFilePath(fileIndex)
+	if _, err := statFile(filepath); errors.Is(err, fs.ErrNotExist) {
 		return ""
 	}
 	return filepath
@@ -1077,18 +1845,20 @@ func (s *TPSStorage) GetSegmentByFileIndex(fileIndex int) *SegmentRecord {
 	return nil
 }
 
-// GetIFrameOffsets 获取 I 帧偏移列表
+// GetIFrameOffsets 获取指定视频通道（帧索引通道 2 或 258）的 I 帧偏移列表
+// VPS 缓存按字节扫描，不区分通道，只在文件中只有一路视频时使用；
+// 两路视频（2 和 258）在同一文件中交错时从帧索引按通道提取
 func (s *TPSStorage) GetIFrameOffsets(fileIndex int, channel int) []VPSPosition {
 	s.mu.RLock()
 	cached := s.cachedSegments[fileIndex]
 	s.mu.RUnlock()
 
-	if cached != nil && len(cached.VPSPositions) > 0 {
+	frameIndex := s.GetFrameIndex(fileIndex)
+	if cached != nil && len(cached.VPSPositions) > 0 && !hasOtherVideoChannel(frameIndex, channel) {
 		return cached.VPSPositions
 	}
 
-	// 回退：从帧索引提取
-	frameIndex := s.GetFrameIndex(fileIndex)
+	// 从帧索引提取
 	var videoFrames []FrameIndexRecord
 	for _, f := range frameIndex {
 		if int(f.Channel) == channel {
@@ -1098,7 +1868,7 @@ func (s *TPSStorage) GetIFrameOffsets(fileIndex int, channel int) []VPSPosition
 
 	var iFrameOffsets []VPSPosition
 	for _, vf := range videoFrames {
-		if vf.FrameType == FrameTypeI {
+		if vf.IsIFrame() {
 			iFrameOffsets = append(iFrameOffsets, VPSPosition{
 				Offset: int(vf.FileOffset),
 				Time:   int64(vf.UnixTs),
@@ -1113,17 +1883,123 @@ func (s *TPSStorage) GetIFrameOffsets(fileIndex int, channel int) []VPSPosition
 	return iFrameOffsets
 }
 
+// hasOtherVideoChannel 帧索引中是否有 channel 之外的视频通道
+func hasOtherVideoChannel(records []FrameIndexRecord, channel int) bool {
+	for _, r := range records {
+		if (r.Channel == ChannelVideo1 || r.Channel == ChannelVideo2) && int(r.Channel) != channel {
+			return true
+		}
+	}
+	return false
+}
+
 // GetFrameIndex 获取帧索引
 func (s *TPSStorage) GetFrameIndex(fileIndex int) []FrameIndexRecord {
 	s.mu.RLock()
 	if cached, ok := s.cachedSegments[fileIndex]; ok {
 		s.mu.RUnlock()
+		if cached.compactFrames != nil {
+			return s.decoded.get(cached.compactFrames)
+		}
 		return cached.FrameIndex
 	}
 	s.mu.RUnlock()
 	return nil
 }
 
+// ReadFrame 读取单帧数据
+func (s *TPSStorage) ReadFrame(fileIndex int, frame FrameIndexRecord) ([]byte, error) {
+	recFile := s.GetRecFile(fileIndex)
+	if recFile == "" {
+		return nil, ErrRecFileNotFound
+	}
+
+	if err := checkFrameSize(frame); err != nil {
+		return nil, err
+	}
+	f, err := OpenRecFile(recFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data := make([]byte, frame.FrameSize)
+	if err := readFull(f, data, int64(frame.FileOffset)); err != nil {
+		return nil, err
+	}
+	if err := decryptFrame(data, frame); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ReadFrameCached 读取单帧数据（复用已打开的文件句柄，适合流式读取）
+func (s *TPSStorage) ReadFrameCached(fileIndex int, frame FrameIndexRecord) ([]byte, error) {
+	if err := checkFrameSize(frame); err != nil {
+		return nil, err
+	}
+	r, err := s.getReader(fileIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, frame.FrameSize)
+	if err := readFull(r, data, int64(frame.FileOffset)); err != nil {
+		return nil, err
+	}
+	if err := decryptFrame(data, frame); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ReadRaw 读取 TRec 文件任意偏移处的原始字节（诊断用）
+// 到达文件末尾时返回实际读到的部分
+func (s *TPSStorage) ReadRaw(fileIndex int, offset int64, length int) ([]byte, error) {
+	r, err := s.getReader(fileIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, length)
+	n, err := r.ReadAt(data, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+// getReader 获取或打开文件句柄
+func (s *TPSStorage) getReader(fileIndex int) (*RecFileReader, error) {
+	s.readersMu.Lock()
+	defer s.readersMu.Unlock()
+
+	if r, ok := s.readers[fileIndex]; ok {
+		return r, nil
+	}
+
+	recFile := s.GetRecFile(fileIndex)
+	if recFile == "" {
+		return nil, ErrRecFileNotFound
+	}
+	r, err := OpenRecFile(recFile)
+	if err != nil {
+		return nil, err
+	}
+	s.readers[fileIndex] = r
+	return r, nil
+}
+
+// Close 关闭所有已打开的文件句柄
+func (s *TPSStorage) Close() {
+	s.readersMu.Lock()
+	defer s.readersMu.Unlock()
+	for _, r := range s.readers {
+		r.Close()
+	}
+	s.readers = make(map[int]*RecFileReader)
+}
+
 // FindVPSForTime 使用 VPS 缓存查找目标时间对应的 VPS 位置
 func (s *TPSStorage) FindVPSForTime(fileIndex int, targetTime int64) *VPSPosition {
 	s.mu.RLock()
@@ -1153,6 +2029,9 @@ func (s *TPSStorage) FindVPSForTime(fileIndex int, targetTime int64) *VPSPositio
 	return bestVPS
 }
 
+// videoHeaderReadSize ReadVideoHeader 从 I 帧位置最多读取的字节数
+const videoHeaderReadSize = 512 * 1024
+
 // ReadVideoHeader 从 I 帧位置读取视频头
 func (s *TPSStorage) ReadVideoHeader(fileIndex int, iframeOffset int64) *VideoHeader {
 	recFile := s.GetRecFile(fileIndex)
@@ -1160,24 +2039,41 @@ func (s *TPSStorage) ReadVideoHeader(fileIndex int, iframeOffset int64) *VideoHe
 		return nil
 	}
 
-	f, err := os.Open(recFile)
+	f, err := openFile(recFile)
 	if err != nil {
 		return nil
 	}
 	defer f.Close()
 
-	f.Seek(iframeOffset, 0)
-	data := make([]byte, 512*1024) // 512KB
-	n, err := f.Read(data)
-	if err != nil || n == 0 {
+	// 只读取数据区域：靠近 TRecIndexRegionStart 的 I 帧不能把索引区的字节当作帧数据
+	if iframeOffset < 0 || iframeOffset >= TRecIndexRegionStart {
+		return nil
+	}
+	data := make([]byte, min(videoHeaderReadSize, TRecIndexRegionStart-iframeOffset))
+	n, err := f.ReadAt(data, iframeOffset)
+	if n == 0 || (err != nil && err != io.EOF) {
 		return nil
 	}
 	data = data[:n]
+	if d := GetFrameDecryptor(); d != nil {
+		if err := decryptRange(d, s.decryptionFrames(fileIndex), data, iframeOffset); err != nil {
+			return nil
+		}
+	}
 
 	header := FindVPSSPSPPSIDR(data)
-	if header != nil {
-		header.StreamStartPos = iframeOffset + header.StreamStartPos
+	if header == nil {
+		return nil
+	}
+	// IDR 之后没有下一个起始码时一直延伸到读取的末尾，数据区域最后一个 GOP 的 IDR 后面是
+	// 到索引区的零填充。H.265 的 NAL 不会以 0x00 结尾（停止位之后才补零，cabac_zero_word 以 0x03 结尾），
+	// 去掉这些零字节
+	if header.StreamStartPos == int64(len(data)) {
+		trimmed := bytes.TrimRight(header.IDR, "\x00")
+		header.StreamStartPos -= int64(len(header.IDR) - len(trimmed))
+		header.IDR = trimmed
 	}
+	header.StreamStartPos = iframeOffset + header.StreamStartPos
 	return header
 }
 
@@ -1188,7 +2084,7 @@ func (s *TPSStorage) CreateStreamReader(fileIndex int, streamPos int64, startTim
 		return nil
 	}
 
-	f, err := os.Open(recFile)
+	f, err := OpenRecFile(recFile)
 	if err != nil {
 		return nil
 	}
@@ -1196,6 +2092,10 @@ func (s *TPSStorage) CreateStreamReader(fileIndex int, streamPos int64, startTim
 	seg := s.GetSegmentByFileIndex(fileIndex)
 	frameOffsets := s.GetIFrameOffsets(fileIndex, channel)
 
-	return NewVideoStreamReader(f, streamPos, startTimeMs, seg, frameOffsets)
+	reader := NewVideoStreamReader(f, streamPos, startTimeMs, seg, frameOffsets)
+	if d := GetFrameDecryptor(); d != nil {
+		reader.decryptor, reader.frames = d, s.decryptionFrames(fileIndex)
+	}
+	return reader
 }
 
@@ -0,0 +1,631 @@
+package seetong
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingStorage 本地文件系统，统计同时进行的 VPS 扫描块读取（[minRead, maxRead) 字节的 ReadAt）
+type countingStorage struct {
+	minRead int
+	maxRead int
+	delay   time.Duration
+	active  atomic.Int32
+	peak    atomic.Int32
+}
+
+func (s *countingStorage) Open(name string) (File, error) {
+	f, err := OSStorage{}.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &countingFile{File: f, s: s}, nil
+}
+
+func (s *countingStorage) Stat(name string) (fs.FileInfo, error) { return OSStorage{}.Stat(name) }
+func (s *countingStorage) ReadDir(name string) ([]fs.DirEntry, error) {
+	return OSStorage{}.ReadDir(name)
+}
+
+type countingFile struct {
+	File
+	s *countingStorage
+}
+
+func (f *countingFile) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) < f.s.minRead || len(p) >= f.s.maxRead {
+		return f.File.ReadAt(p, off)
+	}
+	n := f.s.active.Add(1)
+	defer f.s.active.Add(-1)
+	for {
+		peak := f.s.peak.Load()
+		if n <= peak || f.s.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(f.s.delay)
+	return f.File.ReadAt(p, off)
+}
+
+// writeMultiFileDVR 在临时目录写 files 个内容相同的 TRec 文件和对应的主索引
+func writeMultiFileDVR(t testing.TB, f *trecFixture, files int) string {
+	t.Helper()
+	dir := t.TempDir()
+	var segments []SegmentRecord
+	for i := 0; i < files; i++ {
+		f.write(t, filepath.Join(dir, fmt.Sprintf("TRec%06d.tps", i)))
+		segments = append(segments, f.segment(i))
+	}
+	writeTIndexFixture(t, filepath.Join(dir, "TIndex00.tps"), segments, uint32(files), files+1)
+	return dir
+}
+
+func TestBuildCacheSharesVPSScanReaders(t *testing.T) {
+	useTempCacheDir(t)
+	dir := writeMultiFileDVR(t, newTRecFixture(4, 10), 4)
+
+	st := &countingStorage{minRead: 4 << 20, maxRead: 5 << 20, delay: 2 * time.Millisecond}
+	SetStorage(st)
+	defer SetStorage(nil)
+	SetVPSScanWorkers(4)
+	defer SetVPSScanWorkers(0)
+
+	s := NewTPSStorage(dir)
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if cached := s.BuildCacheWithWorkers(nil, nil, 4); cached != 4 {
+		t.Fatalf("cached %d segments, want 4", cached)
+	}
+	if peak := st.peak.Load(); peak > maxScanReaders {
+		t.Fatalf("%d concurrent scan reads, want at most %d", peak, maxScanReaders)
+	}
+	for _, seg := range s.GetSegments() {
+		if n := len(s.GetCachedSegment(seg.FileIndex).VPSPositions); n != 4 {
+			t.Fatalf("segment %d: %d VPS positions, want 4", seg.FileIndex, n)
+		}
+	}
+}
+
+func TestScanVPSPositionsFindsIFrames(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		startCode []byte
+	}{
+		{"4-byte start codes", NalStartCode4},
+		{"3-byte start codes", NalStartCode3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newTRecFixtureWith(tc.startCode, 6, 8)
+			// 文件头末尾的 0x00 与 3 字节起始码组成 4 字节起始码，改为非零使位置就是帧偏移
+			f.Header[len(f.Header)-1] = 0xFF
+			recFile := f.write(t, filepath.Join(t.TempDir(), "TRec000000.tps"))
+
+			var want []int
+			for _, r := range f.Frames {
+				if r.IsIFrame() {
+					want = append(want, int(r.FileOffset))
+				}
+			}
+			for _, workers := range []int{1, 2, 4} {
+				got, err := ScanVPSPositionsWithWorkers(recFile, workers)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fmt.Sprint(got) != fmt.Sprint(want) {
+					t.Fatalf("workers=%d: VPS at %v, want %v", workers, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestScanVPSPositionsIgnoresLookalikeHeaders(t *testing.T) {
+	f := newTRecFixture(4, 10)
+	// G.711 负载中出现起始码和类型 32 但 NAL 头不是基础层 VPS 的字节
+	for i, lookalike := range [][]byte{
+		{0x00, 0x00, 0x01, 0x40, 0x00}, // nuh_temporal_id_plus1 为 0
+		{0x00, 0x00, 0x01, 0x41, 0x01}, // nuh_layer_id 不为 0
+		{0x00, 0x00, 0x01, 0xC0, 0x01}, // forbidden_zero_bit
+		{0x00, 0x00, 0x01, 0x40, 0x02}, // 时间子层 1
+	} {
+		audio := f.Data[2*i*10+1]
+		copy(audio[100:], lookalike)
+		copy(audio[200:], append([]byte{0x00}, lookalike...))
+	}
+	recFile := f.write(t, filepath.Join(t.TempDir(), "TRec000000.tps"))
+
+	var want []int
+	for _, r := range f.Frames {
+		if r.IsIFrame() {
+			want = append(want, int(r.FileOffset))
+		}
+	}
+	got, err := ScanVPSPositions(recFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("VPS at %v, want only the I frames at %v", got, want)
+	}
+}
+
+// BenchmarkBuildCacheVPSScan VPS 扫描：sequential 每个文件单线程扫描，parallel 每个文件 4 个线程；
+// 4 files 模拟缓存构建时 4 个缓存线程各自扫描一个文件，块读取共享 maxScanReaders 个配额
+func BenchmarkBuildCacheVPSScan(b *testing.B) {
+	dir := writeMultiFileDVR(b, newTRecFixture(4, 10), 4)
+	s := NewTPSStorage(dir)
+	if err := s.Load(); err != nil {
+		b.Fatal(err)
+	}
+	var files []string
+	for _, seg := range s.GetSegments() {
+		files = append(files, s.GetRecFile(seg.FileIndex))
+	}
+
+	for _, bc := range []struct {
+		name    string
+		files   int
+		workers int
+	}{
+		{"1 file sequential", 1, 1},
+		{"1 file parallel", 1, 4},
+		{"4 files sequential", 4, 1},
+		{"4 files parallel", 4, 4},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			SetVPSScanWorkers(bc.workers)
+			defer SetVPSScanWorkers(0)
+			b.SetBytes(int64(bc.files) * TRecIndexRegionStart)
+			for i := 0; i < b.N; i++ {
+				var wg sync.WaitGroup
+				for _, file := range files[:bc.files] {
+					wg.Add(1)
+					go func(file string) {
+						defer wg.Done()
+						if _, err := ScanVPSPositions(file); err != nil {
+							b.Error(err)
+						}
+					}(file)
+				}
+				wg.Wait()
+			}
+		})
+	}
+}
+
+// openNalStream 把 nals 依次写入一个小文件（不是完整的 TRec 文件），返回读取器和每个 NAL 的文件偏移
+func openNalStream(t testing.TB, nals [][]byte) (*RecFileReader, []int64) {
+	t.Helper()
+	var data []byte
+	var offsets []int64
+	for _, nal := range nals {
+		offsets = append(offsets, int64(len(data)))
+		data = append(data, nal...)
+	}
+	path := filepath.Join(t.TempDir(), "stream.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := OpenRecFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, offsets
+}
+
+// readAllNals 读到 ReadNextNals 返回空为止
+func readAllNals(r *VideoStreamReader) []NalResult {
+	var all []NalResult
+	for i := 0; i < 1000; i++ {
+		nals := r.ReadNextNals()
+		if len(nals) == 0 {
+			break
+		}
+		all = append(all, nals...)
+	}
+	return all
+}
+
+func TestVideoStreamReaderSeekTo(t *testing.T) {
+	// 400KB 的 P 帧，超过一次缓冲的数据量，前后跳转都落在缓冲之外
+	var nals [][]byte
+	for i := 0; i < 400; i++ {
+		nals = append(nals, fixturePFrame(1000, i))
+	}
+	f, offsets := openNalStream(t, nals)
+	r := NewVideoStreamReader(f, 0, 0, nil, nil)
+	defer r.Close()
+
+	first := r.ReadNextNals()
+	if len(first) == 0 || first[0].FileOffset != 0 {
+		t.Fatalf("first read: %d NALs", len(first))
+	}
+	// 第一个目标是第一次读取后仍在缓冲中的 NAL
+	for _, target := range []int{len(first), 300, 5, 399} {
+		timeMs := int64(target) * 40
+		if err := r.SeekTo(offsets[target], timeMs); err != nil {
+			t.Fatal(err)
+		}
+		got := readAllNals(r)
+		if len(got) != len(nals)-target {
+			t.Fatalf("seek to NAL %d: read %d NALs, want %d", target, len(got), len(nals)-target)
+		}
+		for i, nal := range got {
+			want := nals[target+i]
+			if nal.FileOffset != offsets[target+i] || !bytes.Equal(nal.Data, StripStartCode(want)) {
+				t.Fatalf("seek to NAL %d: result %d at %d, want NAL %d at %d", target, i, nal.FileOffset, target+i, offsets[target+i])
+			}
+		}
+		for i, nal := range got[:min(len(got), 3)] {
+			if want := timeMs + int64(i)*40; nal.TimestampMs != want {
+				t.Fatalf("seek to NAL %d: result %d at %dms, want %dms", target, i, nal.TimestampMs, want)
+			}
+		}
+	}
+
+	for _, off := range []int64{-1, TRecIndexRegionStart} {
+		if err := r.SeekTo(off, 0); err == nil {
+			t.Errorf("SeekTo(%d) succeeded outside the data region", off)
+		}
+	}
+}
+
+func TestVideoStreamReaderFlushesLastNalAtEOF(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		nals [][]byte
+	}{
+		{"single NAL", [][]byte{fixturePFrame(1000, 1)}},
+		// 最后一个 NAL 大于一次读取的数据量：先是不完整的，读到文件末尾才完整
+		{"long last NAL", [][]byte{fixturePFrame(1000, 1), fixturePFrame(500, 2), fixturePFrame(300*1024, 3)}},
+		{"3-byte start code", [][]byte{fixturePFrame(1000, 1), fixtureNal(NalStartCode3, NalTrailR, 2000, 2)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, offsets := openNalStream(t, tc.nals)
+			r := NewVideoStreamReader(f, 0, 0, nil, nil)
+			defer r.Close()
+
+			got := readAllNals(r)
+			if len(got) != len(tc.nals) {
+				t.Fatalf("read %d NALs, want %d", len(got), len(tc.nals))
+			}
+			last, want := got[len(got)-1], tc.nals[len(tc.nals)-1]
+			if last.FileOffset != offsets[len(offsets)-1] || last.Size != len(want) || !bytes.Equal(last.Data, StripStartCode(want)) {
+				t.Fatalf("last NAL at %d (%d bytes), want %d (%d bytes)", last.FileOffset, last.Size, offsets[len(offsets)-1], len(want))
+			}
+		})
+	}
+}
+
+func TestVideoStreamReaderTimestampsMonotonicWithInvertedIFrames(t *testing.T) {
+	var nals [][]byte
+	for i := 0; i < 60; i++ {
+		nals = append(nals, fixturePFrame(1000, i))
+	}
+	f, offsets := openNalStream(t, nals)
+	seg := &SegmentRecord{StartTime: fixtureUnixTs, EndTime: fixtureUnixTs + 60}
+	// 第三个 I 帧的时间早于第二个（摄像机时钟跳变）
+	iFrames := []VPSPosition{
+		{Offset: int(offsets[0]), Time: fixtureUnixTs},
+		{Offset: int(offsets[15]), Time: fixtureUnixTs + 20},
+		{Offset: int(offsets[30]), Time: fixtureUnixTs + 5},
+		{Offset: int(offsets[45]), Time: fixtureUnixTs + 40},
+	}
+	if got := CalculatePreciseTimeFromIFrames(iFrames, int(offsets[20]), seg); got != fixtureUnixTs+20 {
+		t.Fatalf("time between inverted I-frames = %d, want the earlier I-frame's %d", got, fixtureUnixTs+20)
+	}
+
+	r := NewVideoStreamReader(f, 0, 0, seg, iFrames)
+	defer r.Close()
+	got := readAllNals(r)
+	if len(got) != len(nals) {
+		t.Fatalf("read %d NALs, want %d", len(got), len(nals))
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].TimestampMs < got[i-1].TimestampMs {
+			t.Fatalf("NAL %d at %dms after NAL %d at %dms", i, got[i].TimestampMs, i-1, got[i-1].TimestampMs)
+		}
+	}
+	if first, last := got[0].TimestampMs, got[len(got)-1].TimestampMs; first != fixtureUnixTs*1000 || last < (fixtureUnixTs+40)*1000 {
+		t.Fatalf("timestamps %d..%d, want %d..>=%d", first, last, fixtureUnixTs*1000, (fixtureUnixTs+40)*1000)
+	}
+}
+
+func TestReadVideoHeaderStopsAtIndexRegion(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		gap  int64 // I 帧结尾到 TRecIndexRegionStart 的零填充
+	}{
+		{"ends at index region", 0},
+		{"zero padding before index", 4096},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			useTempCacheDir(t)
+			f := newTRecFixture(2, 5)
+			last := fixtureIFrame(8000, 99)
+			f.add(FrameIndexRecord{FrameType: FrameTypeI, Channel: ChannelVideo1, TimestampUs: 400000, UnixTs: fixtureUnixTs + 1}, last)
+			offset := TRecIndexRegionStart - tc.gap - int64(len(last))
+			f.Frames[len(f.Frames)-1].FileOffset = uint32(offset)
+			dir, _ := writeDVRFixture(t, f)
+
+			s := NewTPSStorage(dir)
+			if err := s.Load(); err != nil {
+				t.Fatal(err)
+			}
+			header := s.ReadVideoHeader(0, offset)
+			if header == nil {
+				t.Fatal("no video header for the I-frame before the index region")
+			}
+			idr := fixtureNal(NalStartCode4, NalIDRWRadl, 8000, 99)
+			if !bytes.Equal(header.IDR, StripStartCode(idr)) {
+				t.Fatalf("IDR is %d bytes, want %d", len(header.IDR), len(idr)-len(NalStartCode4))
+			}
+			if want := TRecIndexRegionStart - tc.gap; header.StreamStartPos != want {
+				t.Fatalf("stream starts at %#x, want %#x", header.StreamStartPos, want)
+			}
+		})
+	}
+
+	dir, _ := writeDVRFixture(t, newTRecFixture(1, 5))
+	s := NewTPSStorage(dir)
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if header := s.ReadVideoHeader(0, TRecIndexRegionStart); header != nil {
+		t.Fatal("read a video header from the index region")
+	}
+}
+
+func TestParseTIndexIgnoresHeaderEntryCount(t *testing.T) {
+	f := newTRecFixture(1, 5)
+	var segments []SegmentRecord
+	for i, fileIndex := range []int{0, 3, 7, 12} {
+		seg := f.segment(fileIndex)
+		seg.StartTime += int64(i) * 3600
+		seg.EndTime += int64(i) * 3600
+		segments = append(segments, seg)
+	}
+	const slots = 16
+
+	for _, tc := range []struct {
+		name          string
+		headerEntries uint32
+		wantEntries   int
+	}{
+		{"correct count", slots, slots},
+		{"zeroed count", 0, 13}, // 最后一个有效条目之后
+		{"huge count", 0xFFFFFFFF, 13},
+		{"count below the valid entries", 2, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, seg := range segments {
+				f.write(t, filepath.Join(dir, fmt.Sprintf("TRec%06d.tps", seg.FileIndex)))
+			}
+			indexPath := writeTIndexFixture(t, filepath.Join(dir, "TIndex00.tps"), segments, tc.headerEntries, slots)
+			// 通道有效但时间范围无效的条目
+			data, err := os.ReadFile(indexPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			putTIndexEntry(data[SegmentIndexOffset+5*EntrySize:], SegmentRecord{Channel: 1, StartTime: fixtureUnixTs, EndTime: fixtureUnixTs})
+			if err := os.WriteFile(indexPath, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, _, entries, err := ParseTIndex(indexPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(segments) {
+				t.Fatalf("parsed %v, want %v", got, segments)
+			}
+			if entries != tc.wantEntries {
+				t.Fatalf("entry count %d, want %d", entries, tc.wantEntries)
+			}
+
+			s := NewTPSStorage(dir)
+			if err := s.Load(); err != nil {
+				t.Fatal(err)
+			}
+			if loaded := s.GetSegments(); len(loaded) != len(segments) {
+				t.Fatalf("storage loaded %d segments, want %d", len(loaded), len(segments))
+			}
+			// 归档主索引按文件大小遍历条目，只保留一个段落
+			for _, seg := range segments {
+				dst := filepath.Join(t.TempDir(), "TIndex00.tps")
+				if err := writeArchiveTIndex(s, seg, dst); err != nil {
+					t.Fatal(err)
+				}
+				archived, _, _, err := ParseTIndex(dst)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fmt.Sprint(archived) != fmt.Sprint([]SegmentRecord{seg}) {
+					t.Fatalf("archive index for file %d has %v", seg.FileIndex, archived)
+				}
+			}
+		})
+	}
+}
+
+// parseNalUnitsReference 改用 bytes.Index 之前逐字节比较的 ParseNalUnits，作为等价性测试的参照
+func parseNalUnitsReference(data []byte) []NalUnit {
+	var results []NalUnit
+	pos := 0
+
+	for pos < len(data)-4 {
+		var startLen int
+		if bytes.Equal(data[pos:pos+4], NalStartCode4) {
+			startLen = 4
+		} else if pos+3 <= len(data) && bytes.Equal(data[pos:pos+3], NalStartCode3) {
+			startLen = 3
+		} else {
+			pos++
+			continue
+		}
+
+		start := pos
+		nalBytePos := start + startLen
+		if nalBytePos >= len(data) {
+			break
+		}
+		nalType := (int(data[nalBytePos]) >> 1) & 0x3F
+
+		nextPos := pos + startLen
+		for nextPos < len(data)-4 {
+			if bytes.Equal(data[nextPos:nextPos+4], NalStartCode4) {
+				break
+			}
+			if nextPos+3 <= len(data) && bytes.Equal(data[nextPos:nextPos+3], NalStartCode3) {
+				break
+			}
+			nextPos++
+		}
+		if nextPos >= len(data)-4 {
+			nextPos = len(data)
+		}
+
+		results = append(results, NalUnit{
+			Offset:  start,
+			Size:    nextPos - start,
+			NalType: nalType,
+		})
+		pos = nextPos
+	}
+
+	return results
+}
+
+func TestParseNalUnitsMatchesReference(t *testing.T) {
+	cases := [][]byte{
+		nil,
+		{0, 0, 1},
+		{0, 0, 1, 0x40},
+		{0, 0, 1, 0x40, 0x01},       // 起始码在最后 4 字节内
+		{0, 0, 1, 0x40, 0x01, 0x0C}, // 起始码之后刚好 3 字节
+		{0, 0, 0, 1, 0x40, 0x01, 0x0C, 0x01},
+		{0, 0, 0, 0, 1, 0x26, 0x01, 0xAF, 0x09},    // 多余的前导零
+		{0, 0, 3, 0, 0, 1, 0x02, 0x01, 0xD0, 9},    // 防竞争字节
+		{0, 0, 1, 0, 0, 1, 0x02, 0x01, 0xD0, 9},    // 空 NAL 之后紧跟 3 字节起始码
+		{0, 0, 1, 0, 0, 0, 1, 0x02, 0x01, 0xD0},    // 空 NAL 之后紧跟 4 字节起始码
+		{0x40, 0, 0, 1, 0x40, 0x01, 1, 1, 0, 0, 1}, // 结尾的起始码被忽略
+	}
+	cases = append(cases, fixtureIFrame(200, 1), append(fixturePFrame(100, 2), fixtureNal(NalStartCode3, NalTrailR, 50, 3)...))
+
+	// 随机数据：大部分字节为 0 或 1，起始码、前导零和结尾附近的情况都会出现
+	rng := rand.New(rand.NewSource(1))
+	alphabet := []byte{0, 0, 0, 1, 3, 0x40, 0x26}
+	for i := 0; i < 20000; i++ {
+		data := make([]byte, rng.Intn(48))
+		for j := range data {
+			data[j] = alphabet[rng.Intn(len(alphabet))]
+		}
+		cases = append(cases, data)
+	}
+
+	for _, data := range cases {
+		if got, want := ParseNalUnits(data), parseNalUnitsReference(data); !reflect.DeepEqual(got, want) {
+			t.Fatalf("% x: got %+v, want %+v", data, got, want)
+		}
+	}
+}
+
+// BenchmarkParseNalUnits 一段 1MB 左右的视频流（每 25 帧一个 I 帧）
+func BenchmarkParseNalUnits(b *testing.B) {
+	var data []byte
+	for i := 0; len(data) < 1<<20; i++ {
+		if i%25 == 0 {
+			data = append(data, fixtureIFrame(60000, i)...)
+		} else {
+			data = append(data, fixturePFrame(8000+i%7*500, i)...)
+		}
+	}
+	for _, bc := range []struct {
+		name  string
+		parse func([]byte) []NalUnit
+	}{
+		{"bytes.Index", ParseNalUnits},
+		{"reference", parseNalUnitsReference},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				bc.parse(data)
+			}
+		})
+	}
+}
+
+// shiftedFixture 首帧 Unix 时间为 firstUnix 的合成录像
+func shiftedFixture(firstUnix int64) *trecFixture {
+	f := newTRecFixture(4, 25)
+	for i := range f.Frames {
+		f.Frames[i].UnixTs = f.Frames[i].UnixTs - fixtureUnixTs + uint32(firstUnix)
+	}
+	return f
+}
+
+func TestTimestampFilter(t *testing.T) {
+	const (
+		y2019 = 1546300800 // 2019-01-01 UTC
+		epoch = 3600       // RTC 未设置：1970-01-01 01:00 UTC
+	)
+	for _, tc := range []struct {
+		name      string
+		firstUnix int64
+		min       int64 // 0 使用默认下限
+		raw       bool
+		want      bool // 是否保留全部记录（否则全部丢弃）
+	}{
+		{"default minimum keeps 2023", fixtureUnixTs, 0, false, true},
+		{"default minimum drops 2019", y2019, 0, false, false},
+		{"lowered minimum keeps 2019", y2019, y2019 - 1, false, true},
+		{"lowered minimum still drops 1970", epoch, y2019 - 1, false, false},
+		{"raw mode keeps 1970", epoch, 0, true, true},
+		{"raw mode ignores the minimum", y2019, fixtureUnixTs, true, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			useTempCacheDir(t)
+			if tc.min > 0 {
+				SetMinValidTimestamp(tc.min)
+				defer SetMinValidTimestamp(MinValidTimestamp)
+			}
+			SetRawTimestampMode(tc.raw)
+			defer SetRawTimestampMode(false)
+
+			f := shiftedFixture(tc.firstUnix)
+			recFile := f.write(t, filepath.Join(t.TempDir(), "TRec000000.tps"))
+			records, err := ParseTRecFrameIndex(recFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := 0
+			if tc.want {
+				want = len(f.Frames)
+			}
+			if len(records) != want {
+				t.Fatalf("parsed %d records, want %d", len(records), want)
+			}
+			if tc.want {
+				checkFrameIndex(t, records, f.Frames)
+			}
+		})
+	}
+
+	// 下限本身无效
+	if isValidTimestamp(MinValidTimestamp) || !isValidTimestamp(MinValidTimestamp+1) {
+		t.Fatalf("default minimum %d: want only later timestamps valid", MinValidTimestamp)
+	}
+}
@@ -7,16 +7,29 @@ import (
 )
 
 var (
-	logger    *slog.Logger
-	loggerMu  sync.RWMutex
-	debugMode bool
+	logger     *slog.Logger
+	loggerMu   sync.RWMutex
+	debugMode  bool
+	jsonFormat bool
 )
 
 func init() {
 	// 默认使用 Info 级别的文本处理器
-	logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	}))
+	logger = newLogger()
+}
+
+// newLogger 根据当前调试模式和输出格式创建 logger（调用方需持有锁）
+func newLogger() *slog.Logger {
+	level := slog.LevelInfo
+	if debugMode {
+		level = slog.LevelDebug
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	if jsonFormat {
+		return slog.New(slog.NewJSONHandler(os.Stdout, opts))
+	}
+	return slog.New(slog.NewTextHandler(os.Stdout, opts))
 }
 
 // SetDebugMode 设置调试模式
@@ -24,15 +37,15 @@ func SetDebugMode(enabled bool) {
 	loggerMu.Lock()
 	defer loggerMu.Unlock()
 	debugMode = enabled
+	logger = newLogger()
+}
 
-	level := slog.LevelInfo
-	if enabled {
-		level = slog.LevelDebug
-	}
-
-	logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: level,
-	}))
+// SetLogFormat 设置日志格式（text 或 json）
+func SetLogFormat(format string) {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	jsonFormat = format == "json"
+	logger = newLogger()
 }
 
 // IsDebugMode 是否调试模式
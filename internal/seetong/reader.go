@@ -0,0 +1,182 @@
+package seetong
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// 带重试的录像文件读取
+// ============================================================================
+
+// 廉价 SD 转 USB 读卡器偶尔返回瞬时 input/output error，
+// 短暂退避后重试通常即可成功；持续失败时重新打开文件（设备重新挂载后旧 fd 失效）
+
+var (
+	readRetryAttempts = 3
+	readRetryBackoff  = 50 * time.Millisecond
+	readRetryMu       sync.RWMutex
+)
+
+// SetReadRetry 设置读取重试次数和初始退避时间（每次重试退避翻倍）
+func SetReadRetry(attempts int, backoff time.Duration) {
+	readRetryMu.Lock()
+	defer readRetryMu.Unlock()
+	if attempts < 1 {
+		attempts = 1
+	}
+	readRetryAttempts = attempts
+	readRetryBackoff = backoff
+}
+
+func getReadRetry() (int, time.Duration) {
+	readRetryMu.RLock()
+	defer readRetryMu.RUnlock()
+	return readRetryAttempts, readRetryBackoff
+}
+
+// RecFileReader 带重试的录像文件读取器（线程安全）
+type RecFileReader struct {
+	path string
+	f    File
+	mu   sync.RWMutex
+}
+
+// OpenRecFile 通过当前存储后端打开录像文件
+func OpenRecFile(path string) (*RecFileReader, error) {
+	f, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &RecFileReader{path: path, f: f}, nil
+}
+
+// ReadAt 实现 io.ReaderAt，读取失败时退避重试
+// io.EOF 是正常的文件结束，不重试
+func (r *RecFileReader) ReadAt(p []byte, off int64) (int, error) {
+	return r.ReadAtContext(context.Background(), p, off)
+}
+
+// ReadAtContext 与 ReadAt 相同，ctx 取消后不再重试（退避等待中立即返回 ctx.Err()）
+// 正在进行的单次读取无法中断，大块读取用 readFullContext 分块
+func (r *RecFileReader) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	attempts, backoff := getReadRetry()
+
+	var n int
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if ctx.Err() != nil {
+			return n, ctx.Err()
+		}
+		if attempt > 0 {
+			LogWarn("读取重试",
+				"file", filepath.Base(r.path),
+				"offset", off,
+				"attempt", attempt,
+				"error", err)
+			if err := sleepContext(ctx, backoff); err != nil {
+				return n, err
+			}
+			backoff *= 2
+
+			// 最后一次重试前重新打开文件
+			if attempt == attempts-1 {
+				r.reopen()
+			}
+		}
+
+		r.mu.RLock()
+		f := r.f
+		r.mu.RUnlock()
+		if f == nil {
+			return 0, os.ErrClosed
+		}
+
+		n, err = f.ReadAt(p, off)
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+// reopen 重新打开文件句柄
+func (r *RecFileReader) reopen() {
+	f, err := openFile(r.path)
+	if err != nil {
+		LogWarn("重新打开文件失败", "file", filepath.Base(r.path), "error", err)
+		return
+	}
+
+	r.mu.Lock()
+	old := r.f
+	r.f = f
+	r.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+}
+
+// Close 关闭文件
+func (r *RecFileReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+// sleepContext 等待 d，ctx 取消时提前返回 ctx.Err()
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// cancelReadChunk readFullContext 每次读取的最大字节数，两次读取之间检查取消
+const cancelReadChunk = 256 * 1024
+
+// readFullContext 分块读取完整的 len(buf) 字节，慢速设备上的大帧读取中途也能取消
+func readFullContext(ctx context.Context, r *RecFileReader, buf []byte, off int64) error {
+	for len(buf) > 0 {
+		chunk := buf
+		if len(chunk) > cancelReadChunk {
+			chunk = chunk[:cancelReadChunk]
+		}
+		n, err := r.ReadAtContext(ctx, chunk, off)
+		if n < len(chunk) {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		buf = buf[n:]
+		off += int64(n)
+	}
+	return nil
+}
+
+// readFull 从 ReaderAt 读取完整的 len(buf) 字节
+func readFull(r io.ReaderAt, buf []byte, off int64) error {
+	n, err := r.ReadAt(buf, off)
+	if n < len(buf) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return nil
+}
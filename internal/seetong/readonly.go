@@ -0,0 +1,96 @@
+package seetong
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// ============================================================================
+// 只读模式与缓存目录保护
+// ============================================================================
+
+// DVR 介质可能是只读的证物或即将写满的硬盘。只读模式下不读写任何缓存文件：
+// 帧索引和 VPS 位置每次加载都从录像文件解析，只保存在内存中。
+// 非只读模式下缓存目录也不能位于 DVR 路径之内（例如在 DVR 盘上直接运行程序时默认的 ./.index_cache），
+// 否则改用系统缓存目录。归档目录（-archive-to 生成）不是 DVR 介质，缓存默认放在其中的 .index_cache
+
+var readOnly atomic.Bool
+
+// ErrReadOnly 只读模式下拒绝的写入
+var ErrReadOnly = errors.New("read-only mode")
+
+// SetReadOnly 设置只读模式
+func SetReadOnly(enabled bool) {
+	readOnly.Store(enabled)
+}
+
+// IsReadOnly 是否为只读模式
+func IsReadOnly() bool {
+	return readOnly.Load()
+}
+
+// defaultCacheDir 未指定缓存目录时使用工作目录下的 .index_cache
+func defaultCacheDir() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		wd = "."
+	}
+	return filepath.Join(wd, ".index_cache")
+}
+
+// fallbackCacheDir 缓存目录位于 DVR 路径之内时改用的目录（系统缓存目录，取不到时为临时目录）
+func fallbackCacheDir() string {
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "seetong-dvr", "index_cache")
+	}
+	return filepath.Join(os.TempDir(), "seetong-dvr-index-cache")
+}
+
+// CacheDirOutside 返回不在 DVR 路径之内的缓存目录
+// dir 为空时使用默认的 ./.index_cache（dvrPath 为归档目录时为其中的 .index_cache）；
+// dir 位于 dvrPath 之内（含符号链接指向其中）时记录警告并返回系统缓存目录
+func CacheDirOutside(dir, dvrPath string) string {
+	archive := IsArchiveDir(dvrPath)
+	if dir == "" {
+		if archive {
+			return ArchiveCacheDir(dvrPath)
+		}
+		dir = defaultCacheDir()
+	}
+	if dvrPath == "" || archive || !isWithin(dir, dvrPath) {
+		return dir
+	}
+	fallback := fallbackCacheDir()
+	LogWarn("缓存目录位于 DVR 路径之内，改用系统缓存目录", "cacheDir", dir, "dvrPath", dvrPath, "fallback", fallback)
+	return fallback
+}
+
+// isWithin path 是否为 root 本身或位于其中
+func isWithin(path, root string) bool {
+	rel, err := filepath.Rel(resolvePath(root), resolvePath(path))
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// resolvePath 转为绝对路径并解析符号链接；路径尚不存在时解析其最近的已存在上级目录
+func resolvePath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	rest := ""
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return abs
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+	}
+}
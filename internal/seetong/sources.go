@@ -0,0 +1,155 @@
+package seetong
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// 多索引来源
+// ============================================================================
+
+// 分批复制的录像常见两种形式：同一目录下的 TIndex00.tps、TIndex01.tps……，
+// 或者每批一个子目录、各自带主索引。加载时把 DVR 路径及其子目录中的主索引都找出来，
+// 同一目录的多个索引合并（同一个 TRec 文件只保留一个段落），不同目录按来源编号区分文件编号：
+// 第 n 个来源目录的 TRecXXXXXX.tps 对应 FileIndex = n*SourceFileStride + XXXXXX。
+// 只有 DVR 路径本身一个来源时 FileIndex 与 TRec 文件编号相同
+
+const (
+	// SourceFileStride 每个来源目录占用的文件编号范围（TRec 文件编号为 6 位十进制）
+	SourceFileStride = 1000000
+
+	// sourceScanDepth 查找子目录中主索引的最大深度
+	sourceScanDepth = 2
+)
+
+// indexFilePattern 主索引文件名（TIndex00.tps、TIndex01.tps……）
+var indexFilePattern = regexp.MustCompile(`(?i)^TIndex\d{2}\.tps$`)
+
+// IsIndexFileName 文件名是否为主索引（不区分大小写）
+func IsIndexFileName(name string) bool {
+	return indexFilePattern.MatchString(name)
+}
+
+// IndexSource 一个来源目录及其中的主索引文件（按文件名排序）
+type IndexSource struct {
+	Dir        string   `json:"dir"`
+	IndexFiles []string `json:"indexFiles"`
+}
+
+// FindIndexSources 查找 dvrPath 及其子目录（最多 sourceScanDepth 层）中的主索引
+// dvrPath 本身有主索引时排在第一个，子目录按路径顺序；子目录无法读取时跳过。
+// 目录无法列举（例如 HTTP 存储没有目录页）时只检查 dvrPath/TIndex00.tps
+func FindIndexSources(dvrPath string) ([]IndexSource, error) {
+	var sources []IndexSource
+	if err := scanIndexSources(dvrPath, sourceScanDepth, &sources); err == nil && len(sources) > 0 {
+		return sources, nil
+	}
+	indexPath := filepath.Join(dvrPath, "TIndex00.tps")
+	if _, err := statFile(indexPath); err != nil {
+		return nil, err
+	}
+	return []IndexSource{{Dir: dvrPath, IndexFiles: []string{indexPath}}}, nil
+}
+
+// scanIndexSources 列举 dir 中的主索引并递归子目录，只有 dir 本身的读取错误会返回
+func scanIndexSources(dir string, depth int, sources *[]IndexSource) error {
+	entries, err := CurrentStorage().ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	source := IndexSource{Dir: dir}
+	var subdirs []string
+	for _, entry := range entries {
+		switch {
+		case entry.IsDir():
+			if depth > 0 && !strings.HasPrefix(entry.Name(), ".") {
+				subdirs = append(subdirs, filepath.Join(dir, entry.Name()))
+			}
+		case IsIndexFileName(entry.Name()):
+			source.IndexFiles = append(source.IndexFiles, filepath.Join(dir, entry.Name()))
+		}
+	}
+	if len(source.IndexFiles) > 0 {
+		sort.Strings(source.IndexFiles)
+		*sources = append(*sources, source)
+	}
+	for _, sub := range subdirs {
+		scanIndexSources(sub, depth-1, sources)
+	}
+	return nil
+}
+
+// loadIndexSources 解析所有来源的主索引，合并为一个段落列表
+// 同一目录的多个索引记录了同一个 TRec 文件时以文件名靠后的索引（后复制的一批）为准；
+// 返回的文件数和条目数为各索引之和
+func loadIndexSources(sources []IndexSource) ([]SegmentRecord, int, int, error) {
+	var segments []SegmentRecord
+	fileCount, entryCount := 0, 0
+	for n, source := range sources {
+		byFile := make(map[int]int) // 文件编号 -> dirSegments 下标
+		var dirSegments []SegmentRecord
+		for _, indexPath := range source.IndexFiles {
+			segs, files, entries, err := ParseTIndex(indexPath)
+			if err != nil {
+				return nil, 0, 0, fmt.Errorf("%s: %w", indexPath, err)
+			}
+			fileCount += files
+			entryCount += entries
+			for _, seg := range segs {
+				seg.FileIndex += n * SourceFileStride
+				if i, ok := byFile[seg.FileIndex]; ok {
+					dirSegments[i] = seg
+					continue
+				}
+				byFile[seg.FileIndex] = len(dirSegments)
+				dirSegments = append(dirSegments, seg)
+			}
+		}
+		if len(source.IndexFiles) > 1 {
+			sort.SliceStable(dirSegments, func(i, j int) bool { return dirSegments[i].FileIndex < dirSegments[j].FileIndex })
+		}
+		segments = append(segments, dirSegments...)
+	}
+	return segments, fileCount, entryCount, nil
+}
+
+// Sources 已加载的来源目录
+func (s *TPSStorage) Sources() []IndexSource {
+	return s.sources
+}
+
+// IndexFiles 已加载的所有主索引文件
+func (s *TPSStorage) IndexFiles() []string {
+	var files []string
+	for _, source := range s.sources {
+		files = append(files, source.IndexFiles...)
+	}
+	return files
+}
+
+// RecFilePath 文件编号对应的 TRec 文件路径（不检查文件是否存在）
+func (s *TPSStorage) RecFilePath(fileIndex int) string {
+	dir := s.dvrPath
+	if n := fileIndex / SourceFileStride; n < len(s.sources) {
+		dir = s.sources[n].Dir
+	}
+	return filepath.Join(dir, fmt.Sprintf("TRec%06d.tps", fileIndex%SourceFileStride))
+}
+
+// RecFiles 所有来源目录中的 TRec 文件（完整路径）
+func (s *TPSStorage) RecFiles() []string {
+	if len(s.sources) == 0 {
+		matches, _ := GlobRecFiles(s.dvrPath)
+		return matches
+	}
+	var files []string
+	for _, source := range s.sources {
+		matches, _ := GlobRecFiles(source.Dir)
+		files = append(files, matches...)
+	}
+	return files
+}
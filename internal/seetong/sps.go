@@ -0,0 +1,197 @@
+package seetong
+
+import "fmt"
+
+// ============================================================================
+// H.265 SPS 解析（只解析到图像尺寸）
+// ============================================================================
+
+// SPSInfo SPS 中的图像参数
+type SPSInfo struct {
+	Width           int // 裁剪后的显示宽度
+	Height          int // 裁剪后的显示高度
+	ChromaFormatIdc int
+}
+
+// bitReader 按位读取 RBSP
+type bitReader struct {
+	data []byte
+	pos  int // 位偏移
+}
+
+func (r *bitReader) u(n int) (uint32, error) {
+	var v uint32
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.data)*8 {
+			return 0, fmt.Errorf("SPS 数据不完整")
+		}
+		bit := r.data[r.pos/8] >> (7 - r.pos%8) & 1
+		v = v<<1 | uint32(bit)
+		r.pos++
+	}
+	return v, nil
+}
+
+func (r *bitReader) skip(n int) error {
+	if r.pos+n > len(r.data)*8 {
+		return fmt.Errorf("SPS 数据不完整")
+	}
+	r.pos += n
+	return nil
+}
+
+// ue 无符号指数哥伦布码
+func (r *bitReader) ue() (uint32, error) {
+	zeros := 0
+	for {
+		bit, err := r.u(1)
+		if err != nil {
+			return 0, err
+		}
+		if bit == 1 {
+			break
+		}
+		zeros++
+		if zeros > 31 {
+			return 0, fmt.Errorf("无效的指数哥伦布码")
+		}
+	}
+	rest, err := r.u(zeros)
+	if err != nil {
+		return 0, err
+	}
+	return (1<<zeros - 1) + rest, nil
+}
+
+// unescapeRBSP 去掉防竞争字节（00 00 03 -> 00 00）
+func unescapeRBSP(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	zeros := 0
+	for _, b := range data {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// ParseSPS 解析 H.265 SPS NAL（不含起始码，含 2 字节 NAL 头）
+func ParseSPS(nal []byte) (*SPSInfo, error) {
+	if len(nal) < 3 || (int(nal[0])>>1)&0x3F != NalSPS {
+		return nil, fmt.Errorf("不是 SPS NAL")
+	}
+	r := &bitReader{data: unescapeRBSP(nal[2:])}
+
+	// sps_video_parameter_set_id(4) + sps_max_sub_layers_minus1(3) + temporal_id_nesting(1)
+	if err := r.skip(4); err != nil {
+		return nil, err
+	}
+	maxSubLayersMinus1, err := r.u(3)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.skip(1); err != nil {
+		return nil, err
+	}
+	if err := skipProfileTierLevel(r, int(maxSubLayersMinus1)); err != nil {
+		return nil, err
+	}
+
+	if _, err := r.ue(); err != nil { // sps_seq_parameter_set_id
+		return nil, err
+	}
+	chroma, err := r.ue()
+	if err != nil {
+		return nil, err
+	}
+	if chroma == 3 {
+		if err := r.skip(1); err != nil { // separate_colour_plane_flag
+			return nil, err
+		}
+	}
+	width, err := r.ue()
+	if err != nil {
+		return nil, err
+	}
+	height, err := r.ue()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &SPSInfo{Width: int(width), Height: int(height), ChromaFormatIdc: int(chroma)}
+
+	// 裁剪窗口以色度采样为单位
+	window, err := r.u(1)
+	if err != nil {
+		return nil, err
+	}
+	if window == 1 {
+		var offsets [4]uint32 // left, right, top, bottom
+		for i := range offsets {
+			if offsets[i], err = r.ue(); err != nil {
+				return nil, err
+			}
+		}
+		subW, subH := 1, 1
+		if chroma == 1 || chroma == 2 {
+			subW = 2
+		}
+		if chroma == 1 {
+			subH = 2
+		}
+		info.Width -= subW * int(offsets[0]+offsets[1])
+		info.Height -= subH * int(offsets[2]+offsets[3])
+	}
+
+	if info.Width <= 0 || info.Height <= 0 {
+		return nil, fmt.Errorf("无效的图像尺寸 %dx%d", info.Width, info.Height)
+	}
+	return info, nil
+}
+
+// skipProfileTierLevel 跳过 profile_tier_level(1, maxSubLayersMinus1)
+func skipProfileTierLevel(r *bitReader, maxSubLayersMinus1 int) error {
+	// general profile(88 位) + general_level_idc(8 位)
+	if err := r.skip(96); err != nil {
+		return err
+	}
+
+	profilePresent := make([]bool, maxSubLayersMinus1)
+	levelPresent := make([]bool, maxSubLayersMinus1)
+	for i := 0; i < maxSubLayersMinus1; i++ {
+		p, err := r.u(1)
+		if err != nil {
+			return err
+		}
+		l, err := r.u(1)
+		if err != nil {
+			return err
+		}
+		profilePresent[i], levelPresent[i] = p == 1, l == 1
+	}
+	if maxSubLayersMinus1 > 0 {
+		if err := r.skip(2 * (8 - maxSubLayersMinus1)); err != nil { // reserved_zero_2bits
+			return err
+		}
+	}
+	for i := 0; i < maxSubLayersMinus1; i++ {
+		if profilePresent[i] {
+			if err := r.skip(88); err != nil {
+				return err
+			}
+		}
+		if levelPresent[i] {
+			if err := r.skip(8); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package seetong
+
+// ============================================================================
+// 段落统计
+// ============================================================================
+
+// VideoStats 单个视频通道的 GOP 和码率统计
+type VideoStats struct {
+	Frames       int     `json:"frames"`
+	IFrames      int     `json:"iFrames"`
+	PFrames      int     `json:"pFrames"`
+	IPRatio      float64 `json:"ipRatio"`      // I 帧数 / P 帧数
+	AvgGOPLength float64 `json:"avgGopLength"` // I 帧之间的平均帧数
+	MaxGOPLength int     `json:"maxGopLength"`
+	TotalBytes   int64   `json:"totalBytes"`
+	DurationSec  float64 `json:"durationSec"` // 按帧时间戳计算的实际时长
+	AvgBitrate   float64 `json:"avgBitrate"`  // bit/s
+	PeakBitrate  float64 `json:"peakBitrate"` // 1 秒窗口内的最大值，bit/s
+}
+
+// ComputeVideoStats 按视频通道统计帧索引
+// 码率使用帧时间戳跨度计算，与 TRec 文件大小无关
+func ComputeVideoStats(frameIndex []FrameIndexRecord) map[uint32]*VideoStats {
+	type channelAcc struct {
+		stats     *VideoStats
+		firstUs   uint64
+		lastUs    uint64
+		sinceI    int // 当前 GOP 的帧数
+		gops      int
+		gopFrames int
+		buckets   map[uint64]int64 // 秒 -> 字节数
+	}
+
+	accs := make(map[uint32]*channelAcc)
+	for _, f := range frameIndex {
+		if f.Channel == ChannelAudio {
+			continue
+		}
+		acc := accs[f.Channel]
+		if acc == nil {
+			acc = &channelAcc{
+				stats:   &VideoStats{},
+				firstUs: f.TimestampUs,
+				buckets: make(map[uint64]int64),
+			}
+			accs[f.Channel] = acc
+		}
+
+		st := acc.stats
+		st.Frames++
+		st.TotalBytes += int64(f.FrameSize)
+		if f.TimestampUs < acc.firstUs {
+			acc.firstUs = f.TimestampUs
+		}
+		if f.TimestampUs > acc.lastUs {
+			acc.lastUs = f.TimestampUs
+		}
+		acc.buckets[f.TimestampUs/1000000] += int64(f.FrameSize)
+
+		if f.FrameType == FrameTypeI {
+			st.IFrames++
+			// 只统计以 I 帧开始的完整 GOP
+			if st.IFrames > 1 {
+				acc.gops++
+				acc.gopFrames += acc.sinceI
+				if acc.sinceI > st.MaxGOPLength {
+					st.MaxGOPLength = acc.sinceI
+				}
+			}
+			acc.sinceI = 1
+		} else {
+			st.PFrames++
+			acc.sinceI++
+		}
+	}
+
+	result := make(map[uint32]*VideoStats, len(accs))
+	for ch, acc := range accs {
+		st := acc.stats
+		if st.PFrames > 0 {
+			st.IPRatio = float64(st.IFrames) / float64(st.PFrames)
+		}
+		if acc.gops > 0 {
+			st.AvgGOPLength = float64(acc.gopFrames) / float64(acc.gops)
+		}
+		st.DurationSec = float64(acc.lastUs-acc.firstUs) / 1e6
+		if st.DurationSec > 0 {
+			st.AvgBitrate = float64(st.TotalBytes) * 8 / st.DurationSec
+		}
+		for _, bytes := range acc.buckets {
+			if rate := float64(bytes) * 8; rate > st.PeakBitrate {
+				st.PeakBitrate = rate
+			}
+		}
+		result[ch] = st
+	}
+	return result
+}
+
+// videoTimeRangeUs 视频帧的 Unix 微秒时间范围，以第一条记录的 UnixTs 为基准加上 TimestampUs 增量
+// 没有视频帧时返回 0, 0
+func videoTimeRangeUs(frameIndex []FrameIndexRecord) (startUs, endUs int64) {
+	if len(frameIndex) == 0 {
+		return 0, 0
+	}
+	baseUs := int64(frameIndex[0].UnixTs) * 1000000
+	baseTs := int64(frameIndex[0].TimestampUs)
+	for _, f := range frameIndex {
+		if f.Channel == ChannelAudio {
+			continue
+		}
+		us := baseUs + int64(f.TimestampUs) - baseTs
+		if startUs == 0 || us < startUs {
+			startUs = us
+		}
+		if us > endUs {
+			endUs = us
+		}
+	}
+	return startUs, endUs
+}
@@ -0,0 +1,97 @@
+package seetong
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ============================================================================
+// 存储后端
+// ============================================================================
+
+// TIndex/TRec 文件的打开、stat 和目录列举都经过 Storage，默认是本地文件系统。
+// 替换为其他实现（如 HTTPStorage）即可直接读取网络上的录像，无需先复制到本地；
+// 索引缓存（.sidx/.vpscache）和 mmap 始终使用本地缓存目录
+
+// File 只读的随机访问文件
+type File interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// Storage 录像文件的读取来源，name 为 filepath.Join(dvrPath, ...) 得到的路径
+// 文件不存在时返回的错误满足 errors.Is(err, fs.ErrNotExist)
+type Storage interface {
+	Open(name string) (File, error)
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+}
+
+// OSStorage 本地文件系统（默认）
+type OSStorage struct{}
+
+// Open 打开本地文件
+func (OSStorage) Open(name string) (File, error) { return os.Open(name) }
+
+// Stat 本地文件信息
+func (OSStorage) Stat(name string) (fs.FileInfo, error) { return os.Stat(name) }
+
+// ReadDir 列举本地目录
+func (OSStorage) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+
+var (
+	fileStorage   Storage = OSStorage{}
+	fileStorageMu sync.RWMutex
+)
+
+// SetStorage 设置录像文件的存储后端，nil 恢复为本地文件系统
+// 应在加载 DVR 之前调用，已打开的文件句柄不受影响
+func SetStorage(st Storage) {
+	fileStorageMu.Lock()
+	defer fileStorageMu.Unlock()
+	if st == nil {
+		st = OSStorage{}
+	}
+	fileStorage = st
+}
+
+// CurrentStorage 当前的存储后端
+func CurrentStorage() Storage {
+	fileStorageMu.RLock()
+	defer fileStorageMu.RUnlock()
+	return fileStorage
+}
+
+// openFile 通过当前存储后端打开文件
+func openFile(name string) (File, error) {
+	return CurrentStorage().Open(name)
+}
+
+// statFile 通过当前存储后端获取文件信息
+func statFile(name string) (fs.FileInfo, error) {
+	return CurrentStorage().Stat(name)
+}
+
+// GlobRecFiles 列出 dvrPath 下的 TRec*.tps 文件（完整路径，按文件名排序）
+// 替代 filepath.Glob，使网络存储后端也能列举录像文件
+func GlobRecFiles(dvrPath string) ([]string, error) {
+	entries, err := CurrentStorage().ReadDir(dvrPath)
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if ok, _ := filepath.Match("TRec*.tps", entry.Name()); ok {
+			matches = append(matches, filepath.Join(dvrPath, entry.Name()))
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
@@ -0,0 +1,115 @@
+package seetong
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// ============================================================================
+// 增量读取帧索引
+// ============================================================================
+
+// 实时尾随正在写入的文件时，每次轮询只读取上次读到的位置之后的条目，不重新解析整个索引。
+// DVR 循环覆盖旧文件时从索引开头重写条目，新条目之后仍是上一轮的旧条目：
+// 时间比已读到的最新记录早 TimestampResetThreshold 秒以上的条目视为尚未被覆盖，读取停在这里，
+// 之后被覆盖时再继续
+
+// tailFirstProbe First 查找第一条有效记录时最多读取的条目数
+const tailFirstProbe = 64
+
+// FrameIndexTail 增量读取一个 TRec 文件的帧索引
+type FrameIndexTail struct {
+	path   string
+	layout IndexLayout // Start 为 0 时尚未找到索引
+	pos    int64       // 下一条待读取条目的文件偏移
+	newest uint32      // 已读到的最晚 UnixTs
+}
+
+// NewFrameIndexTail 创建增量读取器，第一次 Read 从索引开头读取
+func NewFrameIndexTail(recFilePath string) *FrameIndexTail {
+	return &FrameIndexTail{path: recFilePath}
+}
+
+// locate 确认索引位置，未找到（尚未写入）时返回 false
+func (t *FrameIndexTail) locate(f File) (bool, error) {
+	if t.layout.Start > 0 && hasFrameIndexMagic(f, t.layout.Start) {
+		return true, nil
+	}
+	start, err := findFrameIndexStart(f, t.path)
+	if err != nil || start < 0 {
+		return false, err
+	}
+	probe := make([]byte, (strideProbeRecords+1)*TRecFrameIndexSizeWide)
+	n, err := f.ReadAt(probe, start)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	t.layout = IndexLayout{Start: start, Stride: detectTRecIndexStride(probe[:n], 0)}
+	t.pos, t.newest = start, 0
+	return true, nil
+}
+
+// Read 读取上次读取之后写入的有效记录（按文件顺序），没有新条目时返回空
+func (t *FrameIndexTail) Read() ([]FrameIndexRecord, error) {
+	f, err := openFile(t.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if ok, err := t.locate(f); !ok {
+		return nil, err
+	}
+
+	r := bufio.NewReaderSize(io.NewSectionReader(f, t.pos, math.MaxInt64-t.pos), 64*1024)
+	buf := make([]byte, t.layout.Stride)
+	var records []FrameIndexRecord
+	for {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			break
+		}
+		if binary.LittleEndian.Uint32(buf[0:4]) != TRecFrameIndexMagic {
+			break // 尚未写入
+		}
+		record := decodeFrameIndexRecord(buf)
+		if isIndexedFrame(record) {
+			if record.UnixTs+TimestampResetThreshold < t.newest {
+				break // 上一轮的旧条目，尚未被覆盖
+			}
+			t.newest = max(t.newest, record.UnixTs)
+			records = append(records, record)
+		}
+		t.pos += int64(t.layout.Stride)
+	}
+	return records, nil
+}
+
+// First 索引中第一条有效记录，每次调用都重新读取（DVR 覆盖旧文件时首条记录最先变化）
+// 不影响 Read 的读取位置；索引尚未写入或开头没有有效记录时 ok 为 false
+func (t *FrameIndexTail) First() (record FrameIndexRecord, ok bool, err error) {
+	f, err := openFile(t.path)
+	if err != nil {
+		return record, false, err
+	}
+	defer f.Close()
+	if found, err := t.locate(f); !found {
+		return record, false, err
+	}
+
+	data := make([]byte, tailFirstProbe*t.layout.Stride)
+	n, err := f.ReadAt(data, t.layout.Start)
+	if err != nil && err != io.EOF {
+		return record, false, err
+	}
+	for off := 0; off+t.layout.Stride <= n; off += t.layout.Stride {
+		entry := data[off : off+t.layout.Stride]
+		if binary.LittleEndian.Uint32(entry[0:4]) != TRecFrameIndexMagic {
+			break
+		}
+		if record = decodeFrameIndexRecord(entry); isIndexedFrame(record) {
+			return record, true, nil
+		}
+	}
+	return FrameIndexRecord{}, false, nil
+}
@@ -0,0 +1,79 @@
+package seetong
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeIndexEntries 把 f 的第 from 到 to 条帧索引条目写到 path 中对应的位置
+func writeIndexEntries(t *testing.T, path string, f *trecFixture, from, to int) {
+	t.Helper()
+	out, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	index := f.index()
+	if _, err := out.WriteAt(index[from*f.stride():to*f.stride()], f.entryOffset(from)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFrameIndexTailReadsOnlyNewEntries(t *testing.T) {
+	f := newTRecFixture(4, 10)
+	path := filepath.Join(t.TempDir(), "TRec000000.tps")
+	full := f.Frames
+	f.Frames = full[:20] // 只写前 20 条索引，之后的条目还是零
+	f.write(t, path)
+	f.Frames = full
+
+	tail := NewFrameIndexTail(path)
+	records, err := tail.Read()
+	if err != nil || len(records) != 20 {
+		t.Fatalf("first read: %d records, %v; want 20", len(records), err)
+	}
+	if records, _ := tail.Read(); len(records) != 0 {
+		t.Fatalf("read without new entries returned %d records", len(records))
+	}
+
+	writeIndexEntries(t, path, f, 20, len(full))
+	records, err = tail.Read()
+	if err != nil || len(records) != len(full)-20 {
+		t.Fatalf("second read: %d records, %v; want %d", len(records), err, len(full)-20)
+	}
+	if records[0] != full[20] || records[len(records)-1] != full[len(full)-1] {
+		t.Fatalf("second read starts at %+v, want %+v", records[0], full[20])
+	}
+}
+
+func TestFrameIndexTailStopsAtOverwrittenRound(t *testing.T) {
+	// 上一轮的录像：完整的旧索引
+	old := newTRecFixture(4, 10)
+	for i := range old.Frames {
+		old.Frames[i].UnixTs -= 3600
+	}
+	path := old.write(t, filepath.Join(t.TempDir(), "TRec000000.tps"))
+
+	tail := NewFrameIndexTail(path)
+	if first, ok, err := tail.First(); err != nil || !ok || first.UnixTs != old.Frames[0].UnixTs {
+		t.Fatalf("First before overwrite = %+v, %v, %v", first, ok, err)
+	}
+
+	// DVR 从索引开头覆盖了 12 条
+	current := newTRecFixture(4, 10)
+	writeIndexEntries(t, path, current, 0, 12)
+	if first, ok, _ := tail.First(); !ok || first.UnixTs != current.Frames[0].UnixTs {
+		t.Fatalf("First after overwrite = %+v, want UnixTs %d", first, current.Frames[0].UnixTs)
+	}
+	records, err := tail.Read()
+	if err != nil || len(records) != 12 {
+		t.Fatalf("read %d records, %v; want the 12 overwritten entries", len(records), err)
+	}
+
+	// 继续覆盖后从停下的位置读取
+	writeIndexEntries(t, path, current, 12, 30)
+	if records, _ := tail.Read(); len(records) != 18 || records[0] != current.Frames[12] {
+		t.Fatalf("read %d records after more overwrites, want 18 starting at entry 12", len(records))
+	}
+}
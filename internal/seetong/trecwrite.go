@@ -0,0 +1,131 @@
+package seetong
+
+import (
+	"fmt"
+	"io"
+)
+
+// ============================================================================
+// 生成新的 TRec 文件
+// ============================================================================
+
+// 新文件与设备写入的文件布局相同：文件头、连续的帧数据、零填充到 TRecIndexRegionStart、
+// 44 字节的帧索引条目、零填充到 256MB。帧索引是 parseTRecFrameIndex 读取规则的逆操作，
+// 只重新计算 FileOffset，其余字段（含帧序号和保留字节）原样保留
+
+// TRecMaxHeaderSize 原文件第一帧之前的内容（文件头）最多复制的字节数
+const TRecMaxHeaderSize = 1 << 20
+
+// TRecMaxFrames 索引区最多容纳的帧索引条目数
+const TRecMaxFrames = (TRecFileSize - TRecIndexRegionStart) / TRecFrameIndexSize
+
+// TRecCopy 复制到新 TRec 文件的帧
+type TRecCopy struct {
+	Header []byte             // 文件头，原样写在文件开头
+	Source []FrameIndexRecord // 原文件中的帧（读取帧数据用）
+	Index  []FrameIndexRecord // 新文件中的帧索引，与 Source 一一对应
+}
+
+// PlanTRecCopy 按 frames 的顺序为帧分配新文件中的偏移，并检查新索引能被解析器原样读回
+// 帧数据超出 TRecIndexRegionStart 或条目数超出索引区时返回 ErrInvalidFormat
+func PlanTRecCopy(header []byte, frames []FrameIndexRecord) (*TRecCopy, error) {
+	if len(header) > TRecMaxHeaderSize {
+		return nil, fmt.Errorf("%w: header is %d bytes (max %d)", ErrInvalidFormat, len(header), TRecMaxHeaderSize)
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("%w: no frames to copy", ErrInvalidFormat)
+	}
+	if len(frames) > TRecMaxFrames {
+		return nil, fmt.Errorf("%w: %d frames exceed the index region (max %d)", ErrInvalidFormat, len(frames), TRecMaxFrames)
+	}
+
+	c := &TRecCopy{Header: header, Source: frames, Index: make([]FrameIndexRecord, len(frames))}
+	offset := int64(len(header))
+	entry := make([]byte, TRecFrameIndexSize)
+	for i, r := range frames {
+		if err := checkFrameSize(r); err != nil {
+			return nil, err
+		}
+		if offset+int64(r.FrameSize) > TRecIndexRegionStart {
+			return nil, fmt.Errorf("%w: frame data exceeds 0x%X bytes at frame %d", ErrInvalidFormat, TRecIndexRegionStart, i)
+		}
+		r.FileOffset = uint32(offset)
+		offset += int64(r.FrameSize)
+
+		// 解析器读回的记录必须与写入的相同，并且仍能通过帧索引过滤
+		encodeFrameIndexRecord(entry, r)
+		if decodeFrameIndexRecord(entry) != r || !isIndexedFrame(r) {
+			return nil, fmt.Errorf("%w: frame %d does not round-trip through the index parser", ErrInvalidFormat, i)
+		}
+		c.Index[i] = r
+	}
+	return c, nil
+}
+
+// DataSize 帧数据（含文件头）的总字节数
+func (c *TRecCopy) DataSize() int64 {
+	last := c.Index[len(c.Index)-1]
+	return int64(last.FileOffset) + int64(last.FrameSize)
+}
+
+// Write 写出完整的 256MB TRec 文件，read 读取 Source 中一帧的数据
+// （buf 为上一帧返回的缓冲，可作为 ReadFrameInto 的 dst 复用，写完后归还缓冲池）
+// 返回写出的字节数；帧数据长度与索引不符时返回 ErrInvalidFormat
+func (c *TRecCopy) Write(w io.Writer, read func(frame FrameIndexRecord, buf []byte) ([]byte, error)) (int64, error) {
+	var written int64
+	write := func(data []byte) error {
+		n, err := w.Write(data)
+		written += int64(n)
+		return err
+	}
+
+	if err := write(c.Header); err != nil {
+		return written, err
+	}
+	var buf []byte
+	defer func() { PutFrameBuffer(buf) }()
+	for i, frame := range c.Source {
+		var err error
+		if buf, err = read(frame, buf); err != nil {
+			return written, err
+		}
+		if len(buf) != int(frame.FrameSize) {
+			return written, fmt.Errorf("%w: frame %d read %d bytes, index says %d", ErrInvalidFormat, i, len(buf), frame.FrameSize)
+		}
+		if err := write(buf); err != nil {
+			return written, err
+		}
+	}
+	if err := writeZeros(w, TRecIndexRegionStart-written, &written); err != nil {
+		return written, err
+	}
+
+	index := make([]byte, len(c.Index)*TRecFrameIndexSize)
+	for i, r := range c.Index {
+		encodeFrameIndexRecord(index[i*TRecFrameIndexSize:], r)
+	}
+	if err := write(index); err != nil {
+		return written, err
+	}
+	// 索引之后的零字节不是 magic，解析器在此停止
+	err := writeZeros(w, TRecFileSize-written, &written)
+	return written, err
+}
+
+// writeZeros 写出 n 个零字节
+func writeZeros(w io.Writer, n int64, written *int64) error {
+	zeros := make([]byte, 64*1024)
+	for n > 0 {
+		chunk := zeros
+		if n < int64(len(chunk)) {
+			chunk = chunk[:n]
+		}
+		m, err := w.Write(chunk)
+		*written += int64(m)
+		if err != nil {
+			return err
+		}
+		n -= int64(m)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package seetong
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTRecCopyRoundTrip(t *testing.T) {
+	useTempCacheDir(t)
+	f := newTRecFixture(6, 10)
+	s := openFixtureStorage(t, f)
+
+	// 第 2 到第 4 个 GOP（每个 GOP 10 帧视频、10 帧音频）
+	frames := f.Frames[2*20 : 5*20]
+	plan, err := PlanTRecCopy(f.Header, frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "TRec000000.tps")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written, err := plan.Write(out, func(frame FrameIndexRecord, buf []byte) ([]byte, error) {
+		return s.ReadFrameInto(0, frame, buf)
+	})
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != TRecFileSize {
+		t.Fatalf("wrote %d bytes, want %d", written, TRecFileSize)
+	}
+
+	start, raw, err := ReadTRecFrameIndexRaw(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start != TRecIndexRegionStart || !reflect.DeepEqual(raw, plan.Index) {
+		t.Fatalf("index at %#x with %d entries, want %#x with the %d planned", start, len(raw), TRecIndexRegionStart, len(plan.Index))
+	}
+	records, _, err := parseTRecFrameIndex(path, IndexLayout{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFrameIndex(t, records, plan.Index)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data[:len(f.Header)], f.Header) {
+		t.Fatal("header not copied")
+	}
+	size := int64(len(f.Header))
+	for i, r := range plan.Index {
+		size += int64(r.FrameSize)
+		want := f.Data[2*20+i]
+		if !bytes.Equal(data[r.FileOffset:r.FileOffset+r.FrameSize], want) {
+			t.Fatalf("frame %d at %#x differs from the source", i, r.FileOffset)
+		}
+		if i > 0 && r.FileOffset != plan.Index[i-1].FileOffset+plan.Index[i-1].FrameSize {
+			t.Fatalf("frame %d at %#x is not right after frame %d", i, r.FileOffset, i-1)
+		}
+	}
+	if plan.Index[0].FileOffset != uint32(len(f.Header)) || plan.DataSize() != size {
+		t.Fatalf("frames start at %#x, data size %d, want %#x and %d", plan.Index[0].FileOffset, plan.DataSize(), len(f.Header), size)
+	}
+}
+
+func TestPlanTRecCopyRejects(t *testing.T) {
+	f := newTRecFixture(1, 5)
+	invalid := f.Frames[0]
+	invalid.UnixTs = 0
+
+	for _, tc := range []struct {
+		name   string
+		header []byte
+		frames []FrameIndexRecord
+	}{
+		{"no frames", f.Header, nil},
+		{"header too large", make([]byte, TRecMaxHeaderSize+1), f.Frames},
+		{"frame the parser would drop", f.Header, []FrameIndexRecord{invalid}},
+	} {
+		if _, err := PlanTRecCopy(tc.header, tc.frames); !errors.Is(err, ErrInvalidFormat) {
+			t.Errorf("%s: %v, want ErrInvalidFormat", tc.name, err)
+		}
+	}
+
+	plan, err := PlanTRecCopy(f.Header, f.Frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = plan.Write(io.Discard, func(frame FrameIndexRecord, buf []byte) ([]byte, error) {
+		return make([]byte, frame.FrameSize-1), nil
+	})
+	if !errors.Is(err, ErrInvalidFormat) {
+		t.Fatalf("short frame read: %v, want ErrInvalidFormat", err)
+	}
+}
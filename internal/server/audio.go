@@ -0,0 +1,221 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+)
+
+// 音频输出格式（WebSocket ?audio= 参数）
+const (
+	AudioFormatG711 = "g711-ulaw"
+	AudioFormatAAC  = "aac"
+)
+
+// AAC 编码参数
+const (
+	aacFrameSamples  = 1024 // 每个 AAC 帧的采样数
+	aacBitrate       = "32k"
+	aacMaxSilencePad = 5 * audioSampleRate // 录像断档时最多补 5 秒静音
+	g711Silence      = 0xFF                // μ-law 静音
+)
+
+var (
+	ffmpegOnce sync.Once
+	ffmpegBin  string
+)
+
+// ffmpegPath 返回 ffmpeg 可执行文件路径，不可用时返回空字符串
+func ffmpegPath() string {
+	ffmpegOnce.Do(func() {
+		ffmpegBin, _ = exec.LookPath("ffmpeg")
+	})
+	return ffmpegBin
+}
+
+// AACAvailable 是否支持 AAC 转码
+func AACAvailable() bool {
+	return ffmpegPath() != ""
+}
+
+// audioSink 音频输出（按流创建）
+type audioSink interface {
+	Format() string
+	Write(data []byte, timestampMs int64) bool
+	Close()
+}
+
+// newAudioSink 按会话的音频格式创建输出
+func (s *StreamSession) newAudioSink(streamID uint64) audioSink {
+	if s.audioFormat == AudioFormatAAC {
+		sink, err := newAACSink(s, streamID)
+		if err == nil {
+			return sink
+		}
+		fmt.Printf("[Stream#%d] AAC 编码器启动失败，回退到 G.711: %v\n", streamID, err)
+	}
+	return &g711Sink{session: s, streamID: streamID}
+}
+
+// g711Sink 原样发送 G.711 帧
+type g711Sink struct {
+	session  *StreamSession
+	streamID uint64
+}
+
+func (g *g711Sink) Format() string { return AudioFormatG711 }
+
+func (g *g711Sink) Write(data []byte, timestampMs int64) bool {
+	return g.session.sendAudioFrameWithID(g.streamID, data, timestampMs)
+}
+
+func (g *g711Sink) Close() {}
+
+// aacSink 通过 ffmpeg 将 G.711 转码为 ADTS AAC
+//
+// 时间戳按采样数计算而不是沿用 G.711 帧时间戳（只有秒精度）：
+// 第 n 个 AAC 帧覆盖输入的第 (n-1)*1024 个采样起的 1024 个采样（首帧是编码器预热帧），
+// 时间戳为首个 G.711 帧时间 + 采样偏移。录像断档时补静音，保证采样时钟不会相对视频漂移
+type aacSink struct {
+	session  *StreamSession
+	streamID uint64
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	done     chan struct{}
+
+	mu          sync.Mutex
+	baseMs      int64 // 首个输入采样的时间
+	hasBase     bool
+	samplesFed  int64
+	closeOnce   sync.Once
+	writeFailed bool
+}
+
+func newAACSink(s *StreamSession, streamID uint64) (*aacSink, error) {
+	bin := ffmpegPath()
+	if bin == "" {
+		return nil, fmt.Errorf("ffmpeg 不可用")
+	}
+
+	cmd := exec.Command(bin,
+		"-hide_banner", "-loglevel", "error",
+		"-f", "mulaw", "-ar", fmt.Sprint(audioSampleRate), "-ac", "1", "-i", "pipe:0",
+		"-c:a", "aac", "-b:a", aacBitrate, "-ar", fmt.Sprint(audioSampleRate),
+		"-f", "adts", "-flush_packets", "1", "pipe:1")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	a := &aacSink{
+		session:  s,
+		streamID: streamID,
+		cmd:      cmd,
+		stdin:    stdin,
+		done:     make(chan struct{}),
+	}
+	go a.readFrames(stdout)
+	return a, nil
+}
+
+func (a *aacSink) Format() string { return AudioFormatAAC }
+
+// Write 写入一个 G.711 帧
+func (a *aacSink) Write(data []byte, timestampMs int64) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.writeFailed {
+		return true // 编码器已退出，丢弃音频但不中断视频
+	}
+	if !a.hasBase {
+		a.baseMs = timestampMs
+		a.hasBase = true
+	}
+
+	// 帧时间戳只有秒精度，超出采样时钟一秒以上才视为断档
+	expectedMs := a.baseMs + a.samplesFed*1000/audioSampleRate
+	if gapMs := timestampMs - expectedMs; gapMs > 1000 {
+		pad := gapMs * audioSampleRate / 1000
+		if pad > aacMaxSilencePad {
+			pad = aacMaxSilencePad
+		}
+		silence := make([]byte, pad)
+		for i := range silence {
+			silence[i] = g711Silence
+		}
+		data = append(silence, data...)
+	}
+
+	if _, err := a.stdin.Write(data); err != nil {
+		a.writeFailed = true
+		fmt.Printf("[Stream#%d] AAC 编码器写入失败: %v\n", a.streamID, err)
+		return true
+	}
+	a.samplesFed += int64(len(data))
+	return true
+}
+
+// readFrames 读取 ffmpeg 输出的 ADTS 帧并发送
+func (a *aacSink) readFrames(stdout io.Reader) {
+	defer close(a.done)
+
+	r := bufio.NewReader(stdout)
+	header := make([]byte, 7)
+	for frameNum := int64(0); ; frameNum++ {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return
+		}
+		if header[0] != 0xFF || header[1]&0xF0 != 0xF0 {
+			fmt.Printf("[Stream#%d] 无效的 ADTS 同步字\n", a.streamID)
+			return
+		}
+		frameLen := int(header[3]&0x03)<<11 | int(header[4])<<3 | int(header[5])>>5
+		if frameLen < len(header) {
+			return
+		}
+		frame := make([]byte, frameLen)
+		copy(frame, header)
+		if _, err := io.ReadFull(r, frame[len(header):]); err != nil {
+			return
+		}
+
+		a.mu.Lock()
+		baseMs := a.baseMs
+		a.mu.Unlock()
+		tsMs := baseMs + (frameNum-1)*aacFrameSamples*1000/audioSampleRate
+
+		a.session.sendAACFrameWithID(a.streamID, frame, tsMs)
+	}
+}
+
+// Close 关闭编码器并等待剩余帧发送完
+func (a *aacSink) Close() {
+	a.closeOnce.Do(func() {
+		a.stdin.Close()
+		<-a.done
+		a.cmd.Wait()
+	})
+}
+
+// sendAACFrameWithID 发送 AAC 帧（带 ID 验证）
+// "ADTS"(4) + 时间戳毫秒(8) + 采样率(2) + 长度(4) + ADTS 帧
+func (s *StreamSession) sendAACFrameWithID(streamID uint64, frame []byte, timestampMs int64) bool {
+	header := make([]byte, 18)
+	copy(header[0:4], "ADTS")
+	binary.BigEndian.PutUint64(header[4:12], uint64(timestampMs))
+	binary.BigEndian.PutUint16(header[12:14], audioSampleRate)
+	binary.BigEndian.PutUint32(header[14:18], uint32(len(frame)))
+
+	return s.sendBytesWithID(streamID, append(header, frame...))
+}
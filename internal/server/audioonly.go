@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"seetong-dvr/internal/seetong"
+)
+
+// audioOnlyRequested 客户端是否请求纯音频通道（channel == ChannelAudio）
+func audioOnlyRequested(channel int) bool {
+	return channel == seetong.ChannelAudio
+}
+
+// findAudioSegment 查找该时间有音频的已缓存段落
+// 音频没有自己的段落，记录在视频段落的帧索引中；第二个返回值表示该时间有录像但没有音频
+func findAudioSegment(storage *seetong.TPSStorage, timestamp int64) (*seetong.SegmentRecord, bool) {
+	found := false
+	for _, channel := range []int{1, 2} {
+		seg := storage.FindSegmentByTime(timestamp, channel, true)
+		if seg == nil {
+			continue
+		}
+		if len(storage.GetAudioFrames(seg.FileIndex)) > 0 {
+			return seg, true
+		}
+		found = true
+	}
+	return nil, found
+}
+
+// streamAudioOnly 只发送一个段落的音频帧，按音频帧的设备时间控制节奏
+// 与 streamVideoWithAudio 的返回值含义相同；暂停位置只记录音频帧序号
+func (s *StreamSession) streamAudioOnly(ctx context.Context, streamID uint64, startTimestamp int64, speed float64, start streamStart) (fileIndex int, finished bool) {
+	dvr := s.getDVR()
+	storage := dvr.GetStorage()
+	if storage == nil || !dvr.IsLoaded() {
+		s.sendJSON(map[string]interface{}{"error": "DVR 未加载"})
+		return
+	}
+
+	// 1. 查找段落
+	resume := start.resume
+	var seg *seetong.SegmentRecord
+	hasRecording := false
+	if resume != nil {
+		seg = storage.GetSegmentByFileIndex(resume.FileIndex)
+	} else if start.byFrame || start.timeline != nil {
+		seg = storage.GetSegmentByFileIndex(start.fileIndex)
+	} else {
+		seg, hasRecording = findAudioSegment(storage, startTimestamp)
+	}
+	if seg != nil {
+		hasRecording = true
+	}
+	var audioFrames []seetong.FrameIndexRecord
+	if seg != nil {
+		audioFrames = storage.GetAudioFrames(seg.FileIndex)
+	}
+	if len(audioFrames) == 0 {
+		if !hasRecording {
+			if resume == nil && !start.byFrame && start.timeline == nil {
+				s.sendJSON(seekMissMessage(storage, startTimestamp, seetong.ChannelAudio))
+			} else {
+				s.sendJSON(map[string]interface{}{"error": "未找到指定时间的录像"})
+			}
+			return
+		}
+		s.sendJSON(map[string]interface{}{
+			"type":    "error",
+			"reason":  ReasonChannelUnavailable,
+			"message": "该时间的录像没有音频",
+			"channel": seetong.ChannelAudio,
+		})
+		return
+	}
+	fileIndex = seg.FileIndex
+
+	// 2. 起始音频帧
+	audioIdx := 0
+	switch {
+	case resume != nil:
+		audioIdx = resume.AudioIdx
+	case start.byFrame:
+		records := storage.GetFrameIndex(fileIndex)
+		if start.frameIndex < 0 || start.frameIndex >= len(records) {
+			s.sendJSON(map[string]interface{}{"error": "帧序号超出范围"})
+			return
+		}
+		offset := records[start.frameIndex].FileOffset
+		audioIdx = sort.Search(len(audioFrames), func(i int) bool { return audioFrames[i].FileOffset >= offset })
+	case start.timeline == nil:
+		audioIdx = sort.Search(len(audioFrames), func(i int) bool { return int64(audioFrames[i].UnixTs) >= startTimestamp })
+	}
+	if audioIdx >= len(audioFrames) {
+		audioIdx = len(audioFrames) - 1
+	}
+	fmt.Printf("[Stream#%d] 纯音频: file_index=%d, 音频帧: %d, 起始索引: %d\n", streamID, fileIndex, len(audioFrames), audioIdx)
+
+	timeline := newMediaTimeline(storage.GetFrameIndex(fileIndex), 0)
+	startTimeMs := timeline.timeMs(audioFrames[audioIdx])
+	if resume != nil {
+		startTimeMs = resume.TimestampMs
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	audio := s.newAudioSink(streamID)
+	defer audio.Close()
+
+	s.progress.fileIndex.Store(int64(fileIndex))
+	s.sendJSON(map[string]interface{}{
+		"type":            "stream_start",
+		"channel":         seetong.ChannelAudio,
+		"startTime":       seg.StartTime,
+		"endTime":         seg.EndTime,
+		"actualStartTime": startTimeMs / 1000,
+		"hasAudio":        true,
+		"audioOnly":       true,
+		"audioFormat":     audio.Format(),
+		"audioSampleRate": audioSampleRate,
+		"resumed":         resume != nil,
+		"fileIndex":       fileIndex,
+		"timeline":        start.timeline != nil,
+	})
+
+	cursor := &streamCursor{
+		Channel:     seetong.ChannelAudio,
+		FileIndex:   fileIndex,
+		TimestampMs: startTimeMs,
+		AudioIdx:    audioIdx,
+	}
+	s.cursor = cursor
+
+	pacer := newStreamPacer(speed, s.handlers.avSync.paceMaxLagMs)
+	pace := time.NewTimer(time.Hour)
+	pace.Stop()
+	defer pace.Stop()
+
+	var buf []byte
+	defer func() { seetong.PutFrameBuffer(buf) }()
+
+	for ; audioIdx < len(audioFrames); audioIdx++ {
+		af := audioFrames[audioIdx]
+		tsMs := timeline.timeMs(af)
+
+		// 等待到该帧的计划发送时间（可中断）
+		wait := pacer.wait(tsMs, time.Now())
+		s.progress.lagMs.Store(pacer.lag.Milliseconds())
+		if wait > 0 {
+			pace.Reset(wait)
+			select {
+			case <-ctx.Done():
+				pace.Stop()
+				return
+			case <-pace.C:
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		var err error
+		buf, err = storage.ReadFrameIntoContext(ctx, fileIndex, af, buf)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if !dvr.checkStorage() {
+				fmt.Printf("[Stream#%d] 存储已断开，停止播放\n", streamID)
+				s.sendJSON(map[string]interface{}{"type": "error", "reason": ReasonDisconnected, "message": errDisconnected.Message})
+				return fileIndex, false
+			}
+			fmt.Printf("[Stream#%d] 音频帧读取失败: %v\n", streamID, err)
+		} else if !audio.Write(buf, tsMs) {
+			return
+		}
+		cursor.AudioIdx = audioIdx + 1
+		cursor.TimestampMs = tsMs
+		s.progress.timestampMs.Store(tsMs)
+	}
+
+	fmt.Printf("[Stream#%d] 纯音频播放结束, 共 %d 帧\n", streamID, len(audioFrames))
+	s.cursor = nil
+	return fileIndex, true
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/kataras/iris/v12"
+)
+
+// TokenAuth API 访问令牌中间件
+// 令牌可通过 Authorization: Bearer <token> 或 ?token= 传递（WebSocket 只能用查询参数）
+// 只保护 /api 路径，静态页面不受影响
+func TokenAuth(token string) iris.Handler {
+	return func(ctx iris.Context) {
+		if !strings.HasPrefix(ctx.Path(), "/api/") || ctx.Method() == "OPTIONS" {
+			ctx.Next()
+			return
+		}
+
+		provided := ctx.URLParam("token")
+		if auth := ctx.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			provided = strings.TrimPrefix(auth, "Bearer ")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			writeError(ctx, errUnauthorized)
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,237 @@
+package server
+
+import (
+	"sort"
+	"time"
+
+	"seetong-dvr/internal/config"
+	"seetong-dvr/internal/seetong"
+)
+
+// 音视频同步参数
+const (
+	avSyncReportInterval = 5 * time.Second // sync 诊断消息的发送间隔
+	avSyncMaxHoldMs      = 5000            // 漂移超过此值视为时间戳跳变，不再校正
+	paceMaxGapMs         = 2000            // 相邻帧间隔超过此值时视为录像断点，不等待
+)
+
+// mediaTimeline 按设备时间戳计算帧的毫秒时间
+// UnixTs 只有秒级精度，以段落首帧的 UnixTs 为基准加上 TimestampUs 增量；
+// 音频和视频共用设备时钟，两者的时间可以直接比较
+type mediaTimeline struct {
+	baseUnixMs int64
+	baseTsUs   uint64
+	video      []seetong.FrameIndexRecord // 当前通道的视频帧，按 FileOffset 排序
+}
+
+func newMediaTimeline(records []seetong.FrameIndexRecord, frameChannel uint32) *mediaTimeline {
+	t := &mediaTimeline{}
+	if len(records) > 0 {
+		t.baseUnixMs = int64(records[0].UnixTs) * 1000
+		t.baseTsUs = records[0].TimestampUs
+	}
+	for _, r := range records {
+		if r.Channel == frameChannel {
+			t.video = append(t.video, r)
+		}
+	}
+	sort.Slice(t.video, func(i, j int) bool { return t.video[i].FileOffset < t.video[j].FileOffset })
+	return t
+}
+
+// timeMs 帧的毫秒时间
+func (t *mediaTimeline) timeMs(r seetong.FrameIndexRecord) int64 {
+	return t.baseUnixMs + (int64(r.TimestampUs)-int64(t.baseTsUs))/1000
+}
+
+// videoTimeMs 查找包含文件偏移 offset 的视频帧并返回其时间
+func (t *mediaTimeline) videoTimeMs(offset int64) (int64, bool) {
+	i := sort.Search(len(t.video), func(i int) bool { return int64(t.video[i].FileOffset) > offset }) - 1
+	if i < 0 {
+		return 0, false
+	}
+	r := t.video[i]
+	if offset >= int64(r.FileOffset)+int64(r.FrameSize) {
+		return 0, false
+	}
+	return t.timeMs(r), true
+}
+
+// streamPacer 按帧时间（而不是固定帧间隔）控制发送节奏
+// 每帧的发送时间由对齐点加上帧时间增量得到（绝对时间），
+// 发送和读取耗时不会累积，长时间播放与实际时间保持一致，倍速也是精确的
+type streamPacer struct {
+	speed      float64
+	maxLag     time.Duration
+	anchorWall time.Time
+	anchorMs   int64
+	lastMs     int64
+	anchored   bool
+	lastDue    time.Time     // 上一帧的计划发送时间
+	lag        time.Duration // 上一帧落后计划发送时间的时长（未落后为 0）
+	realigned  bool          // 上一帧落后超过 maxLag 而重新对齐
+}
+
+// newStreamPacer 创建发送节奏控制器，落后超过 maxLagMs 时重新对齐（<= 0 使用默认值）
+func newStreamPacer(speed float64, maxLagMs int) *streamPacer {
+	if maxLagMs <= 0 {
+		maxLagMs = config.DefaultPaceMaxLagMs
+	}
+	return &streamPacer{speed: speed, maxLag: time.Duration(maxLagMs) * time.Millisecond}
+}
+
+// wait 返回发送时间为 ms 的帧之前应等待的时长
+// 时间回退、断点或发送严重落后时以当前帧重新对齐
+func (p *streamPacer) wait(ms int64, now time.Time) time.Duration {
+	p.realigned = false
+	if !p.anchored || ms < p.lastMs || ms-p.lastMs > paceMaxGapMs {
+		p.anchorWall, p.anchorMs, p.lastMs, p.anchored = now, ms, ms, true
+		p.lastDue = now
+		return 0
+	}
+	p.lastMs = ms
+
+	due := p.anchorWall.Add(time.Duration(float64(ms-p.anchorMs) / p.speed * float64(time.Millisecond)))
+	return p.until(due, now, func() { p.anchorWall, p.anchorMs = now, ms })
+}
+
+// waitInterval 没有精确帧时间时按固定间隔计算下一帧的发送时间
+// 从上一帧的计划时间（而不是当前时间）累加，同样不会累积误差
+func (p *streamPacer) waitInterval(interval time.Duration, now time.Time) time.Duration {
+	p.realigned = false
+	if p.lastDue.IsZero() {
+		p.lastDue = now
+		return 0
+	}
+	return p.until(p.lastDue.Add(interval), now, func() {})
+}
+
+// until 返回距计划时间 due 的等待时长，落后超过 maxLag 时调用 realign 并从当前时间重新计时
+func (p *streamPacer) until(due, now time.Time, realign func()) time.Duration {
+	d := due.Sub(now)
+	p.lag = 0
+	if d < 0 {
+		p.lag = -d
+	}
+	if d < -p.maxLag {
+		realign()
+		p.lastDue = now
+		p.realigned = true
+		return 0
+	}
+	p.lastDue = due
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// reset 下一帧重新对齐（跳转之后）
+func (p *streamPacer) reset() {
+	p.anchored = false
+	p.lastDue = time.Time{}
+	p.lag = 0
+}
+
+// avSyncAction 音频帧的处理方式
+type avSyncAction int
+
+const (
+	avSyncSend avSyncAction = iota
+	avSyncDrop              // 落后于视频，丢弃
+	avSyncHold              // 超前于视频，推迟到后续视频帧之后发送
+)
+
+// avSyncWatchdog 音视频漂移检测
+// 漂移为音频帧时间减去当前视频帧时间（正值表示音频超前）。超过阈值时记录日志，
+// 启用校正时丢弃落后的音频帧、推迟超前的音频帧
+type avSyncWatchdog struct {
+	thresholdMs int64
+	correct     bool
+
+	videoMs  int64
+	hasVideo bool
+
+	// 当前诊断窗口
+	sumDrift   int64
+	samples    int64
+	maxDrift   int64
+	dropped    int
+	held       int
+	heldMs     int64 // 最近推迟的音频帧时间，同一帧多次推迟只计一次
+	lastReport time.Time
+	exceeded   bool // 已记录超出阈值的日志，回到阈值内后复位
+}
+
+func newAVSyncWatchdog(thresholdMs int64, correct bool, now time.Time) *avSyncWatchdog {
+	return &avSyncWatchdog{thresholdMs: thresholdMs, correct: correct, lastReport: now}
+}
+
+// video 记录当前发送的视频帧时间
+func (w *avSyncWatchdog) video(ms int64) {
+	w.videoMs, w.hasVideo = ms, true
+}
+
+// audio 检查音频帧的漂移，返回处理方式
+func (w *avSyncWatchdog) audio(streamID uint64, ms int64) avSyncAction {
+	if w.thresholdMs <= 0 || !w.hasVideo {
+		return avSyncSend
+	}
+
+	drift := ms - w.videoMs
+	absDrift := drift
+	if absDrift < 0 {
+		absDrift = -absDrift
+	}
+
+	if absDrift <= w.thresholdMs {
+		w.exceeded = false
+	} else {
+		if !w.exceeded {
+			w.exceeded = true
+			seetong.LogWarn("音视频漂移超过阈值", "stream", streamID, "drift_ms", drift,
+				"threshold_ms", w.thresholdMs, "correct", w.correct)
+		}
+		if w.correct && absDrift <= avSyncMaxHoldMs {
+			if drift < 0 {
+				w.dropped++
+				return avSyncDrop
+			}
+			if ms != w.heldMs {
+				w.held++
+				w.heldMs = ms
+			}
+			return avSyncHold
+		}
+	}
+
+	w.sumDrift += drift
+	w.samples++
+	if absDrift > w.maxDrift {
+		w.maxDrift = absDrift
+	}
+	return avSyncSend
+}
+
+// report 到达诊断间隔时返回 sync 消息并开始新窗口
+func (w *avSyncWatchdog) report(now time.Time) (map[string]interface{}, bool) {
+	if now.Sub(w.lastReport) < avSyncReportInterval || (w.samples == 0 && w.dropped == 0 && w.held == 0) {
+		return nil, false
+	}
+
+	var avg int64
+	if w.samples > 0 {
+		avg = w.sumDrift / w.samples
+	}
+	msg := map[string]interface{}{
+		"type":        "sync",
+		"driftMs":     avg,
+		"maxDriftMs":  w.maxDrift,
+		"thresholdMs": w.thresholdMs,
+		"dropped":     w.dropped,
+		"held":        w.held,
+	}
+	w.sumDrift, w.samples, w.maxDrift, w.dropped, w.held = 0, 0, 0, 0, 0
+	w.lastReport = now
+	return msg, true
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"seetong-dvr/internal/config"
+)
+
+// 模拟 10 分钟的 25fps 流：每帧按 wait 等待后发送，读取和发送耗时 1-8ms，
+// 每 1000 帧有一次 300ms 的卡顿（小于 maxLag，不重新对齐）
+func TestStreamPacerDrift(t *testing.T) {
+	const (
+		frames     = 10 * 60 * 25
+		intervalMs = 40
+		stall      = 300 * time.Millisecond
+		maxCost    = 8 * time.Millisecond
+	)
+	for _, tc := range []struct {
+		name     string
+		speed    float64
+		interval bool // 使用 waitInterval（没有精确帧时间）
+	}{
+		{"0.5x", 0.5, false},
+		{"1x", 1, false},
+		{"2x", 2, false},
+		{"0.5x interval", 0.5, true},
+		{"1x interval", 1, true},
+		{"2x interval", 2, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(1))
+			p := newStreamPacer(tc.speed, 0)
+			start := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+			now := start
+			var maxDrift time.Duration
+			for i := 0; i < frames; i++ {
+				ms := int64(i * intervalMs)
+				var w time.Duration
+				if tc.interval {
+					w = p.waitInterval(time.Duration(float64(intervalMs)/tc.speed*float64(time.Millisecond)), now)
+				} else {
+					w = p.wait(ms, now)
+				}
+				if w < 0 {
+					t.Fatalf("frame %d: negative wait %v", i, w)
+				}
+				if p.realigned {
+					t.Fatalf("frame %d: realigned after a %v stall", i, stall)
+				}
+				now = now.Add(w)
+
+				// 发送时刻与理想时刻的偏差
+				ideal := start.Add(time.Duration(float64(ms) / tc.speed * float64(time.Millisecond)))
+				drift := now.Sub(ideal)
+				if drift < 0 {
+					t.Fatalf("frame %d sent %v early", i, -drift)
+				}
+				if drift > maxDrift {
+					maxDrift = drift
+				}
+
+				now = now.Add(time.Millisecond + time.Duration(rng.Int63n(int64(maxCost-time.Millisecond))))
+				if i%1000 == 500 {
+					now = now.Add(stall)
+				}
+			}
+
+			// 卡顿之后追上计划时间，偏差不累积
+			ideal := start.Add(time.Duration(float64(frames*intervalMs) / tc.speed * float64(time.Millisecond)))
+			if drift := now.Sub(ideal); drift > maxCost {
+				t.Errorf("after %d frames the stream is %v behind", frames, drift)
+			}
+			if maxDrift > stall+maxCost {
+				t.Errorf("max drift %v, want at most %v", maxDrift, stall+maxCost)
+			}
+		})
+	}
+}
+
+func TestStreamPacerRealignsAfterLongStall(t *testing.T) {
+	p := newStreamPacer(1, 0)
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	p.wait(0, now)
+	now = now.Add(40*time.Millisecond + config.DefaultPaceMaxLagMs*time.Millisecond + time.Millisecond)
+	if w := p.wait(40, now); w != 0 || !p.realigned {
+		t.Fatalf("after a stall longer than maxLag: wait %v, realigned %v", w, p.realigned)
+	}
+	// 之后的帧按新的对齐点计时，而不是连续发送追赶
+	if w := p.wait(80, now); w != 40*time.Millisecond || p.realigned {
+		t.Fatalf("next frame: wait %v, realigned %v, want 40ms", w, p.realigned)
+	}
+}
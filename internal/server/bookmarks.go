@@ -0,0 +1,258 @@
+package server
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"seetong-dvr/internal/seetong"
+
+	"github.com/kataras/iris/v12"
+)
+
+// 书签标签的最大长度（字符）
+const maxBookmarkLabel = 200
+
+// Bookmark 播放书签，与录像段落无关，只记录时间点
+type Bookmark struct {
+	ID        string `json:"id"`
+	Timestamp int64  `json:"ts"`
+	Channel   int    `json:"channel"`
+	Label     string `json:"label"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// bookmarkFile 单个 DVR 路径的书签文件
+type bookmarkFile struct {
+	DVRPath   string     `json:"dvrPath"`
+	Bookmarks []Bookmark `json:"bookmarks"`
+}
+
+// bookmarkStore 书签存储
+// 每个 DVR 路径一个 JSON 文件，每次操作都重新读写文件，书签数量很少，不需要常驻内存
+type bookmarkStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func newBookmarkStore(dir string) *bookmarkStore {
+	return &bookmarkStore{dir: dir}
+}
+
+// pathFor 书签文件路径，按 DVR 路径的 hash 命名（路径本身记录在文件中）
+func (b *bookmarkStore) pathFor(dvrPath string) string {
+	if abs, err := filepath.Abs(dvrPath); err == nil {
+		dvrPath = abs
+	}
+	sum := md5.Sum([]byte(dvrPath))
+	return filepath.Join(b.dir, "bookmarks", hex.EncodeToString(sum[:8])+".json")
+}
+
+func (b *bookmarkStore) loadLocked(dvrPath string) ([]Bookmark, error) {
+	data, err := os.ReadFile(b.pathFor(dvrPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f bookmarkFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("书签文件损坏: %w", err)
+	}
+	return f.Bookmarks, nil
+}
+
+// saveLocked 先写临时文件再重命名，避免写入中断导致书签丢失
+func (b *bookmarkStore) saveLocked(dvrPath string, bookmarks []Bookmark) error {
+	if seetong.IsReadOnly() {
+		return seetong.ErrReadOnly
+	}
+	path := b.pathFor(dvrPath)
+	data, err := json.MarshalIndent(bookmarkFile{DVRPath: dvrPath, Bookmarks: bookmarks}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// list 返回 [from, to) 内的书签（to 为 0 表示不限），按时间排序；channel 为 nil 时返回全部通道
+func (b *bookmarkStore) list(dvrPath string, from, to int64, channel *int) ([]Bookmark, error) {
+	b.mu.Lock()
+	bookmarks, err := b.loadLocked(dvrPath)
+	b.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Bookmark{}
+	for _, bm := range bookmarks {
+		if bm.Timestamp < from || (to > 0 && bm.Timestamp >= to) {
+			continue
+		}
+		if channel != nil && bm.Channel != *channel {
+			continue
+		}
+		result = append(result, bm)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Timestamp < result[j].Timestamp })
+	return result, nil
+}
+
+// add 添加书签，返回带 ID 的书签
+func (b *bookmarkStore) add(dvrPath string, bm Bookmark) (Bookmark, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bookmarks, err := b.loadLocked(dvrPath)
+	if err != nil {
+		return bm, err
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	bm.ID = hex.EncodeToString(id)
+	bm.CreatedAt = time.Now().Unix()
+	if err := b.saveLocked(dvrPath, append(bookmarks, bm)); err != nil {
+		return bm, err
+	}
+	return bm, nil
+}
+
+// remove 删除书签，不存在时返回 false
+func (b *bookmarkStore) remove(dvrPath, id string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bookmarks, err := b.loadLocked(dvrPath)
+	if err != nil {
+		return false, err
+	}
+	for i, bm := range bookmarks {
+		if bm.ID == id {
+			bookmarks = append(bookmarks[:i], bookmarks[i+1:]...)
+			return true, b.saveLocked(dvrPath, bookmarks)
+		}
+	}
+	return false, nil
+}
+
+// dayBounds 指定日期在显示时区中的起止时间 [start, end)
+// 结束时间是下一个日历日的零点而不是 24 小时之后，夏令时切换当天为 23 或 25 小时
+func (s *DVRServer) dayBounds(date string) (int64, int64, error) {
+	day, err := time.ParseInLocation("2006-01-02", date, s.location())
+	if err != nil {
+		return 0, 0, err
+	}
+	return day.Unix(), nextLocalDay(day).Unix(), nil
+}
+
+// bookmarkRequest 添加书签请求
+type bookmarkRequest struct {
+	Timestamp int64  `json:"ts"`
+	Channel   int    `json:"channel"`
+	Label     string `json:"label"`
+}
+
+// GetBookmarks 获取书签
+// GET /api/v1/bookmarks?date=2024-01-15&channel=1
+// date 和 channel 都可省略
+func (h *Handlers) GetBookmarks(ctx iris.Context) {
+	var from, to int64
+	if date := ctx.URLParam("date"); date != "" {
+		var err error
+		if from, to, err = h.dvr.dayBounds(date); err != nil {
+			writeError(ctx, errInvalidParam("无效的 date 参数", "invalid date parameter"))
+			return
+		}
+	}
+	var channel *int
+	if ctx.URLParamExists("channel") {
+		ch, err := ctx.URLParamInt("channel")
+		if err != nil {
+			writeError(ctx, errInvalidParam("无效的 channel 参数", "invalid channel parameter"))
+			return
+		}
+		channel = &ch
+	}
+
+	bookmarks, err := h.bookmarks.list(h.dvr.GetDVRPath(), from, to, channel)
+	if err != nil {
+		writeError(ctx, errBookmarkStore.WithDetail(err.Error()))
+		return
+	}
+	ctx.JSON(iris.Map{"bookmarks": bookmarks})
+}
+
+// AddBookmark 添加书签（只读模式下返回 403）
+// POST /api/v1/bookmarks {"ts": 1705300000, "channel": 1, "label": "..."}
+func (h *Handlers) AddBookmark(ctx iris.Context) {
+	if seetong.IsReadOnly() {
+		writeError(ctx, errReadOnly)
+		return
+	}
+	var req bookmarkRequest
+	if err := ctx.ReadJSON(&req); err != nil {
+		writeError(ctx, errInvalidParam("无效的请求", "invalid request body").WithDetail(err.Error()))
+		return
+	}
+	if req.Timestamp <= 0 {
+		writeError(ctx, errInvalidParam("缺少 ts 参数", "missing ts"))
+		return
+	}
+	req.Label = strings.TrimSpace(req.Label)
+	if utf8.RuneCountInString(req.Label) > maxBookmarkLabel {
+		writeError(ctx, errInvalidParam(fmt.Sprintf("标签不能超过 %d 个字符", maxBookmarkLabel),
+			fmt.Sprintf("label longer than %d characters", maxBookmarkLabel)))
+		return
+	}
+
+	dvrPath := h.dvr.GetDVRPath()
+	if dvrPath == "" {
+		writeError(ctx, errNotLoaded)
+		return
+	}
+	bm, err := h.bookmarks.add(dvrPath, Bookmark{
+		Timestamp: req.Timestamp,
+		Channel:   req.Channel,
+		Label:     req.Label,
+	})
+	if err != nil {
+		writeError(ctx, errBookmarkStore.WithDetail(err.Error()))
+		return
+	}
+	ctx.StatusCode(iris.StatusCreated)
+	ctx.JSON(bm)
+}
+
+// DeleteBookmark 删除书签（只读模式下返回 403）
+// DELETE /api/v1/bookmarks/{id}
+func (h *Handlers) DeleteBookmark(ctx iris.Context) {
+	if seetong.IsReadOnly() {
+		writeError(ctx, errReadOnly)
+		return
+	}
+	ok, err := h.bookmarks.remove(h.dvr.GetDVRPath(), ctx.Params().Get("id"))
+	if err != nil {
+		writeError(ctx, errBookmarkStore.WithDetail(err.Error()))
+		return
+	}
+	if !ok {
+		writeError(ctx, errBookmarkNotFound)
+		return
+	}
+	ctx.StatusCode(iris.StatusNoContent)
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"seetong-dvr/internal/seetong"
+
+	"github.com/kataras/iris/v12"
+)
+
+// DaySummary 一天的录像统计
+type DaySummary struct {
+	Date     string `json:"date"`     // YYYY-MM-DD
+	Segments int    `json:"segments"` // 与这一天重叠的段落数（跨零点的段落在每一天都计入）
+	Seconds  int64  `json:"seconds"`  // 段落落在这一天内的时长之和（多个通道分别计入）
+}
+
+// CalendarSummary 一个月或一年的录像统计
+type CalendarSummary struct {
+	Period   string `json:"period"` // 月为 YYYY-MM，年为 YYYY
+	Days     int    `json:"days"`   // 有录像的天数
+	Segments int    `json:"segments"`
+	Seconds  int64  `json:"seconds"`
+}
+
+// datedSegments 日期列表统计的段落：已缓存的段落，设置了 cacheDays 时为全部段落
+// channels 为 nil 时包括所有通道，否则只包括其中的通道
+func (s *DVRServer) datedSegments(channels map[int]bool) []*seetong.SegmentRecord {
+	segments := s.storage.GetCachedSegments()
+	if s.cacheDays > 0 {
+		all := s.storage.GetSegments()
+		segments = make([]*seetong.SegmentRecord, len(all))
+		for i := range all {
+			segments[i] = &all[i]
+		}
+	}
+	if channels == nil {
+		return segments
+	}
+	var filtered []*seetong.SegmentRecord
+	for _, seg := range segments {
+		if channels[seg.Channel] {
+			filtered = append(filtered, seg)
+		}
+	}
+	return filtered
+}
+
+// GetDaySummaries 按本地日期汇总 channels 中通道的段落（日期升序）
+func (s *DVRServer) GetDaySummaries(channels map[int]bool) []DaySummary {
+	if !s.loaded || s.storage == nil {
+		return nil
+	}
+
+	byDate := make(map[string]*DaySummary)
+	for _, seg := range s.datedSegments(channels) {
+		for _, date := range localDates(seg.StartTime, seg.EndTime, s.location()) {
+			from, to, err := s.dayBounds(date)
+			if err != nil {
+				continue
+			}
+			day := byDate[date]
+			if day == nil {
+				day = &DaySummary{Date: date}
+				byDate[date] = day
+			}
+			day.Segments++
+			day.Seconds += max(0, min(to, seg.EndTime)-max(from, seg.StartTime))
+		}
+	}
+
+	days := make([]DaySummary, 0, len(byDate))
+	for _, day := range byDate {
+		days = append(days, *day)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+	return days
+}
+
+// summarizePeriods 按 period(date) 汇总日统计，days 按日期升序，结果也按升序
+func summarizePeriods(days []DaySummary, period func(date string) string) []CalendarSummary {
+	var periods []CalendarSummary
+	for _, day := range days {
+		p := period(day.Date)
+		if n := len(periods); n == 0 || periods[n-1].Period != p {
+			periods = append(periods, CalendarSummary{Period: p})
+		}
+		last := &periods[len(periods)-1]
+		last.Days++
+		last.Segments += day.Segments
+		last.Seconds += day.Seconds
+	}
+	return periods
+}
+
+// adjacentPeriods periods（升序）中 current 之前和之后最近的一项，没有时为 nil
+func adjacentPeriods(periods []CalendarSummary, current string) (prev, next any) {
+	for _, p := range periods {
+		if p.Period < current {
+			prev = p.Period
+		} else if p.Period > current && next == nil {
+			next = p.Period
+		}
+	}
+	return prev, next
+}
+
+// getDateCalendar 日历形式的日期列表（GetDates 带 year/month/summary 参数时）
+//
+//	summary=true        每年的统计
+//	year=2024           该年每月的统计
+//	year=2024&month=5   该月每天的统计
+//
+// prev/next 为之前/之后最近的有录像的年或月（没有时为 null），用于跳过没有录像的月份翻页
+func (h *Handlers) getDateCalendar(ctx iris.Context, channels map[int]bool, listed []int) {
+	year, month := 0, 0
+	if v := ctx.URLParam("year"); v != "" {
+		y, err := strconv.Atoi(v)
+		if err != nil || y < 1970 || y > 9999 {
+			writeError(ctx, errInvalidParam("无效的 year 参数", "invalid year parameter"))
+			return
+		}
+		year = y
+	}
+	if v := ctx.URLParam("month"); v != "" {
+		m, err := strconv.Atoi(v)
+		if err != nil || m < 1 || m > 12 || year == 0 {
+			writeError(ctx, errInvalidParam("month 需要 1-12 并同时指定 year", "month must be 1-12 and requires year"))
+			return
+		}
+		month = m
+	}
+
+	days := h.dvr.GetDaySummaries(channels)
+	years := append([]CalendarSummary{}, summarizePeriods(days, func(date string) string { return date[:4] })...)
+	switch {
+	case year == 0:
+		var first, last any
+		if len(days) > 0 {
+			first, last = days[0].Date, days[len(days)-1].Date
+		}
+		ctx.JSON(iris.Map{
+			"years":    years,
+			"first":    first,
+			"last":     last,
+			"channels": listed,
+		})
+
+	case month == 0:
+		current := fmt.Sprintf("%04d", year)
+		var inYear []DaySummary
+		for _, day := range days {
+			if day.Date[:4] == current {
+				inYear = append(inYear, day)
+			}
+		}
+		prev, next := adjacentPeriods(years, current)
+		ctx.JSON(iris.Map{
+			"year":     year,
+			"months":   append([]CalendarSummary{}, summarizePeriods(inYear, func(date string) string { return date[:7] })...),
+			"prev":     prev,
+			"next":     next,
+			"channels": listed,
+		})
+
+	default:
+		current := fmt.Sprintf("%04d-%02d", year, month)
+		inMonth := []DaySummary{}
+		for _, day := range days {
+			if day.Date[:7] == current {
+				inMonth = append(inMonth, day)
+			}
+		}
+		prev, next := adjacentPeriods(summarizePeriods(days, func(date string) string { return date[:7] }), current)
+		ctx.JSON(iris.Map{
+			"year":     year,
+			"month":    month,
+			"days":     inMonth,
+			"prev":     prev,
+			"next":     next,
+			"channels": listed,
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/kataras/iris/v12"
+)
+
+// catalogChangeHistory 保留的目录变化次数，更早的版本只能取得完整列表
+const catalogChangeHistory = 256
+
+// CatalogEntry 目录中的一个段落（与日期和录像列表统计的段落相同：已缓存的段落，设置了 cacheDays 时为全部段落）
+type CatalogEntry struct {
+	FileIndex int   `json:"fileIndex"`
+	Channel   int   `json:"channel"`
+	StartTime int64 `json:"startTime"`
+	EndTime   int64 `json:"endTime"`
+}
+
+// catalogChange 一次版本变化中新增、内容变化或被移除的段落
+type catalogChange struct {
+	version int64
+	touched []int
+}
+
+// catalogTracker 目录版本：每次观察到段落集合与上次不同时版本加一，并记录变化的段落
+// 版本号从创建时的毫秒时间戳开始，服务重启后也不会变小，客户端保存的旧版本不会被误认为当前版本
+type catalogTracker struct {
+	mu      sync.Mutex
+	version int64
+	etag    string
+	entries map[int]CatalogEntry
+	changes []catalogChange // 按版本升序，最多 catalogChangeHistory 条
+}
+
+func newCatalogTracker(startMs int64) *catalogTracker {
+	return &catalogTracker{version: startMs, etag: catalogETag(nil), entries: map[int]CatalogEntry{}}
+}
+
+// catalogETag 段落集合的哈希（按 fileIndex 排序后计算），集合相同时相同
+func catalogETag(entries []CatalogEntry) string {
+	h := sha1.New()
+	var buf [28]byte
+	for _, e := range entries {
+		binary.LittleEndian.PutUint64(buf[0:], uint64(e.FileIndex))
+		binary.LittleEndian.PutUint32(buf[8:], uint32(e.Channel))
+		binary.LittleEndian.PutUint64(buf[12:], uint64(e.StartTime))
+		binary.LittleEndian.PutUint64(buf[20:], uint64(e.EndTime))
+		h.Write(buf[:])
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// observe 用当前的段落集合（按 fileIndex 升序）更新版本，返回当前版本和 etag
+func (t *catalogTracker) observe(current []CatalogEntry) (int64, string) {
+	etag := catalogETag(current)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if etag == t.etag {
+		return t.version, t.etag
+	}
+
+	next := make(map[int]CatalogEntry, len(current))
+	var touched []int
+	for _, e := range current {
+		next[e.FileIndex] = e
+		if old, ok := t.entries[e.FileIndex]; !ok || old != e {
+			touched = append(touched, e.FileIndex)
+		}
+	}
+	for fileIndex := range t.entries {
+		if _, ok := next[fileIndex]; !ok {
+			touched = append(touched, fileIndex)
+		}
+	}
+
+	t.version++
+	t.etag = etag
+	t.entries = next
+	t.changes = append(t.changes, catalogChange{version: t.version, touched: touched})
+	if n := len(t.changes) - catalogChangeHistory; n > 0 {
+		t.changes = append([]catalogChange(nil), t.changes[n:]...)
+	}
+	return t.version, t.etag
+}
+
+// since 版本 since 之后新增或内容变化（added）和被移除（removed）的段落，以及计算时的版本和 etag
+// since 早于保留的变化记录或不是本进程发出的版本（大于当前版本）时 reset 为 true，added 为全部段落
+func (t *catalogTracker) since(since int64) (added []CatalogEntry, removed []int, reset bool, version int64, etag string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	oldest := t.version // 能够计算变化的最早版本
+	if len(t.changes) > 0 {
+		oldest = t.changes[0].version - 1
+	}
+	added, removed = []CatalogEntry{}, []int{}
+	if since < oldest || since > t.version {
+		for _, e := range t.entries {
+			added = append(added, e)
+		}
+		sort.Slice(added, func(i, j int) bool { return added[i].FileIndex < added[j].FileIndex })
+		return added, removed, true, t.version, t.etag
+	}
+
+	touched := make(map[int]bool)
+	for _, c := range t.changes {
+		if c.version > since {
+			for _, fileIndex := range c.touched {
+				touched[fileIndex] = true
+			}
+		}
+	}
+	for fileIndex := range touched {
+		if e, ok := t.entries[fileIndex]; ok {
+			added = append(added, e)
+		} else {
+			removed = append(removed, fileIndex)
+		}
+	}
+	sort.Slice(added, func(i, j int) bool { return added[i].FileIndex < added[j].FileIndex })
+	sort.Ints(removed)
+	return added, removed, false, t.version, t.etag
+}
+
+// catalogEntries 当前 DVR 的目录段落（按 fileIndex 升序），未加载时为空
+func (s *DVRServer) catalogEntries() []CatalogEntry {
+	if !s.loaded || s.storage == nil {
+		return nil
+	}
+	segments := s.datedSegments(nil)
+	entries := make([]CatalogEntry, 0, len(segments))
+	for _, seg := range segments {
+		entries = append(entries, CatalogEntry{
+			FileIndex: seg.FileIndex,
+			Channel:   seg.Channel,
+			StartTime: seg.StartTime,
+			EndTime:   seg.EndTime,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].FileIndex < entries[j].FileIndex })
+	return entries
+}
+
+// catalogVersion 按当前 DVR 的段落更新并返回目录版本
+// 切换 DVR 路径后新路径的段落与之前的段落比较，版本继续递增
+func (h *Handlers) catalogVersion() (int64, string, int) {
+	entries := h.dvr.catalogEntries()
+	version, etag := h.catalog.observe(entries)
+	return version, etag, len(entries)
+}
+
+// GetCatalogVersion 目录版本
+// GET /api/v1/catalog/version
+//
+// 段落集合变化（缓存构建完成新的段落、切换 DVR 路径）后版本递增；etag 为段落集合的哈希，
+// 同时作为 ETag 响应头，带 If-None-Match 的请求在没有变化时返回 304
+func (h *Handlers) GetCatalogVersion(ctx iris.Context) {
+	version, etag, count := h.catalogVersion()
+	ctx.Header("ETag", strconv.Quote(etag))
+	if ctx.GetHeader("If-None-Match") == strconv.Quote(etag) {
+		ctx.StatusCode(iris.StatusNotModified)
+		return
+	}
+	ctx.JSON(iris.Map{
+		"version": version,
+		"etag":    etag,
+		"entries": count,
+	})
+}
+
+// GetCatalogChanges 某个目录版本之后的变化
+// GET /api/v1/catalog/changes?since=<version>
+//
+// added 为新增或内容变化（按 fileIndex 覆盖）的段落，removed 为被移除段落的 fileIndex。
+// reset 为 true 时 since 太旧或来自之前的服务进程，added 为全部段落，客户端应替换整个列表
+func (h *Handlers) GetCatalogChanges(ctx iris.Context) {
+	since, err := strconv.ParseInt(ctx.URLParam("since"), 10, 64)
+	if err != nil {
+		writeError(ctx, errInvalidParam("需要 since 参数（目录版本）", "since (catalog version) is required"))
+		return
+	}
+
+	h.catalogVersion()
+	added, removed, reset, version, etag := h.catalog.since(since)
+	ctx.JSON(iris.Map{
+		"since":   since,
+		"version": version,
+		"etag":    etag,
+		"reset":   reset,
+		"added":   added,
+		"removed": removed,
+	})
+}
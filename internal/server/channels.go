@@ -0,0 +1,187 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"seetong-dvr/internal/seetong"
+
+	"github.com/kataras/iris/v12"
+)
+
+// 通道类型
+const (
+	ChannelKindVideo  = "video"
+	ChannelKindAudio  = "audio"
+	ChannelKindHidden = "hidden" // 不出现在日期和录像列表中，指定通道号时仍可查询和播放
+)
+
+// audioLabelKey 音频通道在标签和类型映射中的键（视频通道使用通道号）
+const audioLabelKey = "audio"
+
+// channelKinds 配置 channelKinds：通道号或 "audio" -> 通道类型
+type channelKinds map[string]string
+
+// lookup 配置的类型，未配置或取值无效时返回 fallback
+func (k channelKinds) lookup(key, fallback string) string {
+	switch kind := k[key]; kind {
+	case ChannelKindVideo, ChannelKindAudio, ChannelKindHidden:
+		return kind
+	}
+	return fallback
+}
+
+// kind 段落通道的类型，默认音频通道号为 audio，其余为 video
+func (k channelKinds) kind(channel int) string {
+	fallback := ChannelKindVideo
+	if channel == seetong.ChannelAudio {
+		fallback = ChannelKindAudio
+	}
+	return k.lookup(strconv.Itoa(channel), fallback)
+}
+
+// listed 未指定通道时该通道是否出现在日期和录像列表中（只列出视频通道）
+func (k channelKinds) listed(channel int) bool {
+	return k.kind(channel) == ChannelKindVideo
+}
+
+// ChannelInfo 通道信息
+type ChannelInfo struct {
+	Channel        int    `json:"channel"`      // 段落通道号（视频）或帧通道号（音频）
+	FrameChannel   int    `json:"frameChannel"` // 帧索引中的通道号
+	Label          string `json:"label"`
+	Kind           string `json:"kind"`
+	Resolution     string `json:"resolution,omitempty"` // 如 "1920x1080"，来自 SPS
+	Width          int    `json:"width,omitempty"`
+	Height         int    `json:"height,omitempty"`
+	RecordingCount int    `json:"recordingCount"`
+	Earliest       int64  `json:"earliest"`
+	Latest         int64  `json:"latest"`
+}
+
+// channelLabel 通道显示名称，labels 中的配置优先
+func channelLabel(labels map[string]string, key, fallback string) string {
+	if label, ok := labels[key]; ok && label != "" {
+		return label
+	}
+	return fallback
+}
+
+// GetChannelInfo 汇总各通道的录像数、时间范围和分辨率
+// 分辨率取该通道最新一个已缓存段落的首个 I 帧 SPS
+func (s *DVRServer) GetChannelInfo(labels map[string]string, kinds channelKinds) []ChannelInfo {
+	result := []ChannelInfo{}
+	if !s.loaded || s.storage == nil {
+		return result
+	}
+
+	byChannel := make(map[int]*ChannelInfo)
+	latestCached := make(map[int]seetong.SegmentRecord) // 通道 -> 最新的已缓存段落
+	audio := ChannelInfo{
+		Channel:      seetong.ChannelAudio,
+		FrameChannel: seetong.ChannelAudio,
+		Label:        channelLabel(labels, audioLabelKey, "Audio"),
+		Kind:         kinds.lookup(audioLabelKey, ChannelKindAudio),
+	}
+
+	for _, seg := range s.storage.GetSegments() {
+		info := byChannel[seg.Channel]
+		if info == nil {
+			info = &ChannelInfo{
+				Channel:      seg.Channel,
+				FrameChannel: frameChannelFor(seg.Channel),
+				Label:        channelLabel(labels, strconv.Itoa(seg.Channel), fmt.Sprintf("Camera %d", seg.Channel)),
+				Kind:         kinds.kind(seg.Channel),
+			}
+			byChannel[seg.Channel] = info
+		}
+		addRecording(info, seg)
+
+		if !s.storage.IsSegmentCached(seg.FileIndex) {
+			continue
+		}
+		if prev, ok := latestCached[seg.Channel]; !ok || seg.StartTime > prev.StartTime {
+			latestCached[seg.Channel] = seg
+		}
+		if s.storage.HasAudio(seg.FileIndex) {
+			addRecording(&audio, seg)
+		}
+	}
+
+	for ch, info := range byChannel {
+		if seg, ok := latestCached[ch]; ok {
+			if sps := s.channelSPS(seg.FileIndex, info.FrameChannel); sps != nil {
+				info.Width, info.Height = sps.Width, sps.Height
+				info.Resolution = fmt.Sprintf("%dx%d", sps.Width, sps.Height)
+			}
+		}
+		result = append(result, *info)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Channel < result[j].Channel })
+
+	if audio.RecordingCount > 0 {
+		result = append(result, audio)
+	}
+	return result
+}
+
+// addRecording 累计录像数和时间范围
+func addRecording(info *ChannelInfo, seg seetong.SegmentRecord) {
+	info.RecordingCount++
+	if info.Earliest == 0 || seg.StartTime < info.Earliest {
+		info.Earliest = seg.StartTime
+	}
+	if seg.EndTime > info.Latest {
+		info.Latest = seg.EndTime
+	}
+}
+
+// channelSPS 解析段落首个 I 帧的 SPS
+func (s *DVRServer) channelSPS(fileIndex int, frameChannel int) *seetong.SPSInfo {
+	iframes := s.storage.GetIFrameOffsets(fileIndex, frameChannel)
+	if len(iframes) == 0 {
+		return nil
+	}
+	header := s.storage.ReadVideoHeader(fileIndex, int64(iframes[0].Offset))
+	if header == nil {
+		return nil
+	}
+	sps, err := seetong.ParseSPS(header.SPS)
+	if err != nil {
+		seetong.LogDebug("SPS 解析失败", "file_index", fileIndex, "error", err)
+		return nil
+	}
+	return sps
+}
+
+// GetChannels 获取通道列表（显示名称、类型、分辨率和录像范围）
+// GET /api/v1/channels
+// 显示名称可通过配置 channelLabels 覆盖，类型可通过 channelKinds 覆盖，键为通道号或 "audio"；
+// hidden 通道也在列表中，由客户端决定是否显示
+func (h *Handlers) GetChannels(ctx iris.Context) {
+	cfg := h.cfg.Get()
+	ctx.JSON(h.dvr.GetChannelInfo(cfg.ChannelLabels, cfg.ChannelKinds))
+}
+
+// listedChannels 过滤出出现在日期和录像列表中的通道
+func listedChannels(channels []int, kinds channelKinds) []int {
+	listed := make([]int, 0, len(channels))
+	for _, ch := range channels {
+		if kinds.listed(ch) {
+			listed = append(listed, ch)
+		}
+	}
+	return listed
+}
+
+// listedRecordings 过滤出出现在录像列表中的通道的录像
+func listedRecordings(recordings []RecordingInfo, kinds channelKinds) []RecordingInfo {
+	listed := make([]RecordingInfo, 0, len(recordings))
+	for _, rec := range recordings {
+		if kinds.listed(rec.Channel) {
+			listed = append(listed, rec)
+		}
+	}
+	return listed
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kataras/iris/v12"
+)
+
+// GetChapters 一天录像的 WebVTT 章节
+// GET /api/v1/chapters?date=2024-01-15&channel=1&gap=5
+//
+// 每个连续录像块（间隔不超过 gap 秒的录像合并，与 /recordings?merge=true 相同）一个 cue，
+// 标题为块的开始时间（显示时区）和录像时长。cue 时间以 playTimeline 的播放进度为准：
+// 从当天第一段录像开始计时，录像之间的空白不占时间（时间线播放跳过空白）
+func (h *Handlers) GetChapters(ctx iris.Context) {
+	date := ctx.URLParam("date")
+	if date == "" {
+		writeError(ctx, errInvalidParam("缺少 date 参数", "missing date parameter"))
+		return
+	}
+	channel := ctx.URLParamIntDefault("channel", 1)
+	gap := ctx.URLParamInt64Default("gap", DefaultMergeGap)
+
+	dvr := h.dvr
+	timeline, err := buildDayTimeline(dvr, date, channel)
+	if err != nil {
+		writeError(ctx, errNoRecordings.WithDetail(err.Error()))
+		return
+	}
+
+	loc := dvr.location()
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i, block := range MergeRecordings(timeline.segments, gap) {
+		start := timeline.playbackOffset(block.StartTimestamp)
+		end := timeline.playbackOffset(block.EndTimestamp)
+		fmt.Fprintf(&b, "\n%d\n%s --> %s\n%s (%s)\n", i+1,
+			vttTimestamp(start), vttTimestamp(end),
+			time.Unix(block.StartTimestamp, 0).In(loc).Format("15:04:05"),
+			time.Duration(end-start)*time.Second)
+	}
+
+	ctx.ContentType("text/vtt; charset=utf-8")
+	ctx.WriteString(b.String())
+}
+
+// vttTimestamp WebVTT 时间（HH:MM:SS.mmm，小时可以超过两位）
+func vttTimestamp(sec int64) string {
+	return fmt.Sprintf("%02d:%02d:%02d.000", sec/3600, sec/60%60, sec%60)
+}
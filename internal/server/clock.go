@@ -0,0 +1,36 @@
+package server
+
+import "time"
+
+// Clock 时间和时区来源
+// 默认使用系统时钟和时区数据库；测试或回放历史数据时可固定当前时间和时区，
+// 结果不再依赖运行环境的本地时区
+type Clock interface {
+	Now() time.Time
+	LoadLocation(name string) (*time.Location, error)
+}
+
+// systemClock 系统时钟
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) LoadLocation(name string) (*time.Location, error) {
+	return time.LoadLocation(name)
+}
+
+// FixedClock 固定时间的时钟
+// Location 非空时忽略配置的时区名，总是使用该时区
+type FixedClock struct {
+	Time     time.Time
+	Location *time.Location
+}
+
+func (c FixedClock) Now() time.Time { return c.Time }
+
+func (c FixedClock) LoadLocation(name string) (*time.Location, error) {
+	if c.Location != nil {
+		return c.Location, nil
+	}
+	return time.LoadLocation(name)
+}
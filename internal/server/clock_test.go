@@ -0,0 +1,97 @@
+package server
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // 不依赖主机的时区数据库
+)
+
+func TestRecordingAcrossMidnightListedUnderBothDates(t *testing.T) {
+	// 主机时区与显示时区不同，结果只由固定的 Clock 决定
+	defer func(local *time.Location) { time.Local = local }(time.Local)
+	time.Local = time.FixedZone("host", -7*3600)
+
+	loc := time.FixedZone("UTC+8", 8*3600)
+	start := time.Date(2024, 1, 15, 23, 30, 0, 0, loc)
+	end := time.Date(2024, 1, 16, 0, 30, 0, 0, loc)
+	clock := FixedClock{Time: time.Date(2024, 1, 20, 12, 0, 0, 0, loc), Location: loc}
+	s := loadFixtureDVR(t, writeFixtureDVR(t, fixtureSegment{Channel: 1, Start: start, End: end}), clock, "Asia/Shanghai")
+
+	if !s.Now().Equal(clock.Time) {
+		t.Fatalf("Now() = %v, want the pinned %v", s.Now(), clock.Time)
+	}
+	dates := s.GetRecordingDates(nil)
+	if len(dates) != 2 || !dates["2024-01-15"] || !dates["2024-01-16"] {
+		t.Fatalf("recording dates %v, want 2024-01-15 and 2024-01-16", dates)
+	}
+
+	midnight := time.Date(2024, 1, 16, 0, 0, 0, 0, loc).Unix()
+	for _, tc := range []struct {
+		date       string
+		start, end int64
+		startText  string
+	}{
+		{"2024-01-15", start.Unix(), midnight, "23:30:00"},
+		{"2024-01-16", midnight, end.Unix(), "00:00:00"},
+	} {
+		recordings := s.GetRecordings(tc.date, nil)
+		if len(recordings) != 1 {
+			t.Fatalf("%s: %d recordings, want 1", tc.date, len(recordings))
+		}
+		r := recordings[0]
+		if r.StartTimestamp != tc.start || r.EndTimestamp != tc.end || r.Duration != 1800 {
+			t.Errorf("%s: %d-%d (%ds), want %d-%d (1800s)", tc.date, r.StartTimestamp, r.EndTimestamp, r.Duration, tc.start, tc.end)
+		}
+		if r.Start != tc.startText {
+			t.Errorf("%s: start %q, want %q", tc.date, r.Start, tc.startText)
+		}
+	}
+}
+
+func TestDayBoundsAcrossDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 02:00 EST 跳到 03:00 EDT：01:30 到 03:30 的录像实际只有一小时
+	start := time.Date(2024, 3, 10, 1, 30, 0, 0, loc)
+	end := time.Date(2024, 3, 10, 3, 30, 0, 0, loc)
+	clock := FixedClock{Time: time.Date(2024, 3, 12, 12, 0, 0, 0, loc), Location: loc}
+	s := loadFixtureDVR(t, writeFixtureDVR(t, fixtureSegment{Channel: 1, Start: start, End: end}), clock, "America/New_York")
+
+	for _, tc := range []struct {
+		date  string
+		hours int64
+	}{
+		{"2024-03-09", 24},
+		{"2024-03-10", 23}, // 春季调快
+		{"2024-11-03", 25}, // 秋季调回
+	} {
+		from, to, err := s.dayBounds(tc.date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := time.Unix(from, 0).In(loc).Format("2006-01-02 15:04"); got != tc.date+" 00:00" {
+			t.Errorf("%s: day starts at %v", tc.date, time.Unix(from, 0).In(loc))
+		}
+		if to-from != tc.hours*3600 {
+			t.Errorf("%s: day is %dh, want %dh", tc.date, (to-from)/3600, tc.hours)
+		}
+	}
+
+	dates := s.GetRecordingDates(nil)
+	if len(dates) != 1 || !dates["2024-03-10"] {
+		t.Fatalf("recording dates %v, want only 2024-03-10", dates)
+	}
+	recordings := s.GetRecordings("2024-03-10", nil)
+	if len(recordings) != 1 {
+		t.Fatalf("%d recordings, want 1", len(recordings))
+	}
+	r := recordings[0]
+	if r.StartTimestamp != start.Unix() || r.EndTimestamp != end.Unix() || r.Duration != 3600 {
+		t.Errorf("recording %d-%d (%ds), want %d-%d (3600s)", r.StartTimestamp, r.EndTimestamp, r.Duration, start.Unix(), end.Unix())
+	}
+	if r.Start != "01:30:00" || r.End != "03:30:00" {
+		t.Errorf("recording %s-%s, want 01:30:00-03:30:00", r.Start, r.End)
+	}
+}
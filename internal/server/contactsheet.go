@@ -0,0 +1,221 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"seetong-dvr/internal/seetong"
+
+	"github.com/kataras/iris/v12"
+)
+
+// 联系表参数
+const (
+	contactSheetDefaultGrid = 4
+	contactSheetMaxGrid     = 10
+	contactSheetTileWidth   = 240
+	contactSheetWorkers     = 4 // 同时运行的 ffmpeg 进程数
+	contactSheetQuality     = 85
+)
+
+// GetContactSheet 生成段落的联系表（缩略图网格）
+// GET /api/v1/contactsheet/{file_index}?cols=4&rows=4&channel=<n>
+//
+// 在段落内均匀抽取 cols×rows 个 I 帧，解码为缩略图后拼成一张 JPEG，每格标注时间。
+// 需要 ffmpeg；结果按录像文件缓存到索引缓存目录，文件变化后自动失效
+func (h *Handlers) GetContactSheet(ctx iris.Context) {
+	storage := h.dvr.GetStorage()
+	if storage == nil || !h.dvr.IsLoaded() {
+		writeError(ctx, errNotLoaded)
+		return
+	}
+
+	fileIndex := ctx.Params().GetIntDefault("file_index", 0)
+	seg := storage.GetSegmentByFileIndex(fileIndex)
+	if seg == nil {
+		writeError(ctx, errSegmentNotFound)
+		return
+	}
+
+	cols := ctx.URLParamIntDefault("cols", contactSheetDefaultGrid)
+	rows := ctx.URLParamIntDefault("rows", contactSheetDefaultGrid)
+	if cols < 1 || rows < 1 || cols > contactSheetMaxGrid || rows > contactSheetMaxGrid {
+		writeError(ctx, errInvalidParam("无效的 cols/rows 参数", "invalid cols/rows parameter").
+			WithDetail(fmt.Sprintf("1..%d", contactSheetMaxGrid)))
+		return
+	}
+	channel := ctx.URLParamIntDefault("channel", seg.Channel)
+
+	if ffmpegPath() == "" {
+		writeError(ctx, newAPIError(501, ReasonUnsupported, "缩略图需要 ffmpeg", "thumbnails require ffmpeg"))
+		return
+	}
+	recFile := storage.GetRecFile(fileIndex)
+	if recFile == "" {
+		writeError(ctx, errRecFileMissing)
+		return
+	}
+
+	// 标注时间依赖显示时区，时区也是缓存键的一部分
+	tz := h.dvr.GetTimezone()
+	cachePath := filepath.Join(seetong.GetCacheDir(), fmt.Sprintf("%s-sheet-ch%d-%dx%d-%s.jpg",
+		seetong.FileCacheKey(recFile), channel, cols, rows, strings.ReplaceAll(tz, "/", "_")))
+	readOnly := seetong.IsReadOnly() // 只读模式下不使用缓存目录
+	if data, err := os.ReadFile(cachePath); err == nil && !readOnly {
+		ctx.ContentType("image/jpeg")
+		ctx.Write(data)
+		return
+	}
+
+	iframes := storage.GetIFrameOffsets(fileIndex, frameChannelFor(channel))
+	if len(iframes) == 0 {
+		writeError(ctx, errNoIFrame)
+		return
+	}
+
+	samples := sampleEvenly(iframes, cols*rows)
+	sheet := buildContactSheet(ctx.Request().Context(), storage, fileIndex, samples, cols, h.dvr.location())
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, sheet, &jpeg.Options{Quality: contactSheetQuality}); err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	if !readOnly {
+		tmp := cachePath + ".tmp"
+		if err := os.WriteFile(tmp, buf.Bytes(), 0644); err == nil {
+			os.Rename(tmp, cachePath)
+		} else {
+			seetong.LogWarn("联系表缓存写入失败", "file", filepath.Base(cachePath), "error", err)
+		}
+	}
+
+	ctx.ContentType("image/jpeg")
+	ctx.Write(buf.Bytes())
+}
+
+// sampleEvenly 均匀抽取 n 个位置（取每个区间的中点），不足 n 个时全部返回
+func sampleEvenly(positions []seetong.VPSPosition, n int) []seetong.VPSPosition {
+	if len(positions) <= n {
+		return positions
+	}
+	samples := make([]seetong.VPSPosition, n)
+	for k := range samples {
+		samples[k] = positions[(2*k+1)*len(positions)/(2*n)]
+	}
+	return samples
+}
+
+// buildContactSheet 解码抽样的 I 帧并拼成网格，解码失败的格子留灰
+func buildContactSheet(ctx context.Context, storage *seetong.TPSStorage, fileIndex int,
+	samples []seetong.VPSPosition, cols int, loc *time.Location) *image.RGBA {
+
+	tiles := make([]image.Image, len(samples))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, contactSheetWorkers)
+	for i, sample := range samples {
+		wg.Add(1)
+		go func(i int, offset int64) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			data, err := keyframeAnnexB(storage, fileIndex, offset)
+			if err == nil {
+				tiles[i], err = decodeThumbnail(ctx, data, contactSheetTileWidth)
+			}
+			if err != nil {
+				seetong.LogWarn("联系表解码失败", "file_index", fileIndex, "offset", offset, "error", err)
+			}
+		}(i, int64(sample.Offset))
+	}
+	wg.Wait()
+
+	tileW, tileH := contactSheetTileWidth, contactSheetTileWidth*9/16
+	for _, tile := range tiles {
+		if tile != nil && tile.Bounds().Dy() > 0 {
+			tileH = tile.Bounds().Dy()
+			break
+		}
+	}
+
+	rows := (len(samples) + cols - 1) / cols
+	sheet := image.NewRGBA(image.Rect(0, 0, cols*tileW, rows*tileH))
+	draw.Draw(sheet, sheet.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	for i, sample := range samples {
+		cell := image.Rect(0, 0, tileW, tileH).Add(image.Pt(i%cols*tileW, i/cols*tileH))
+		if tiles[i] != nil {
+			draw.Draw(sheet, cell, tiles[i], tiles[i].Bounds().Min, draw.Src)
+		} else {
+			draw.Draw(sheet, cell.Inset(1), image.NewUniform(color.Gray{0x40}), image.Point{}, draw.Src)
+		}
+		caption := time.Unix(sample.Time, 0).In(loc).Format("2006-01-02 15:04:05")
+		drawCaption(sheet, cell, caption)
+	}
+	return sheet
+}
+
+// ============================================================================
+// 标注文字（内置 5×7 点阵，只包含时间所需的字符）
+// ============================================================================
+
+const (
+	glyphWidth   = 5
+	glyphHeight  = 7
+	glyphSpacing = 1
+	captionPad   = 3
+)
+
+var captionGlyphs = map[rune][glyphHeight]uint8{
+	'0': {0x0E, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0E},
+	'1': {0x04, 0x0C, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'2': {0x0E, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1F},
+	'3': {0x1F, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0E},
+	'4': {0x02, 0x06, 0x0A, 0x12, 0x1F, 0x02, 0x02},
+	'5': {0x1F, 0x10, 0x1E, 0x01, 0x01, 0x11, 0x0E},
+	'6': {0x06, 0x08, 0x10, 0x1E, 0x11, 0x11, 0x0E},
+	'7': {0x1F, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8': {0x0E, 0x11, 0x11, 0x0E, 0x11, 0x11, 0x0E},
+	'9': {0x0E, 0x11, 0x11, 0x0F, 0x01, 0x02, 0x0C},
+	'-': {0x00, 0x00, 0x00, 0x1F, 0x00, 0x00, 0x00},
+	':': {0x00, 0x0C, 0x0C, 0x00, 0x0C, 0x0C, 0x00},
+}
+
+// drawCaption 在格子底部的半透明条上绘制文字，宽度允许时放大一倍
+func drawCaption(dst *image.RGBA, cell image.Rectangle, text string) {
+	scale := 2
+	if len(text)*(glyphWidth+glyphSpacing)*scale+2*captionPad > cell.Dx() {
+		scale = 1
+	}
+
+	band := image.Rect(cell.Min.X, cell.Max.Y-glyphHeight*scale-2*captionPad, cell.Max.X, cell.Max.Y)
+	draw.Draw(dst, band, image.NewUniform(color.NRGBA{0, 0, 0, 0xA0}), image.Point{}, draw.Over)
+
+	x := band.Min.X + captionPad
+	y := band.Min.Y + captionPad
+	for _, ch := range text {
+		glyph := captionGlyphs[ch] // 未定义的字符（空格）为空白
+		for row := 0; row < glyphHeight; row++ {
+			for col := 0; col < glyphWidth; col++ {
+				if glyph[row]&(1<<(glyphWidth-1-col)) == 0 {
+					continue
+				}
+				px := image.Rect(0, 0, scale, scale).Add(image.Pt(x+col*scale, y+row*scale))
+				draw.Draw(dst, px.Intersect(cell), image.NewUniform(color.White), image.Point{}, draw.Src)
+			}
+		}
+		x += (glyphWidth + glyphSpacing) * scale
+	}
+}
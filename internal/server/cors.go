@@ -0,0 +1,45 @@
+package server
+
+import (
+	"github.com/kataras/iris/v12"
+)
+
+// exposedHeaders 允许跨域客户端读取的自定义响应头
+const exposedHeaders = "Content-Disposition, X-Clip-Start-Ms, X-Clip-End-Ms, X-Clip-Frames, X-Clip-Preroll-Ms, X-Clip-Trim, " +
+	"X-Frame-Start, X-Frame-Count, X-Frame-Total, " +
+	"X-Seq-Scope, X-Seq-Next, X-Seq-Gaps, X-Seq-Missing, X-Seq-Duplicates, " +
+	"X-Raw-Offset, X-Raw-Length"
+
+// CORS 跨域中间件
+// origins 包含 "*" 时允许任意来源（不带凭据，规范不允许通配符与凭据同时使用）；
+// 否则只对列表中的来源回显 Origin 并允许携带凭据
+func CORS(origins []string) iris.Handler {
+	wildcard := false
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		if origin == "*" {
+			wildcard = true
+		}
+		allowed[origin] = true
+	}
+
+	return func(ctx iris.Context) {
+		origin := ctx.GetHeader("Origin")
+		switch {
+		case wildcard:
+			ctx.Header("Access-Control-Allow-Origin", "*")
+		case origin != "" && allowed[origin]:
+			ctx.Header("Access-Control-Allow-Origin", origin)
+			ctx.Header("Access-Control-Allow-Credentials", "true")
+			ctx.Header("Vary", "Origin")
+		}
+		ctx.Header("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+		ctx.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		ctx.Header("Access-Control-Expose-Headers", exposedHeaders)
+		if ctx.Method() == "OPTIONS" {
+			ctx.StatusCode(204)
+			return
+		}
+		ctx.Next()
+	}
+}
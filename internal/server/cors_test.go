@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kataras/iris/v12"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	app := iris.New()
+	app.Logger().SetLevel("disable")
+	app.UseRouter(CORS([]string{"http://viewer.local"}))
+	app.Delete("/api/v1/bookmarks/{id}", func(ctx iris.Context) { ctx.StatusCode(204) })
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	req, _ := http.NewRequest("OPTIONS", srv.URL+"/api/v1/bookmarks/1", nil)
+	req.Header.Set("Origin", "http://viewer.local")
+	req.Header.Set("Access-Control-Request-Method", "DELETE")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Access-Control-Allow-Origin") != "http://viewer.local" {
+		t.Fatalf("preflight: status %d, origin %q", resp.StatusCode, resp.Header.Get("Access-Control-Allow-Origin"))
+	}
+	methods := strings.Split(resp.Header.Get("Access-Control-Allow-Methods"), ", ")
+	if !containsString(methods, "DELETE") {
+		t.Fatalf("allowed methods %v do not include DELETE", methods)
+	}
+
+	// 帧批量读取、序号查询和导出接口的元数据响应头
+	exposed := strings.Split(resp.Header.Get("Access-Control-Expose-Headers"), ", ")
+	for _, header := range []string{"Content-Disposition", "X-Clip-Start-Ms", "X-Frame-Start", "X-Frame-Count", "X-Frame-Total",
+		"X-Seq-Scope", "X-Seq-Next", "X-Seq-Gaps", "X-Seq-Missing", "X-Seq-Duplicates"} {
+		if !containsString(exposed, header) {
+			t.Errorf("%s is not exposed to cross-origin clients", header)
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	_ "embed"
+
+	"github.com/kataras/iris/v12"
+)
+
+// debugPlayerPath 内置测试播放页的地址
+const debugPlayerPath = "/debug/player"
+
+// debugPlayerHTML 不依赖前端构建的单文件播放页
+//
+//go:embed debugplayer.html
+var debugPlayerHTML []byte
+
+// GetDebugPlayer 内置测试播放页（需要 -debug）
+// GET /debug/player?token=<auth-token>
+//
+// 页面直接调用 REST 接口和 /api/v1/stream，按二进制帧格式解析 H265/G711 帧，
+// 用 WebCodecs 解码视频、Web Audio 播放 μ-law 音频，并显示收到的帧数和时间戳。
+// 与嵌入的 static/ 前端完全独立，用于区分前端和后端的问题
+func (h *Handlers) GetDebugPlayer(ctx iris.Context) {
+	ctx.ContentType("text/html; charset=utf-8")
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Write(debugPlayerHTML)
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+
+	"seetong-dvr/internal/seetong"
+
+	"github.com/kataras/iris/v12"
+)
+
+// DefaultDriveScanTimeout 驱动器扫描超时
+const DefaultDriveScanTimeout = 3 * time.Second
+
+// DriveCandidate 候选 DVR 存储位置
+type DriveCandidate struct {
+	Path         string `json:"path"`
+	FileCount    int    `json:"fileCount"`
+	SegmentCount int    `json:"segmentCount"`
+	Earliest     int64  `json:"earliest"`
+	Latest       int64  `json:"latest"`
+}
+
+// DefaultDriveScanRoots 返回当前平台的默认扫描根目录
+func DefaultDriveScanRoots() []string {
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"/Volumes"}
+	case "windows":
+		var roots []string
+		for letter := 'C'; letter <= 'Z'; letter++ {
+			roots = append(roots, string(letter)+`:\`)
+		}
+		return roots
+	default:
+		return []string{"/media", "/run/media", "/mnt"}
+	}
+}
+
+// driveScanDepth 扫描根目录下的最大层级
+// Linux 的 /media/<用户>/<卷标> 需要两层
+const driveScanDepth = 2
+
+// ScanDrives 在扫描根目录下查找包含 TIndex00.tps 的目录
+// 超时后返回已找到的候选（卡住的网络挂载或休眠的 USB 设备不会阻塞请求）
+func ScanDrives(roots []string, timeout time.Duration) []DriveCandidate {
+	if timeout <= 0 {
+		timeout = DefaultDriveScanTimeout
+	}
+
+	results := make(chan DriveCandidate, 16)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(results)
+		s := &driveScan{seen: make(map[string]bool), results: results, done: done}
+		for _, root := range roots {
+			s.scanDir(root, driveScanDepth)
+		}
+	}()
+
+	candidates := []DriveCandidate{}
+	deadline := time.After(timeout)
+	for {
+		select {
+		case c, ok := <-results:
+			if !ok {
+				sort.Slice(candidates, func(i, j int) bool {
+					return candidates[i].Path < candidates[j].Path
+				})
+				return candidates
+			}
+			candidates = append(candidates, c)
+		case <-deadline:
+			seetong.LogWarn("驱动器扫描超时", "timeout", timeout, "found", len(candidates))
+			return candidates
+		}
+	}
+}
+
+// driveScan 一次驱动器扫描的状态
+type driveScan struct {
+	seen    map[string]bool
+	results chan<- DriveCandidate
+	done    <-chan struct{} // 请求超时返回后关闭，后台扫描随之停止
+}
+
+// scanDir 检查目录是否为 DVR 存储，否则继续扫描子目录
+func (s *driveScan) scanDir(dir string, depth int) {
+	if s.seen[dir] {
+		return
+	}
+	s.seen[dir] = true
+
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+
+	if c, ok := peekDVR(dir); ok {
+		select {
+		case s.results <- c:
+		case <-s.done:
+		}
+		return
+	}
+	if depth == 0 {
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && entry.Type()&os.ModeSymlink == 0 {
+			continue
+		}
+		s.scanDir(filepath.Join(dir, entry.Name()), depth-1)
+	}
+}
+
+// peekDVR 只解析主索引的段落表，快速获取录像时间范围
+func peekDVR(dir string) (DriveCandidate, bool) {
+	segments, fileCount, _, err := seetong.ParseTIndex(filepath.Join(dir, "TIndex00.tps"))
+	if err != nil {
+		return DriveCandidate{}, false
+	}
+
+	c := DriveCandidate{
+		Path:         dir,
+		FileCount:    fileCount,
+		SegmentCount: len(segments),
+	}
+	for _, seg := range segments {
+		if c.Earliest == 0 || seg.StartTime < c.Earliest {
+			c.Earliest = seg.StartTime
+		}
+		if seg.EndTime > c.Latest {
+			c.Latest = seg.EndTime
+		}
+	}
+	return c, true
+}
+
+// GetDrives 列出可能的 DVR 存储位置
+// GET /api/v1/drives
+func (h *Handlers) GetDrives(ctx iris.Context) {
+	cfg := h.cfg.Get()
+	roots := cfg.DriveScanRoots
+	if len(roots) == 0 {
+		roots = DefaultDriveScanRoots()
+	}
+	timeout := time.Duration(cfg.DriveScanTimeoutMs) * time.Millisecond
+
+	ctx.JSON(iris.Map{"drives": ScanDrives(roots, timeout)})
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"path/filepath"
+	"sort"
+
+	"seetong-dvr/internal/seetong"
+
+	"github.com/kataras/iris/v12"
+)
+
+// DuplicateGroup 帧索引指纹相同、认为内容相同的一组 TRec 文件
+type DuplicateGroup struct {
+	Fingerprint      string         `json:"fingerprint"`
+	FileIndexes      []int          `json:"fileIndexes"` // 升序
+	Files            []string       `json:"files"`       // 相对 DVR 路径的文件名，与 fileIndexes 一一对应
+	Channels         map[uint32]int `json:"channels"`    // 每个帧通道的记录数
+	Frames           int            `json:"frames"`
+	StartTimestampUs uint64         `json:"startTimestampUs"` // 设备时间戳范围
+	EndTimestampUs   uint64         `json:"endTimestampUs"`
+	FirstFrameSeq    uint32         `json:"firstFrameSeq"`
+	LastFrameSeq     uint32         `json:"lastFrameSeq"`
+}
+
+// frameIndexFingerprint 帧索引指纹：各通道记录数、设备时间戳范围、首末帧序号
+// records 为缓存中按时间排序的帧索引，为空时返回空字符串
+func frameIndexFingerprint(records []seetong.FrameIndexRecord) (string, DuplicateGroup) {
+	if len(records) == 0 {
+		return "", DuplicateGroup{}
+	}
+	first, last := records[0], records[len(records)-1]
+	group := DuplicateGroup{
+		Channels:         make(map[uint32]int),
+		Frames:           len(records),
+		StartTimestampUs: first.TimestampUs,
+		EndTimestampUs:   last.TimestampUs,
+		FirstFrameSeq:    first.FrameSeq,
+		LastFrameSeq:     last.FrameSeq,
+	}
+	for _, r := range records {
+		group.Channels[r.Channel]++
+	}
+
+	channels := make([]uint32, 0, len(group.Channels))
+	for ch := range group.Channels {
+		channels = append(channels, ch)
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i] < channels[j] })
+
+	h := sha1.New()
+	var buf [8]byte
+	for _, ch := range channels {
+		binary.LittleEndian.PutUint32(buf[0:], ch)
+		binary.LittleEndian.PutUint32(buf[4:], uint32(group.Channels[ch]))
+		h.Write(buf[:])
+	}
+	for _, v := range []uint64{first.TimestampUs, last.TimestampUs, uint64(first.FrameSeq), uint64(last.FrameSeq)} {
+		binary.LittleEndian.PutUint64(buf[:], v)
+		h.Write(buf[:])
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8]), group
+}
+
+// FindDuplicates 按帧索引指纹分组已缓存的 TRec 文件，只返回包含两个以上文件的组（按首个文件编号排序）
+// 只使用缓存中的帧索引，不读取录像文件；checked 为参与比较的文件数
+func (s *DVRServer) FindDuplicates() (groups []DuplicateGroup, checked int) {
+	if !s.loaded || s.storage == nil {
+		return nil, 0
+	}
+
+	byFingerprint := make(map[string]*DuplicateGroup)
+	for _, seg := range s.storage.GetCachedSegments() {
+		fingerprint, group := frameIndexFingerprint(s.storage.GetFrameIndex(seg.FileIndex))
+		if fingerprint == "" {
+			continue
+		}
+		checked++
+		g := byFingerprint[fingerprint]
+		if g == nil {
+			group.Fingerprint = fingerprint
+			g = &group
+			byFingerprint[fingerprint] = g
+		}
+		g.FileIndexes = append(g.FileIndexes, seg.FileIndex)
+	}
+
+	groups = []DuplicateGroup{}
+	for _, g := range byFingerprint {
+		if len(g.FileIndexes) < 2 {
+			continue
+		}
+		sort.Ints(g.FileIndexes)
+		for _, fileIndex := range g.FileIndexes {
+			name := s.storage.RecFilePath(fileIndex)
+			if rel, err := filepath.Rel(s.dvrPath, name); err == nil {
+				name = rel
+			}
+			g.Files = append(g.Files, filepath.ToSlash(name))
+		}
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].FileIndexes[0] < groups[j].FileIndexes[0] })
+	return groups, checked
+}
+
+// GetDuplicates 查找内容相同的 TRec 文件（同一段录像被复制到不同的文件编号或来源目录）
+// GET /api/v1/duplicates
+//
+// 比较已缓存段落的帧索引指纹（各通道记录数、设备时间戳范围、首末帧序号），
+// 未缓存的段落不参与比较，数量在 uncached 中返回
+func (h *Handlers) GetDuplicates(ctx iris.Context) {
+	storage := h.dvr.GetStorage()
+	if storage == nil || !h.dvr.IsLoaded() {
+		writeError(ctx, errNotLoaded)
+		return
+	}
+
+	groups, checked := h.dvr.FindDuplicates()
+	duplicates := 0
+	for _, g := range groups {
+		duplicates += len(g.FileIndexes) - 1
+	}
+	ctx.JSON(iris.Map{
+		"groups":     groups,
+		"checked":    checked,
+		"uncached":   len(storage.GetSegments()) - len(storage.GetCachedSegments()),
+		"duplicates": duplicates, // 每组保留一个文件时多余的文件数
+	})
+}
@@ -1,12 +1,16 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"sort"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"seetong-dvr/internal/config"
 	"seetong-dvr/internal/seetong"
 )
 
@@ -17,18 +21,60 @@ type DVRServer struct {
 	storage  *seetong.TPSStorage
 	loaded   bool
 	timezone string
+	clock    Clock
 	mu       sync.RWMutex
 
 	// 音频采样率
 	audioSampleRate int
+
+	// 缓存构建线程数（0 使用默认值）
+	workers int
+
+	// 缓存构建顺序（CacheOrder*）
+	cacheOrder string
+
+	// 初始构建只包含最新录像之前的天数（0 构建全部），更早的段落浏览到时按需构建
+	cacheDays int
+
+	// 同一时间只进行一次缓存构建；lazyBuilds 记录按需构建过的段落（true 为排队或构建中）
+	buildMu    sync.Mutex
+	lazyBuilds map[int]bool
+	lazyMu     sync.Mutex
+
+	// 缓存构建取消：CancelCacheBuild 取消 buildCtx（包括排队等待的构建）并换用新的 context
+	buildCtx    context.Context
+	buildCancel context.CancelFunc
+	running     *cacheRun
+	runMu       sync.Mutex
+
+	// 初始化段缓存 "fileIndex-channel" -> 二进制帧
+	initSegments map[string][]byte
+
+	// 缓存构建进度订阅者（SSE）
+	cacheSubs   map[chan CacheEvent]struct{}
+	cacheSubsMu sync.Mutex
+
+	// 存储断开检测（U 盘拔出后 TIndex 文件不可访问）
+	disconnected atomic.Bool
+	stopWatch    chan struct{}
 }
 
+// storageCheckInterval 检查 DVR 存储是否仍然可访问的间隔
+const storageCheckInterval = 2 * time.Second
+
 // NewDVRServer 创建 DVR 服务器
 func NewDVRServer(dvrPath string) *DVRServer {
+	buildCtx, buildCancel := context.WithCancel(context.Background())
 	return &DVRServer{
 		dvrPath:         dvrPath,
-		timezone:        "Asia/Shanghai",
+		timezone:        config.DefaultTimezone,
+		clock:           systemClock{},
 		audioSampleRate: 8000,
+		initSegments:    make(map[string][]byte),
+		cacheSubs:       make(map[chan CacheEvent]struct{}),
+		lazyBuilds:      make(map[int]bool),
+		buildCtx:        buildCtx,
+		buildCancel:     buildCancel,
 	}
 }
 
@@ -41,9 +87,58 @@ func (s *DVRServer) Load() error {
 
 	s.loaded = true
 	fmt.Printf("✓ 发现 %d 个段落索引\n", len(s.storage.GetSegments()))
+
+	if s.stopWatch == nil {
+		s.stopWatch = make(chan struct{})
+		go s.watchStorage(s.stopWatch)
+	}
 	return nil
 }
 
+// watchStorage 定期检查存储是否可访问，直到 stop 关闭
+func (s *DVRServer) watchStorage(stop chan struct{}) {
+	ticker := time.NewTicker(storageCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.checkStorage()
+		}
+	}
+}
+
+// checkStorage 检查 TIndex 文件是否可访问，返回存储是否在线
+// 存储断开时主动关闭所有录像文件句柄和 mmap 缓存，避免之后访问失效的映射（SIGBUS），
+// 请求返回 storage_disconnected 错误；重新插入后句柄在下次读取时重新打开
+func (s *DVRServer) checkStorage() bool {
+	indexPath := filepath.Join(s.dvrPath, "TIndex00.tps")
+	if s.storage != nil {
+		if files := s.storage.IndexFiles(); len(files) > 0 {
+			indexPath = files[0]
+		}
+	}
+	_, err := seetong.CurrentStorage().Stat(indexPath)
+	if err != nil {
+		if s.disconnected.CompareAndSwap(false, true) {
+			s.storage.Close()
+			seetong.GetGlobalMmapManager().Close()
+			seetong.LogWarn("DVR 存储已断开，已关闭录像文件和缓存映射", "path", s.dvrPath, "error", err)
+		}
+		return false
+	}
+	if s.disconnected.CompareAndSwap(true, false) {
+		seetong.LogInfo("DVR 存储已重新连接", "path", s.dvrPath)
+	}
+	return true
+}
+
+// IsDisconnected 存储是否已断开（已加载的 DVR 路径当前不可访问）
+func (s *DVRServer) IsDisconnected() bool {
+	return s.disconnected.Load()
+}
+
 // IsLoaded 是否已加载
 func (s *DVRServer) IsLoaded() bool {
 	return s.loaded
@@ -60,33 +155,272 @@ func (s *DVRServer) GetDVRPath() string {
 }
 
 // BuildVPSCache 构建帧索引和 VPS 缓存
+// 设置了 cacheDays 时只构建最新录像之前 cacheDays 天内的段落
 func (s *DVRServer) BuildVPSCache() {
 	if !s.loaded || s.storage == nil {
 		return
 	}
 
-	segments := s.storage.GetSegments()
-	fileIndices := make([]int, len(segments))
-	for i, seg := range segments {
-		fileIndices[i] = seg.FileIndex
+	if s.cacheDays > 0 {
+		if latest := s.latestSegmentEnd(); latest > 0 {
+			from := latest - int64(s.cacheDays)*24*3600
+			fmt.Printf("[Cache] 只构建最近 %d 天的录像，更早的录像浏览时按需构建\n", s.cacheDays)
+			s.BuildVPSCacheRange(from, latest+1, nil)
+			return
+		}
+	}
+	s.buildSegments(s.cacheBuildOrder())
+}
+
+// BuildVPSCacheRange 构建与 [from, to) 重叠的未缓存段落（channel 为空时包括所有通道）
+// 返回新缓存的段落数
+func (s *DVRServer) BuildVPSCacheRange(from, to int64, channel *int) int {
+	if !s.loaded || s.storage == nil {
+		return 0
+	}
+	cached, _ := s.buildSegments(s.uncachedSegments(from, to, channel))
+	return cached
+}
+
+// uncachedSegments 按缓存构建顺序返回与 [from, to) 重叠且尚未缓存的段落
+func (s *DVRServer) uncachedSegments(from, to int64, channel *int) []seetong.SegmentRecord {
+	var segments []seetong.SegmentRecord
+	for _, seg := range s.cacheBuildOrder() {
+		if channel != nil && seg.Channel != *channel {
+			continue
+		}
+		if seg.StartTime >= to || seg.EndTime <= from {
+			continue
+		}
+		if s.storage.GetCachedSegment(seg.FileIndex) == nil {
+			segments = append(segments, seg)
+		}
+	}
+	return segments
+}
+
+// latestSegmentEnd TIndex 中最新段落的结束时间，没有段落时返回 0
+func (s *DVRServer) latestSegmentEnd() int64 {
+	var latest int64
+	for _, seg := range s.storage.GetSegments() {
+		latest = max(latest, seg.EndTime)
+	}
+	return latest
+}
+
+// cacheRun 正在进行的一次缓存构建
+type cacheRun struct {
+	done   chan struct{}
+	cached int // done 关闭后有效
+}
+
+// buildSegments 按顺序构建段落缓存并广播进度，返回缓存成功的段落数和构建是否被取消
+// 构建互斥进行；等待期间已被其他构建缓存的段落跳过，等待期间被取消时不再构建
+func (s *DVRServer) buildSegments(segments []seetong.SegmentRecord) (int, bool) {
+	s.runMu.Lock()
+	ctx := s.buildCtx
+	s.runMu.Unlock()
+
+	s.buildMu.Lock()
+	defer s.buildMu.Unlock()
+	if ctx.Err() != nil {
+		return 0, true
+	}
+
+	run := &cacheRun{done: make(chan struct{})}
+	s.runMu.Lock()
+	s.running = run
+	s.runMu.Unlock()
+	defer func() {
+		s.runMu.Lock()
+		s.running = nil
+		s.runMu.Unlock()
+		close(run.done)
+	}()
+
+	fileIndices := make([]int, 0, len(segments))
+	for _, seg := range segments {
+		if s.storage.GetCachedSegment(seg.FileIndex) == nil {
+			fileIndices = append(fileIndices, seg.FileIndex)
+		}
 	}
 
 	fmt.Printf("[Cache] 开始构建缓存，共 %d 个文件...\n", len(fileIndices))
 	startTime := time.Now()
 
-	cachedCount := s.storage.BuildCache(fileIndices, func(current, total, fileIndex int) {
+	cachedCount := s.storage.BuildCacheWithWorkersContext(ctx, fileIndices, func(current, total, fileIndex int) {
 		if current%10 == 0 || current == total {
 			elapsed := time.Since(startTime)
 			fmt.Printf("[Cache] 进度: %d/%d (%.1fs)\n", current, total, elapsed.Seconds())
 		}
-	})
+		s.publishCacheEvent(CacheEvent{
+			Type:      "progress",
+			Progress:  current * 100 / total,
+			Current:   current,
+			Total:     total,
+			FileIndex: fileIndex,
+		})
+	}, s.workers)
+	run.cached = cachedCount
 
 	elapsed := time.Since(startTime)
+	if ctx.Err() != nil {
+		fmt.Printf("[Cache] 缓存构建已取消: 完成 %d/%d 个文件，耗时 %.1fs\n", cachedCount, len(fileIndices), elapsed.Seconds())
+		s.publishCacheEvent(CacheEvent{
+			Type:   "cancelled",
+			Total:  len(fileIndices),
+			Cached: cachedCount,
+		})
+		return cachedCount, true
+	}
 	fmt.Printf("[Cache] ✓ 缓存完成: %d 个文件，耗时 %.1fs\n", cachedCount, elapsed.Seconds())
+
+	s.publishCacheEvent(CacheEvent{
+		Type:     "done",
+		Progress: 100,
+		Current:  len(fileIndices),
+		Total:    len(fileIndices),
+		Cached:   cachedCount,
+	})
+	return cachedCount, false
+}
+
+// CancelCacheBuild 取消正在进行和排队等待的缓存构建
+// 等待工作线程完成当前段落后返回；cancelled 表示有正在进行的构建，completed 为该次构建缓存成功的段落数
+// 已缓存的段落保留，之后的构建（包括按需构建）不受影响
+func (s *DVRServer) CancelCacheBuild() (cancelled bool, completed int) {
+	s.runMu.Lock()
+	run := s.running
+	s.buildCancel()
+	s.buildCtx, s.buildCancel = context.WithCancel(context.Background())
+	s.runMu.Unlock()
+
+	if run == nil {
+		return false, 0
+	}
+	<-run.done
+	return true, run.cached
+}
+
+// RequestDateCache 按需构建某天（channel 为空时包括所有通道）尚未缓存的段落
+// 只在设置了 cacheDays 时生效；构建在后台进行，完成后发送缓存进度事件，
+// 返回该天仍在排队或构建中的段落数。构建失败的段落不再重试
+func (s *DVRServer) RequestDateCache(date string, channel *int) int {
+	if s.cacheDays <= 0 || !s.loaded || s.storage == nil {
+		return 0
+	}
+	dayStart, dayEnd, err := s.dayBounds(date)
+	if err != nil {
+		return 0
+	}
+	uncached := s.uncachedSegments(dayStart, dayEnd, channel)
+
+	s.lazyMu.Lock()
+	pending := 0
+	var queue []seetong.SegmentRecord
+	for _, seg := range uncached {
+		building, seen := s.lazyBuilds[seg.FileIndex]
+		if !seen {
+			s.lazyBuilds[seg.FileIndex] = true
+			queue = append(queue, seg)
+			building = true
+		}
+		if building {
+			pending++
+		}
+	}
+	s.lazyMu.Unlock()
+
+	if len(queue) > 0 {
+		fmt.Printf("[Cache] 按需构建 %s 的 %d 个段落\n", date, len(queue))
+		go func() {
+			_, cancelled := s.buildSegments(queue)
+			s.lazyMu.Lock()
+			for _, seg := range queue {
+				// 取消时未构建的段落在下次浏览时重新排队
+				if cancelled && s.storage.GetCachedSegment(seg.FileIndex) == nil {
+					delete(s.lazyBuilds, seg.FileIndex)
+				} else {
+					s.lazyBuilds[seg.FileIndex] = false
+				}
+			}
+			s.lazyMu.Unlock()
+		}()
+	}
+	return pending
+}
+
+// 缓存构建顺序
+const (
+	CacheOrderNewest = "newest" // 从最新的录像开始（默认），最近的录像最先可以播放
+	CacheOrderOldest = "oldest" // 按时间从旧到新
+	CacheOrderIndex  = "index"  // 按 TRec 文件编号，磁盘写满循环覆盖后不代表时间顺序
+)
+
+// cacheBuildOrder 按缓存构建顺序排列的段落
+func (s *DVRServer) cacheBuildOrder() []seetong.SegmentRecord {
+	switch s.cacheOrder {
+	case CacheOrderIndex:
+		return s.storage.GetSegments()
+	case CacheOrderOldest:
+		return s.storage.SegmentsByTime(false)
+	default:
+		return s.storage.SegmentsByTime(true)
+	}
+}
+
+// SubscribeCacheEvents 订阅缓存构建进度
+// 返回的通道带缓冲，消费过慢时丢弃 progress 事件，不会阻塞缓存构建；done / cancelled 事件总会送达
+func (s *DVRServer) SubscribeCacheEvents() (<-chan CacheEvent, func()) {
+	ch := make(chan CacheEvent, 64)
+
+	s.cacheSubsMu.Lock()
+	s.cacheSubs[ch] = struct{}{}
+	s.cacheSubsMu.Unlock()
+
+	unsubscribe := func() {
+		s.cacheSubsMu.Lock()
+		delete(s.cacheSubs, ch)
+		s.cacheSubsMu.Unlock()
+	}
+	return ch, unsubscribe
 }
 
-// GetCacheStatus 获取缓存构建状态
+// publishCacheEvent 广播缓存构建事件
+// 通道满时丢弃 progress 事件；结束事件（done / cancelled）丢弃通道中最早的一个事件腾出位置，
+// 订阅者据此结束 SSE 流，不能丢失。只有这里向通道发送且持有锁，腾出的位置不会被占用
+func (s *DVRServer) publishCacheEvent(event CacheEvent) {
+	s.cacheSubsMu.Lock()
+	defer s.cacheSubsMu.Unlock()
+	for ch := range s.cacheSubs {
+		select {
+		case ch <- event:
+			continue
+		default:
+		}
+		if !event.terminal() {
+			continue
+		}
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- event
+	}
+}
+
+// GetCacheStatus 获取缓存构建状态和缓存目录占用
 func (s *DVRServer) GetCacheStatus() CacheStatus {
+	status := s.cacheBuildStatus()
+	if status.ReadOnly = seetong.IsReadOnly(); !status.ReadOnly {
+		status.CacheDirBytes, status.CacheFiles = seetong.CacheDirUsage()
+	}
+	status.Compressed = seetong.IsCompressedCache()
+	return status
+}
+
+// cacheBuildStatus 缓存构建进度
+func (s *DVRServer) cacheBuildStatus() CacheStatus {
 	if !s.loaded || s.storage == nil {
 		return CacheStatus{
 			Status:   "not_loaded",
@@ -99,6 +433,7 @@ func (s *DVRServer) GetCacheStatus() CacheStatus {
 
 	status := s.storage.GetCacheStatus()
 	building, _ := status["building"].(bool)
+	cancelled, _ := status["cancelled"].(bool)
 	progress, _ := status["progress"].(int)
 	totalSegments, _ := status["total_segments"].(int)
 	cachedSegments, _ := status["cached_segments"].(int)
@@ -113,6 +448,16 @@ func (s *DVRServer) GetCacheStatus() CacheStatus {
 		}
 	}
 
+	if cancelled {
+		return CacheStatus{
+			Status:   "cancelled",
+			Progress: progress,
+			Total:    totalSegments,
+			Current:  cachedSegments,
+			Cached:   cachedSegments,
+		}
+	}
+
 	return CacheStatus{
 		Status:   "ready",
 		Progress: 100,
@@ -123,37 +468,53 @@ func (s *DVRServer) GetCacheStatus() CacheStatus {
 }
 
 // GetRecordingDates 获取有录像的日期列表（只返回已缓存的段落）
+// 设置了 cacheDays 时也包括尚未缓存的段落，这些日期在浏览时按需构建
 // 与 Python dvr_server.get_recording_dates 对应
 func (s *DVRServer) GetRecordingDates(channel *int) map[string]bool {
 	if !s.loaded || s.storage == nil {
 		return make(map[string]bool)
 	}
 
-	segments := s.storage.GetCachedSegments()
+	var channels map[int]bool
 	if channel != nil {
-		var filtered []*seetong.SegmentRecord
-		for _, seg := range segments {
-			if seg.Channel == *channel {
-				filtered = append(filtered, seg)
-			}
-		}
-		segments = filtered
+		channels = map[int]bool{*channel: true}
 	}
 
-	loc, _ := time.LoadLocation(s.timezone)
+	loc := s.location()
 	dates := make(map[string]bool)
 
-	for _, seg := range segments {
-		dt := time.Unix(seg.StartTime, 0).In(loc)
-		dates[dt.Format("2006-01-02")] = true
-
-		dtEnd := time.Unix(seg.EndTime, 0).In(loc)
-		dates[dtEnd.Format("2006-01-02")] = true
+	for _, seg := range s.datedSegments(channels) {
+		for _, date := range localDates(seg.StartTime, seg.EndTime, loc) {
+			dates[date] = true
+		}
 	}
 
 	return dates
 }
 
+// nextLocalDay t 所在日历日的下一天零点（零点不存在时为该天最早的时刻）
+func nextLocalDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+}
+
+// localDates [start, end) 覆盖的显示时区日期（YYYY-MM-DD）
+// 时间计算都用 Unix 秒，只在取日期时转换时区；结束于零点的录像不计入下一天，
+// 跨过整天的录像包括中间的每一天
+func localDates(start, end int64, loc *time.Location) []string {
+	last := time.Unix(max(end-1, start), 0).In(loc).Format("2006-01-02")
+	day := time.Unix(start, 0).In(loc)
+	var dates []string
+	for {
+		date := day.Format("2006-01-02")
+		dates = append(dates, date)
+		if date >= last {
+			return dates
+		}
+		day = nextLocalDay(day)
+	}
+}
+
 // GetRecordings 获取指定日期的录像列表（只返回已缓存的段落）
 // 与 Python dvr_server.get_recordings 对应
 func (s *DVRServer) GetRecordings(date string, channel *int) []RecordingInfo {
@@ -161,18 +522,13 @@ func (s *DVRServer) GetRecordings(date string, channel *int) []RecordingInfo {
 		return nil
 	}
 
-	loc, _ := time.LoadLocation(s.timezone)
+	loc := s.location()
 
-	targetDate, err := time.ParseInLocation("2006-01-02", date, loc)
+	startTs, endTs, err := s.dayBounds(date)
 	if err != nil {
 		return nil
 	}
 
-	dayStart := targetDate
-	dayEnd := targetDate.Add(24 * time.Hour)
-	startTs := dayStart.Unix()
-	endTs := dayEnd.Unix()
-
 	var recordings []RecordingInfo
 
 	for _, seg := range s.storage.GetCachedSegments() {
@@ -186,16 +542,19 @@ func (s *DVRServer) GetRecordings(date string, channel *int) []RecordingInfo {
 
 			startDt := time.Unix(actualStart, 0).In(loc)
 			endDt := time.Unix(actualEnd, 0).In(loc)
+			startUs, endUs := s.segmentTimesUs(seg)
 
 			recordings = append(recordings, RecordingInfo{
-				ID:             seg.FileIndex,
-				Channel:        seg.Channel,
-				Start:          startDt.Format("15:04:05"),
-				End:            endDt.Format("15:04:05"),
-				StartTimestamp: actualStart,
-				EndTimestamp:   actualEnd,
-				Duration:       actualEnd - actualStart,
-				FrameCount:     seg.FrameCount,
+				ID:               seg.FileIndex,
+				Channel:          seg.Channel,
+				Start:            startDt.Format(recordingTimeLayout),
+				End:              endDt.Format(recordingTimeLayout),
+				StartTimestamp:   actualStart,
+				EndTimestamp:     actualEnd,
+				StartTimestampUs: min(max(startUs, startTs*1000000), endTs*1000000),
+				EndTimestampUs:   min(max(endUs, startTs*1000000), endTs*1000000),
+				Duration:         actualEnd - actualStart,
+				FrameCount:       seg.FrameCount,
 			})
 		}
 	}
@@ -207,6 +566,159 @@ func (s *DVRServer) GetRecordings(date string, channel *int) []RecordingInfo {
 	return recordings
 }
 
+// QuickPlay 快速播放的录像：最新的已缓存录像，从其开始时间播放
+// channel 为空时优先取 defaultChannel（大于 0 且有录像时）的最新录像，否则取所有通道中最新的
+func (s *DVRServer) QuickPlay(channel *int, defaultChannel int) (RecordingInfo, bool) {
+	if channel == nil && defaultChannel > 0 {
+		if latest := s.GetLatestRecordings(1, &defaultChannel); len(latest) > 0 {
+			return latest[0], true
+		}
+	}
+	latest := s.GetLatestRecordings(1, channel)
+	if len(latest) == 0 {
+		return RecordingInfo{}, false
+	}
+	return latest[0], true
+}
+
+// GetLatestRecordings 按结束时间返回最近的 n 段录像（只包含已缓存的段落，最新的在前）
+// 按实际时间排序，磁盘写满循环覆盖后编号小的文件可能比编号大的更新
+func (s *DVRServer) GetLatestRecordings(n int, channel *int) []RecordingInfo {
+	if !s.loaded || s.storage == nil {
+		return nil
+	}
+
+	var segments []*seetong.SegmentRecord
+	for _, seg := range s.storage.GetCachedSegments() {
+		if channel == nil || seg.Channel == *channel {
+			segments = append(segments, seg)
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].EndTime != segments[j].EndTime {
+			return segments[i].EndTime > segments[j].EndTime
+		}
+		return segments[i].FileIndex > segments[j].FileIndex
+	})
+	if n > 0 && len(segments) > n {
+		segments = segments[:n]
+	}
+
+	loc := s.location()
+	recordings := make([]RecordingInfo, len(segments))
+	for i, seg := range segments {
+		startUs, endUs := s.segmentTimesUs(seg)
+		recordings[i] = RecordingInfo{
+			ID:               seg.FileIndex,
+			Channel:          seg.Channel,
+			Start:            time.Unix(seg.StartTime, 0).In(loc).Format(recordingDateTimeLayout),
+			End:              time.Unix(seg.EndTime, 0).In(loc).Format(recordingDateTimeLayout),
+			StartTimestamp:   seg.StartTime,
+			EndTimestamp:     seg.EndTime,
+			StartTimestampUs: startUs,
+			EndTimestampUs:   endUs,
+			Duration:         seg.EndTime - seg.StartTime,
+			FrameCount:       seg.FrameCount,
+		}
+	}
+	return recordings
+}
+
+// Start/End 的显示格式：/recordings 只有时间，/recordings/latest 带日期
+const (
+	recordingTimeLayout     = "15:04:05"
+	recordingDateTimeLayout = "2006-01-02 15:04:05"
+)
+
+// segmentTimesUs 段落首/末视频帧的 Unix 微秒时间，帧索引中没有视频帧时使用 TIndex 的秒级时间
+func (s *DVRServer) segmentTimesUs(seg *seetong.SegmentRecord) (startUs, endUs int64) {
+	if info := s.storage.GetCachedSegment(seg.FileIndex); info != nil && info.StartUs > 0 {
+		return info.StartUs, info.EndUs
+	}
+	return seg.StartTime * 1000000, seg.EndTime * 1000000
+}
+
+// withMilliseconds 按 StartTimestampUs/EndTimestampUs 把 Start/End 改为毫秒精度（layout 后加 .000）
+func (s *DVRServer) withMilliseconds(recordings []RecordingInfo, layout string) {
+	loc := s.location()
+	for i := range recordings {
+		rec := &recordings[i]
+		rec.Start = time.UnixMicro(rec.StartTimestampUs).In(loc).Format(layout + ".000")
+		rec.End = time.UnixMicro(rec.EndTimestampUs).In(loc).Format(layout + ".000")
+	}
+}
+
+// DefaultMergeGap 合并录像时允许的最大间隔（秒）
+const DefaultMergeGap = 5
+
+// MergeRecordings 将同一通道中间隔不超过 gap 秒的相邻录像合并为连续块
+// 输入需按开始时间排序，合并后的 ID 为首个段落的文件索引，FileIndices 列出全部成员
+func MergeRecordings(recordings []RecordingInfo, gap int64) []RecordingInfo {
+	var merged []RecordingInfo
+	last := make(map[int]int) // 通道 -> merged 中最后一个块的位置
+
+	for _, rec := range recordings {
+		if i, ok := last[rec.Channel]; ok && rec.StartTimestamp-merged[i].EndTimestamp <= gap {
+			block := &merged[i]
+			block.FileIndices = append(block.FileIndices, rec.ID)
+			block.FrameCount += rec.FrameCount
+			if rec.EndTimestamp > block.EndTimestamp {
+				block.EndTimestamp = rec.EndTimestamp
+				block.EndTimestampUs = rec.EndTimestampUs
+				block.End = rec.End
+			}
+			block.Duration = block.EndTimestamp - block.StartTimestamp
+			continue
+		}
+
+		rec.FileIndices = []int{rec.ID}
+		merged = append(merged, rec)
+		last[rec.Channel] = len(merged) - 1
+	}
+
+	return merged
+}
+
+// GetInitSegment 获取段落首个可解码 GOP 的初始化数据
+// 返回 VPS/SPS/PPS/IDR 四个 WebSocket 二进制帧的拼接，同一文件内头部基本不变，按文件缓存
+func (s *DVRServer) GetInitSegment(fileIndex int, channel int) ([]byte, error) {
+	if !s.loaded || s.storage == nil {
+		return nil, errNotLoaded
+	}
+
+	key := fmt.Sprintf("%d-%d", fileIndex, channel)
+	s.mu.RLock()
+	cached, ok := s.initSegments[key]
+	s.mu.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	iFrames := s.storage.GetIFrameOffsets(fileIndex, frameChannelFor(channel))
+	if len(iFrames) == 0 {
+		return nil, errNoIFrame
+	}
+
+	first := iFrames[0]
+	header := s.storage.ReadVideoHeader(fileIndex, int64(first.Offset))
+	if header == nil {
+		return nil, errNoVideoHeader
+	}
+
+	timestampMs := first.Time * 1000
+	var data []byte
+	data = append(data, encodeVideoFrame(header.VPS, seetong.NalVPS, timestampMs)...)
+	data = append(data, encodeVideoFrame(header.SPS, seetong.NalSPS, timestampMs)...)
+	data = append(data, encodeVideoFrame(header.PPS, seetong.NalPPS, timestampMs)...)
+	data = append(data, encodeVideoFrame(header.IDR, seetong.NalIDRWRadl, timestampMs)...)
+
+	s.mu.Lock()
+	s.initSegments[key] = data
+	s.mu.Unlock()
+
+	return data, nil
+}
+
 // GetChannels 获取所有通道
 func (s *DVRServer) GetChannels() []int {
 	if !s.loaded || s.storage == nil {
@@ -239,17 +751,57 @@ func (s *DVRServer) GetConfig() Config {
 
 	if s.loaded && s.storage != nil {
 		cfg.EntryCount = len(s.storage.GetSegments())
-		// 统计 TRec 文件数量
-		matches, _ := filepath.Glob(filepath.Join(s.dvrPath, "TRec*.tps"))
-		cfg.FileCount = len(matches)
+		// 统计 TRec 文件数量（所有来源目录）
+		cfg.FileCount = len(s.storage.RecFiles())
 	}
 
 	return cfg
 }
 
+// GetStorageReport 获取存储使用情况
+// 文件大小逐个 stat 获取（最后一个/正在录制的文件可能小于 256MB）
+func (s *DVRServer) GetStorageReport() StorageReport {
+	report := StorageReport{
+		StoragePath:     s.dvrPath,
+		Loaded:          s.loaded,
+		Timezone:        s.GetTimezone(),
+		ChannelSegments: make(map[int]int),
+	}
+	if !s.loaded || s.storage == nil {
+		return report
+	}
+
+	matches := s.storage.RecFiles()
+	report.FileCount = len(matches)
+	for _, path := range matches {
+		if info, err := seetong.CurrentStorage().Stat(path); err == nil {
+			report.RecordingBytes += info.Size()
+		}
+	}
+
+	for _, seg := range s.storage.GetSegments() {
+		report.ChannelSegments[seg.Channel]++
+		if report.Earliest == 0 || seg.StartTime < report.Earliest {
+			report.Earliest = seg.StartTime
+		}
+		if seg.EndTime > report.Latest {
+			report.Latest = seg.EndTime
+		}
+	}
+	report.SegmentCount = len(s.storage.GetSegments())
+
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(s.dvrPath, &fs); err == nil {
+		report.DiskTotalBytes = int64(fs.Blocks) * int64(fs.Bsize)
+		report.DiskFreeBytes = int64(fs.Bavail) * int64(fs.Bsize)
+	}
+
+	return report
+}
+
 // SetTimezone 设置时区
 func (s *DVRServer) SetTimezone(tz string) error {
-	if _, err := time.LoadLocation(tz); err != nil {
+	if _, err := s.getClock().LoadLocation(tz); err != nil {
 		return err
 	}
 	s.mu.Lock()
@@ -258,6 +810,53 @@ func (s *DVRServer) SetTimezone(tz string) error {
 	return nil
 }
 
+// SetClock 设置时间来源（默认系统时钟）
+func (s *DVRServer) SetClock(clock Clock) {
+	s.mu.Lock()
+	s.clock = clock
+	s.mu.Unlock()
+}
+
+// getClock 获取时间来源
+func (s *DVRServer) getClock() Clock {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clock
+}
+
+// Now 当前时间（由时间来源决定，回放历史数据时可固定）
+func (s *DVRServer) Now() time.Time {
+	return s.getClock().Now()
+}
+
+// location 当前显示时区，时区无效时回退到 UTC
+func (s *DVRServer) location() *time.Location {
+	s.mu.RLock()
+	clock, tz := s.clock, s.timezone
+	s.mu.RUnlock()
+
+	loc, err := clock.LoadLocation(tz)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// SetWorkers 设置缓存构建线程数
+func (s *DVRServer) SetWorkers(workers int) {
+	s.workers = workers
+}
+
+// SetCacheOrder 设置缓存构建顺序（CacheOrderNewest/Oldest/Index，空值使用 newest）
+func (s *DVRServer) SetCacheOrder(order string) {
+	s.cacheOrder = order
+}
+
+// SetCacheDays 设置初始缓存构建包含的天数（0 构建全部）
+func (s *DVRServer) SetCacheDays(days int) {
+	s.cacheDays = days
+}
+
 // GetTimezone 获取时区
 func (s *DVRServer) GetTimezone() string {
 	s.mu.RLock()
@@ -267,7 +866,13 @@ func (s *DVRServer) GetTimezone() string {
 
 // Close 关闭服务器
 func (s *DVRServer) Close() {
-	// 目前无需清理
+	if s.stopWatch != nil {
+		close(s.stopWatch)
+		s.stopWatch = nil
+	}
+	if s.storage != nil {
+		s.storage.Close()
+	}
 }
 
 // ==================== 数据类型 ====================
@@ -282,6 +887,11 @@ type RecordingInfo struct {
 	EndTimestamp   int64  `json:"endTimestamp"`
 	Duration       int64  `json:"duration"`
 	FrameCount     int    `json:"frameCount"`
+	FileIndices    []int  `json:"fileIndices,omitempty"` // 合并后包含的段落
+
+	// 首/末视频帧的 Unix 微秒时间（与 WebSocket 帧时间一致），/recordings 中裁剪到当天范围
+	StartTimestampUs int64 `json:"startTimestampUs"`
+	EndTimestampUs   int64 `json:"endTimestampUs"`
 }
 
 // CacheStatus 缓存状态
@@ -291,6 +901,42 @@ type CacheStatus struct {
 	Total    int    `json:"total"`
 	Current  int    `json:"current"`
 	Cached   int    `json:"cached"`
+
+	// 缓存目录占用
+	CacheDirBytes int64 `json:"cacheDirBytes"`
+	CacheFiles    int   `json:"cacheFiles"`
+	Compressed    bool  `json:"compressed"`         // 磁盘缓存使用压缩格式
+	ReadOnly      bool  `json:"readOnly,omitempty"` // 只读模式：索引只保存在内存中，不使用缓存目录
+}
+
+// StorageReport 存储使用情况
+type StorageReport struct {
+	StoragePath     string      `json:"storagePath"`
+	Loaded          bool        `json:"loaded"`
+	Timezone        string      `json:"timezone"`
+	FileCount       int         `json:"fileCount"`
+	RecordingBytes  int64       `json:"recordingBytes"`
+	DiskTotalBytes  int64       `json:"diskTotalBytes"`
+	DiskFreeBytes   int64       `json:"diskFreeBytes"`
+	SegmentCount    int         `json:"segmentCount"`
+	ChannelSegments map[int]int `json:"channelSegments"`
+	Earliest        int64       `json:"earliest"`
+	Latest          int64       `json:"latest"`
+}
+
+// CacheEvent 缓存构建进度事件
+type CacheEvent struct {
+	Type      string `json:"type"` // progress / done / cancelled
+	Progress  int    `json:"progress"`
+	Current   int    `json:"current"`
+	Total     int    `json:"total"`
+	FileIndex int    `json:"fileIndex"`
+	Cached    int    `json:"cached,omitempty"`
+}
+
+// terminal 是否为构建结束事件
+func (e CacheEvent) terminal() bool {
+	return e.Type == "done" || e.Type == "cancelled"
 }
 
 // Config 配置
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"seetong-dvr/internal/seetong"
+)
+
+func TestPublishCacheEventDeliversTerminalEvents(t *testing.T) {
+	for _, final := range []string{"done", "cancelled"} {
+		s := NewDVRServer("")
+		events, unsubscribe := s.SubscribeCacheEvents()
+
+		// 订阅者不消费时 progress 填满通道，之后的 progress 被丢弃
+		for i := 0; i < 200; i++ {
+			s.publishCacheEvent(CacheEvent{Type: "progress", Current: i + 1, Total: 200})
+		}
+		s.publishCacheEvent(CacheEvent{Type: final, Total: 200})
+
+		var last CacheEvent
+		count := len(events)
+		for i := 0; i < count; i++ {
+			last = <-events
+		}
+		unsubscribe()
+		if last.Type != final {
+			t.Fatalf("last event %q, want %q", last.Type, final)
+		}
+		if count != cap(events) {
+			t.Fatalf("%d buffered events, want %d", count, cap(events))
+		}
+	}
+}
+
+func TestMultipleIndexSourcesMergeIntoOneDateList(t *testing.T) {
+	// 同一目录两批（TIndex00.tps、TIndex01.tps），子目录 batch2 一批，每批一天
+	day := func(d int) fixtureSegment {
+		start := time.Date(2024, 1, d, 12, 0, 0, 0, time.UTC)
+		return fixtureSegment{Channel: 1, Start: start, End: start.Add(fixtureGOPs * time.Second)}
+	}
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "batch2")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFixtureIndex(t, dir, "TIndex00.tps", 0, day(15))
+	writeFixtureIndex(t, dir, "TIndex01.tps", 1, day(16))
+	writeFixtureIndex(t, sub, "TIndex00.tps", 0, day(17))
+
+	clock := FixedClock{Time: time.Date(2024, 1, 20, 12, 0, 0, 0, time.UTC), Location: time.UTC}
+	s := loadFixtureDVR(t, dir, clock, "UTC")
+
+	if n := len(s.storage.Sources()); n != 2 {
+		t.Fatalf("%d index sources, want 2", n)
+	}
+	if n := len(s.storage.IndexFiles()); n != 3 {
+		t.Fatalf("%d index files, want 3", n)
+	}
+	for _, tc := range []struct {
+		fileIndex int
+		recFile   string
+		day       int
+	}{
+		{0, filepath.Join(dir, "TRec000000.tps"), 15},
+		{1, filepath.Join(dir, "TRec000001.tps"), 16},
+		{seetong.SourceFileStride, filepath.Join(sub, "TRec000000.tps"), 17},
+	} {
+		if s.storage.GetSegmentByFileIndex(tc.fileIndex) == nil {
+			t.Errorf("no segment for file %d", tc.fileIndex)
+		}
+		if got := s.storage.RecFilePath(tc.fileIndex); got != tc.recFile {
+			t.Errorf("RecFilePath(%d) = %q, want %q", tc.fileIndex, got, tc.recFile)
+		}
+		if !s.storage.IsSegmentCached(tc.fileIndex) {
+			t.Errorf("file %d was not cached from %s", tc.fileIndex, tc.recFile)
+		}
+		// 帧时间写在各自的 TRec 文件里，读错目录时会得到另一天的帧
+		if frames := s.storage.GetFrameIndex(tc.fileIndex); len(frames) == 0 || int64(frames[0].UnixTs) != day(tc.day).Start.Unix() {
+			t.Errorf("file %d: frame index does not come from %s", tc.fileIndex, tc.recFile)
+		}
+	}
+
+	dates := s.GetRecordingDates(nil)
+	if len(dates) != 3 || !dates["2024-01-15"] || !dates["2024-01-16"] || !dates["2024-01-17"] {
+		t.Fatalf("recording dates %v, want 2024-01-15 to 2024-01-17", dates)
+	}
+}
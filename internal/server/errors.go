@@ -0,0 +1,164 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"seetong-dvr/internal/seetong"
+
+	"github.com/kataras/iris/v12"
+)
+
+// 错误原因（机器可读），客户端应按 reason 分支，不要匹配本地化文本
+const (
+	ReasonNotLoaded    = "not_loaded"           // 未配置或未加载 DVR
+	ReasonDisconnected = "storage_disconnected" // DVR 存储（U 盘）已拔出
+	ReasonNotFound     = "not_found"            // 段落、I 帧等资源不存在
+	ReasonFileMissing  = "file_missing"         // 磁盘上的录像/索引文件不存在
+	ReasonOutOfRange   = "out_of_range"         // 帧序号、时间等超出范围
+	ReasonNotKeyframe  = "not_keyframe"         // 请求的帧不能单独解码
+	ReasonInvalidParam = "invalid_param"        // 请求参数无效
+	ReasonParseFailure = "parse_failure"        // 录像数据格式无法解析
+	ReasonReadFailure  = "read_failure"         // 读取录像数据失败
+	ReasonUnauthorized = "unauthorized"
+	ReasonForbidden    = "forbidden"   // 接口未开放
+	ReasonUnsupported  = "unsupported" // 服务端缺少可选依赖（如 ffmpeg）
+	ReasonReadOnly     = "read_only"   // 只读模式下不允许写入
+
+	ReasonChannelUnavailable = "channel_unavailable" // 该时间/段落没有请求的通道（WebSocket strictChannel）
+	ReasonSeekGap            = "seek_gap"            // 指定时间位于两段录像之间（或早于第一段录像）
+	ReasonSeekPastEnd        = "seek_past_end"       // 指定时间晚于最后一段录像
+)
+
+// APIError 接口错误响应
+// error 字段保留中文消息，兼容现有前端；messageEn 为英文消息
+type APIError struct {
+	Code      int    `json:"code"` // HTTP 状态码
+	Reason    string `json:"reason"`
+	Message   string `json:"error"`
+	MessageEn string `json:"messageEn"`
+	Detail    string `json:"detail,omitempty"` // 底层错误信息（不翻译）
+
+	// 请求体校验失败时出错的字段（JSON 名称）和提交的值
+	Field string      `json:"field,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	if e.Detail != "" {
+		return e.Message + ": " + e.Detail
+	}
+	return e.Message
+}
+
+// WithDetail 返回附带底层错误信息的副本
+func (e *APIError) WithDetail(detail string) *APIError {
+	c := *e
+	c.Detail = detail
+	return &c
+}
+
+// WithField 返回附带出错字段和提交值的副本
+func (e *APIError) WithField(field string, value interface{}) *APIError {
+	c := *e
+	c.Field = field
+	c.Value = value
+	return &c
+}
+
+func newAPIError(code int, reason, message, messageEn string) *APIError {
+	return &APIError{Code: code, Reason: reason, Message: message, MessageEn: messageEn}
+}
+
+// 常用错误
+var (
+	errNotLoaded        = newAPIError(503, ReasonNotLoaded, "DVR 未加载", "DVR not loaded")
+	errDisconnected     = newAPIError(503, ReasonDisconnected, "DVR 存储已断开", "DVR storage disconnected")
+	errSegmentNotFound  = newAPIError(404, ReasonNotFound, "段落不存在", "segment not found")
+	errSegmentNotCached = newAPIError(404, ReasonNotFound, "段落未缓存", "segment not cached yet")
+	errFrameNotFound    = newAPIError(404, ReasonOutOfRange, "帧不存在", "frame index out of range")
+	errNotKeyframe      = newAPIError(409, ReasonNotKeyframe, "P 帧无法单独解码，请请求覆盖该帧的 I 帧", "P-frame cannot be decoded alone, request the covering I-frame")
+	errNoIFrame         = newAPIError(404, ReasonNotFound, "未找到 I 帧", "no I-frame found")
+	errNoVideoHeader    = newAPIError(404, ReasonNotFound, "未找到视频头", "no video parameter sets found")
+	errNoVideoFrames    = newAPIError(404, ReasonNotFound, "段落中没有视频帧", "segment has no video frames")
+	errRecFileMissing   = newAPIError(404, ReasonFileMissing, "录像文件不存在", "recording file missing")
+	errParseFailure     = newAPIError(500, ReasonParseFailure, "录像数据无法解析", "recording data could not be parsed")
+	errReadFailure      = newAPIError(500, ReasonReadFailure, "读取帧失败", "failed to read frame")
+	errUnauthorized     = newAPIError(401, ReasonUnauthorized, "未授权", "unauthorized")
+	errRawDisabled      = newAPIError(403, ReasonForbidden, "原始数据接口需要 -debug 或 -auth-token", "raw access requires -debug or -auth-token")
+	errAPINotFound      = newAPIError(404, ReasonNotFound, "接口不存在", "endpoint not found")
+	errNoRecordings     = newAPIError(404, ReasonNotFound, "没有录像", "no recordings")
+	errBookmarkNotFound = newAPIError(404, ReasonNotFound, "书签不存在", "bookmark not found")
+	errBookmarkStore    = newAPIError(500, ReasonReadFailure, "书签读写失败", "failed to read or write bookmarks")
+	errReadOnly         = newAPIError(403, ReasonReadOnly, "只读模式下不能修改", "not allowed in read-only mode")
+)
+
+// errInvalidParam 参数错误
+func errInvalidParam(message, messageEn string) *APIError {
+	return newAPIError(400, ReasonInvalidParam, message, messageEn)
+}
+
+// errInvalidJSON 请求体无法解析为 JSON 对象
+// 语法错误的 detail 带字节偏移，类型不符时 field 为字段名、value 为提交值的 JSON 类型
+func errInvalidJSON(err error) *APIError {
+	apiErr := errInvalidParam("无效的 JSON", "invalid JSON body")
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, io.EOF):
+		return apiErr.WithDetail("empty body")
+	case errors.As(err, &syntaxErr):
+		return apiErr.WithDetail(fmt.Sprintf("offset %d: %v", syntaxErr.Offset, syntaxErr))
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		apiErr = errInvalidParam("字段类型错误", "invalid field type").WithField(typeErr.Field, typeErr.Value)
+		return apiErr.WithDetail(fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value))
+	default:
+		return apiErr.WithDetail(err.Error())
+	}
+}
+
+// toAPIError 将领域错误映射为接口错误
+// 已经是 APIError 的原样返回；只读模式拒绝的写入返回 403，映射失效视为存储断开，文件不存在、格式错误、读取截断分别映射，其余视为读取失败
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.Is(err, seetong.ErrReadOnly):
+		return errReadOnly
+	case errors.Is(err, seetong.ErrMappingFault):
+		return errDisconnected.WithDetail(err.Error())
+	case errors.Is(err, seetong.ErrRecFileNotFound), errors.Is(err, fs.ErrNotExist):
+		return errRecFileMissing.WithDetail(err.Error())
+	case errors.Is(err, seetong.ErrInvalidFormat), errors.Is(err, io.ErrUnexpectedEOF):
+		return errParseFailure.WithDetail(err.Error())
+	default:
+		return errReadFailure.WithDetail(err.Error())
+	}
+}
+
+// writeError 写入错误响应
+func writeError(ctx iris.Context, err error) {
+	apiErr := toAPIError(err)
+	ctx.StatusCode(apiErr.Code)
+	ctx.JSON(apiErr)
+}
+
+// writeLoadError 写入 DVR 加载失败响应
+// 路径由客户端提交，统一返回 400，reason 区分索引缺失和格式错误
+func writeLoadError(ctx iris.Context, storagePath string, err error) {
+	apiErr := *toAPIError(err)
+	apiErr.Code = 400
+	apiErr.Message = "无法加载指定路径的 DVR 数据"
+	apiErr.MessageEn = "failed to load DVR data from the given path"
+
+	ctx.StatusCode(apiErr.Code)
+	ctx.JSON(struct {
+		*APIError
+		StoragePath string `json:"storagePath"`
+		Loaded      bool   `json:"loaded"`
+	}{&apiErr, storagePath, false})
+}
@@ -0,0 +1,281 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+
+	"seetong-dvr/internal/seetong"
+
+	"github.com/kataras/iris/v12"
+)
+
+// 流式导出时每写出这么多字节刷新一次，数据及时发给客户端而不是堆积在缓冲区
+const exportFlushBytes = 1 << 20
+
+// exportWriter 流式写出导出数据
+// 导出可能达到数 GB，逐帧写出并定期刷新，内存只占一个帧缓冲；
+// 客户端断开后请求 context 被取消，write 返回错误，调用方停止读取
+type exportWriter struct {
+	ctx     iris.Context
+	pending int
+}
+
+func (w *exportWriter) write(data []byte) error {
+	if err := w.ctx.Request().Context().Err(); err != nil {
+		return err
+	}
+	if _, err := w.ctx.Write(data); err != nil {
+		return err
+	}
+	w.pending += len(data)
+	if w.pending >= exportFlushBytes {
+		w.pending = 0
+		w.ctx.ResponseWriter().Flush()
+	}
+	return nil
+}
+
+// Write 实现 io.Writer
+func (w *exportWriter) Write(data []byte) (int, error) {
+	if err := w.write(data); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// clipFrame 导出片段中的一帧
+type clipFrame struct {
+	record seetong.FrameIndexRecord
+	timeMs int64 // 首帧 Unix 时间 + 设备时间戳增量，精确到毫秒
+}
+
+// clipRange 导出片段的帧范围
+type clipRange struct {
+	frames     []clipFrame
+	start, end int // [start, end) 为导出的帧
+}
+
+// resolveClip 计算导出范围
+// 起点总是 from 之前最近的 I 帧（裸 H.265 流没有编辑列表，只能从关键帧开始解码）；
+// trim=false 时终点扩展到 to 所在 GOP 的末尾，trim=true 时精确截断在 to 之前的最后一帧
+func resolveClip(records []seetong.FrameIndexRecord, frameChannel uint32, fromMs, toMs int64, trim bool) (*clipRange, error) {
+	var frames []clipFrame
+	var baseUnixMs int64
+	var baseTsUs uint64
+	for _, r := range records {
+		if r.Channel != frameChannel {
+			continue
+		}
+		if len(frames) == 0 {
+			baseUnixMs = int64(r.UnixTs) * 1000
+			baseTsUs = r.TimestampUs
+		}
+		frames = append(frames, clipFrame{
+			record: r,
+			timeMs: baseUnixMs + (int64(r.TimestampUs)-int64(baseTsUs))/1000,
+		})
+	}
+	if len(frames) == 0 {
+		return nil, errNoVideoFrames
+	}
+
+	clip := &clipRange{frames: frames, start: -1}
+	for i, f := range frames {
+		if !f.record.IsIFrame() {
+			continue
+		}
+		if f.timeMs <= fromMs || clip.start < 0 {
+			clip.start = i
+		}
+		if f.timeMs > fromMs {
+			break
+		}
+	}
+	if clip.start < 0 {
+		return nil, errNoIFrame
+	}
+
+	clip.end = clip.start
+	for clip.end < len(frames) && frames[clip.end].timeMs < toMs {
+		clip.end++
+	}
+	if !trim {
+		// 补齐到下一个 I 帧之前
+		for clip.end < len(frames) && !frames[clip.end].record.IsIFrame() {
+			clip.end++
+		}
+	}
+	if clip.end <= clip.start {
+		clip.end = clip.start + 1
+	}
+	return clip, nil
+}
+
+// ExportClip 导出时间范围内的 H.265 裸流（Annex B）
+// GET /api/v1/export/{file_index}?from=<unix>&to=<unix>&channel=<n>&trim=true
+//
+// from/to 支持小数秒。裸流不支持编辑列表，片段总是从 from 之前的 I 帧开始，
+// X-Clip-Preroll-Ms 给出播放器需要跳过的时长；trim=true 时尾部精确截断在 to。
+// 裸流就是各帧数据直接拼接，Content-Length 为帧大小之和，客户端可以显示下载进度
+func (h *Handlers) ExportClip(ctx iris.Context) {
+	storage := h.dvr.GetStorage()
+	if storage == nil || !h.dvr.IsLoaded() {
+		writeError(ctx, errNotLoaded)
+		return
+	}
+
+	fileIndex := ctx.Params().GetIntDefault("file_index", 0)
+	seg := storage.GetSegmentByFileIndex(fileIndex)
+	if seg == nil {
+		writeError(ctx, errSegmentNotFound)
+		return
+	}
+
+	from := ctx.URLParamFloat64Default("from", float64(seg.StartTime))
+	to := ctx.URLParamFloat64Default("to", float64(seg.EndTime))
+	if to <= from {
+		writeError(ctx, errInvalidParam("to 必须大于 from", "to must be greater than from"))
+		return
+	}
+	trim, _ := ctx.URLParamBool("trim")
+	channel := ctx.URLParamIntDefault("channel", seg.Channel)
+	fromMs := int64(math.Round(from * 1000))
+	toMs := int64(math.Round(to * 1000))
+
+	clip, err := resolveClip(storage.GetFrameIndex(fileIndex), uint32(frameChannelFor(channel)), fromMs, toMs, trim)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	first := clip.frames[clip.start]
+	last := clip.frames[clip.end-1]
+	preroll := fromMs - first.timeMs
+	if preroll < 0 {
+		preroll = 0
+	}
+
+	ctx.ContentType("video/H265")
+	ctx.Header("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="clip_%d_%d.h265"`, fileIndex, fromMs/1000))
+	ctx.Header("X-Clip-Start-Ms", fmt.Sprint(first.timeMs))
+	ctx.Header("X-Clip-End-Ms", fmt.Sprint(last.timeMs))
+	ctx.Header("X-Clip-Frames", fmt.Sprint(clip.end-clip.start))
+	ctx.Header("X-Clip-Preroll-Ms", fmt.Sprint(preroll))
+	var length int64
+	for _, f := range clip.frames[clip.start:clip.end] {
+		length += int64(f.record.FrameSize)
+	}
+	ctx.Header("Content-Length", strconv.FormatInt(length, 10))
+	if trim {
+		ctx.Header("X-Clip-Trim", "tail-exact; head starts at keyframe, skip X-Clip-Preroll-Ms on playback")
+	} else {
+		ctx.Header("X-Clip-Trim", "none; keyframe start and full final GOP")
+	}
+
+	// 读取失败时响应短于 Content-Length，客户端能发现下载不完整
+	out := &exportWriter{ctx: ctx}
+	var buf []byte
+	defer func() { seetong.PutFrameBuffer(buf) }()
+	for _, f := range clip.frames[clip.start:clip.end] {
+		var err error
+		buf, err = storage.ReadFrameInto(fileIndex, f.record, buf)
+		if err != nil {
+			seetong.LogWarn("导出读取帧失败", "file_index", fileIndex, "offset", f.record.FileOffset, "error", err)
+			return
+		}
+		if err := out.write(buf); err != nil {
+			seetong.LogDebug("导出中止", "file_index", fileIndex, "error", err) // 客户端断开
+			return
+		}
+	}
+}
+
+// ExportTRec 把时间范围内的帧复制到新的 TRec 文件，供厂商 PC 软件打开
+// GET /api/v1/export/{file_index}/trec?from=<unix>&to=<unix>&channel=<n>&trim=true
+//
+// 范围与 ExportClip 相同（从 channel 在 from 之前的 I 帧开始），该范围内所有通道的帧（含音频）
+// 按原顺序连续写入，原文件第一帧之前的文件头原样复制，索引区按设备的 44 字节布局重建，
+// 只重新计算偏移，帧序号和保留字节不变。输出为标准的 256MB 文件（大部分为零填充），
+// 文件名沿用原文件名；新索引在写出前检查能被本程序的解析器原样读回
+func (h *Handlers) ExportTRec(ctx iris.Context) {
+	storage := h.dvr.GetStorage()
+	if storage == nil || !h.dvr.IsLoaded() {
+		writeError(ctx, errNotLoaded)
+		return
+	}
+
+	fileIndex := ctx.Params().GetIntDefault("file_index", 0)
+	seg := storage.GetSegmentByFileIndex(fileIndex)
+	if seg == nil {
+		writeError(ctx, errSegmentNotFound)
+		return
+	}
+
+	from := ctx.URLParamFloat64Default("from", float64(seg.StartTime))
+	to := ctx.URLParamFloat64Default("to", float64(seg.EndTime))
+	if to <= from {
+		writeError(ctx, errInvalidParam("to 必须大于 from", "to must be greater than from"))
+		return
+	}
+	trim, _ := ctx.URLParamBool("trim")
+	channel := ctx.URLParamIntDefault("channel", seg.Channel)
+	fromMs := int64(math.Round(from * 1000))
+	toMs := int64(math.Round(to * 1000))
+
+	records := storage.GetFrameIndex(fileIndex)
+	clip, err := resolveClip(records, uint32(frameChannelFor(channel)), fromMs, toMs, trim)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	// 按设备时间戳取范围：从起始 I 帧到下一个未导出的视频帧之前
+	first := clip.frames[clip.start]
+	lo, hi := first.record.TimestampUs, uint64(math.MaxUint64)
+	if clip.end < len(clip.frames) {
+		hi = clip.frames[clip.end].record.TimestampUs
+	}
+	var frames []seetong.FrameIndexRecord
+	headerSize := int64(-1)
+	for _, r := range records {
+		if headerSize < 0 || int64(r.FileOffset) < headerSize {
+			headerSize = int64(r.FileOffset)
+		}
+		if r.TimestampUs >= lo && r.TimestampUs < hi {
+			frames = append(frames, r)
+		}
+	}
+
+	var header []byte
+	if headerSize > 0 && headerSize <= seetong.TRecMaxHeaderSize {
+		if header, err = storage.ReadRaw(fileIndex, 0, int(headerSize)); err != nil {
+			writeError(ctx, err)
+			return
+		}
+	}
+	plan, err := seetong.PlanTRecCopy(header, frames)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	ctx.ContentType("application/octet-stream")
+	ctx.Header("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="%s"`, filepath.Base(storage.GetRecFile(fileIndex))))
+	ctx.Header("X-Clip-Start-Ms", fmt.Sprint(first.timeMs))
+	ctx.Header("X-Clip-End-Ms", fmt.Sprint(clip.frames[clip.end-1].timeMs))
+	ctx.Header("X-Clip-Frames", fmt.Sprint(len(frames)))
+	ctx.Header("Content-Length", strconv.FormatInt(seetong.TRecFileSize, 10))
+
+	// 读取失败时响应短于 Content-Length，客户端能发现下载不完整
+	out := &exportWriter{ctx: ctx}
+	_, err = plan.Write(out, func(frame seetong.FrameIndexRecord, buf []byte) ([]byte, error) {
+		return storage.ReadFrameInto(fileIndex, frame, buf)
+	})
+	if err != nil {
+		seetong.LogWarn("TRec 导出中止", "file_index", fileIndex, "error", err)
+	}
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"seetong-dvr/internal/config"
+	"seetong-dvr/internal/seetong"
+
+	"github.com/kataras/iris/v12"
+)
+
+// ============================================================================
+// 测试用的合成 DVR
+// ============================================================================
+
+// 每个 TRec 文件是 256MB 稀疏文件：文件头之后是 fixtureGOPs 个 GOP 的 H.265 帧和 G.711 音频，
+// 帧索引在 TRecIndexRegionStart；段落的起止时间只由 TIndex00.tps 决定
+
+const (
+	fixtureGOPs         = 8
+	fixtureFramesPerGOP = 25 // 25fps，每个 GOP 1 秒
+	fixtureHeaderSize   = 0x200
+)
+
+// fixtureNal 4 字节起始码 + 两字节 NAL 头 + size 字节不含 0x00 的负载
+func fixtureNal(nalType, size, seed int) []byte {
+	nal := []byte{0x00, 0x00, 0x00, 0x01, byte(nalType << 1), 0x01}
+	for i := 0; i < size; i++ {
+		nal = append(nal, byte(0x10+(i*7+seed)%0xE0))
+	}
+	return nal
+}
+
+// fixtureFrames 一个 TRec 文件中的帧（按写入顺序）和帧数据，firstUnix 为首帧的 Unix 时间
+// 负载随 firstUnix 变化：缓存键包括文件头部内容，不同录像的同名文件不能相同
+func fixtureFrames(firstUnix int64) ([]seetong.FrameIndexRecord, [][]byte) {
+	var records []seetong.FrameIndexRecord
+	var data [][]byte
+	offset := uint32(fixtureHeaderSize)
+	add := func(r seetong.FrameIndexRecord, frame []byte) {
+		r.FrameSeq = uint32(len(records))
+		r.FileOffset, r.FrameSize = offset, uint32(len(frame))
+		offset += r.FrameSize
+		records = append(records, r)
+		data = append(data, frame)
+	}
+	for i := 0; i < fixtureGOPs*fixtureFramesPerGOP; i++ {
+		seed := i + int(firstUnix%0xE0)
+		ts := seetong.FrameIndexRecord{TimestampUs: uint64(i) * 40000, UnixTs: uint32(firstUnix) + uint32(i/25)}
+		video := ts
+		video.Channel = seetong.ChannelVideo1
+		if i%fixtureFramesPerGOP == 0 {
+			video.FrameType = seetong.FrameTypeI
+			var frame []byte
+			for _, nal := range [][]byte{fixtureNal(seetong.NalVPS, 20, seed), fixtureNal(seetong.NalSPS, 30, seed), fixtureNal(seetong.NalPPS, 6, seed), fixtureNal(seetong.NalIDRWRadl, 3000, seed)} {
+				frame = append(frame, nal...)
+			}
+			add(video, frame)
+		} else {
+			video.FrameType = seetong.FrameTypeP
+			add(video, fixtureNal(seetong.NalTrailR, 400+i%7*30, seed))
+		}
+		audio := ts
+		audio.Channel = seetong.ChannelAudio
+		add(audio, make([]byte, 320))
+	}
+	return records, data
+}
+
+// putFrameIndexEntry 按 44 字节布局编码一条帧索引条目
+func putFrameIndexEntry(buf []byte, r seetong.FrameIndexRecord) {
+	binary.LittleEndian.PutUint32(buf[0:4], seetong.TRecFrameIndexMagic)
+	binary.LittleEndian.PutUint32(buf[4:8], r.FrameType)
+	binary.LittleEndian.PutUint32(buf[8:12], r.Channel)
+	binary.LittleEndian.PutUint32(buf[12:16], r.FrameSeq)
+	binary.LittleEndian.PutUint32(buf[16:20], r.FileOffset)
+	binary.LittleEndian.PutUint32(buf[20:24], r.FrameSize)
+	binary.LittleEndian.PutUint64(buf[24:32], r.TimestampUs)
+	binary.LittleEndian.PutUint32(buf[32:36], r.UnixTs)
+}
+
+// writeFixtureTRec 写一个 TRec 文件，首帧的 Unix 时间为 firstUnix
+func writeFixtureTRec(t testing.TB, path string, firstUnix int64) {
+	t.Helper()
+	records, data := fixtureFrames(firstUnix)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Truncate(seetong.TRecFileSize); err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range records {
+		if _, err := f.WriteAt(data[i], int64(r.FileOffset)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	index := make([]byte, len(records)*seetong.TRecFrameIndexSize)
+	for i, r := range records {
+		putFrameIndexEntry(index[i*seetong.TRecFrameIndexSize:], r)
+	}
+	if _, err := f.WriteAt(index, seetong.TRecIndexRegionStart); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fixtureSegment 通道 channel 上 [start, end) 的段落，FileIndex 由 writeFixtureDVR 按顺序分配
+type fixtureSegment struct {
+	Channel    int
+	Start, End time.Time
+}
+
+// writeFixtureDVR 在临时目录写 DVR：每个段落一个 TRec 文件（TRec000000 起），返回 DVR 目录
+func writeFixtureDVR(t testing.TB, segments ...fixtureSegment) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeFixtureIndex(t, dir, "TIndex00.tps", 0, segments...)
+	return dir
+}
+
+// writeFixtureIndex 在 dir 写主索引 name 和其中段落的 TRec 文件：segments[i] 对应 TRec 文件编号 first+i，
+// 之前的条目为空（分批复制时后一批的索引从上一批之后的文件编号开始）
+func writeFixtureIndex(t testing.TB, dir, name string, first int, segments ...fixtureSegment) {
+	t.Helper()
+	entries := first + len(segments)
+	index := make([]byte, seetong.SegmentIndexOffset+(entries+1)*seetong.EntrySize)
+	binary.LittleEndian.PutUint32(index[0:4], seetong.TPSIndexMagic)
+	binary.LittleEndian.PutUint32(index[0x10:0x14], uint32(len(segments)))
+	binary.LittleEndian.PutUint32(index[0x14:0x18], uint32(entries))
+	for i, seg := range segments {
+		writeFixtureTRec(t, filepath.Join(dir, fmt.Sprintf("TRec%06d.tps", first+i)), seg.Start.Unix())
+		entry := index[seetong.SegmentIndexOffset+(first+i)*seetong.EntrySize:]
+		entry[4] = byte(seg.Channel)
+		binary.LittleEndian.PutUint16(entry[6:8], fixtureGOPs*fixtureFramesPerGOP*2)
+		binary.LittleEndian.PutUint32(entry[8:12], uint32(seg.Start.Unix()))
+		binary.LittleEndian.PutUint32(entry[12:16], uint32(seg.End.Unix()))
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), index, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// loadFixtureDVR 加载 DVR 并构建全部段落的缓存（缓存目录为临时目录），时间来源为 clock
+func loadFixtureDVR(t testing.TB, dir string, clock Clock, timezone string) *DVRServer {
+	t.Helper()
+	seetong.SetCacheDir(t.TempDir())
+	s := NewDVRServer(dir)
+	s.SetClock(clock)
+	if err := s.SetTimezone(timezone); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	s.BuildVPSCache()
+	return s
+}
+
+// 测试服务器使用的段落：8 秒录像，1x 播放时发送到结束之前有足够的时间断开
+var streamFixtureStart = time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+// startFixtureServer 在 httptest 服务器上运行 RegisterRoutes 注册的接口，DVR 只有通道 1 的一个段落
+// register 在 API 路由之后注册其他路由（如前端静态文件）
+func startFixtureServer(t *testing.T, cfg *config.Config, register ...func(*iris.Application)) (*Handlers, *httptest.Server) {
+	t.Helper()
+	dir := writeFixtureDVR(t, fixtureSegment{Channel: 1, Start: streamFixtureStart, End: streamFixtureStart.Add(fixtureGOPs * time.Second)})
+	dvr := loadFixtureDVR(t, dir, FixedClock{Time: streamFixtureStart.Add(time.Hour), Location: time.UTC}, "UTC")
+	h := NewHandlers(dvr, config.NewStore("", cfg))
+
+	app := iris.New()
+	app.Logger().SetLevel("disable")
+	RegisterRoutes(app, h)
+	for _, fn := range register {
+		fn(app)
+	}
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(app)
+	t.Cleanup(srv.Close)
+	return h, srv
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"seetong-dvr/internal/seetong"
+)
+
+// frameFilter play 消息的 frameTypes：流中保留的视频帧类型，零值表示全部发送
+// 快速浏览时只发送 I 帧（或 I 帧和参考 P 帧），跳过的帧不发送也不参与节奏控制，
+// 参数集（VPS/SPS/PPS）等非 VCL NAL 总是发送，保留的帧始终可以解码
+type frameFilter uint8
+
+const (
+	frameFilterI frameFilter = 1 << iota // IRAP（IDR/CRA/BLA）
+	frameFilterP                         // 参考帧（TRAIL_R 等）
+	frameFilterN                         // 非参考帧（TRAIL_N 等），丢弃不影响其他帧
+
+	frameFilterAll = frameFilterI | frameFilterP | frameFilterN
+)
+
+// parseFrameFilter 解析 frameTypes（"I"、"P"、"N"，不区分大小写），空列表表示全部
+// 必须包含 I；包含 N 时必须包含 P（非参考帧参考 P 帧）
+func parseFrameFilter(types []string) (frameFilter, error) {
+	var f frameFilter
+	for _, t := range types {
+		switch strings.ToUpper(strings.TrimSpace(t)) {
+		case "I":
+			f |= frameFilterI
+		case "P":
+			f |= frameFilterP
+		case "N":
+			f |= frameFilterN
+		default:
+			return 0, fmt.Errorf("未知的帧类型: %q（可选 I、P、N）", t)
+		}
+	}
+	switch {
+	case f == 0, f == frameFilterAll:
+		return 0, nil
+	case f&frameFilterI == 0:
+		return 0, fmt.Errorf("frameTypes 必须包含 I")
+	case f&frameFilterN != 0 && f&frameFilterP == 0:
+		return 0, fmt.Errorf("frameTypes 包含 N 时必须包含 P")
+	}
+	return f, nil
+}
+
+// allows 是否发送该 NAL
+func (f frameFilter) allows(nalType int) bool {
+	if f == 0 || nalType >= 32 { // 非 VCL
+		return true
+	}
+	switch {
+	case nalType >= 16 && nalType <= 23:
+		return f&frameFilterI != 0
+	case seetong.IsSubLayerNonReference(nalType):
+		return f&frameFilterN != 0
+	default:
+		return f&frameFilterP != 0
+	}
+}
+
+// effective 实际发送的帧类型（零值为全部）
+func (f frameFilter) effective() frameFilter {
+	if f == 0 {
+		return frameFilterAll
+	}
+	return f
+}
+
+// names stream_start 中返回的帧类型列表
+func (f frameFilter) names() []string {
+	f = f.effective()
+	var names []string
+	for _, t := range []struct {
+		bit  frameFilter
+		name string
+	}{{frameFilterI, "I"}, {frameFilterP, "P"}, {frameFilterN, "N"}} {
+		if f&t.bit != 0 {
+			names = append(names, t.name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+
+	"seetong-dvr/internal/seetong"
+
+	"github.com/kataras/iris/v12"
+)
+
+// FrameIndexLine NDJSON 帧索引导出中的一行
+type FrameIndexLine struct {
+	Entry       int    `json:"entry"` // 在文件中的顺序（只计有效记录，从 0 开始）
+	Channel     uint32 `json:"channel"`
+	FrameType   uint32 `json:"frameType"`
+	FrameSeq    uint32 `json:"frameSeq"`
+	FileOffset  uint32 `json:"fileOffset"`
+	FrameSize   uint32 `json:"frameSize"`
+	TimestampUs uint64 `json:"timestampUs"`
+	UnixTs      uint32 `json:"unixTs"`
+	Reserved    string `json:"reserved"` // 保留字节（十六进制）
+}
+
+// GetFrameIndexNDJSON 以 NDJSON 流式导出 TRec 文件的全部有效帧索引记录
+// GET /api/v1/frame_index/{file_index}/ndjson
+//
+// 边解析边输出，每行一条记录，不在内存中保存整个索引。记录按文件顺序（写入顺序），
+// 不排序、不去除时间戳重置前的记录，因此 entry 与 /frame/{file_index}/{frame_idx} 的序号不同
+func (h *Handlers) GetFrameIndexNDJSON(ctx iris.Context) {
+	storage := h.dvr.GetStorage()
+	if storage == nil || !h.dvr.IsLoaded() {
+		writeError(ctx, errNotLoaded)
+		return
+	}
+
+	fileIndex := ctx.Params().GetIntDefault("file_index", 0)
+	recFile := storage.GetRecFile(fileIndex)
+	if recFile == "" {
+		writeError(ctx, errRecFileMissing)
+		return
+	}
+
+	w := &exportWriter{ctx: ctx}
+	enc := json.NewEncoder(w)
+	entry := 0
+	var writeErr error
+	err := seetong.ParseTRecFrameIndexStream(recFile, func(r seetong.FrameIndexRecord) bool {
+		if entry == 0 {
+			ctx.ContentType("application/x-ndjson")
+			ctx.Header("Cache-Control", "no-cache")
+		}
+		writeErr = enc.Encode(FrameIndexLine{
+			Entry:       entry,
+			Channel:     r.Channel,
+			FrameType:   r.FrameType,
+			FrameSeq:    r.FrameSeq,
+			FileOffset:  r.FileOffset,
+			FrameSize:   r.FrameSize,
+			TimestampUs: r.TimestampUs,
+			UnixTs:      r.UnixTs,
+			Reserved:    hex.EncodeToString(r.Reserved[:]),
+		})
+		entry++
+		return writeErr == nil
+	})
+	switch {
+	case err != nil && entry == 0:
+		writeError(ctx, errParseFailure.WithDetail(err.Error()))
+		return
+	case err != nil:
+		seetong.LogWarn("帧索引导出中断", "fileIndex", fileIndex, "lines", entry, "error", err)
+	case writeErr != nil:
+		seetong.LogDebug("帧索引导出被客户端中断", "fileIndex", fileIndex, "lines", entry, "error", writeErr)
+	case entry == 0:
+		ctx.ContentType("application/x-ndjson")
+	}
+	ctx.ResponseWriter().Flush()
+}
@@ -0,0 +1,561 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"seetong-dvr/internal/seetong"
+
+	"github.com/kataras/iris/v12"
+)
+
+// NalSummary NAL 单元摘要
+type NalSummary struct {
+	Offset     int    `json:"offset"`
+	Size       int    `json:"size"`
+	NalType    int    `json:"nalType"`
+	NalName    string `json:"nalName"`
+	IsKeyframe bool   `json:"isKeyframe"`
+	Hex        string `json:"hex,omitempty"`
+}
+
+// nalHexDumpSize 调试模式下每个 NAL 输出的字节数
+const nalHexDumpSize = 32
+
+// GetFrameNals 获取单帧包含的 NAL 单元摘要（调试用）
+// GET /api/v1/frame/{file_index}/{frame_idx}/nals?hex=true
+func (h *Handlers) GetFrameNals(ctx iris.Context) {
+	storage := h.dvr.GetStorage()
+	if storage == nil || !h.dvr.IsLoaded() {
+		writeError(ctx, errNotLoaded)
+		return
+	}
+
+	fileIndex := ctx.Params().GetIntDefault("file_index", 0)
+	frameIdx := ctx.Params().GetIntDefault("frame_idx", 0)
+	withHex, _ := ctx.URLParamBool("hex")
+
+	frames := storage.GetFrameIndex(fileIndex)
+	if frameIdx < 0 || frameIdx >= len(frames) {
+		writeError(ctx, errFrameNotFound)
+		return
+	}
+	frame := frames[frameIdx]
+
+	data, err := storage.ReadFrame(fileIndex, frame)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	nals := seetong.ParseNalUnits(data)
+	summaries := make([]NalSummary, 0, len(nals))
+	for _, nal := range nals {
+		summary := NalSummary{
+			Offset:     nal.Offset,
+			Size:       nal.Size,
+			NalType:    nal.NalType,
+			NalName:    seetong.NalTypeName(nal.NalType),
+			IsKeyframe: seetong.IsKeyframe(nal.NalType),
+		}
+		if withHex {
+			end := nal.Offset + nal.Size
+			if end > nal.Offset+nalHexDumpSize {
+				end = nal.Offset + nalHexDumpSize
+			}
+			summary.Hex = hex.EncodeToString(data[nal.Offset:end])
+		}
+		summaries = append(summaries, summary)
+	}
+
+	ctx.JSON(iris.Map{
+		"fileIndex":  fileIndex,
+		"frameIndex": frameIdx,
+		"channel":    frame.Channel,
+		"frameType":  frame.FrameType,
+		"fileOffset": frame.FileOffset,
+		"frameSize":  frame.FrameSize,
+		"reserved":   hex.EncodeToString(frame.Reserved[:]),
+		"nals":       summaries,
+	})
+}
+
+// GetFrameRaw 获取单帧的 Annex B 数据，可直接交给解码器（如 WASM HEVC 解码器）
+// GET /api/v1/frame/{file_index}/{frame_idx}/raw
+//
+// I 帧前补齐 VPS/SPS/PPS（帧数据本身已带参数集时不重复添加）；
+// P 帧无法单独解码，返回 409 并在 iFrameIndex 中给出覆盖该帧的 I 帧序号
+func (h *Handlers) GetFrameRaw(ctx iris.Context) {
+	storage := h.dvr.GetStorage()
+	if storage == nil || !h.dvr.IsLoaded() {
+		writeError(ctx, errNotLoaded)
+		return
+	}
+
+	fileIndex := ctx.Params().GetIntDefault("file_index", 0)
+	frameIdx := ctx.Params().GetIntDefault("frame_idx", 0)
+
+	frames := storage.GetFrameIndex(fileIndex)
+	if frameIdx < 0 || frameIdx >= len(frames) {
+		writeError(ctx, errFrameNotFound)
+		return
+	}
+	frame := frames[frameIdx]
+	if frame.Channel == seetong.ChannelAudio {
+		writeError(ctx, errInvalidParam("不是视频帧", "not a video frame"))
+		return
+	}
+
+	if !frame.IsIFrame() {
+		var covering *int
+		for i := frameIdx - 1; i >= 0; i-- {
+			if frames[i].Channel == frame.Channel && frames[i].IsIFrame() {
+				covering = &i
+				break
+			}
+		}
+		ctx.StatusCode(errNotKeyframe.Code)
+		ctx.JSON(struct {
+			*APIError
+			IFrameIndex *int `json:"iFrameIndex,omitempty"`
+		}{errNotKeyframe, covering})
+		return
+	}
+
+	data, err := storage.ReadFrame(fileIndex, frame)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	hasParamSets := false
+	for _, nal := range seetong.ParseNalUnits(data) {
+		if nal.NalType == seetong.NalVPS {
+			hasParamSets = true
+			break
+		}
+	}
+
+	var out []byte
+	if !hasParamSets {
+		header := storage.ReadVideoHeader(fileIndex, int64(frame.FileOffset))
+		if header == nil {
+			writeError(ctx, errNoVideoHeader)
+			return
+		}
+		for _, ps := range [][]byte{header.VPS, header.SPS, header.PPS} {
+			out = append(out, seetong.NalStartCode4...)
+			out = append(out, ps...)
+		}
+	}
+	if !bytes.HasPrefix(data, seetong.NalStartCode3) && !bytes.HasPrefix(data, seetong.NalStartCode4) {
+		out = append(out, seetong.NalStartCode4...)
+	}
+	out = append(out, data...)
+
+	ctx.ContentType("video/H265")
+	ctx.Header("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="frame_%d_%d.h265"`, fileIndex, frameIdx))
+	ctx.Write(out)
+}
+
+// 批量获取帧的数量限制
+const (
+	defaultFrameBatch = 25
+	maxFrameBatch     = 250
+)
+
+// frameBatchHeaderSize 批量帧每帧的头部大小
+// 帧序号(4) + 时间戳毫秒(8) + 帧类型(1) + 长度(4)
+const frameBatchHeaderSize = 17
+
+// GetFramesBatch 批量获取一个通道的连续视频帧，供客户端预取
+// GET /api/v1/frames/{file_index}?channel=<n>&start=<n>&count=<n>
+// GET /api/v1/frames/{file_index}?channel=<n>&from_ts=<unix>&to_ts=<unix>
+//
+// start 为该通道视频帧（按时间排序）中的位置；也可以用 from_ts/to_ts（秒，可带小数）按时间窗口获取，
+// 两种方式不能混用，每次最多返回 maxFrameBatch 帧。
+// 响应为连续的帧：帧序号(4，与 /frame/{file_index}/{frame_idx} 一致) + 时间戳毫秒(8)
+// + 帧类型(1，1=I 帧 3=P 帧) + 长度(4) + 帧数据，均为大端。
+// X-Frame-Start、X-Frame-Count、X-Frame-Total 给出本批在视频帧中的位置、帧数和总帧数，
+// 时间窗口超过上限时从 X-Frame-Start + X-Frame-Count 继续按 start 获取
+func (h *Handlers) GetFramesBatch(ctx iris.Context) {
+	storage := h.dvr.GetStorage()
+	if storage == nil || !h.dvr.IsLoaded() {
+		writeError(ctx, errNotLoaded)
+		return
+	}
+
+	fileIndex := ctx.Params().GetIntDefault("file_index", 0)
+	seg := storage.GetSegmentByFileIndex(fileIndex)
+	if seg == nil {
+		writeError(ctx, errSegmentNotFound)
+		return
+	}
+
+	channel := ctx.URLParamIntDefault("channel", seg.Channel)
+	frameChannel := uint32(frameChannelFor(channel))
+
+	records := storage.GetFrameIndex(fileIndex)
+	timeline := newMediaTimeline(records, frameChannel)
+	var video []int // 视频帧在 records 中的序号
+	for i, f := range records {
+		if f.Channel == frameChannel {
+			video = append(video, i)
+		}
+	}
+
+	byTime := ctx.URLParamExists("from_ts") || ctx.URLParamExists("to_ts")
+	if byTime && (ctx.URLParamExists("start") || ctx.URLParamExists("count")) {
+		writeError(ctx, errInvalidParam("start/count 不能与 from_ts/to_ts 同时使用", "start/count cannot be combined with from_ts/to_ts"))
+		return
+	}
+
+	var start, end int
+	if byTime {
+		fromTs, err1 := ctx.URLParamFloat64("from_ts")
+		toTs, err2 := ctx.URLParamFloat64("to_ts")
+		if err1 != nil || err2 != nil || fromTs >= toTs {
+			writeError(ctx, errInvalidParam("from_ts/to_ts 无效，需要 from_ts < to_ts", "invalid from_ts/to_ts, need from_ts < to_ts"))
+			return
+		}
+		fromMs, toMs := int64(fromTs*1000), int64(toTs*1000)
+		start = sort.Search(len(video), func(i int) bool { return timeline.timeMs(records[video[i]]) >= fromMs })
+		end = sort.Search(len(video), func(i int) bool { return timeline.timeMs(records[video[i]]) >= toMs })
+		if end-start > maxFrameBatch {
+			end = start + maxFrameBatch
+		}
+	} else {
+		var err error
+		if start, err = strconv.Atoi(ctx.URLParamDefault("start", "0")); err != nil || start < 0 {
+			writeError(ctx, errInvalidParam("start 必须是非负整数", "start must be a non-negative integer"))
+			return
+		}
+		count, err := strconv.Atoi(ctx.URLParamDefault("count", strconv.Itoa(defaultFrameBatch)))
+		if err != nil || count <= 0 || count > maxFrameBatch {
+			writeError(ctx, errInvalidParam(fmt.Sprintf("count 必须在 1~%d 之间", maxFrameBatch),
+				fmt.Sprintf("count must be between 1 and %d", maxFrameBatch)))
+			return
+		}
+		if start > len(video) {
+			writeError(ctx, errFrameNotFound)
+			return
+		}
+		end = start + count
+		if end > len(video) {
+			end = len(video)
+		}
+	}
+
+	var out bytes.Buffer
+	var buf []byte
+	defer func() { seetong.PutFrameBuffer(buf) }()
+	header := make([]byte, frameBatchHeaderSize)
+	for _, idx := range video[start:end] {
+		frame := records[idx]
+		var err error
+		if buf, err = storage.ReadFrameInto(fileIndex, frame, buf); err != nil {
+			writeError(ctx, err)
+			return
+		}
+		putFrameBatchHeader(header, idx, timeline.timeMs(frame), frame.FrameType, len(buf))
+		out.Write(header)
+		out.Write(buf)
+	}
+
+	ctx.ContentType("application/octet-stream")
+	ctx.Header("X-Frame-Start", strconv.Itoa(start))
+	ctx.Header("X-Frame-Count", strconv.Itoa(end-start))
+	ctx.Header("X-Frame-Total", strconv.Itoa(len(video)))
+	ctx.Write(out.Bytes())
+}
+
+// putFrameBatchHeader 写入批量帧的帧头（帧序号、时间戳毫秒、帧类型、长度）
+func putFrameBatchHeader(header []byte, idx int, timeMs int64, frameType uint32, size int) {
+	binary.BigEndian.PutUint32(header[0:4], uint32(idx))
+	binary.BigEndian.PutUint64(header[4:12], uint64(timeMs))
+	header[12] = byte(frameType)
+	binary.BigEndian.PutUint32(header[13:17], uint32(size))
+}
+
+// SeekByPosition 按段落内相对位置（0~1）查找前一个 I 帧
+// GET /api/v1/seek/{file_index}?pos=<0..1>&channel=<n>
+func (h *Handlers) SeekByPosition(ctx iris.Context) {
+	storage := h.dvr.GetStorage()
+	if storage == nil || !h.dvr.IsLoaded() {
+		writeError(ctx, errNotLoaded)
+		return
+	}
+
+	fileIndex := ctx.Params().GetIntDefault("file_index", 0)
+	seg := storage.GetSegmentByFileIndex(fileIndex)
+	if seg == nil {
+		writeError(ctx, errSegmentNotFound)
+		return
+	}
+
+	pos, err := ctx.URLParamFloat64("pos")
+	if err != nil || math.IsNaN(pos) || math.IsInf(pos, 0) {
+		writeError(ctx, errInvalidParam("无效的 pos 参数", "invalid pos parameter"))
+		return
+	}
+	// 超出范围时取边界
+	if pos < 0 {
+		pos = 0
+	} else if pos > 1 {
+		pos = 1
+	}
+
+	channel := ctx.URLParamIntDefault("channel", seg.Channel)
+	frameChannel := uint32(frameChannelFor(channel))
+	targetTime := seg.StartTime + int64(pos*float64(seg.EndTime-seg.StartTime))
+
+	// 查找目标时间之前最近的 I 帧，目标早于首个 I 帧时取首个 I 帧
+	frames := storage.GetFrameIndex(fileIndex)
+	bestIdx := -1
+	for i, f := range frames {
+		if f.Channel != frameChannel || !f.IsIFrame() {
+			continue
+		}
+		if int64(f.UnixTs) <= targetTime || bestIdx < 0 {
+			bestIdx = i
+		}
+		if int64(f.UnixTs) > targetTime {
+			break
+		}
+	}
+
+	if bestIdx < 0 {
+		writeError(ctx, errNoIFrame)
+		return
+	}
+	frame := frames[bestIdx]
+
+	ctx.JSON(iris.Map{
+		"fileIndex":   fileIndex,
+		"pos":         pos,
+		"targetTime":  targetTime,
+		"frameIndex":  bestIdx,
+		"timestamp":   frame.UnixTs,
+		"timestampUs": frame.TimestampUs,
+		"fileOffset":  frame.FileOffset,
+	})
+}
+
+// KeyframeInfo I 帧位置
+type KeyframeInfo struct {
+	FrameIndex int    `json:"frameIndex"`
+	UnixTs     uint32 `json:"unixTs"`
+	FileOffset uint32 `json:"fileOffset"`
+	FrameSize  uint32 `json:"frameSize"`
+}
+
+// GetKeyframes 获取段落的 I 帧索引（按时间排序），供客户端自行对齐 seek
+// GET /api/v1/keyframes/{file_index}?channel=<n>
+func (h *Handlers) GetKeyframes(ctx iris.Context) {
+	storage := h.dvr.GetStorage()
+	if storage == nil || !h.dvr.IsLoaded() {
+		writeError(ctx, errNotLoaded)
+		return
+	}
+
+	fileIndex := ctx.Params().GetIntDefault("file_index", 0)
+	seg := storage.GetSegmentByFileIndex(fileIndex)
+	if seg == nil {
+		writeError(ctx, errSegmentNotFound)
+		return
+	}
+
+	channel := ctx.URLParamIntDefault("channel", seg.Channel)
+	frameChannel := uint32(frameChannelFor(channel))
+
+	// 帧索引已按时间排序，frameIndex 与 /frame/{file_index}/{frame_idx} 一致
+	keyframes := []KeyframeInfo{}
+	for i, f := range storage.GetFrameIndex(fileIndex) {
+		if f.Channel != frameChannel || !f.IsIFrame() {
+			continue
+		}
+		keyframes = append(keyframes, KeyframeInfo{
+			FrameIndex: i,
+			UnixTs:     f.UnixTs,
+			FileOffset: f.FileOffset,
+			FrameSize:  f.FrameSize,
+		})
+	}
+
+	ctx.JSON(iris.Map{
+		"fileIndex": fileIndex,
+		"channel":   channel,
+		"startTime": seg.StartTime,
+		"endTime":   seg.EndTime,
+		"keyframes": keyframes,
+	})
+}
+
+// GOPFrame GOP 中的一帧
+type GOPFrame struct {
+	FrameIndex  int    `json:"frameIndex"`
+	FrameType   uint32 `json:"frameType"`
+	TimestampMs int64  `json:"timestampMs"`
+	FileOffset  uint32 `json:"fileOffset"`
+	FrameSize   uint32 `json:"frameSize"`
+	Reserved    string `json:"reserved"` // 帧索引条目的保留字节（十六进制）
+}
+
+// GetGOP 获取覆盖指定时间的 GOP：ts 所在或之前的 I 帧，以及到下一个 I 帧之前的所有帧
+// GET /api/v1/gop/{file_index}?ts=<unix>&channel=<n>
+//
+// ts 为秒，可带小数。依次获取 keyframe 和 frames 中的帧（如 /frame/{file_index}/{frame_idx}/raw）
+// 即可独立解码这一个 GOP；段落最后一个 GOP 后面没有 I 帧，nextKeyframeIndex 为 -1
+func (h *Handlers) GetGOP(ctx iris.Context) {
+	storage := h.dvr.GetStorage()
+	if storage == nil || !h.dvr.IsLoaded() {
+		writeError(ctx, errNotLoaded)
+		return
+	}
+
+	fileIndex := ctx.Params().GetIntDefault("file_index", 0)
+	seg := storage.GetSegmentByFileIndex(fileIndex)
+	if seg == nil {
+		writeError(ctx, errSegmentNotFound)
+		return
+	}
+	ts, err := ctx.URLParamFloat64("ts")
+	if err != nil {
+		writeError(ctx, errInvalidParam("缺少或无效的 ts 参数", "missing or invalid ts parameter"))
+		return
+	}
+	tsMs := int64(ts * 1000)
+
+	channel := ctx.URLParamIntDefault("channel", seg.Channel)
+	frameChannel := uint32(frameChannelFor(channel))
+	records := storage.GetFrameIndex(fileIndex)
+	timeline := newMediaTimeline(records, frameChannel)
+	var video []int // 视频帧在 records 中的序号
+	for i, f := range records {
+		if f.Channel == frameChannel {
+			video = append(video, i)
+		}
+	}
+	if len(video) == 0 {
+		writeError(ctx, errNoVideoFrames)
+		return
+	}
+
+	// ts 之前（含）最后一个 I 帧
+	key := -1
+	for i, idx := range video {
+		if timeline.timeMs(records[idx]) > tsMs {
+			break
+		}
+		if records[idx].IsIFrame() {
+			key = i
+		}
+	}
+	if key < 0 {
+		writeError(ctx, errNoIFrame.WithDetail("ts 早于段落的第一个 I 帧"))
+		return
+	}
+
+	gopFrame := func(idx int) GOPFrame {
+		f := records[idx]
+		return GOPFrame{
+			FrameIndex:  idx,
+			FrameType:   f.FrameType,
+			TimestampMs: timeline.timeMs(f),
+			FileOffset:  f.FileOffset,
+			FrameSize:   f.FrameSize,
+			Reserved:    hex.EncodeToString(f.Reserved[:]),
+		}
+	}
+	keyframe := gopFrame(video[key])
+	frames := []GOPFrame{}
+	totalBytes := int64(keyframe.FrameSize)
+	next := -1
+	for _, idx := range video[key+1:] {
+		if records[idx].IsIFrame() {
+			next = idx
+			break
+		}
+		frames = append(frames, gopFrame(idx))
+		totalBytes += int64(records[idx].FrameSize)
+	}
+
+	// 时长到下一个 I 帧为止；最后一个 GOP 到最后一帧为止
+	endMs := keyframe.TimestampMs
+	if next >= 0 {
+		endMs = timeline.timeMs(records[next])
+	} else if len(frames) > 0 {
+		endMs = frames[len(frames)-1].TimestampMs
+	}
+
+	ctx.JSON(iris.Map{
+		"fileIndex":         fileIndex,
+		"channel":           channel,
+		"keyframe":          keyframe,
+		"frames":            frames,
+		"frameCount":        len(frames) + 1,
+		"totalBytes":        totalBytes,
+		"durationMs":        endMs - keyframe.TimestampMs,
+		"nextKeyframeIndex": next,
+		"lastGop":           next < 0,
+	})
+}
+
+// GetSegmentStats 获取段落的 GOP 结构和码率统计
+// GET /api/v1/segment/{file_index}/stats
+func (h *Handlers) GetSegmentStats(ctx iris.Context) {
+	storage := h.dvr.GetStorage()
+	if storage == nil || !h.dvr.IsLoaded() {
+		writeError(ctx, errNotLoaded)
+		return
+	}
+
+	fileIndex := ctx.Params().GetIntDefault("file_index", 0)
+	cached := storage.GetCachedSegment(fileIndex)
+	if cached == nil {
+		writeError(ctx, errSegmentNotCached)
+		return
+	}
+
+	ctx.JSON(iris.Map{
+		"fileIndex": fileIndex,
+		"channel":   cached.Segment.Channel,
+		"startTime": cached.Segment.StartTime,
+		"endTime":   cached.Segment.EndTime,
+		"video":     cached.VideoStats,
+	})
+}
+
+// GetInitSegment 获取首个可解码 GOP（VPS/SPS/PPS + IDR）的二进制初始化段
+// 格式与 WebSocket 视频帧相同，客户端可在建立 WebSocket 前初始化解码器
+// GET /api/v1/init/{file_index}?channel=<n>
+func (h *Handlers) GetInitSegment(ctx iris.Context) {
+	storage := h.dvr.GetStorage()
+	if storage == nil || !h.dvr.IsLoaded() {
+		writeError(ctx, errNotLoaded)
+		return
+	}
+
+	fileIndex := ctx.Params().GetIntDefault("file_index", 0)
+	seg := storage.GetSegmentByFileIndex(fileIndex)
+	if seg == nil {
+		writeError(ctx, errSegmentNotFound)
+		return
+	}
+	channel := ctx.URLParamIntDefault("channel", seg.Channel)
+
+	data, err := h.dvr.GetInitSegment(fileIndex, channel)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	ctx.ContentType("application/octet-stream")
+	ctx.Write(data)
+}
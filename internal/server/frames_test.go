@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"seetong-dvr/internal/config"
+)
+
+func TestSeekByPositionRejectsNonFinite(t *testing.T) {
+	_, srv := startFixtureServer(t, config.Default())
+	for _, tc := range []struct {
+		pos    string
+		status int
+	}{
+		{"NaN", http.StatusBadRequest},
+		{"Inf", http.StatusBadRequest},
+		{"-Inf", http.StatusBadRequest},
+		{"abc", http.StatusBadRequest},
+		{"0.5", http.StatusOK},
+		{"2", http.StatusOK}, // 超出范围时取边界
+	} {
+		resp, err := http.Get(srv.URL + "/api/v1/seek/0?pos=" + url.QueryEscape(tc.pos))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("pos=%s: status %d, want %d", tc.pos, resp.StatusCode, tc.status)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"seetong-dvr/internal/seetong"
+
+	"github.com/kataras/iris/v12"
+)
+
+// 帧序号编号方式
+const (
+	seqScopeFile    = "file"    // 整个文件的帧（音视频交错）统一编号
+	seqScopeChannel = "channel" // 每个通道单独编号
+)
+
+// 帧序号报告的数量限制
+const (
+	maxSeqReportItems = 1000 // gaps/duplicates 各自最多列出的条数
+	seqGapHeaderItems = 20   // X-Seq-Gaps 头部最多列出的缺口数
+)
+
+// SeqGap 帧序号中的一段缺失
+type SeqGap struct {
+	Channel    uint32 `json:"channel,omitempty"` // 按通道编号时为帧通道号
+	From       uint32 `json:"from"`              // 缺失的第一个序号
+	To         uint32 `json:"to"`                // 缺失的最后一个序号
+	Missing    uint32 `json:"missing"`
+	AfterFrame int    `json:"afterFrame"` // 缺口之前那一帧在帧索引中的位置
+}
+
+// SeqDuplicate 重复出现的帧序号
+type SeqDuplicate struct {
+	Channel uint32 `json:"channel,omitempty"`
+	Seq     uint32 `json:"seq"`
+	Frames  []int  `json:"frames"` // 带该序号的帧在帧索引中的位置
+}
+
+// SeqReport 帧序号范围的完整性报告
+type SeqReport struct {
+	FileIndex  int            `json:"fileIndex"`
+	Channel    *int           `json:"channel,omitempty"` // 只统计该通道的帧
+	Scope      string         `json:"scope"`             // file / channel，由整个文件的序号推断
+	FromSeq    uint32         `json:"fromSeq"`
+	ToSeq      uint32         `json:"toSeq"`
+	Frames     int            `json:"frames"` // 序号在范围内的帧数
+	FirstSeq   uint32         `json:"firstSeq"`
+	LastSeq    uint32         `json:"lastSeq"`
+	Missing    int64          `json:"missing"` // 首尾序号之间缺失的序号总数
+	Gaps       []SeqGap       `json:"gaps"`
+	Duplicates []SeqDuplicate `json:"duplicates"`
+	Truncated  bool           `json:"truncated,omitempty"` // gaps 或 duplicates 超过上限未全部列出
+}
+
+// detectSeqScope 推断帧序号的编号方式：统计相邻帧序号加一的次数，
+// 按文件顺序连续的多于按通道连续的时视为整个文件统一编号
+func detectSeqScope(records []seetong.FrameIndexRecord) string {
+	fileSteps, channelSteps := 0, 0
+	last := make(map[uint32]uint32)
+	for i, r := range records {
+		if i > 0 && r.FrameSeq == records[i-1].FrameSeq+1 {
+			fileSteps++
+		}
+		if prev, ok := last[r.Channel]; ok && r.FrameSeq == prev+1 {
+			channelSteps++
+		}
+		last[r.Channel] = r.FrameSeq
+	}
+	if channelSteps > fileSteps {
+		return seqScopeChannel
+	}
+	return seqScopeFile
+}
+
+// seqFrame 序号范围内的一帧
+type seqFrame struct {
+	pos    int // 在帧索引中的位置
+	record seetong.FrameIndexRecord
+}
+
+// analyzeSeq 统计 frames（按帧索引顺序）中的缺口和重复序号
+// 按通道编号时每个通道分别统计，只在已出现的首尾序号之间查找缺口
+func analyzeSeq(report *SeqReport, frames []seqFrame) {
+	groups := make(map[uint32][]seqFrame)
+	var keys []uint32
+	for _, f := range frames {
+		key := uint32(0)
+		if report.Scope == seqScopeChannel {
+			key = f.record.Channel
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], f)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	for _, key := range keys {
+		group := groups[key]
+		sort.SliceStable(group, func(i, j int) bool { return group[i].record.FrameSeq < group[j].record.FrameSeq })
+		for i := 1; i < len(group); i++ {
+			prev, cur := group[i-1], group[i]
+			switch {
+			case cur.record.FrameSeq == prev.record.FrameSeq:
+				n := len(report.Duplicates)
+				if n > 0 && report.Duplicates[n-1].Channel == key && report.Duplicates[n-1].Seq == cur.record.FrameSeq {
+					report.Duplicates[n-1].Frames = append(report.Duplicates[n-1].Frames, cur.pos)
+				} else if n < maxSeqReportItems {
+					report.Duplicates = append(report.Duplicates, SeqDuplicate{
+						Channel: key, Seq: cur.record.FrameSeq, Frames: []int{prev.pos, cur.pos},
+					})
+				} else {
+					report.Truncated = true
+				}
+			case cur.record.FrameSeq > prev.record.FrameSeq+1:
+				missing := cur.record.FrameSeq - prev.record.FrameSeq - 1
+				report.Missing += int64(missing)
+				if len(report.Gaps) < maxSeqReportItems {
+					report.Gaps = append(report.Gaps, SeqGap{
+						Channel:    key,
+						From:       prev.record.FrameSeq + 1,
+						To:         cur.record.FrameSeq - 1,
+						Missing:    missing,
+						AfterFrame: prev.pos,
+					})
+				} else {
+					report.Truncated = true
+				}
+			}
+		}
+	}
+}
+
+// GetFramesBySeq 按帧序号（FrameSeq）范围获取帧，并报告序号中的缺口和重复
+// GET /api/v1/frames/seq/{file_index}?from_seq=<n>&to_seq=<n>&channel=<n>&meta=true
+//
+// 用于排查丢帧/重复帧，也供按序号而不是时间跟踪帧的客户端使用。from_seq/to_seq 均包含在内，
+// 不带 channel 时包括所有通道（含音频）。编号方式（整个文件统一编号或每个通道单独编号）由
+// 整个文件的序号推断，缺口按该方式统计。
+// 默认返回与 /frames/{file_index} 相同格式的帧数据（帧序号字段为帧索引中的位置），每次最多
+// maxFrameBatch 帧，超出时 X-Seq-Next 给出下一次请求的 from_seq；X-Seq-Scope、X-Seq-Missing、
+// X-Seq-Duplicates 和 X-Seq-Gaps（最多 20 段，from-to）给出本批的统计。
+// meta=true 时只返回整个范围的 SeqReport（JSON），不读取帧数据
+func (h *Handlers) GetFramesBySeq(ctx iris.Context) {
+	storage := h.dvr.GetStorage()
+	if storage == nil || !h.dvr.IsLoaded() {
+		writeError(ctx, errNotLoaded)
+		return
+	}
+
+	fileIndex := ctx.Params().GetIntDefault("file_index", 0)
+	if storage.GetSegmentByFileIndex(fileIndex) == nil {
+		writeError(ctx, errSegmentNotFound)
+		return
+	}
+
+	fromSeq, err1 := strconv.ParseUint(ctx.URLParamDefault("from_seq", "0"), 10, 32)
+	toSeq, err2 := strconv.ParseUint(ctx.URLParamDefault("to_seq", strconv.FormatUint(math.MaxUint32, 10)), 10, 32)
+	if err1 != nil || err2 != nil || fromSeq > toSeq {
+		writeError(ctx, errInvalidParam("from_seq/to_seq 无效，需要 0 <= from_seq <= to_seq", "invalid from_seq/to_seq, need 0 <= from_seq <= to_seq"))
+		return
+	}
+	meta, _ := ctx.URLParamBool("meta")
+
+	records := storage.GetFrameIndex(fileIndex)
+	report := SeqReport{
+		FileIndex:  fileIndex,
+		Scope:      detectSeqScope(records),
+		FromSeq:    uint32(fromSeq),
+		ToSeq:      uint32(toSeq),
+		Gaps:       []SeqGap{},
+		Duplicates: []SeqDuplicate{},
+	}
+	var frameChannel uint32
+	if ctx.URLParamExists("channel") {
+		channel, err := ctx.URLParamInt("channel")
+		if err != nil {
+			writeError(ctx, errInvalidParam("无效的 channel 参数", "invalid channel parameter"))
+			return
+		}
+		report.Channel = &channel
+		frameChannel = uint32(frameChannelFor(channel))
+	}
+
+	// 帧索引顺序中序号在范围内的帧；整个文件统一编号时缺口要在所有通道的帧中查找
+	var inRange, selected []seqFrame
+	for i, r := range records {
+		if r.FrameSeq < report.FromSeq || r.FrameSeq > report.ToSeq {
+			continue
+		}
+		f := seqFrame{pos: i, record: r}
+		if report.Channel == nil || r.Channel == frameChannel {
+			selected = append(selected, f)
+		}
+		if report.Scope == seqScopeFile || report.Channel == nil || r.Channel == frameChannel {
+			inRange = append(inRange, f)
+		}
+	}
+
+	// 按序号返回，分批时从下一个序号继续不会遗漏或重复
+	sort.SliceStable(selected, func(i, j int) bool { return selected[i].record.FrameSeq < selected[j].record.FrameSeq })
+	next := -1
+	if !meta && len(selected) > maxFrameBatch {
+		next = int(selected[maxFrameBatch].record.FrameSeq)
+		selected = selected[:maxFrameBatch]
+		for len(selected) > 1 && int(selected[len(selected)-1].record.FrameSeq) == next {
+			selected = selected[:len(selected)-1] // 同一序号的重复帧放在同一批
+		}
+		if int(selected[0].record.FrameSeq) == next {
+			next++ // 同一序号的重复帧超过一批，跳过其余的
+		}
+		// 本批的统计只到最后返回的序号
+		last := selected[len(selected)-1].record.FrameSeq
+		trimmed := inRange[:0:0]
+		for _, f := range inRange {
+			if f.record.FrameSeq <= last {
+				trimmed = append(trimmed, f)
+			}
+		}
+		inRange = trimmed
+	}
+
+	report.Frames = len(selected)
+	if len(selected) > 0 {
+		report.FirstSeq = selected[0].record.FrameSeq
+		report.LastSeq = selected[len(selected)-1].record.FrameSeq
+	}
+	analyzeSeq(&report, inRange)
+
+	if meta {
+		ctx.JSON(report)
+		return
+	}
+
+	timeline := newMediaTimeline(records, frameChannel)
+	var out bytes.Buffer
+	var buf []byte
+	defer func() { seetong.PutFrameBuffer(buf) }()
+	header := make([]byte, frameBatchHeaderSize)
+	for _, f := range selected {
+		var err error
+		if buf, err = storage.ReadFrameInto(fileIndex, f.record, buf); err != nil {
+			writeError(ctx, err)
+			return
+		}
+		putFrameBatchHeader(header, f.pos, timeline.timeMs(f.record), f.record.FrameType, len(buf))
+		out.Write(header)
+		out.Write(buf)
+	}
+
+	gaps := make([]string, 0, seqGapHeaderItems)
+	for _, gap := range report.Gaps {
+		if len(gaps) == seqGapHeaderItems {
+			break
+		}
+		gaps = append(gaps, fmt.Sprintf("%d-%d", gap.From, gap.To))
+	}
+
+	ctx.ContentType("application/octet-stream")
+	ctx.Header("X-Frame-Count", strconv.Itoa(report.Frames))
+	ctx.Header("X-Seq-Scope", report.Scope)
+	ctx.Header("X-Seq-Missing", strconv.FormatInt(report.Missing, 10))
+	ctx.Header("X-Seq-Duplicates", strconv.Itoa(len(report.Duplicates)))
+	if len(gaps) > 0 {
+		ctx.Header("X-Seq-Gaps", strings.Join(gaps, ","))
+	}
+	if next >= 0 {
+		ctx.Header("X-Seq-Next", strconv.Itoa(next))
+	}
+	ctx.Write(out.Bytes())
+}
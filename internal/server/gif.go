@@ -0,0 +1,177 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"math"
+	"sort"
+	"strconv"
+
+	"seetong-dvr/internal/seetong"
+
+	"github.com/kataras/iris/v12"
+)
+
+// GIF 导出参数
+const (
+	gifDefaultSeconds = 5.0
+	gifMaxSeconds     = 60.0
+	gifDecodeSeconds  = 10.0 // 超过该时长（或 fps 不超过 1）时只解码 I 帧
+	gifDefaultFPS     = 2.0
+	gifMaxFPS         = 10.0
+	gifMaxFrames      = 60
+	gifDefaultWidth   = 320
+	gifMaxWidth       = 640
+	gifMaxBytes       = 8 << 20
+	gifKeyframeFPS    = mjpegKeyframeFPS
+	gifDelayPerSecond = 100 // GIF 帧延时单位为 1/100 秒
+)
+
+// ExportGIF 导出时间范围内的动画 GIF，用于在聊天/邮件中分享事件预览
+// GET /api/v1/gif/{file_index}?from=<unix>&to=<unix>&channel=<n>&fps=2&width=320
+//
+// from 默认段落开始，to 默认 from 之后 5 秒（不超过段落结束），支持小数秒。
+// 按 fps 在帧索引中取样：范围超过 10 秒或 fps 不超过 1 时取覆盖该时间的 I 帧，
+// 否则从 I 帧解码到该时间的帧；取样到同一帧时延长上一帧的显示时间。
+// 输出最多 60 帧、8MB，范围超过 60 秒或帧数超限时返回 400。需要 ffmpeg
+func (h *Handlers) ExportGIF(ctx iris.Context) {
+	storage := h.dvr.GetStorage()
+	if storage == nil || !h.dvr.IsLoaded() {
+		writeError(ctx, errNotLoaded)
+		return
+	}
+
+	fileIndex := ctx.Params().GetIntDefault("file_index", 0)
+	seg := storage.GetSegmentByFileIndex(fileIndex)
+	if seg == nil {
+		writeError(ctx, errSegmentNotFound)
+		return
+	}
+	channel := ctx.URLParamIntDefault("channel", seg.Channel)
+
+	from := ctx.URLParamFloat64Default("from", float64(seg.StartTime))
+	to := ctx.URLParamFloat64Default("to", math.Min(from+gifDefaultSeconds, float64(seg.EndTime)))
+	if to <= from {
+		writeError(ctx, errInvalidParam("to 必须大于 from", "to must be greater than from"))
+		return
+	}
+	if to-from > gifMaxSeconds {
+		writeError(ctx, errInvalidParam("时间范围过长，无法生成 GIF", "range too long for GIF").
+			WithDetail(fmt.Sprintf("max %g seconds, got %g", gifMaxSeconds, to-from)))
+		return
+	}
+
+	fps := gifDefaultFPS
+	if v := ctx.URLParam("fps"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 || f > gifMaxFPS {
+			writeError(ctx, errInvalidParam("无效的 fps 参数", "invalid fps parameter").
+				WithDetail(fmt.Sprintf("0 < fps <= %g", gifMaxFPS)))
+			return
+		}
+		fps = f
+	}
+	width := ctx.URLParamIntDefault("width", gifDefaultWidth)
+	if width < 16 || width > gifMaxWidth {
+		writeError(ctx, errInvalidParam("无效的 width 参数", "invalid width parameter").
+			WithDetail(fmt.Sprintf("16..%d", gifMaxWidth)))
+		return
+	}
+
+	fromMs := int64(math.Round(from * 1000))
+	toMs := int64(math.Round(to * 1000))
+	intervalMs := 1000 / fps
+	samples := int(math.Ceil(float64(toMs-fromMs) / intervalMs))
+	if samples > gifMaxFrames {
+		writeError(ctx, errInvalidParam("帧数过多，请降低 fps 或缩短时间范围", "too many frames, lower fps or shorten the range").
+			WithDetail(fmt.Sprintf("max %d frames, got %d", gifMaxFrames, samples)))
+		return
+	}
+
+	if ffmpegPath() == "" {
+		writeError(ctx, newAPIError(501, ReasonUnsupported, "GIF 导出需要 ffmpeg", "GIF export requires ffmpeg"))
+		return
+	}
+	if storage.GetRecFile(fileIndex) == "" {
+		writeError(ctx, errRecFileMissing)
+		return
+	}
+
+	timeline := newMediaTimeline(storage.GetFrameIndex(fileIndex), uint32(frameChannelFor(channel)))
+	video := timeline.video
+	if len(video) == 0 {
+		writeError(ctx, errNoVideoFrames)
+		return
+	}
+	keyOf, firstKey := keyframeMap(video)
+	if firstKey < 0 {
+		writeError(ctx, errNoIFrame)
+		return
+	}
+
+	// 每个取样时间对应的帧，相邻取样落在同一帧时合并为一个 GIF 帧
+	keyframeOnly := fps <= gifKeyframeFPS || to-from > gifDecodeSeconds
+	var targets, delays []int
+	for i := 0; i < samples; i++ {
+		posMs := fromMs + int64(float64(i)*intervalMs)
+		target := sort.Search(len(video), func(j int) bool { return timeline.timeMs(video[j]) > posMs }) - 1
+		if target < 0 || keyOf[target] < 0 {
+			target = firstKey
+		}
+		if keyframeOnly {
+			target = keyOf[target]
+		}
+		delay := int(math.Round(float64(gifDelayPerSecond) / fps))
+		if n := len(targets); n > 0 && targets[n-1] == target {
+			delays[n-1] += delay
+			continue
+		}
+		targets = append(targets, target)
+		delays = append(delays, delay)
+	}
+
+	reqCtx := ctx.Request().Context()
+	anim := &gif.GIF{LoopCount: 0}
+	for i, target := range targets {
+		img, err := decodeVideoFrame(reqCtx, storage, fileIndex, video, keyOf[target], target, width)
+		if reqCtx.Err() != nil {
+			return
+		}
+		if err != nil {
+			seetong.LogWarn("GIF 解码失败", "file_index", fileIndex, "offset", video[target].FileOffset, "error", err)
+			writeError(ctx, errParseFailure.WithDetail(err.Error()))
+			return
+		}
+		anim.Image = append(anim.Image, quantizeFrame(img))
+		anim.Delay = append(anim.Delay, delays[i])
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		writeError(ctx, newAPIError(500, ReasonReadFailure, "GIF 编码失败", "GIF encoding failed").WithDetail(err.Error()))
+		return
+	}
+	if buf.Len() > gifMaxBytes {
+		writeError(ctx, errInvalidParam("GIF 过大，请降低 fps、宽度或缩短时间范围", "GIF too large, lower fps or width, or shorten the range").
+			WithDetail(fmt.Sprintf("max %d bytes, got %d", gifMaxBytes, buf.Len())))
+		return
+	}
+
+	ctx.ContentType("image/gif")
+	ctx.Header("Content-Disposition",
+		fmt.Sprintf(`inline; filename="preview_%d_%d.gif"`, fileIndex, fromMs/1000))
+	ctx.Header("Content-Length", strconv.Itoa(buf.Len()))
+	ctx.Write(buf.Bytes())
+}
+
+// quantizeFrame 将解码帧量化为 256 色调色板（Floyd-Steinberg 抖动）
+func quantizeFrame(img image.Image) *image.Paletted {
+	bounds := img.Bounds()
+	dst := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), palette.Plan9)
+	draw.FloydSteinberg.Draw(dst, dst.Bounds(), img, bounds.Min)
+	return dst
+}
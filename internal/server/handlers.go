@@ -1,11 +1,22 @@
 package server
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"seetong-dvr/internal/config"
+	"seetong-dvr/internal/seetong"
+
+	"github.com/gorilla/websocket"
 	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
 )
 
 // DVRCache 单个路径的 DVR 缓存数据
@@ -25,16 +36,104 @@ type Handlers struct {
 
 	// 路径 -> DVRServer 缓存 Map
 	dvrCache map[string]*DVRCache
+
+	// 运行时配置（存储路径、时区、路径历史会持久化）
+	cfg *config.Store
+
+	// 所有 WebSocket 会话共享的流配额
+	streams *streamLimiter
+
+	// WebSocket 断线重连令牌
+	reconnect *reconnectStore
+
+	// 目录版本（切换 DVR 路径后继续递增）
+	catalog *catalogTracker
+
+	// WebSocket 升级（缓冲大小和压缩按启动时的配置）
+	upgrader *websocket.Upgrader
+
+	// 音视频同步检测
+	avSync avSyncSettings
+
+	// 播放书签（按 DVR 路径持久化）
+	bookmarks *bookmarkStore
+}
+
+// avSyncSettings 音视频同步检测配置
+type avSyncSettings struct {
+	thresholdMs  int64 // 漂移阈值，0 表示不检测
+	correct      bool  // 超过阈值时丢弃/推迟音频帧
+	paceMaxLagMs int   // 发送落后超过此值时重新对齐，避免突发
 }
 
 const maxPathHistory = 10
 
 // NewHandlers 创建处理器
-func NewHandlers(dvr *DVRServer) *Handlers {
+func NewHandlers(dvr *DVRServer, cfg *config.Store) *Handlers {
+	c := cfg.Get()
+	pathHistory := c.PathHistory
+	if pathHistory == nil {
+		pathHistory = []string{}
+	}
 	return &Handlers{
 		dvr:         dvr,
-		pathHistory: []string{},
+		pathHistory: pathHistory,
 		dvrCache:    make(map[string]*DVRCache),
+		cfg:         cfg,
+		streams: newStreamLimiter(StreamLimits{
+			MaxStreams:          c.MaxStreams,
+			MaxStreamsPerClient: c.MaxStreamsPerClient,
+			MaxSpeed:            c.MaxSpeed,
+		}),
+		reconnect: newReconnectStore(time.Duration(c.ReconnectTTLSec) * time.Second),
+		upgrader:  newUpgrader(c),
+		catalog:   newCatalogTracker(time.Now().UnixMilli()),
+		avSync: avSyncSettings{
+			thresholdMs:  int64(c.AVSyncThresholdMs),
+			correct:      c.AVSyncCorrect,
+			paceMaxLagMs: c.PaceMaxLagMs,
+		},
+		bookmarks: newBookmarkStore(bookmarkDir(cfg)),
+	}
+}
+
+// bookmarkDir 书签目录：与配置文件同目录，不持久化配置时使用索引缓存目录
+func bookmarkDir(cfg *config.Store) string {
+	if cfg.Path() != "" {
+		return filepath.Dir(cfg.Path())
+	}
+	return seetong.GetCacheDir()
+}
+
+// newDVRServer 按当前配置创建 DVR 服务器
+func (h *Handlers) newDVRServer(dvrPath string) *DVRServer {
+	dvr := NewDVRServer(dvrPath)
+	dvr.SetWorkers(h.cfg.Get().Workers)
+	dvr.SetCacheOrder(h.cfg.Get().CacheOrder)
+	dvr.SetCacheDays(h.cfg.Get().CacheDays)
+	return dvr
+}
+
+// getDVR 获取当前 DVR（线程安全），长时间运行的处理器（SSE 等）用它取得切换路径前后一致的实例
+func (h *Handlers) getDVR() *DVRServer {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.dvr
+}
+
+// persistConfig 持久化运行时可修改的配置
+func (h *Handlers) persistConfig() {
+	h.mu.RLock()
+	pathHistory := append([]string(nil), h.pathHistory...)
+	h.mu.RUnlock()
+
+	err := h.cfg.Update(func(c *config.Config) {
+		c.DVRPath = h.dvr.GetDVRPath()
+		c.Timezone = h.dvr.GetTimezone()
+		c.PathHistory = pathHistory
+	})
+	if err != nil {
+		fmt.Printf("[Config] 保存配置失败: %v\n", err)
 	}
 }
 
@@ -90,6 +189,7 @@ func (h *Handlers) GetConfig(ctx iris.Context) {
 		result["entryCount"] = cfg.EntryCount
 		result["fileCount"] = cfg.FileCount
 		result["cacheStatus"] = h.dvr.GetCacheStatus()
+		result["catalogVersion"], _, _ = h.catalogVersion()
 	}
 
 	ctx.JSON(result)
@@ -103,11 +203,34 @@ func (h *Handlers) SetConfig(ctx iris.Context) {
 		Timezone    string `json:"timezone"`
 	}
 
-	if err := ctx.ReadJSON(&req); err != nil {
-		ctx.StatusCode(400)
-		ctx.JSON(iris.Map{"error": "无效的 JSON"})
+	body, err := ctx.GetBody()
+	switch {
+	case err != nil:
+	case len(body) == 0:
+		err = io.EOF
+	default:
+		err = json.Unmarshal(body, &req)
+	}
+	if err != nil {
+		writeError(ctx, errInvalidJSON(err))
 		return
 	}
+	req.StoragePath = config.NormalizeDVRPath(req.StoragePath)
+
+	// 先校验全部字段，任何一项无效都不修改当前配置
+	if req.Timezone != "" {
+		if _, err := h.dvr.getClock().LoadLocation(req.Timezone); err != nil {
+			writeError(ctx, errInvalidParam("无效的时区", "invalid timezone").
+				WithField("timezone", req.Timezone).WithDetail(err.Error()))
+			return
+		}
+	}
+	if req.StoragePath != "" {
+		if apiErr := validateStoragePath(req.StoragePath); apiErr != nil {
+			writeError(ctx, apiErr)
+			return
+		}
+	}
 
 	result := iris.Map{
 		"timezone": h.dvr.GetTimezone(),
@@ -115,11 +238,7 @@ func (h *Handlers) SetConfig(ctx iris.Context) {
 
 	// 更新时区
 	if req.Timezone != "" {
-		if err := h.dvr.SetTimezone(req.Timezone); err != nil {
-			ctx.StatusCode(400)
-			ctx.JSON(iris.Map{"error": "无效的时区: " + req.Timezone})
-			return
-		}
+		h.dvr.SetTimezone(req.Timezone)
 		result["timezone"] = req.Timezone
 	}
 
@@ -144,11 +263,12 @@ func (h *Handlers) SetConfig(ctx iris.Context) {
 
 		if cached, ok := h.dvrCache[req.StoragePath]; ok {
 			// 创建临时 DVR 来获取当前文件系统的 hash
-			tempDvr := NewDVRServer(req.StoragePath)
+			tempDvr := h.newDVRServer(req.StoragePath)
 			if err := tempDvr.Load(); err == nil {
 				currentHash := computeDVRHash(tempDvr)
 				if currentHash == cached.hash {
 					// Hash 一致，使用缓存
+					tempDvr.Close()
 					newDvr = cached.dvr
 					fromCache = true
 					// 从缓存中移除（因为即将成为当前 DVR）
@@ -159,33 +279,28 @@ func (h *Handlers) SetConfig(ctx iris.Context) {
 				}
 			} else {
 				h.mu.Unlock()
-				ctx.StatusCode(400)
-				ctx.JSON(iris.Map{
-					"storagePath": req.StoragePath,
-					"loaded":      false,
-					"error":       "无法加载指定路径的 DVR 数据",
-				})
+				writeLoadError(ctx, req.StoragePath, err)
 				return
 			}
 		} else {
 			// 缓存中没有，需要新加载
-			newDvr = NewDVRServer(req.StoragePath)
+			newDvr = h.newDVRServer(req.StoragePath)
 			if err := newDvr.Load(); err != nil {
 				h.mu.Unlock()
-				ctx.StatusCode(400)
-				ctx.JSON(iris.Map{
-					"storagePath": req.StoragePath,
-					"loaded":      false,
-					"error":       "无法加载指定路径的 DVR 数据",
-				})
+				writeLoadError(ctx, req.StoragePath, err)
 				return
 			}
 		}
 
-		// 替换当前实例（不关闭旧的，因为已经缓存了）
+		// 替换当前实例（不关闭旧的，因为已经缓存了），沿用当前时区和时间来源
+		newDvr.SetClock(h.dvr.getClock())
+		newDvr.SetTimezone(h.dvr.GetTimezone())
 		h.dvr = newDvr
 		h.mu.Unlock()
 
+		// 新路径可能包含缓存目录（如在 DVR 盘上运行），构建缓存前检查
+		seetong.SetCacheDir(seetong.CacheDirOutside(h.cfg.Get().CacheDir, req.StoragePath))
+
 		// 添加到路径历史
 		h.addToPathHistory(req.StoragePath)
 
@@ -215,17 +330,91 @@ func (h *Handlers) SetConfig(ctx iris.Context) {
 		}
 	}
 
+	if req.StoragePath != "" || req.Timezone != "" {
+		h.persistConfig()
+	}
+
 	ctx.JSON(result)
 }
 
+// validateStoragePath 检查提交的 DVR 路径存在且包含主索引，在替换当前 DVR 之前调用
+func validateStoragePath(path string) *APIError {
+	if _, err := seetong.FindIndexSources(path); err == nil {
+		return nil
+	}
+	if _, err := seetong.CurrentStorage().Stat(path); err != nil {
+		return errInvalidParam("存储路径不存在", "storage path does not exist").
+			WithField("storagePath", path).WithDetail(err.Error())
+	}
+	return errInvalidParam("存储路径中没有 TIndex00.tps", "storage path contains no TIndex00.tps").
+		WithField("storagePath", path)
+}
+
 // GetCacheStatus 获取缓存构建状态
 // GET /api/v1/cache/status
 func (h *Handlers) GetCacheStatus(ctx iris.Context) {
 	ctx.JSON(h.dvr.GetCacheStatus())
 }
 
+// CancelCacheBuild 取消正在进行的缓存构建，已缓存的段落保留
+// POST /api/v1/cache/cancel
+// 等待工作线程完成当前段落后返回；没有正在进行的构建时 cancelled 为 false
+func (h *Handlers) CancelCacheBuild(ctx iris.Context) {
+	cancelled, completed := h.dvr.CancelCacheBuild()
+	ctx.JSON(iris.Map{
+		"cancelled":   cancelled,
+		"completed":   completed,
+		"cacheStatus": h.dvr.GetCacheStatus(),
+	})
+}
+
+// GetCacheEvents 缓存构建进度 SSE 流
+// 每完成一个段落推送一次 progress 事件，构建结束时推送 done（取消时为 cancelled）事件并关闭
+// GET /api/v1/cache/events
+func (h *Handlers) GetCacheEvents(ctx iris.Context) {
+	dvr := h.getDVR()
+	events, unsubscribe := dvr.SubscribeCacheEvents()
+	defer unsubscribe()
+
+	ctx.ContentType("text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+
+	writeEvent := func(event CacheEvent) {
+		data, _ := json.Marshal(event)
+		fmt.Fprintf(ctx, "event: %s\ndata: %s\n\n", event.Type, data)
+		ctx.ResponseWriter().Flush()
+	}
+
+	// 先订阅再检查状态，避免错过 done 事件
+	status := dvr.GetCacheStatus()
+	if status.Status != "building" {
+		writeEvent(CacheEvent{
+			Type:     "done",
+			Progress: status.Progress,
+			Current:  status.Current,
+			Total:    status.Total,
+			Cached:   status.Cached,
+		})
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Request().Context().Done():
+			return
+		case event := <-events:
+			writeEvent(event)
+			if event.terminal() {
+				return
+			}
+		}
+	}
+}
+
 // GetDates 获取有录像的日期列表
 // GET /api/v1/recordings/dates
+// 不带 channel 时只统计视频通道（配置 channelKinds 中的 audio/hidden 通道不计）
 func (h *Handlers) GetDates(ctx iris.Context) {
 	channelStr := ctx.URLParam("channel")
 	var channel *int
@@ -234,7 +423,30 @@ func (h *Handlers) GetDates(ctx iris.Context) {
 		channel = &ch
 	}
 
-	datesMap := h.dvr.GetRecordingDates(channel)
+	kinds := channelKinds(h.cfg.Get().ChannelKinds)
+	channels := listedChannels(h.dvr.GetChannels(), kinds)
+	if summary, _ := ctx.URLParamBool("summary"); summary || ctx.URLParamExists("year") || ctx.URLParamExists("month") {
+		selected := make(map[int]bool)
+		if channel != nil {
+			selected[*channel] = true
+		} else {
+			for _, ch := range channels {
+				selected[ch] = true
+			}
+		}
+		h.getDateCalendar(ctx, selected, channels)
+		return
+	}
+	datesMap := make(map[string]bool)
+	if channel != nil {
+		datesMap = h.dvr.GetRecordingDates(channel)
+	} else {
+		for _, ch := range channels {
+			for d := range h.dvr.GetRecordingDates(&ch) {
+				datesMap[d] = true
+			}
+		}
+	}
 
 	// 转换为排序的列表
 	dates := make([]string, 0, len(datesMap))
@@ -245,17 +457,21 @@ func (h *Handlers) GetDates(ctx iris.Context) {
 
 	ctx.JSON(iris.Map{
 		"dates":    dates,
-		"channels": h.dvr.GetChannels(),
+		"channels": channels,
 	})
 }
 
 // GetRecordings 获取指定日期的录像列表
-// GET /api/v1/recordings
+// GET /api/v1/recordings?date=2024-01-01&channel=1&merge=true&gap=5&precision=ms
+// merge=true 时将间隔不超过 gap 秒的相邻录像合并为连续块
 func (h *Handlers) GetRecordings(ctx iris.Context) {
 	date := ctx.URLParam("date")
 	if date == "" {
-		ctx.StatusCode(400)
-		ctx.JSON(iris.Map{"error": "缺少 date 参数"})
+		writeError(ctx, errInvalidParam("缺少 date 参数", "missing date parameter"))
+		return
+	}
+	ms, ok := msPrecision(ctx)
+	if !ok {
 		return
 	}
 
@@ -266,26 +482,220 @@ func (h *Handlers) GetRecordings(ctx iris.Context) {
 		channel = &ch
 	}
 
+	pending := h.dvr.RequestDateCache(date, channel)
 	recordings := h.dvr.GetRecordings(date, channel)
+	if channel == nil {
+		recordings = listedRecordings(recordings, channelKinds(h.cfg.Get().ChannelKinds))
+	}
+	if merge, _ := ctx.URLParamBool("merge"); merge {
+		gap := ctx.URLParamInt64Default("gap", DefaultMergeGap)
+		recordings = MergeRecordings(recordings, gap)
+	}
 	if recordings == nil {
 		recordings = []RecordingInfo{}
 	}
+	if ms {
+		h.dvr.withMilliseconds(recordings, recordingTimeLayout)
+	}
+
+	ctx.JSON(iris.Map{"recordings": recordings, "pending": pending})
+}
+
+// GetLatestRecordings 最近的录像（按实际时间，不受循环覆盖影响）
+// GET /api/v1/recordings/latest?n=10&channel=1
+// start/end 带日期（最近的录像可能跨天）
+func (h *Handlers) GetLatestRecordings(ctx iris.Context) {
+	n := ctx.URLParamIntDefault("n", DefaultLatestRecordings)
+	if n <= 0 {
+		writeError(ctx, errInvalidParam("n 必须大于 0", "n must be positive"))
+		return
+	}
+	ms, ok := msPrecision(ctx)
+	if !ok {
+		return
+	}
+	var channel *int
+	if ctx.URLParamExists("channel") {
+		ch := ctx.URLParamIntDefault("channel", 0)
+		channel = &ch
+	}
 
+	recordings := h.dvr.GetLatestRecordings(n, channel)
+	if recordings == nil {
+		recordings = []RecordingInfo{}
+	}
+	if ms {
+		h.dvr.withMilliseconds(recordings, recordingDateTimeLayout)
+	}
 	ctx.JSON(iris.Map{"recordings": recordings})
 }
 
+// msPrecision precision 参数：s（默认）时 start/end 精确到秒，ms 时精确到毫秒（15:04:05.000）
+// 参数无效时写入错误并返回 ok=false
+func msPrecision(ctx iris.Context) (ms, ok bool) {
+	switch ctx.URLParamDefault("precision", "s") {
+	case "s":
+		return false, true
+	case "ms":
+		return true, true
+	}
+	writeError(ctx, errInvalidParam("precision 只能是 s 或 ms", "precision must be s or ms"))
+	return false, false
+}
+
+// DefaultLatestRecordings /recordings/latest 默认返回的段落数
+const DefaultLatestRecordings = 10
+
+// GetQuickPlay 播放最新录像所需的 WebSocket play 参数
+// GET /api/v1/quickplay?channel=1
+// 不带 channel 时使用配置的 defaultChannel，未配置或该通道没有录像时取所有通道中最新的录像
+func (h *Handlers) GetQuickPlay(ctx iris.Context) {
+	ms, ok := msPrecision(ctx)
+	if !ok {
+		return
+	}
+	var channel *int
+	if ctx.URLParamExists("channel") {
+		ch := segmentChannelFor(ctx.URLParamIntDefault("channel", 0))
+		channel = &ch
+	}
+
+	rec, ok := h.dvr.QuickPlay(channel, h.cfg.Get().DefaultChannel)
+	if !ok {
+		writeError(ctx, errNoRecordings)
+		return
+	}
+	if ms {
+		recs := []RecordingInfo{rec}
+		h.dvr.withMilliseconds(recs, recordingDateTimeLayout)
+		rec = recs[0]
+	}
+	ctx.JSON(iris.Map{
+		"action":    "play",
+		"channel":   rec.Channel,
+		"timestamp": rec.StartTimestamp,
+		"recording": rec,
+	})
+}
+
+// GetStorage 获取存储使用情况
+// GET /api/v1/storage
+func (h *Handlers) GetStorage(ctx iris.Context) {
+	ctx.JSON(h.dvr.GetStorageReport())
+}
+
 // ==================== 路由注册 ====================
 
+// compressJSON 按客户端 Accept-Encoding 压缩 JSON 和文本响应
+// 是否压缩由第一次写入时响应的 Content-Type 决定，二进制帧/音频/图片原样发送；WebSocket 不经过压缩
+func compressJSON(ctx iris.Context) {
+	if !websocket.IsWebSocketUpgrade(ctx.Request()) {
+		ctx.CompressWriter(true)
+		if cw, ok := ctx.ResponseWriter().(*context.CompressResponseWriter); ok {
+			ctx.ResetResponseWriter(&contentTypeCompressWriter{CompressResponseWriter: cw})
+		}
+	}
+	ctx.Next()
+}
+
+// contentTypeCompressWriter 只在 Content-Type 可压缩时压缩的响应写入器
+type contentTypeCompressWriter struct {
+	*context.CompressResponseWriter
+	decided bool
+}
+
+func (w *contentTypeCompressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.decided = true
+		if !compressibleContentType(w.Header().Get(context.ContentTypeHeaderKey)) {
+			// 响应头尚未发送，去掉 Content-Encoding 后按原样写入
+			w.Disabled = true
+			w.FlushHeaders()
+		}
+	}
+	return w.CompressResponseWriter.Write(p)
+}
+
+// compressibleContentType JSON 和文本响应值得压缩，其余（包括未设置 Content-Type）原样发送
+func compressibleContentType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	return strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" ||
+		strings.HasSuffix(mediaType, "+json") || mediaType == "application/x-ndjson"
+}
+
+// requireStorage 存储断开时拒绝读取录像的请求
+// 配置、驱动器和缓存状态接口仍然可用，前端据此提示用户重新插入或切换存储路径
+func (h *Handlers) requireStorage(ctx iris.Context) {
+	if h.dvr.IsDisconnected() && !storageIndependent(ctx.Path()) {
+		writeError(ctx, errDisconnected)
+		return
+	}
+	ctx.Next()
+}
+
+// storageIndependent 不读取 DVR 存储的接口
+func storageIndependent(path string) bool {
+	switch path {
+	case "/api/v1/config", "/api/v1/drives", "/api/v1/timezones", "/api/v1/cache/status", "/api/v1/cache/events", "/api/v1/cache/cancel":
+		return true
+	}
+	return false
+}
+
 // RegisterRoutes 注册路由
 func RegisterRoutes(app *iris.Application, h *Handlers) {
 	// Python 风格 API (v1) - 与 Python 版本兼容
-	v1 := app.Party("/api/v1")
+	v1 := app.Party("/api/v1", h.requireStorage)
 	{
-		v1.Get("/config", h.GetConfig)
-		v1.Post("/config", h.SetConfig)
-		v1.Get("/cache/status", h.GetCacheStatus)
-		v1.Get("/recordings/dates", h.GetDates)
-		v1.Get("/recordings", h.GetRecordings)
+		// JSON 接口（按 Content-Type 支持 gzip/deflate 压缩）
+		api := v1.Party("/", compressJSON)
+		api.Get("/config", h.GetConfig)
+		api.Post("/config", h.SetConfig)
+		api.Get("/timezones", h.GetTimezones)
+		api.Get("/cache/status", h.GetCacheStatus)
+		api.Post("/cache/cancel", h.CancelCacheBuild)
+		api.Get("/recordings/dates", h.GetDates)
+		api.Get("/recordings", h.GetRecordings)
+		api.Get("/recordings/latest", h.GetLatestRecordings)
+		api.Get("/catalog/version", h.GetCatalogVersion)
+		api.Get("/catalog/changes", h.GetCatalogChanges)
+		api.Get("/quickplay", h.GetQuickPlay)
+		api.Get("/chapters", h.GetChapters)
+		api.Get("/storage", h.GetStorage)
+		api.Get("/channels", h.GetChannels)
+		api.Get("/bookmarks", h.GetBookmarks)
+		api.Post("/bookmarks", h.AddBookmark)
+		api.Delete("/bookmarks/{id}", h.DeleteBookmark)
+		api.Get("/drives", h.GetDrives)
+		api.Get("/frame/{file_index:int}/{frame_idx:int}/nals", h.GetFrameNals)
+		api.Get("/seek/{file_index:int}", h.SeekByPosition)
+		api.Get("/keyframes/{file_index:int}", h.GetKeyframes)
+		api.Get("/gop/{file_index:int}", h.GetGOP)
+		api.Get("/segment/{file_index:int}/stats", h.GetSegmentStats)
+		api.Get("/verify/{file_index:int}", h.VerifyRecording)
+		api.Get("/duplicates", h.GetDuplicates)
+		api.Get("/layout/{file_index:int}", h.GetFileLayout) // 调试用，需要 -debug 或 -auth-token
+
+		// 二进制接口（视频/音频已压缩，不再压缩）
 		v1.Get("/stream", h.HandleWebSocket) // WebSocket 视频流
+		v1.Get("/init/{file_index:int}", h.GetInitSegment)
+		v1.Get("/frame/{file_index:int}/{frame_idx:int}/raw", h.GetFrameRaw)
+		v1.Get("/frames/{file_index:int}", h.GetFramesBatch)
+		v1.Get("/frames/seq/{file_index:int}", h.GetFramesBySeq)
+		v1.Get("/frame_index/{file_index:int}/ndjson", h.GetFrameIndexNDJSON) // 流式输出，逐块 flush
+		v1.Get("/raw/{file_index:int}", h.GetRawBytes)                        // 调试用，需要 -debug 或 -auth-token
+		v1.Get("/export/{file_index:int}", h.ExportClip)
+		v1.Get("/export/{file_index:int}/trec", h.ExportTRec)
+		v1.Get("/contactsheet/{file_index:int}", h.GetContactSheet)
+		v1.Get("/mjpeg/{file_index:int}", h.GetMJPEG)
+		v1.Get("/gif/{file_index:int}", h.ExportGIF)
+		v1.Get("/cache/events", h.GetCacheEvents) // SSE 不能压缩（需要逐条 flush）
 	}
+	app.Get(openAPIPath, compressJSON, h.GetOpenAPI)
+	if seetong.IsDebugMode() {
+		app.Get(debugPlayerPath, h.GetDebugPlayer)
+	}
+
+	checkAPIDocument(app)
 }
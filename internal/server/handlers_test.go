@@ -0,0 +1,72 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kataras/iris/v12"
+)
+
+func TestCompressJSONByContentType(t *testing.T) {
+	frame := bytes.Repeat([]byte{0x00, 0x00, 0x00, 0x01, 0x26, 0x01}, 512)
+	app := iris.New()
+	app.Logger().SetLevel("disable")
+	api := app.Party("/", compressJSON)
+	api.Get("/json", func(ctx iris.Context) {
+		ctx.JSON(map[string]interface{}{"frames": bytes.Repeat([]byte("a"), 2048)})
+	})
+	api.Get("/binary", func(ctx iris.Context) { ctx.Binary(frame) })
+	api.Get("/untyped", func(ctx iris.Context) { ctx.Write(frame) })
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	for _, tc := range []struct {
+		path       string
+		compressed bool
+		body       []byte // nil 时不比较
+	}{
+		{"/json", true, nil},
+		{"/binary", false, frame},
+		{"/untyped", false, frame},
+	} {
+		req, _ := http.NewRequest("GET", srv.URL+tc.path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoding := resp.Header.Get("Content-Encoding")
+		if (encoding == "gzip") != tc.compressed {
+			t.Fatalf("%s: Content-Encoding %q, want compressed %v", tc.path, encoding, tc.compressed)
+		}
+		body := raw
+		if tc.compressed {
+			zr, err := gzip.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				t.Fatalf("%s: %v", tc.path, err)
+			}
+			if body, err = io.ReadAll(zr); err != nil {
+				t.Fatalf("%s: %v", tc.path, err)
+			}
+			if len(raw) >= len(body) {
+				t.Fatalf("%s: %d bytes compressed to %d", tc.path, len(body), len(raw))
+			}
+		}
+		if tc.body != nil && !bytes.Equal(body, tc.body) {
+			t.Fatalf("%s: body of %d bytes differs from the %d written", tc.path, len(body), len(tc.body))
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"seetong-dvr/internal/seetong"
+)
+
+// 发送落后（读取或发送跟不上帧的计划时间）超过阈值时的处理方式
+const (
+	lagPolicySlow = "slow" // 默认：从当前帧重新对齐节奏，不丢帧，播放位置整体推迟
+	lagPolicySkip = "skip" // 跳到计划播放位置之后的下一个 I 帧，发送 resync 消息
+)
+
+// maxLagThresholdMs play 消息中 lagThresholdMs 的上限
+const maxLagThresholdMs = 60000
+
+// lagPolicy play 消息的 lagPolicy 和 lagThresholdMs，零值为 slow、阈值使用服务端的 paceMaxLagMs
+type lagPolicy struct {
+	skip        bool
+	thresholdMs int
+}
+
+// parseLagPolicy 解析 lagPolicy（slow / skip，不区分大小写，空为 slow）和 lagThresholdMs（0 使用服务端配置）
+func parseLagPolicy(policy string, thresholdMs int) (lagPolicy, error) {
+	var p lagPolicy
+	switch strings.ToLower(strings.TrimSpace(policy)) {
+	case "", lagPolicySlow:
+	case lagPolicySkip:
+		p.skip = true
+	default:
+		return p, fmt.Errorf("未知的 lagPolicy: %q（可选 slow、skip）", policy)
+	}
+	if thresholdMs < 0 || thresholdMs > maxLagThresholdMs {
+		return p, fmt.Errorf("lagThresholdMs 需要在 0-%d 之间", maxLagThresholdMs)
+	}
+	p.thresholdMs = thresholdMs
+	return p, nil
+}
+
+// name stream_start 和 status 中返回的策略名
+func (p lagPolicy) name() string {
+	if p.skip {
+		return lagPolicySkip
+	}
+	return lagPolicySlow
+}
+
+// threshold 实际使用的阈值（毫秒），未指定时为 defaultMs
+func (p lagPolicy) threshold(defaultMs int) int {
+	if p.thresholdMs > 0 {
+		return p.thresholdMs
+	}
+	return defaultMs
+}
+
+// nextKeyframeAfter timeline 中文件偏移在 offset 之后、时间不早于 targetMs 的第一个 I 帧
+func nextKeyframeAfter(timeline *mediaTimeline, offset, targetMs int64) (seetong.FrameIndexRecord, bool) {
+	video := timeline.video
+	i := sort.Search(len(video), func(i int) bool { return int64(video[i].FileOffset) > offset })
+	for ; i < len(video); i++ {
+		if video[i].IsIFrame() && timeline.timeMs(video[i]) >= targetMs {
+			return video[i], true
+		}
+	}
+	return seetong.FrameIndexRecord{}, false
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+)
+
+// StreamLimits 流资源限制，0 表示不限制
+type StreamLimits struct {
+	MaxStreams          int     // 全局并发流上限
+	MaxStreamsPerClient int     // 单个客户端（按 IP）并发流上限
+	MaxSpeed            float64 // 最大播放速度
+}
+
+// streamLimiter 跟踪所有会话的活动流
+type streamLimiter struct {
+	limits    StreamLimits
+	mu        sync.Mutex
+	active    int
+	perClient map[string]int
+}
+
+func newStreamLimiter(limits StreamLimits) *streamLimiter {
+	return &streamLimiter{
+		limits:    limits,
+		perClient: make(map[string]int),
+	}
+}
+
+// checkSpeed 检查播放速度是否超出限制
+func (l *streamLimiter) checkSpeed(speed float64) error {
+	if l.limits.MaxSpeed > 0 && speed > l.limits.MaxSpeed {
+		return fmt.Errorf("播放速度 %.1fx 超出上限 %.1fx", speed, l.limits.MaxSpeed)
+	}
+	return nil
+}
+
+// acquire 占用一个流配额，超出限制时返回错误
+func (l *streamLimiter) acquire(client string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limits.MaxStreams > 0 && l.active >= l.limits.MaxStreams {
+		return fmt.Errorf("服务器并发流已达上限 (%d)", l.limits.MaxStreams)
+	}
+	if l.limits.MaxStreamsPerClient > 0 && l.perClient[client] >= l.limits.MaxStreamsPerClient {
+		return fmt.Errorf("客户端并发流已达上限 (%d)", l.limits.MaxStreamsPerClient)
+	}
+	l.active++
+	l.perClient[client]++
+	return nil
+}
+
+// release 释放流配额
+func (l *streamLimiter) release(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.active--
+	if l.perClient[client]--; l.perClient[client] <= 0 {
+		delete(l.perClient, client)
+	}
+}
@@ -0,0 +1,306 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"seetong-dvr/internal/seetong"
+)
+
+// 实时尾随模式参数
+const (
+	livePollInterval  = time.Second // 追上写入位置后读取新增帧索引的间隔
+	liveMaxFrameDelay = time.Second // 相邻帧间隔上限，避免录像断档时长时间停顿
+)
+
+// latestRecFileIndex 返回存储目录中编号最大的 TRec 文件
+func latestRecFileIndex(dvrPath string) int {
+	matches, _ := seetong.GlobRecFiles(dvrPath)
+	latest := -1
+	for _, match := range matches {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(match), "TRec"), ".tps")
+		if idx, err := strconv.Atoi(name); err == nil && idx > latest {
+			latest = idx
+		}
+	}
+	return latest
+}
+
+// liveStartFileIndex 实时模式的起始文件：TIndex 中最近写入的文件
+// 磁盘写满循环覆盖后编号最大的文件不一定是正在写入的文件，TIndex 没有段落时回退到编号最大的文件
+func liveStartFileIndex(storage *seetong.TPSStorage, dvrPath string) int {
+	if head := storage.WriteHead(); head >= 0 && storage.GetRecFile(head) != "" {
+		return head
+	}
+	return latestRecFileIndex(dvrPath)
+}
+
+// nextRecFileIndex DVR 写完 fileIndex 后写入的文件：下一个编号，最后一个文件之后回到同一来源目录的 TRec000000
+func nextRecFileIndex(storage *seetong.TPSStorage, fileIndex int) int {
+	if storage.GetRecFile(fileIndex+1) != "" {
+		return fileIndex + 1
+	}
+	return fileIndex - fileIndex%seetong.SourceFileStride
+}
+
+// liveFile 正在尾随的录像文件
+type liveFile struct {
+	fileIndex int
+	recFile   string
+	tail      *seetong.FrameIndexTail
+	records   []seetong.FrameIndexRecord // 已读到的帧索引（按文件顺序，只增不减）
+	newest    uint32                     // records 中最晚的 Unix 时间
+	next      int                        // 下一个待发送的记录
+	started   bool                       // 是否已从 I 帧开始发送
+	baseUnix  int64                      // 时间基：首帧 Unix 时间（毫秒）
+	baseTsUs  uint64                     // 时间基：首帧设备时间戳
+	hasBase   bool
+}
+
+func newLiveFile(fileIndex int, recFile string) *liveFile {
+	return &liveFile{fileIndex: fileIndex, recFile: recFile, tail: seetong.NewFrameIndexTail(recFile)}
+}
+
+// refresh 读取上次读取之后新增的帧索引条目，追加到 records
+func (f *liveFile) refresh() error {
+	records, err := f.tail.Read()
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if r.UnixTs > f.newest {
+			f.newest = r.UnixTs
+		}
+	}
+	f.records = append(f.records, records...)
+	return nil
+}
+
+// seekLastIFrame 定位到最后一个 I 帧
+// 帧索引中没有 I 帧时扫描 VPS 位置，取最后一个 VPS 之后的首帧
+func (f *liveFile) seekLastIFrame(frameChannel uint32) bool {
+	for i := len(f.records) - 1; i >= 0; i-- {
+		r := f.records[i]
+		if r.Channel == frameChannel && r.IsIFrame() {
+			f.next = i
+			f.started = true
+			return true
+		}
+	}
+
+	positions, err := seetong.ScanVPSPositions(f.recFile)
+	if err != nil || len(positions) == 0 {
+		return false
+	}
+	lastVPS := uint32(positions[len(positions)-1])
+	for i, r := range f.records {
+		if r.Channel == frameChannel && r.FileOffset >= lastVPS {
+			f.next = i
+			f.started = true
+			return true
+		}
+	}
+	return false
+}
+
+// timestampMs 帧的显示时间（首帧 Unix 时间 + 设备时间戳增量）
+func (f *liveFile) timestampMs(r seetong.FrameIndexRecord) int64 {
+	if !f.hasBase {
+		f.baseUnix = int64(r.UnixTs) * 1000
+		f.baseTsUs = r.TimestampUs
+		f.hasBase = true
+	}
+	return f.baseUnix + (int64(r.TimestampUs)-int64(f.baseTsUs))/1000
+}
+
+// startLive 启动实时尾随流
+func (s *StreamSession) startLive(channel int) {
+	if !s.acquireStream() {
+		return
+	}
+	s.channel, s.speed = channel, 1.0
+	s.live, s.freshDecoder = true, false
+
+	ctx, cancel := context.WithCancel(s.conn)
+	newStreamID := atomic.AddUint64(&streamCounter, 1)
+
+	s.mu.Lock()
+	s.cancel = cancel
+	s.streamID = newStreamID
+	s.mu.Unlock()
+	s.progress.reset(time.Now())
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.handlers.streams.release(s.clientIP)
+		s.streamLive(ctx, newStreamID, channel)
+	}()
+}
+
+// streamLive 尾随正在录制的 TRec 文件
+// 从最后一个 I 帧开始按帧索引发送，追上写入位置后定期读取上次读到的位置之后新增的条目，
+// DVR 切换到下一个文件（最后一个文件之后回到 TRec000000）后从新文件开头继续
+func (s *StreamSession) streamLive(ctx context.Context, streamID uint64, channel int) {
+	dvr := s.getDVR()
+	storage := dvr.GetStorage()
+	if storage == nil || !dvr.IsLoaded() {
+		s.sendJSON(map[string]interface{}{"error": "DVR 未加载"})
+		return
+	}
+
+	dvrPath := dvr.GetDVRPath()
+	fileIndex := liveStartFileIndex(storage, dvrPath)
+	if fileIndex < 0 {
+		s.sendJSON(map[string]interface{}{"error": "未找到录像文件"})
+		return
+	}
+
+	frameChannel := uint32(frameChannelFor(channel))
+	live := newLiveFile(fileIndex, storage.GetRecFile(fileIndex))
+	if err := live.refresh(); err != nil || !live.seekLastIFrame(frameChannel) {
+		s.sendJSON(map[string]interface{}{"type": "error", "message": "未找到 I 帧"})
+		return
+	}
+
+	startRecord := live.records[live.next]
+	hasAudio := false
+	for _, r := range live.records {
+		if r.Channel == seetong.ChannelAudio {
+			hasAudio = true
+			break
+		}
+	}
+	fmt.Printf("[Live#%d] file_index=%d, 起始帧 %d/%d\n", streamID, fileIndex, live.next, len(live.records))
+
+	audio := s.newAudioSink(streamID)
+	defer audio.Close()
+
+	s.progress.fileIndex.Store(int64(fileIndex))
+	s.sendJSON(map[string]interface{}{
+		"type":            "stream_start",
+		"live":            true,
+		"channel":         channel,
+		"fileIndex":       fileIndex,
+		"actualStartTime": int64(startRecord.UnixTs),
+		"hasAudio":        hasAudio,
+		"audioFormat":     audio.Format(),
+		"audioSampleRate": audioSampleRate,
+	})
+
+	var lastVideoTsMs int64
+	totalFramesSent := 0
+
+	// 帧读取缓冲，发送时已复制到消息中，可以在帧之间复用
+	var buf []byte
+	// DVR 写完当前文件后将要写入的文件，轮询其首条记录判断是否已开始写入
+	var pending *liveFile
+	defer func() { seetong.PutFrameBuffer(buf) }()
+
+	for {
+		if ctx.Err() != nil {
+			fmt.Printf("[Live#%d] 已取消，发送了 %d 帧\n", streamID, totalFramesSent)
+			return
+		}
+
+		// 追上写入位置：等待后读取新增的索引条目，没有新帧且 DVR 已切换文件时跟随到新文件
+		if live.next >= len(live.records) {
+			select {
+			case <-ctx.Done():
+				fmt.Printf("[Live#%d] 已取消，发送了 %d 帧\n", streamID, totalFramesSent)
+				return
+			case <-time.After(livePollInterval):
+			}
+
+			if err := live.refresh(); err != nil {
+				seetong.LogWarn("实时模式读取帧索引失败", "file", filepath.Base(live.recFile), "error", err)
+			}
+			if live.next < len(live.records) {
+				continue
+			}
+
+			// 下一个文件的首条记录比当前文件更新时切换（文件可能是预分配的，或保存着上一轮的旧录像，
+			// 覆盖时从索引开头重写，首条记录最先变化）
+			if following := nextRecFileIndex(storage, live.fileIndex); following != live.fileIndex {
+				if pending == nil || pending.fileIndex != following {
+					pending = newLiveFile(following, storage.GetRecFile(following))
+				}
+				first, ok, err := pending.tail.First()
+				if err != nil || !ok || first.UnixTs <= live.newest {
+					continue // 新文件的帧索引尚未写入
+				}
+				if err := pending.refresh(); err != nil {
+					continue
+				}
+				fmt.Printf("[Live#%d] 切换到 file_index=%d\n", streamID, following)
+				live, pending = pending, nil
+				s.progress.fileIndex.Store(int64(following))
+				s.sendJSON(map[string]interface{}{"type": "live_file", "fileIndex": following})
+			}
+			continue
+		}
+
+		record := live.records[live.next]
+		live.next++
+
+		// 新文件从首个 I 帧开始，保证解码器能拿到参数集
+		if !live.started {
+			if record.Channel != frameChannel || !record.IsIFrame() {
+				continue
+			}
+			live.started = true
+		}
+
+		tsMs := live.timestampMs(record)
+
+		if record.Channel == seetong.ChannelAudio {
+			var err error
+			buf, err = storage.ReadFrameIntoContext(ctx, live.fileIndex, record, buf)
+			if err != nil {
+				continue
+			}
+			if !audio.Write(buf, tsMs) {
+				return
+			}
+			continue
+		}
+		if record.Channel != frameChannel {
+			continue
+		}
+
+		// 按帧时间戳间隔节流
+		if lastVideoTsMs > 0 && tsMs > lastVideoTsMs {
+			delay := time.Duration(tsMs-lastVideoTsMs) * time.Millisecond
+			if delay > liveMaxFrameDelay {
+				delay = liveMaxFrameDelay
+			}
+			select {
+			case <-ctx.Done():
+				fmt.Printf("[Live#%d] sleep 期间取消\n", streamID)
+				return
+			case <-time.After(delay):
+			}
+		}
+		lastVideoTsMs = tsMs
+
+		var err error
+		buf, err = storage.ReadFrameIntoContext(ctx, live.fileIndex, record, buf)
+		if err != nil {
+			fmt.Printf("[Live#%d] 视频帧读取失败: %v\n", streamID, err)
+			continue
+		}
+		for _, nal := range seetong.ParseNalUnits(buf) {
+			nalData := seetong.StripStartCode(buf[nal.Offset : nal.Offset+nal.Size])
+			if !s.sendVideoFrameWithID(streamID, nalData, nal.NalType, tsMs) {
+				fmt.Printf("[Live#%d] 发送失败（ID 不匹配），退出\n", streamID)
+				return
+			}
+		}
+		totalFramesSent++
+	}
+}
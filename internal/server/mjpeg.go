@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"sort"
+	"strconv"
+	"time"
+
+	"seetong-dvr/internal/seetong"
+
+	"github.com/kataras/iris/v12"
+)
+
+// MJPEG 流参数
+const (
+	mjpegDefaultFPS   = 1.0
+	mjpegMaxFPS       = 10.0
+	mjpegKeyframeFPS  = 1.0 // 不超过该帧率时只解码 I 帧，否则从覆盖的 I 帧解码到目标帧
+	mjpegDefaultWidth = 640
+	mjpegMaxWidth     = 1920
+	mjpegQuality      = 80
+	mjpegBoundary     = "mjpegframe"
+)
+
+// GetMJPEG 以 MJPEG（multipart/x-mixed-replace）按实际速度播放段落
+// GET /api/v1/mjpeg/{file_index}?channel=<n>&fps=1&width=640
+//
+// 供只支持 MJPEG 的旧浏览器和嵌入式看板使用，与缩略图共用 ffmpeg 解码。
+// 每个输出帧按播放时间在帧索引中取样：fps 不超过 1 时取覆盖该时间的 I 帧，
+// 更高的帧率从 I 帧解码到该时间的帧（CPU 开销随 GOP 长度增加）；取样到同一帧时重复发送上一张图。
+// 客户端断开后停止解码
+func (h *Handlers) GetMJPEG(ctx iris.Context) {
+	storage := h.dvr.GetStorage()
+	if storage == nil || !h.dvr.IsLoaded() {
+		writeError(ctx, errNotLoaded)
+		return
+	}
+
+	fileIndex := ctx.Params().GetIntDefault("file_index", 0)
+	seg := storage.GetSegmentByFileIndex(fileIndex)
+	if seg == nil {
+		writeError(ctx, errSegmentNotFound)
+		return
+	}
+	channel := ctx.URLParamIntDefault("channel", seg.Channel)
+
+	fps := mjpegDefaultFPS
+	if v := ctx.URLParam("fps"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 || f > mjpegMaxFPS {
+			writeError(ctx, errInvalidParam("无效的 fps 参数", "invalid fps parameter").
+				WithDetail(fmt.Sprintf("0 < fps <= %g", mjpegMaxFPS)))
+			return
+		}
+		fps = f
+	}
+	width := ctx.URLParamIntDefault("width", mjpegDefaultWidth)
+	if width < 16 || width > mjpegMaxWidth {
+		writeError(ctx, errInvalidParam("无效的 width 参数", "invalid width parameter").
+			WithDetail(fmt.Sprintf("16..%d", mjpegMaxWidth)))
+		return
+	}
+
+	if ffmpegPath() == "" {
+		writeError(ctx, newAPIError(501, ReasonUnsupported, "MJPEG 需要 ffmpeg", "MJPEG requires ffmpeg"))
+		return
+	}
+	if storage.GetRecFile(fileIndex) == "" {
+		writeError(ctx, errRecFileMissing)
+		return
+	}
+
+	timeline := newMediaTimeline(storage.GetFrameIndex(fileIndex), uint32(frameChannelFor(channel)))
+	video := timeline.video
+	if len(video) == 0 {
+		writeError(ctx, errNoVideoFrames)
+		return
+	}
+
+	keyOf, firstKey := keyframeMap(video)
+	if firstKey < 0 {
+		writeError(ctx, errNoIFrame)
+		return
+	}
+
+	ctx.ContentType("multipart/x-mixed-replace; boundary=" + mjpegBoundary)
+	ctx.Header("Cache-Control", "no-cache")
+
+	reqCtx := ctx.Request().Context()
+	keyframeOnly := fps <= mjpegKeyframeFPS
+	startMs, endMs := timeline.timeMs(video[0]), timeline.timeMs(video[len(video)-1])
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / fps))
+	defer ticker.Stop()
+
+	began := time.Now()
+	shown := -1
+	var jpegData []byte
+	for {
+		posMs := startMs + time.Since(began).Milliseconds()
+		if posMs > endMs {
+			return
+		}
+
+		target := sort.Search(len(video), func(i int) bool { return timeline.timeMs(video[i]) > posMs }) - 1
+		if target < 0 || keyOf[target] < 0 {
+			target = firstKey // 第一个 I 帧之前的帧无法解码
+		}
+		if keyframeOnly {
+			target = keyOf[target]
+		}
+
+		if target != shown {
+			data, err := mjpegFrame(reqCtx, storage, fileIndex, video, keyOf[target], target, width)
+			if reqCtx.Err() != nil {
+				return
+			}
+			if err != nil {
+				seetong.LogWarn("MJPEG 解码失败", "file_index", fileIndex, "offset", video[target].FileOffset, "error", err)
+			} else {
+				jpegData, shown = data, target
+			}
+		}
+
+		if jpegData != nil {
+			part := fmt.Sprintf("--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", mjpegBoundary, len(jpegData))
+			if _, err := ctx.Write(append(append([]byte(part), jpegData...), '\r', '\n')); err != nil {
+				return
+			}
+			ctx.ResponseWriter().Flush()
+		}
+
+		select {
+		case <-reqCtx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// keyframeMap 每个视频帧对应的 I 帧序号（之前没有 I 帧的帧无法解码，记为 -1）和第一个 I 帧的序号
+func keyframeMap(video []seetong.FrameIndexRecord) (keyOf []int, firstKey int) {
+	keyOf = make([]int, len(video))
+	key := -1
+	firstKey = -1
+	for i, f := range video {
+		if f.IsIFrame() {
+			key = i
+			if firstKey < 0 {
+				firstKey = i
+			}
+		}
+		keyOf[i] = key
+	}
+	return keyOf, firstKey
+}
+
+// decodeVideoFrame 解码 video[target]
+// 从 video[key] 的 VPS/SPS/PPS/IDR 开始，拼接到目标帧为止的所有帧数据，取第 target-key 个解码帧
+func decodeVideoFrame(ctx context.Context, storage *seetong.TPSStorage, fileIndex int,
+	video []seetong.FrameIndexRecord, key, target, width int) (image.Image, error) {
+
+	annexB, err := keyframeAnnexB(storage, fileIndex, int64(video[key].FileOffset))
+	if err != nil {
+		return nil, err
+	}
+	for i := key + 1; i <= target; i++ {
+		data, err := storage.ReadFrame(fileIndex, video[i])
+		if err != nil {
+			return nil, err
+		}
+		annexB = append(annexB, data...)
+	}
+	return decodeFrameAt(ctx, annexB, width, target-key)
+}
+
+// mjpegFrame 解码 video[target] 并编码为 JPEG
+func mjpegFrame(ctx context.Context, storage *seetong.TPSStorage, fileIndex int,
+	video []seetong.FrameIndexRecord, key, target, width int) ([]byte, error) {
+
+	img, err := decodeVideoFrame(ctx, storage, fileIndex, video, key, target, width)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: mjpegQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
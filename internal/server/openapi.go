@@ -0,0 +1,552 @@
+package server
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"seetong-dvr/internal/seetong"
+	"seetong-dvr/internal/spec"
+
+	"github.com/kataras/iris/v12"
+)
+
+// openAPIPath 文档本身的地址
+const openAPIPath = "/api/openapi.json"
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  *spec.Document
+)
+
+// GetOpenAPI 返回 REST 接口的 OpenAPI 3 文档
+// GET /api/openapi.json
+func (h *Handlers) GetOpenAPI(ctx iris.Context) {
+	ctx.JSON(apiDocument())
+}
+
+// apiDocument REST 接口文档，新增或修改路由时需要同步更新
+// RegisterRoutes 启动时检查每个 /api 路由都在文档中，遗漏时输出警告
+func apiDocument() *spec.Document {
+	openAPIOnce.Do(func() { openAPIDoc = buildAPIDocument() })
+	return openAPIDoc
+}
+
+// 常用参数
+func pathParam(name, description string) *spec.Parameter {
+	return &spec.Parameter{Name: name, In: "path", Description: description, Required: true, Schema: spec.Integer}
+}
+
+func queryParam(name string, schema *spec.Schema, description string) *spec.Parameter {
+	return &spec.Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+func requiredQuery(name string, schema *spec.Schema, description string) *spec.Parameter {
+	p := queryParam(name, schema, description)
+	p.Required = true
+	return p
+}
+
+var (
+	fileIndexParam = pathParam("file_index", "段落所在的 TRec 文件序号")
+	channelParam   = queryParam("channel", spec.Integer, "段落通道号，默认为段落的通道")
+)
+
+// jsonResponse JSON 响应
+func jsonResponse(description string, schema *spec.Schema) *spec.Response {
+	return &spec.Response{
+		Description: description,
+		Content:     map[string]*spec.MediaType{"application/json": {Schema: schema}},
+	}
+}
+
+// binaryResponse 二进制响应
+func binaryResponse(description, contentType string) *spec.Response {
+	return &spec.Response{
+		Description: description,
+		Content:     map[string]*spec.MediaType{contentType: {Schema: spec.Binary}},
+	}
+}
+
+func buildAPIDocument() *spec.Document {
+	doc := spec.New("Seetong DVR API", "1",
+		"天视通 DVR 录像浏览接口。错误响应统一为 APIError，客户端应按 reason 分支")
+	doc.Components.SecuritySchemes = map[string]*spec.SecurityScheme{
+		"bearer":     {Type: "http", Scheme: "bearer"},
+		"queryToken": {Type: "apiKey", In: "query", Name: "token"},
+	}
+	doc.Security = []map[string][]string{{"bearer": {}}, {"queryToken": {}}}
+
+	apiError := doc.Define("APIError", APIError{})
+	cacheStatus := doc.Define("CacheStatus", CacheStatus{})
+	recording := doc.Define("RecordingInfo", RecordingInfo{})
+	daySummary := doc.Define("DaySummary", DaySummary{})
+	calendarSummary := doc.Define("CalendarSummary", CalendarSummary{})
+	storageReport := doc.Define("StorageReport", StorageReport{})
+	channelInfo := doc.Define("ChannelInfo", ChannelInfo{})
+	bookmark := doc.Define("Bookmark", Bookmark{})
+	drive := doc.Define("DriveCandidate", DriveCandidate{})
+	timezone := doc.Define("TimezoneInfo", TimezoneInfo{})
+	nal := doc.Define("NalSummary", NalSummary{})
+	keyframe := doc.Define("KeyframeInfo", KeyframeInfo{})
+	gopFrame := doc.Define("GOPFrame", GOPFrame{})
+	videoStats := doc.Define("VideoStats", seetong.VideoStats{})
+	verifyReport := doc.Define("VerifyReport", VerifyReport{})
+	seqReport := doc.Define("SeqReport", SeqReport{})
+	catalogEntry := doc.Define("CatalogEntry", CatalogEntry{})
+	duplicateGroup := doc.Define("DuplicateGroup", DuplicateGroup{})
+	frameIndexLine := doc.Define("FrameIndexLine", FrameIndexLine{})
+	trecLayout := doc.Define("TRecLayout", seetong.TRecLayout{})
+	// GetConfig/SetConfig 直接构造 iris.Map，没有对应的 Go 类型
+	config := spec.Ref("Config")
+	doc.Components.Schemas["Config"] = spec.Object(map[string]*spec.Schema{
+		"storagePath":    spec.String,
+		"loaded":         spec.Boolean,
+		"timezone":       spec.String,
+		"pathHistory":    spec.ArrayOf(spec.String),
+		"entryCount":     spec.Integer,
+		"fileCount":      spec.Integer,
+		"cacheStatus":    cacheStatus,
+		"catalogVersion": spec.Int64,
+		"fromCache":      spec.Boolean,
+	})
+
+	errorResponse := jsonResponse("错误", apiError)
+	ok := func(description string, schema *spec.Schema) map[string]*spec.Response {
+		return map[string]*spec.Response{"200": jsonResponse(description, schema), "default": errorResponse}
+	}
+	binary := func(description, contentType string) map[string]*spec.Response {
+		return map[string]*spec.Response{"200": binaryResponse(description, contentType), "default": errorResponse}
+	}
+
+	// 配置和存储
+	doc.Add("GET", "/api/v1/config", &spec.Operation{
+		Summary: "获取当前存储配置", OperationID: "getConfig", Tags: []string{"config"},
+		Responses: ok("当前配置，未加载时不包含 entryCount/fileCount/cacheStatus", config),
+	})
+	doc.Add("POST", "/api/v1/config", &spec.Operation{
+		Summary: "切换存储路径或时区", OperationID: "setConfig", Tags: []string{"config"},
+		RequestBody: &spec.RequestBody{Required: true, Content: map[string]*spec.MediaType{
+			"application/json": {Schema: spec.Object(map[string]*spec.Schema{
+				"storagePath": spec.String,
+				"timezone":    spec.String,
+			})},
+		}},
+		Responses: ok("更新后的配置", config),
+	})
+	doc.Add("GET", "/api/v1/timezones", &spec.Operation{
+		Summary: "服务端接受的时区", OperationID: "getTimezones", Tags: []string{"config"},
+		Description: "系统有时区数据库时返回全部时区，否则返回常用时区；按当前 UTC 偏移排序，当前时区带 current 标记",
+		Responses: ok("时区列表", spec.Object(map[string]*spec.Schema{
+			"current":   spec.String,
+			"source":    spec.String,
+			"timezones": spec.ArrayOf(timezone),
+		})),
+	})
+	doc.Add("GET", "/api/v1/cache/status", &spec.Operation{
+		Summary: "缓存构建状态和缓存目录占用", OperationID: "getCacheStatus", Tags: []string{"config"},
+		Responses: ok("缓存状态", cacheStatus),
+	})
+	doc.Add("POST", "/api/v1/cache/cancel", &spec.Operation{
+		Summary: "取消正在进行的缓存构建", OperationID: "cancelCacheBuild", Tags: []string{"config"},
+		Description: "当前段落完成后返回，已缓存的段落保留；缓存状态变为 cancelled",
+		Responses: ok("取消结果", spec.Object(map[string]*spec.Schema{
+			"cancelled":   spec.Boolean,
+			"completed":   spec.Integer,
+			"cacheStatus": cacheStatus,
+		})),
+	})
+	doc.Add("GET", "/api/v1/cache/events", &spec.Operation{
+		Summary: "缓存构建进度（SSE）", OperationID: "getCacheEvents", Tags: []string{"config"},
+		Description: "每完成一个段落推送 progress 事件，结束时推送 done 事件（取消时为 cancelled）",
+		Responses: map[string]*spec.Response{"200": {
+			Description: "text/event-stream",
+			Content:     map[string]*spec.MediaType{"text/event-stream": {Schema: spec.String}},
+		}},
+	})
+	doc.Add("GET", "/api/v1/storage", &spec.Operation{
+		Summary: "存储使用情况", OperationID: "getStorage", Tags: []string{"config"},
+		Responses: ok("存储报告", storageReport),
+	})
+	doc.Add("GET", "/api/v1/drives", &spec.Operation{
+		Summary: "扫描包含 DVR 录像的驱动器", OperationID: "getDrives", Tags: []string{"config"},
+		Responses: ok("候选存储位置", spec.Object(map[string]*spec.Schema{"drives": spec.ArrayOf(drive)})),
+	})
+
+	// 录像
+	precisionParam := queryParam("precision", spec.String, "start/end 的精度：s（默认，15:04:05）或 ms（15:04:05.000）")
+	doc.Add("GET", "/api/v1/recordings/dates", &spec.Operation{
+		Summary: "有录像的日期", OperationID: "getRecordingDates", Tags: []string{"recordings"},
+		Description: "不带 channel 时只统计 kind 为 video 的通道。" +
+			"带 summary=true、year 或 year+month 时不返回 dates，改为返回每年（years）、该年每月（months）或该月每天（days）的统计；" +
+			"prev/next 为之前/之后最近的有录像的年（YYYY）或月（YYYY-MM），没有时为 null",
+		Parameters: []*spec.Parameter{
+			queryParam("channel", spec.Integer, "只返回该通道的日期"),
+			queryParam("summary", spec.Boolean, "返回每年的统计"),
+			queryParam("year", spec.Integer, "返回该年每月的统计"),
+			queryParam("month", spec.Integer, "1-12，与 year 一起使用，返回该月每天的统计"),
+		},
+		Responses: ok("日期列表（YYYY-MM-DD，升序）和视频通道号；日历参数时为对应的统计", spec.Object(map[string]*spec.Schema{
+			"dates":    spec.ArrayOf(spec.String),
+			"channels": spec.ArrayOf(spec.Integer),
+			"years":    spec.ArrayOf(calendarSummary),
+			"first":    spec.String,
+			"last":     spec.String,
+			"year":     spec.Integer,
+			"month":    spec.Integer,
+			"months":   spec.ArrayOf(calendarSummary),
+			"days":     spec.ArrayOf(daySummary),
+			"prev":     spec.String,
+			"next":     spec.String,
+		})),
+	})
+	doc.Add("GET", "/api/v1/recordings", &spec.Operation{
+		Summary: "指定日期的录像", OperationID: "getRecordings", Tags: []string{"recordings"},
+		Description: "不带 channel 时只返回 kind 为 video 的通道",
+		Parameters: []*spec.Parameter{
+			requiredQuery("date", spec.String, "YYYY-MM-DD"),
+			queryParam("channel", spec.Integer, "通道号"),
+			queryParam("merge", spec.Boolean, "合并间隔不超过 gap 秒的相邻录像"),
+			queryParam("gap", spec.Int64, "合并间隔（秒）"),
+			precisionParam,
+		},
+		Responses: ok("录像列表（pending 为该天按需构建中的段落数，构建完成后重新请求）", spec.Object(map[string]*spec.Schema{
+			"recordings": spec.ArrayOf(recording),
+			"pending":    spec.Integer,
+		})),
+	})
+	doc.Add("GET", "/api/v1/recordings/latest", &spec.Operation{
+		Summary: "最近的录像", OperationID: "getLatestRecordings", Tags: []string{"recordings"},
+		Description: "按结束时间倒序，不受磁盘写满后循环覆盖的文件编号影响；start/end 带日期",
+		Parameters: []*spec.Parameter{
+			queryParam("n", spec.Integer, "段落数，默认 10"),
+			queryParam("channel", spec.Integer, "通道号"),
+			precisionParam,
+		},
+		Responses: ok("最新的在前", spec.Object(map[string]*spec.Schema{"recordings": spec.ArrayOf(recording)})),
+	})
+	doc.Add("GET", "/api/v1/catalog/version", &spec.Operation{
+		Summary: "目录版本", OperationID: "getCatalogVersion", Tags: []string{"recordings"},
+		Description: "段落集合变化后递增；ETag 响应头为 etag，If-None-Match 相同时返回 304",
+		Responses: ok("当前版本", spec.Object(map[string]*spec.Schema{
+			"version": spec.Int64,
+			"etag":    spec.String,
+			"entries": spec.Integer,
+		})),
+	})
+	doc.Add("GET", "/api/v1/catalog/changes", &spec.Operation{
+		Summary: "目录版本之后的变化", OperationID: "getCatalogChanges", Tags: []string{"recordings"},
+		Description: "reset 为 true 时 since 太旧或来自之前的服务进程，added 为全部段落",
+		Parameters:  []*spec.Parameter{requiredQuery("since", spec.Int64, "之前取得的 version")},
+		Responses: ok("新增或变化的段落和被移除的 fileIndex", spec.Object(map[string]*spec.Schema{
+			"since":   spec.Int64,
+			"version": spec.Int64,
+			"etag":    spec.String,
+			"reset":   spec.Boolean,
+			"added":   spec.ArrayOf(catalogEntry),
+			"removed": spec.ArrayOf(spec.Integer),
+		})),
+	})
+	doc.Add("GET", "/api/v1/quickplay", &spec.Operation{
+		Summary: "播放最新录像的参数", OperationID: "getQuickPlay", Tags: []string{"recordings"},
+		Description: "返回的 action/channel/timestamp 可直接作为 WebSocket play 消息；不带 channel 时使用配置的 defaultChannel",
+		Parameters:  []*spec.Parameter{queryParam("channel", spec.Integer, "通道号"), precisionParam},
+		Responses: ok("最新录像", spec.Object(map[string]*spec.Schema{
+			"action":    spec.String,
+			"channel":   spec.Integer,
+			"timestamp": spec.Int64,
+			"recording": recording,
+		})),
+	})
+	doc.Add("GET", "/api/v1/chapters", &spec.Operation{
+		Summary: "一天录像的 WebVTT 章节", OperationID: "getChapters", Tags: []string{"recordings"},
+		Description: "每个连续录像块一个 cue，时间为 playTimeline 的播放进度（空白不计时）",
+		Parameters: []*spec.Parameter{
+			requiredQuery("date", spec.String, "YYYY-MM-DD"),
+			queryParam("channel", spec.Integer, "通道号，默认 1"),
+			queryParam("gap", spec.Int64, "合并间隔（秒）"),
+		},
+		Responses: map[string]*spec.Response{
+			"200":     {Description: "WebVTT", Content: map[string]*spec.MediaType{"text/vtt": {Schema: spec.String}}},
+			"default": errorResponse,
+		},
+	})
+	doc.Add("GET", "/api/v1/channels", &spec.Operation{
+		Summary: "通道列表", OperationID: "getChannels", Tags: []string{"recordings"},
+		Description: "包括 audio 和 hidden 通道；类型和名称可通过配置 channelKinds/channelLabels 覆盖",
+		Responses:   ok("各通道的录像数、时间范围和分辨率", spec.ArrayOf(channelInfo)),
+	})
+
+	// 书签
+	doc.Add("GET", "/api/v1/bookmarks", &spec.Operation{
+		Summary: "书签列表", OperationID: "getBookmarks", Tags: []string{"bookmarks"},
+		Parameters: []*spec.Parameter{
+			queryParam("date", spec.String, "YYYY-MM-DD，按显示时区过滤"),
+			queryParam("channel", spec.Integer, "通道号"),
+		},
+		Responses: ok("按时间排序的书签", spec.Object(map[string]*spec.Schema{"bookmarks": spec.ArrayOf(bookmark)})),
+	})
+	doc.Add("POST", "/api/v1/bookmarks", &spec.Operation{
+		Summary: "添加书签", OperationID: "addBookmark", Tags: []string{"bookmarks"},
+		RequestBody: &spec.RequestBody{Required: true, Content: map[string]*spec.MediaType{
+			"application/json": {Schema: spec.SchemaOf(bookmarkRequest{})},
+		}},
+		Responses: map[string]*spec.Response{"201": jsonResponse("新书签", bookmark), "default": errorResponse},
+	})
+	doc.Add("DELETE", "/api/v1/bookmarks/{id}", &spec.Operation{
+		Summary: "删除书签", OperationID: "deleteBookmark", Tags: []string{"bookmarks"},
+		Parameters: []*spec.Parameter{{Name: "id", In: "path", Required: true, Schema: spec.String}},
+		Responses:  map[string]*spec.Response{"204": {Description: "已删除"}, "default": errorResponse},
+	})
+
+	// 帧索引
+	frameIdxParam := pathParam("frame_idx", "帧在段落帧索引中的序号")
+	doc.Add("GET", "/api/v1/frame/{file_index}/{frame_idx}/nals", &spec.Operation{
+		Summary: "单帧的 NAL 单元", OperationID: "getFrameNals", Tags: []string{"frames"},
+		Parameters: []*spec.Parameter{fileIndexParam, frameIdxParam, queryParam("hex", spec.Boolean, "附带每个 NAL 开头的十六进制")},
+		Responses: ok("NAL 摘要", spec.Object(map[string]*spec.Schema{
+			"fileIndex":  spec.Integer,
+			"frameIndex": spec.Integer,
+			"channel":    spec.Integer,
+			"frameType":  spec.Integer,
+			"fileOffset": spec.Int64,
+			"frameSize":  spec.Int64,
+			"reserved":   spec.String,
+			"nals":       spec.ArrayOf(nal),
+		})),
+	})
+	doc.Add("GET", "/api/v1/frame/{file_index}/{frame_idx}/raw", &spec.Operation{
+		Summary: "单个 I 帧的 Annex B 数据", OperationID: "getFrameRaw", Tags: []string{"frames"},
+		Description: "I 帧前补齐 VPS/SPS/PPS；P 帧返回 409，iFrameIndex 为覆盖该帧的 I 帧序号",
+		Parameters:  []*spec.Parameter{fileIndexParam, frameIdxParam},
+		Responses:   binary("H.265 Annex B", "video/H265"),
+	})
+	doc.Add("GET", "/api/v1/frames/{file_index}", &spec.Operation{
+		Summary: "批量获取连续视频帧", OperationID: "getFramesBatch", Tags: []string{"frames"},
+		Description: "每帧为 帧序号(4) + 时间戳毫秒(8) + 帧类型(1) + 长度(4) + 数据，大端；" +
+			"start/count 与 from_ts/to_ts 不能混用，每次最多 250 帧",
+		Parameters: []*spec.Parameter{
+			fileIndexParam, channelParam,
+			queryParam("start", spec.Integer, "该通道视频帧中的起始位置"),
+			queryParam("count", spec.Integer, "1~250，默认 25"),
+			queryParam("from_ts", spec.Number, "时间窗口起点（Unix 秒）"),
+			queryParam("to_ts", spec.Number, "时间窗口终点（Unix 秒）"),
+		},
+		Responses: binary("连续的帧，X-Frame-Start/X-Frame-Count/X-Frame-Total 给出位置", "application/octet-stream"),
+	})
+	doc.Add("GET", "/api/v1/frames/seq/{file_index}", &spec.Operation{
+		Summary: "按帧序号范围获取帧", OperationID: "getFramesBySeq", Tags: []string{"frames"},
+		Description: "格式与 /frames/{file_index} 相同，按 FrameSeq 排序，每次最多 250 帧（X-Seq-Next 给出下一批的 from_seq）；" +
+			"X-Seq-Scope/X-Seq-Missing/X-Seq-Duplicates/X-Seq-Gaps 报告序号缺口，meta=true 时返回整个范围的 SeqReport",
+		Parameters: []*spec.Parameter{
+			fileIndexParam,
+			queryParam("channel", spec.Integer, "只返回该通道的帧，默认所有通道"),
+			queryParam("from_seq", spec.Int64, "起始序号（包含），默认 0"),
+			queryParam("to_seq", spec.Int64, "结束序号（包含），默认最大值"),
+			queryParam("meta", spec.Boolean, "只返回 JSON 报告，不读取帧数据"),
+		},
+		Responses: map[string]*spec.Response{
+			"200": {Description: "连续的帧，或 meta=true 时的 SeqReport", Content: map[string]*spec.MediaType{
+				"application/octet-stream": {Schema: spec.String},
+				"application/json":         {Schema: seqReport},
+			}},
+			"default": errorResponse,
+		},
+	})
+	doc.Add("GET", "/api/v1/seek/{file_index}", &spec.Operation{
+		Summary: "按进度条位置查找 I 帧", OperationID: "seekByPosition", Tags: []string{"frames"},
+		Parameters: []*spec.Parameter{fileIndexParam, channelParam, requiredQuery("pos", spec.Number, "0~1")},
+		Responses: ok("目标时间之前最近的 I 帧", spec.Object(map[string]*spec.Schema{
+			"fileIndex":   spec.Integer,
+			"pos":         spec.Number,
+			"targetTime":  spec.Int64,
+			"frameIndex":  spec.Integer,
+			"timestamp":   spec.Int64,
+			"timestampUs": spec.Int64,
+			"fileOffset":  spec.Int64,
+		})),
+	})
+	segmentRange := func(extra map[string]*spec.Schema) *spec.Schema {
+		props := map[string]*spec.Schema{
+			"fileIndex": spec.Integer,
+			"channel":   spec.Integer,
+			"startTime": spec.Int64,
+			"endTime":   spec.Int64,
+		}
+		for k, v := range extra {
+			props[k] = v
+		}
+		return spec.Object(props)
+	}
+	doc.Add("GET", "/api/v1/keyframes/{file_index}", &spec.Operation{
+		Summary: "段落的 I 帧索引", OperationID: "getKeyframes", Tags: []string{"frames"},
+		Parameters: []*spec.Parameter{fileIndexParam, channelParam},
+		Responses:  ok("按时间排序的 I 帧", segmentRange(map[string]*spec.Schema{"keyframes": spec.ArrayOf(keyframe)})),
+	})
+	doc.Add("GET", "/api/v1/gop/{file_index}", &spec.Operation{
+		Summary: "覆盖指定时间的 GOP", OperationID: "getGOP", Tags: []string{"frames"},
+		Parameters: []*spec.Parameter{fileIndexParam, channelParam, requiredQuery("ts", spec.Number, "Unix 秒，可带小数")},
+		Responses: ok("ts 之前的 I 帧和到下一个 I 帧之前的所有帧", spec.Object(map[string]*spec.Schema{
+			"fileIndex":         spec.Integer,
+			"channel":           spec.Integer,
+			"keyframe":          gopFrame,
+			"frames":            spec.ArrayOf(gopFrame),
+			"frameCount":        spec.Integer,
+			"totalBytes":        spec.Int64,
+			"durationMs":        spec.Int64,
+			"nextKeyframeIndex": spec.Integer,
+			"lastGop":           spec.Boolean,
+		})),
+	})
+	doc.Add("GET", "/api/v1/segment/{file_index}/stats", &spec.Operation{
+		Summary: "段落的 GOP 结构和码率统计", OperationID: "getSegmentStats", Tags: []string{"frames"},
+		Parameters: []*spec.Parameter{fileIndexParam},
+		Responses: ok("按帧通道号统计", segmentRange(map[string]*spec.Schema{
+			"video": {Type: "object", AdditionalProperties: videoStats},
+		})),
+	})
+	doc.Add("GET", "/api/v1/verify/{file_index}", &spec.Operation{
+		Summary: "录像文件完整性检查", OperationID: "verifyRecording", Tags: []string{"frames"},
+		Parameters: []*spec.Parameter{fileIndexParam},
+		Responses:  ok("检查报告", verifyReport),
+	})
+	doc.Add("GET", "/api/v1/duplicates", &spec.Operation{
+		Summary: "内容相同的 TRec 文件", OperationID: "getDuplicates", Tags: []string{"frames"},
+		Description: "按已缓存帧索引的指纹（各通道记录数、设备时间戳范围、首末帧序号）分组，未缓存的段落不参与比较",
+		Responses: ok("包含两个以上文件的组", spec.Object(map[string]*spec.Schema{
+			"groups":     spec.ArrayOf(duplicateGroup),
+			"checked":    spec.Integer,
+			"uncached":   spec.Integer,
+			"duplicates": spec.Integer,
+		})),
+	})
+
+	// 二进制数据
+	doc.Add("GET", "/api/v1/stream", &spec.Operation{
+		Summary: "WebSocket 视频流", OperationID: "stream", Tags: []string{"streaming"},
+		Description: "升级为 WebSocket，控制消息为 JSON，视频帧为二进制（见 README）",
+		Parameters: []*spec.Parameter{
+			queryParam("audio", spec.String, "g711（默认）或 aac"),
+			queryParam("sessionToken", spec.String, "断线重连时恢复会话"),
+		},
+		Responses: map[string]*spec.Response{"101": {Description: "切换到 WebSocket"}, "default": errorResponse},
+	})
+	doc.Add("GET", "/api/v1/init/{file_index}", &spec.Operation{
+		Summary: "首个可解码 GOP 的初始化段", OperationID: "getInitSegment", Tags: []string{"streaming"},
+		Parameters: []*spec.Parameter{fileIndexParam, channelParam},
+		Responses:  binary("与 WebSocket 视频帧相同的格式", "application/octet-stream"),
+	})
+	doc.Add("GET", "/api/v1/export/{file_index}", &spec.Operation{
+		Summary: "导出时间范围内的 H.265 裸流", OperationID: "exportClip", Tags: []string{"streaming"},
+		Description: "从 from 之前的 I 帧开始；X-Clip-Preroll-Ms 为播放时需要跳过的时长",
+		Parameters: []*spec.Parameter{
+			fileIndexParam, channelParam,
+			queryParam("from", spec.Number, "Unix 秒，默认段落开始"),
+			queryParam("to", spec.Number, "Unix 秒，默认段落结束"),
+			queryParam("trim", spec.Boolean, "尾部精确截断在 to"),
+		},
+		Responses: binary("H.265 Annex B", "video/H265"),
+	})
+	doc.Add("GET", "/api/v1/export/{file_index}/trec", &spec.Operation{
+		Summary: "把时间范围内的帧复制到新的 TRec 文件", OperationID: "exportTRec", Tags: []string{"streaming"},
+		Description: "范围与 exportClip 相同，包含所有通道的帧；输出为重建了帧索引的 256MB TRec 文件，可由厂商软件打开",
+		Parameters: []*spec.Parameter{
+			fileIndexParam, channelParam,
+			queryParam("from", spec.Number, "Unix 秒，默认段落开始"),
+			queryParam("to", spec.Number, "Unix 秒，默认段落结束"),
+			queryParam("trim", spec.Boolean, "尾部精确截断在 to"),
+		},
+		Responses: binary("TRec 文件", "application/octet-stream"),
+	})
+	doc.Add("GET", "/api/v1/contactsheet/{file_index}", &spec.Operation{
+		Summary: "段落关键帧缩略图网格", OperationID: "getContactSheet", Tags: []string{"streaming"},
+		Parameters: []*spec.Parameter{
+			fileIndexParam, channelParam,
+			queryParam("cols", spec.Integer, "列数"),
+			queryParam("rows", spec.Integer, "行数"),
+		},
+		Responses: binary("JPEG", "image/jpeg"),
+	})
+	doc.Add("GET", "/api/v1/mjpeg/{file_index}", &spec.Operation{
+		Summary: "段落的 MJPEG 流", OperationID: "getMJPEG", Tags: []string{"streaming"},
+		Description: "按实际速度播放，fps 不超过 1 时只解码 I 帧；需要 ffmpeg",
+		Parameters: []*spec.Parameter{
+			fileIndexParam, channelParam,
+			queryParam("fps", spec.Number, "输出帧率，默认 1，最大 10"),
+			queryParam("width", spec.Integer, "输出宽度，默认 640"),
+		},
+		Responses: binary("MJPEG", "multipart/x-mixed-replace"),
+	})
+	doc.Add("GET", "/api/v1/gif/{file_index}", &spec.Operation{
+		Summary: "时间范围的动画 GIF 预览", OperationID: "exportGIF", Tags: []string{"streaming"},
+		Description: "最多 60 秒、60 帧、8MB，超出时返回 400；超过 10 秒或 fps 不超过 1 时只解码 I 帧；需要 ffmpeg",
+		Parameters: []*spec.Parameter{
+			fileIndexParam, channelParam,
+			queryParam("from", spec.Number, "Unix 秒，默认段落开始"),
+			queryParam("to", spec.Number, "Unix 秒，默认 from 之后 5 秒"),
+			queryParam("fps", spec.Number, "取样帧率，默认 2，最大 10"),
+			queryParam("width", spec.Integer, "输出宽度，默认 320，最大 640"),
+		},
+		Responses: binary("GIF", "image/gif"),
+	})
+	doc.Add("GET", "/api/v1/frame_index/{file_index}/ndjson", &spec.Operation{
+		Summary: "流式导出全部帧索引记录", OperationID: "getFrameIndexNDJSON", Tags: []string{"frames"},
+		Description: "每行一个 FrameIndexLine，按文件顺序边解析边输出，不排序",
+		Parameters:  []*spec.Parameter{fileIndexParam},
+		Responses: map[string]*spec.Response{
+			"200":     {Description: "NDJSON", Content: map[string]*spec.MediaType{"application/x-ndjson": {Schema: frameIndexLine}}},
+			"default": errorResponse,
+		},
+	})
+	doc.Add("GET", "/api/v1/raw/{file_index}", &spec.Operation{
+		Summary: "TRec 文件任意偏移的原始字节", OperationID: "getRawBytes", Tags: []string{"debug"},
+		Description: "需要 -debug 或 -auth-token",
+		Parameters: []*spec.Parameter{
+			fileIndexParam,
+			queryParam("offset", spec.String, "十进制或 0x 十六进制"),
+			queryParam("length", spec.Integer, "默认 256，最多 1MB"),
+			queryParam("format", spec.String, "hexdump 时返回文本"),
+		},
+		Responses: binary("原始字节", "application/octet-stream"),
+	})
+	doc.Add("GET", "/api/v1/layout/{file_index}", &spec.Operation{
+		Summary: "TRec 文件的字节布局", OperationID: "getFileLayout", Tags: []string{"debug"},
+		Description: "帧索引偏移、索引和数据区域、条目大小、通道和帧类型统计、VPS 扫描范围；需要 -debug 或 -auth-token",
+		Parameters:  []*spec.Parameter{fileIndexParam},
+		Responses:   ok("字节布局", trecLayout),
+	})
+
+	doc.Add("GET", openAPIPath, &spec.Operation{
+		Summary: "本文档", OperationID: "getOpenAPI", Tags: []string{"meta"},
+		Responses: map[string]*spec.Response{"200": jsonResponse("OpenAPI 3 文档", &spec.Schema{Type: "object"})},
+	})
+	return doc
+}
+
+// routeParamPattern iris 路由参数，如 {file_index:int}
+var routeParamPattern = regexp.MustCompile(`\{(\w+)(:[^}]*)?\}`)
+
+// checkAPIDocument 检查已注册的 /api 路由都在文档中
+func checkAPIDocument(app *iris.Application) {
+	if missing := undocumentedRoutes(app); len(missing) > 0 {
+		seetong.LogWarn("OpenAPI 文档缺少路由", "routes", strings.Join(missing, ", "))
+	}
+}
+
+// undocumentedRoutes 已注册但不在文档中的 /api 路由（"GET /api/v1/..."，已排序）
+func undocumentedRoutes(app *iris.Application) []string {
+	doc := apiDocument()
+	var missing []string
+	for _, r := range app.GetRoutes() {
+		path := routeParamPattern.ReplaceAllString(r.Tmpl().Src, "{$1}")
+		if !strings.HasPrefix(path, "/api/") || r.Method == iris.MethodOptions || r.Method == iris.MethodHead {
+			continue
+		}
+		if !doc.Has(r.Method, path) {
+			missing = append(missing, r.Method+" "+path)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
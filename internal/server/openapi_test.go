@@ -0,0 +1,34 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"seetong-dvr/internal/config"
+
+	"github.com/kataras/iris/v12"
+)
+
+func TestAPIDocumentCoversRoutes(t *testing.T) {
+	app := iris.New()
+	RegisterRoutes(app, NewHandlers(NewDVRServer(t.TempDir()), config.NewStore("", config.Default())))
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+	if missing := undocumentedRoutes(app); len(missing) > 0 {
+		t.Fatalf("routes missing from the OpenAPI document:\n%s", strings.Join(missing, "\n"))
+	}
+
+	// 文档中的每个接口都有对应的路由
+	registered := make(map[string]bool)
+	for _, r := range app.GetRoutes() {
+		registered[strings.ToLower(r.Method)+" "+routeParamPattern.ReplaceAllString(r.Tmpl().Src, "{$1}")] = true
+	}
+	for path, item := range apiDocument().Paths {
+		for method := range item {
+			if !registered[method+" "+path] {
+				t.Errorf("documented %s %s is not registered", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
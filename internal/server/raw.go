@@ -0,0 +1,134 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"seetong-dvr/internal/seetong"
+
+	"github.com/kataras/iris/v12"
+)
+
+// 原始字节读取参数
+const (
+	rawDefaultLength = 256
+	rawMaxLength     = 1 << 20 // 单次最多 1MB
+	hexdumpWidth     = 16
+)
+
+// rawAccessAllowed 原始数据接口只在调试模式或启用访问令牌时开放
+func (h *Handlers) rawAccessAllowed() bool {
+	return seetong.IsDebugMode() || h.cfg.Get().AuthToken != ""
+}
+
+// GetRawBytes 读取 TRec 文件任意偏移处的原始字节（格式分析用）
+// GET /api/v1/raw/{file_index}?offset=<0x十六进制|十进制>&length=<n>&format=hexdump
+//
+// 需要 -debug 或 -auth-token；length 默认 256、上限 1MB，读取范围不超过 256MB 的 TRec 文件。
+// format=hexdump 时返回带文件偏移、十六进制和 ASCII 列的文本
+func (h *Handlers) GetRawBytes(ctx iris.Context) {
+	if !h.rawAccessAllowed() {
+		writeError(ctx, errRawDisabled)
+		return
+	}
+
+	storage := h.dvr.GetStorage()
+	if storage == nil || !h.dvr.IsLoaded() {
+		writeError(ctx, errNotLoaded)
+		return
+	}
+
+	fileIndex := ctx.Params().GetIntDefault("file_index", 0)
+	offset, err := strconv.ParseInt(ctx.URLParamDefault("offset", "0"), 0, 64)
+	if err != nil {
+		writeError(ctx, errInvalidParam("无效的 offset 参数", "invalid offset parameter"))
+		return
+	}
+	length := ctx.URLParamIntDefault("length", rawDefaultLength)
+	if offset < 0 || offset >= seetong.TRecFileSize || length <= 0 || length > rawMaxLength {
+		writeError(ctx, newAPIError(400, ReasonOutOfRange, "读取范围无效", "read range out of bounds").
+			WithDetail(fmt.Sprintf("offset 0..0x%X, length 1..%d", seetong.TRecFileSize-1, rawMaxLength)))
+		return
+	}
+	if remaining := seetong.TRecFileSize - offset; int64(length) > remaining {
+		length = int(remaining)
+	}
+
+	data, err := storage.ReadRaw(fileIndex, offset, length)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	ctx.Header("X-Raw-Offset", fmt.Sprint(offset))
+	ctx.Header("X-Raw-Length", fmt.Sprint(len(data)))
+	if ctx.URLParam("format") == "hexdump" {
+		ctx.ContentType("text/plain; charset=utf-8")
+		ctx.WriteString(hexdump(data, offset))
+		return
+	}
+	ctx.ContentType("application/octet-stream")
+	ctx.Write(data)
+}
+
+// GetFileLayout TRec 文件的字节布局（帧索引位置、各区域范围、条目统计、VPS 扫描结果）
+// GET /api/v1/layout/{file_index}
+//
+// 与 -dump-file 相同的信息，供外部解析器核对实现；需要 -debug 或 -auth-token
+func (h *Handlers) GetFileLayout(ctx iris.Context) {
+	if !h.rawAccessAllowed() {
+		writeError(ctx, errRawDisabled)
+		return
+	}
+
+	storage := h.dvr.GetStorage()
+	if storage == nil || !h.dvr.IsLoaded() {
+		writeError(ctx, errNotLoaded)
+		return
+	}
+
+	recFile := storage.GetRecFile(ctx.Params().GetIntDefault("file_index", 0))
+	if recFile == "" {
+		writeError(ctx, errRecFileMissing)
+		return
+	}
+	layout, err := seetong.DescribeTRecLayout(recFile)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+	ctx.JSON(layout)
+}
+
+// hexdump 按 hexdump -C 的格式输出，行首为文件偏移
+func hexdump(data []byte, base int64) string {
+	var sb strings.Builder
+	for i := 0; i < len(data); i += hexdumpWidth {
+		end := i + hexdumpWidth
+		if end > len(data) {
+			end = len(data)
+		}
+		line := data[i:end]
+		fmt.Fprintf(&sb, "%08x  ", base+int64(i))
+		for j := 0; j < hexdumpWidth; j++ {
+			if j < len(line) {
+				fmt.Fprintf(&sb, "%02x ", line[j])
+			} else {
+				sb.WriteString("   ")
+			}
+			if j == hexdumpWidth/2-1 {
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString(" |")
+		for _, b := range line {
+			if b < 0x20 || b > 0x7e {
+				b = '.'
+			}
+			sb.WriteByte(b)
+		}
+		sb.WriteString("|\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"seetong-dvr/internal/seetong"
+)
+
+// 等待同一令牌的旧连接退出的最长时间
+const reconnectTakeoverTimeout = 2 * time.Second
+
+// savedSession 连接断开时的播放状态
+type savedSession struct {
+	cursor  *streamCursor // nil 表示没有可继续的位置
+	channel int
+	speed   float64
+	live    bool
+	playing bool // 断开时是否正在播放（暂停中断开的重连后保持暂停）
+	expires time.Time
+
+	timeline *dayTimeline // playTimeline 模式的时间线
+}
+
+// reconnectStore 断线重连令牌
+// 连接时发放令牌，断开时按令牌保存播放状态，客户端在 TTL 内带令牌重连即可从原位置继续。
+// 移动网络切换时旧连接可能还没有被检测到断开，重连会先关闭持有同一令牌的旧连接再接管其状态
+type reconnectStore struct {
+	ttl    time.Duration
+	mu     sync.Mutex
+	active map[string]*StreamSession
+	saved  map[string]*savedSession
+}
+
+func newReconnectStore(ttl time.Duration) *reconnectStore {
+	return &reconnectStore{
+		ttl:    ttl,
+		active: make(map[string]*StreamSession),
+		saved:  make(map[string]*savedSession),
+	}
+}
+
+// enabled 是否发放令牌
+func (r *reconnectStore) enabled() bool {
+	return r.ttl > 0
+}
+
+// newSessionToken 生成不透明的随机令牌
+func newSessionToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// attach 为新连接绑定令牌
+// token 有效时返回断开前的状态（状态只能取出一次），否则发放新令牌
+func (r *reconnectStore) attach(s *StreamSession, token string) (string, *savedSession) {
+	if token != "" {
+		r.mu.Lock()
+		old := r.active[token]
+		r.mu.Unlock()
+		if old != nil {
+			old.ws.Close()
+			select {
+			case <-old.closed:
+			case <-time.After(reconnectTakeoverTimeout):
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sweepLocked()
+
+	state, ok := r.saved[token]
+	if !ok {
+		token = newSessionToken()
+	}
+	delete(r.saved, token)
+	r.active[token] = s
+	return token, state
+}
+
+// detach 连接断开，保存播放状态
+// 令牌已被新连接接管时不保存
+func (r *reconnectStore) detach(s *StreamSession, token string, state savedSession) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.active[token] != s {
+		return
+	}
+	delete(r.active, token)
+	state.expires = time.Now().Add(r.ttl)
+	r.saved[token] = &state
+	r.sweepLocked()
+}
+
+// sweepLocked 清理过期的状态
+func (r *reconnectStore) sweepLocked() {
+	now := time.Now()
+	for token, state := range r.saved {
+		if now.After(state.expires) {
+			delete(r.saved, token)
+		}
+	}
+}
+
+// frameIndexAtOffset 返回文件偏移 pos 之前最后一个属于 frameChannel 的帧序号
+func frameIndexAtOffset(records []seetong.FrameIndexRecord, frameChannel uint32, pos int64) int {
+	idx := 0
+	for i, r := range records {
+		if r.Channel == frameChannel && int64(r.FileOffset) < pos {
+			idx = i
+		}
+	}
+	return idx
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"seetong-dvr/internal/seetong"
+)
+
+// seekMissMessage 指定时间没有已缓存录像时发送给客户端的错误
+// 区分三种情况：晚于最后一段录像（seek_past_end）、位于录像之间的空白（seek_gap，附带下一段的开始时间），
+// 以及段落存在但尚未建立索引（沿用原有的错误消息）
+// 只考虑该通道的段落，该通道没有任何段落时（如纯音频）考虑所有段落
+func seekMissMessage(storage *seetong.TPSStorage, timestamp int64, channel int) map[string]interface{} {
+	segments := storage.GetSegments()
+	var candidates []seetong.SegmentRecord
+	for _, seg := range segments {
+		if seg.Channel == segmentChannelFor(channel) {
+			candidates = append(candidates, seg)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = segments
+	}
+
+	var lastEnd, prevEnd, nextStart int64
+	for _, seg := range candidates {
+		if seg.StartTime <= timestamp && timestamp <= seg.EndTime {
+			return map[string]interface{}{"error": "未找到指定时间的录像"}
+		}
+		if seg.EndTime > lastEnd {
+			lastEnd = seg.EndTime
+		}
+		if seg.EndTime < timestamp && seg.EndTime > prevEnd {
+			prevEnd = seg.EndTime
+		}
+		if seg.StartTime > timestamp && (nextStart == 0 || seg.StartTime < nextStart) {
+			nextStart = seg.StartTime
+		}
+	}
+
+	if nextStart == 0 {
+		msg := map[string]interface{}{
+			"error":   "指定时间晚于最后一段录像",
+			"reason":  ReasonSeekPastEnd,
+			"channel": channel,
+		}
+		if lastEnd > 0 {
+			msg["lastTime"] = lastEnd
+		}
+		return msg
+	}
+	msg := map[string]interface{}{
+		"error":    "指定时间没有录像",
+		"reason":   ReasonSeekGap,
+		"channel":  channel,
+		"nextTime": nextStart,
+	}
+	if prevEnd > 0 {
+		msg["previousTime"] = prevEnd
+	}
+	return msg
+}
+
+// clampSeekOffset 目标偏移之后没有该通道的 I 帧时（定位到段落末尾附近或 EndTime），
+// 改为从段落最后一个 I 帧开始，让客户端看到最后一个 GOP，而不是立即收到 stream_end
+func clampSeekOffset(frames []seetong.FrameIndexRecord, targetOffset int64, frameChannel uint32) (int64, bool) {
+	last := int64(-1)
+	for _, f := range frames {
+		if f.Channel != frameChannel || !f.IsIFrame() {
+			continue
+		}
+		if int64(f.FileOffset) >= targetOffset {
+			return targetOffset, false
+		}
+		if int64(f.FileOffset) > last {
+			last = int64(f.FileOffset)
+		}
+	}
+	if last < 0 {
+		return targetOffset, false
+	}
+	return last, true
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"seetong-dvr/internal/seetong"
+)
+
+func TestSeekMissMessage(t *testing.T) {
+	day := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	first := fixtureSegment{Channel: 1, Start: day, End: day.Add(8 * time.Second)}
+	last := fixtureSegment{Channel: 1, Start: day.Add(10 * time.Minute), End: day.Add(10*time.Minute + 8*time.Second)}
+	other := fixtureSegment{Channel: 2, Start: day.Add(20 * time.Minute), End: day.Add(20*time.Minute + 8*time.Second)}
+	s := loadFixtureDVR(t, writeFixtureDVR(t, first, last, other), FixedClock{Time: day.Add(time.Hour), Location: time.UTC}, "UTC")
+	storage := s.GetStorage()
+
+	notIndexed := map[string]interface{}{"error": "未找到指定时间的录像"}
+	for _, tc := range []struct {
+		name    string
+		ts      time.Time
+		channel int
+		want    map[string]interface{}
+	}{
+		{"inside a segment", first.Start.Add(3 * time.Second), 1, notIndexed},
+		{"at the last segment end", last.End, 1, notIndexed},
+		{"in a gap", day.Add(5 * time.Minute), 1, map[string]interface{}{
+			"error": "指定时间没有录像", "reason": ReasonSeekGap, "channel": 1,
+			"nextTime": last.Start.Unix(), "previousTime": first.End.Unix(),
+		}},
+		{"before the first segment", day.Add(-time.Hour), 1, map[string]interface{}{
+			"error": "指定时间没有录像", "reason": ReasonSeekGap, "channel": 1,
+			"nextTime": first.Start.Unix(),
+		}},
+		// 通道 2 更晚的段落不影响通道 1
+		{"past the end", last.End.Add(time.Second), 1, map[string]interface{}{
+			"error": "指定时间晚于最后一段录像", "reason": ReasonSeekPastEnd, "channel": 1,
+			"lastTime": last.End.Unix(),
+		}},
+		{"other channel gap", last.End.Add(time.Second), 2, map[string]interface{}{
+			"error": "指定时间没有录像", "reason": ReasonSeekGap, "channel": 2,
+			"nextTime": other.Start.Unix(),
+		}},
+	} {
+		if got := seekMissMessage(storage, tc.ts.Unix(), tc.channel); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestClampSeekOffset(t *testing.T) {
+	frames, _ := fixtureFrames(time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC).Unix())
+	var iframes []int64
+	for _, f := range frames {
+		if f.Channel == seetong.ChannelVideo1 && f.IsIFrame() {
+			iframes = append(iframes, int64(f.FileOffset))
+		}
+	}
+	lastI := iframes[len(iframes)-1]
+	end := int64(frames[len(frames)-1].FileOffset)
+
+	for _, tc := range []struct {
+		name    string
+		target  int64
+		channel uint32
+		want    int64
+		clamped bool
+	}{
+		{"before the first I frame", 0, seetong.ChannelVideo1, 0, false},
+		{"at an I frame", iframes[2], seetong.ChannelVideo1, iframes[2], false},
+		{"inside a GOP", iframes[2] + 1, seetong.ChannelVideo1, iframes[2] + 1, false},
+		{"at the last I frame", lastI, seetong.ChannelVideo1, lastI, false},
+		{"no I frame after the target", lastI + 1, seetong.ChannelVideo1, lastI, true},
+		{"at the last frame", end, seetong.ChannelVideo1, lastI, true},
+		{"channel without I frames", end, seetong.ChannelVideo2, end, false},
+	} {
+		got, clamped := clampSeekOffset(frames, tc.target, tc.channel)
+		if got != tc.want || clamped != tc.clamped {
+			t.Errorf("%s: offset %d clamped %v, want %d clamped %v", tc.name, got, clamped, tc.want, tc.clamped)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"bytes"
+	"io/fs"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/kataras/iris/v12"
+)
+
+// spaIndex 单页应用入口
+const spaIndex = "index.html"
+
+// RegisterSPA 注册前端静态文件和单页应用回退
+// 存在的文件直接返回；不存在且扩展名为已知静态资源类型（.js/.css/.png 等）时返回 404；
+// 其余路径（如 /2024-01-02/ch2 这类前端路由）返回 index.html，刷新深链接不会 404。
+// /api/ 下未注册的路径返回 JSON 404，不会被前端入口遮蔽
+func RegisterSPA(app *iris.Application, fsys fs.FS) {
+	startTime := time.Now() // 嵌入文件没有修改时间，用启动时间作为 Last-Modified
+
+	handler := func(ctx iris.Context) {
+		reqPath := ctx.Path()
+		if reqPath == "/api" || strings.HasPrefix(reqPath, "/api/") {
+			writeError(ctx, errAPINotFound)
+			return
+		}
+
+		name := strings.TrimPrefix(path.Clean(reqPath), "/")
+		if name == "" {
+			name = spaIndex
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			if mime.TypeByExtension(path.Ext(name)) != "" {
+				ctx.StatusCode(404)
+				return
+			}
+			name = spaIndex
+			if data, err = fs.ReadFile(fsys, name); err != nil {
+				ctx.StatusCode(404)
+				return
+			}
+		}
+
+		ctx.ServeContent(bytes.NewReader(data), name, startTime)
+	}
+
+	app.Get("/", handler)
+	app.Get("/{path:path}", handler)
+}
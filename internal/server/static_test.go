@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"seetong-dvr/internal/config"
+
+	"github.com/kataras/iris/v12"
+)
+
+func TestSPAFallback(t *testing.T) {
+	const index = "<!doctype html><title>Seetong DVR</title>"
+	static := fstest.MapFS{
+		"index.html": {Data: []byte(index)},
+		"app.js":     {Data: []byte("console.log(1)")},
+	}
+	_, srv := startFixtureServer(t, config.Default(), func(app *iris.Application) { RegisterSPA(app, static) })
+
+	get := func(path string) (*http.Response, string) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(body)
+	}
+
+	// 前端路由和根路径返回入口页面
+	for _, path := range []string{"/", "/recordings/2024-01-01", "/2024-01-02/ch2"} {
+		resp, body := get(path)
+		if resp.StatusCode != http.StatusOK || body != index || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+			t.Errorf("%s: status %d, %s %q, want index.html", path, resp.StatusCode, resp.Header.Get("Content-Type"), body)
+		}
+	}
+
+	// 静态资源原样返回，不存在的资源不回退到入口页面
+	if resp, body := get("/app.js"); resp.StatusCode != http.StatusOK || body != "console.log(1)" {
+		t.Errorf("/app.js: status %d, body %q", resp.StatusCode, body)
+	}
+	if resp, body := get("/missing.js"); resp.StatusCode != http.StatusNotFound || body == index {
+		t.Errorf("/missing.js: status %d, body %q, want 404", resp.StatusCode, body)
+	}
+
+	// 注册的接口仍然返回 JSON
+	resp, body := get("/api/v1/recordings/dates")
+	var dates map[string]interface{}
+	if resp.StatusCode != http.StatusOK || json.Unmarshal([]byte(body), &dates) != nil {
+		t.Fatalf("/api/v1/recordings/dates: status %d, body %q, want JSON", resp.StatusCode, body)
+	}
+
+	// /api 下未注册的路径返回 JSON 404
+	for _, path := range []string{"/api", "/api/v1/unknown", "/api/v2/recordings"} {
+		resp, body := get(path)
+		var apiErr APIError
+		if resp.StatusCode != http.StatusNotFound || json.Unmarshal([]byte(body), &apiErr) != nil || apiErr.Reason != ReasonNotFound {
+			t.Errorf("%s: status %d, body %q, want the JSON 404", path, resp.StatusCode, body)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"seetong-dvr/internal/seetong"
+)
+
+// stepFrame 从暂停位置前进或后退一帧（正在播放时先暂停）
+//
+// 前进直接发送下一帧；后退需要从覆盖目标帧的 I 帧开始解码，
+// 先发送 VPS/SPS/PPS 和该 I 帧，再依次发送到目标帧为止的所有帧。
+// 帧数据之前发送 step 消息，decodeFrames 为本次发送的视频帧数，
+// 客户端只需显示时间为 timestampMs 的最后一帧。步进后暂停位置随之更新，play 从新位置继续
+func (s *StreamSession) stepFrame(backward bool) {
+	cursor := s.cursor
+	if cursor == nil {
+		s.sendJSON(map[string]interface{}{"error": "没有可步进的暂停位置"})
+		return
+	}
+	if audioOnlyRequested(cursor.Channel) {
+		s.sendJSON(map[string]interface{}{"error": "纯音频播放不支持逐帧"})
+		return
+	}
+	dvr := s.getDVR()
+	storage := dvr.GetStorage()
+	if storage == nil || !dvr.IsLoaded() {
+		s.sendJSON(map[string]interface{}{"error": "DVR 未加载"})
+		return
+	}
+
+	records := storage.GetFrameIndex(cursor.FileIndex)
+	timeline := newMediaTimeline(records, uint32(frameChannelFor(cursor.Channel)))
+	video := timeline.video
+
+	// 当前显示的帧：暂停位置之前最后一个完整发送的视频帧
+	shown := sort.Search(len(video), func(i int) bool { return int64(video[i].FileOffset) >= cursor.StreamPos }) - 1
+	if shown >= 0 && int64(video[shown].FileOffset)+int64(video[shown].FrameSize) > cursor.StreamPos {
+		shown--
+	}
+	target := shown + 1
+	if backward {
+		target = shown - 1
+	}
+	if target < 0 || target >= len(video) {
+		edge := "最后一帧"
+		if backward {
+			edge = "第一帧"
+		}
+		s.sendJSON(map[string]interface{}{"error": "已经是段落的" + edge})
+		return
+	}
+
+	// 前进时解码器已有参考帧，只发送目标帧中尚未发送的部分；
+	// 后退或重连后的新解码器从 I 帧开始
+	first, fromPos := target, cursor.StreamPos
+	fromIFrame := backward || s.freshDecoder
+	if fromIFrame {
+		first = -1
+		for i := target; i >= 0; i-- {
+			if video[i].IsIFrame() {
+				first = i
+				break
+			}
+		}
+		if first < 0 {
+			s.sendJSON(map[string]interface{}{"error": "未找到目标帧之前的 I 帧"})
+			return
+		}
+		fromPos = 0
+	}
+
+	streamID := atomic.AddUint64(&streamCounter, 1)
+	s.mu.Lock()
+	s.streamID = streamID
+	s.mu.Unlock()
+
+	direction := "forward"
+	if backward {
+		direction = "backward"
+	}
+	targetMs := timeline.timeMs(video[target])
+	s.sendJSON(map[string]interface{}{
+		"type":         "step",
+		"direction":    direction,
+		"fileIndex":    cursor.FileIndex,
+		"frameIndex":   recordIndex(records, video[target]),
+		"frameType":    video[target].FrameType,
+		"timestamp":    targetMs / 1000,
+		"timestampMs":  targetMs,
+		"decodeFrames": target - first + 1,
+	})
+
+	var buf []byte
+	defer func() { seetong.PutFrameBuffer(buf) }()
+	for i := first; i <= target; i++ {
+		frame := video[i]
+		var err error
+		if buf, err = storage.ReadFrameIntoContext(s.conn, cursor.FileIndex, frame, buf); err != nil {
+			s.sendJSON(map[string]interface{}{"error": fmt.Sprintf("读取帧失败: %v", err)})
+			return
+		}
+		if fromIFrame && i == first {
+			if !s.sendParameterSets(streamID, storage, cursor.FileIndex, frame, buf, timeline.timeMs(frame)) {
+				return
+			}
+		}
+		if !s.sendFrameNals(streamID, frame, buf, fromPos, timeline.timeMs(frame)) {
+			return
+		}
+	}
+	s.freshDecoder = false
+
+	// 更新暂停位置；步进时不播放音频，跳过目标帧之前的音频帧
+	cursor.StreamPos = int64(video[target].FileOffset) + int64(video[target].FrameSize)
+	cursor.TimestampMs = targetMs
+	audioFrames := storage.GetAudioFrames(cursor.FileIndex)
+	cursor.AudioIdx = len(audioFrames)
+	for i, af := range audioFrames {
+		if af.FileOffset > video[target].FileOffset {
+			cursor.AudioIdx = i
+			break
+		}
+	}
+}
+
+// sendParameterSets I 帧数据本身不带 VPS 时补发段落的 VPS/SPS/PPS
+func (s *StreamSession) sendParameterSets(streamID uint64, storage *seetong.TPSStorage, fileIndex int, frame seetong.FrameIndexRecord, data []byte, tsMs int64) bool {
+	for _, nal := range seetong.ParseNalUnits(data) {
+		if nal.NalType == seetong.NalVPS {
+			return true
+		}
+	}
+	header := storage.ReadVideoHeader(fileIndex, int64(frame.FileOffset))
+	if header == nil {
+		s.sendJSON(map[string]interface{}{"type": "error", "message": "未找到视频头"})
+		return false
+	}
+	return s.sendVideoFrameWithID(streamID, header.VPS, seetong.NalVPS, tsMs) &&
+		s.sendVideoFrameWithID(streamID, header.SPS, seetong.NalSPS, tsMs) &&
+		s.sendVideoFrameWithID(streamID, header.PPS, seetong.NalPPS, tsMs)
+}
+
+// sendFrameNals 逐个发送帧中的 NAL，跳过文件偏移 fromPos 之前已发送的部分
+func (s *StreamSession) sendFrameNals(streamID uint64, frame seetong.FrameIndexRecord, data []byte, fromPos int64, tsMs int64) bool {
+	for _, nal := range seetong.ParseNalUnits(data) {
+		if int64(frame.FileOffset)+int64(nal.Offset) < fromPos {
+			continue
+		}
+		nalData := seetong.StripStartCode(data[nal.Offset : nal.Offset+nal.Size])
+		if !s.sendVideoFrameWithID(streamID, nalData, nal.NalType, tsMs) {
+			return false
+		}
+	}
+	return true
+}
+
+// recordIndex 帧在段落帧索引中的序号（与 /frame/{file_index}/{frame_idx} 一致）
+func recordIndex(records []seetong.FrameIndexRecord, frame seetong.FrameIndexRecord) int {
+	for i, r := range records {
+		if r.FileOffset == frame.FileOffset && r.Channel == frame.Channel {
+			return i
+		}
+	}
+	return -1
+}
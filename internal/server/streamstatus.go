@@ -0,0 +1,133 @@
+package server
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// streamProgress 流 goroutine 发布的播放进度和发送统计
+// 流 goroutine 每帧更新，读循环处理 status 命令时读取；字段都是原子值，查询不会阻塞正在发送的流
+type streamProgress struct {
+	startedAt   atomic.Int64 // 流开始的 Unix 毫秒
+	fileIndex   atomic.Int64 // 正在播放的段落
+	timestampMs atomic.Int64 // 最后发送的帧时间（纯音频时为音频帧）
+	frames      atomic.Int64 // 已发送的二进制消息数
+	bytes       atomic.Int64 // 已发送的二进制字节数
+	lagMs       atomic.Int64 // 最后一帧落后计划发送时间的毫秒数
+	writeUs     atomic.Int64 // 最后一次 WebSocket 写入的耗时（客户端接收慢、发送缓冲区满时变长）
+	maxWriteUs  atomic.Int64
+	ended       atomic.Bool // 流已播放到末尾（最后一段结束后不再发送）
+}
+
+// reset 新的流开始时清零（在启动流 goroutine 之前调用）
+func (p *streamProgress) reset(now time.Time) {
+	p.startedAt.Store(now.UnixMilli())
+	p.fileIndex.Store(-1)
+	p.timestampMs.Store(0)
+	p.frames.Store(0)
+	p.bytes.Store(0)
+	p.lagMs.Store(0)
+	p.writeUs.Store(0)
+	p.maxWriteUs.Store(0)
+	p.ended.Store(false)
+}
+
+// wrote 记录一次成功的二进制写入（调用方持有 StreamSession.mu）
+func (p *streamProgress) wrote(n int, took time.Duration) {
+	p.frames.Add(1)
+	p.bytes.Add(int64(n))
+	us := took.Microseconds()
+	p.writeUs.Store(us)
+	if us > p.maxWriteUs.Load() {
+		p.maxWriteUs.Store(us)
+	}
+}
+
+// 播放状态（status 命令的 state 字段）
+const (
+	streamStateIdle    = "idle"    // 没有播放过，或 live 停止后
+	streamStatePlaying = "playing" // 流正在发送
+	streamStatePaused  = "paused"  // 已暂停，不带 timestamp 的 play 从暂停位置继续
+	streamStateEnded   = "ended"   // 已播放到末尾
+)
+
+// StreamStats status 命令返回的发送统计
+type StreamStats struct {
+	UptimeMs    int64   `json:"uptimeMs"`    // 流已运行的时间
+	FramesSent  int64   `json:"framesSent"`  // 已发送的二进制消息数（视频 NAL 和音频帧）
+	BytesSent   int64   `json:"bytesSent"`   // 已发送的二进制字节数
+	LagMs       int64   `json:"lagMs"`       // 最后一帧落后计划发送时间的毫秒数，持续增加说明服务端读取跟不上
+	LastWriteMs float64 `json:"lastWriteMs"` // 最后一次 WebSocket 写入的耗时，持续变长说明客户端接收跟不上
+	MaxWriteMs  float64 `json:"maxWriteMs"`  // 本次流中最长的一次写入
+}
+
+// StreamStatus status 命令的响应
+type StreamStatus struct {
+	Type          string       `json:"type"` // 固定为 "status"
+	State         string       `json:"state"`
+	Mode          string       `json:"mode"` // recording / timeline / live
+	StreamID      uint64       `json:"streamId,omitempty"`
+	Channel       int          `json:"channel"`
+	Speed         float64      `json:"speed"`
+	FileIndex     *int         `json:"fileIndex,omitempty"`
+	TimestampMs   int64        `json:"timestampMs,omitempty"` // 当前播放位置（最后发送的帧时间）
+	FrameTypes    []string     `json:"frameTypes"`
+	StrictChannel bool         `json:"strictChannel"`
+	LagPolicy     string       `json:"lagPolicy"`
+	Stats         *StreamStats `json:"stats,omitempty"` // 只在 playing/ended 时返回
+}
+
+// status 汇总当前的播放状态（在读循环中调用）
+// 流运行时从 progress 读取位置，暂停后从 cursor 读取（stop() 之后 cursor 只由读循环访问）
+func (s *StreamSession) status(now time.Time) StreamStatus {
+	st := StreamStatus{
+		Type:          "status",
+		State:         streamStateIdle,
+		Mode:          "recording",
+		Channel:       s.channel,
+		Speed:         s.speed,
+		FrameTypes:    s.frameTypes.names(),
+		StrictChannel: s.strict,
+		LagPolicy:     s.lag.name(),
+	}
+	switch {
+	case s.live:
+		st.Mode = "live"
+	case s.timeline != nil:
+		st.Mode = "timeline"
+	}
+
+	s.mu.Lock()
+	running := s.cancel != nil
+	streamID := s.streamID
+	s.mu.Unlock()
+
+	p := &s.progress
+	switch {
+	case running:
+		st.State = streamStatePlaying
+		if p.ended.Load() {
+			st.State = streamStateEnded
+		}
+		st.StreamID = streamID
+		if fileIndex := int(p.fileIndex.Load()); fileIndex >= 0 {
+			st.FileIndex = &fileIndex
+		}
+		st.TimestampMs = p.timestampMs.Load()
+		st.Stats = &StreamStats{
+			UptimeMs:    now.UnixMilli() - p.startedAt.Load(),
+			FramesSent:  p.frames.Load(),
+			BytesSent:   p.bytes.Load(),
+			LagMs:       p.lagMs.Load(),
+			LastWriteMs: float64(p.writeUs.Load()) / 1000,
+			MaxWriteMs:  float64(p.maxWriteUs.Load()) / 1000,
+		}
+	case s.cursor != nil:
+		st.State = streamStatePaused
+		fileIndex := s.cursor.FileIndex
+		st.FileIndex = &fileIndex
+		st.Channel = s.cursor.Channel
+		st.TimestampMs = s.cursor.TimestampMs
+	}
+	return st
+}
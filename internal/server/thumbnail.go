@@ -0,0 +1,65 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"os/exec"
+	"time"
+
+	"seetong-dvr/internal/seetong"
+)
+
+// 单帧解码超时
+const thumbnailDecodeTimeout = 10 * time.Second
+
+// keyframeAnnexB 读取 I 帧位置处的 VPS/SPS/PPS/IDR，拼成可独立解码的 Annex B 数据
+func keyframeAnnexB(storage *seetong.TPSStorage, fileIndex int, offset int64) ([]byte, error) {
+	header := storage.ReadVideoHeader(fileIndex, offset)
+	if header == nil {
+		return nil, errNoVideoHeader
+	}
+
+	var out []byte
+	for _, nal := range [][]byte{header.VPS, header.SPS, header.PPS, header.IDR} {
+		out = append(out, seetong.NalStartCode4...)
+		out = append(out, nal...)
+	}
+	return out, nil
+}
+
+// decodeThumbnail 通过 ffmpeg 将单个关键帧解码为缩放到 width 宽的图像（高度按比例）
+func decodeThumbnail(ctx context.Context, annexB []byte, width int) (image.Image, error) {
+	return decodeFrameAt(ctx, annexB, width, 0)
+}
+
+// decodeFrameAt 解码从关键帧开始的 Annex B 数据，返回第 n 个解码帧（0 为关键帧本身）
+func decodeFrameAt(ctx context.Context, annexB []byte, width, n int) (image.Image, error) {
+	bin := ffmpegPath()
+	if bin == "" {
+		return nil, fmt.Errorf("ffmpeg 不可用")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, thumbnailDecodeTimeout)
+	defer cancel()
+
+	filter := fmt.Sprintf("scale=%d:-2", width)
+	if n > 0 {
+		filter = fmt.Sprintf("select=eq(n\\,%d),%s", n, filter)
+	}
+	cmd := exec.CommandContext(ctx, bin,
+		"-hide_banner", "-loglevel", "error",
+		"-f", "hevc", "-i", "pipe:0",
+		"-frames:v", "1", "-vf", filter,
+		"-f", "image2pipe", "-vcodec", "png", "pipe:1")
+	cmd.Stdin = bytes.NewReader(annexB)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg 解码失败: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return png.Decode(&stdout)
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+
+	"seetong-dvr/internal/seetong"
+)
+
+// dayTimeline 一天内某个通道的全部录像，按时间顺序连续播放
+type dayTimeline struct {
+	date     string
+	channel  int
+	segments []RecordingInfo // 按开始时间排序，时间已裁剪到当天范围
+}
+
+// timelineGap 录像之间的空白
+type timelineGap struct {
+	From     int64 `json:"from"`
+	To       int64 `json:"to"`
+	Duration int64 `json:"duration"`
+}
+
+// buildDayTimeline 构建指定日期和通道的时间线（只包含已缓存的段落）
+func buildDayTimeline(dvr *DVRServer, date string, channel int) (*dayTimeline, error) {
+	recordings := dvr.GetRecordings(date, &channel)
+	if len(recordings) == 0 {
+		return nil, fmt.Errorf("%s 通道 %d 没有录像", date, channel)
+	}
+	sort.SliceStable(recordings, func(i, j int) bool {
+		return recordings[i].StartTimestamp < recordings[j].StartTimestamp
+	})
+	return &dayTimeline{date: date, channel: channel, segments: recordings}, nil
+}
+
+// resolve 将时间线上的时间映射到段落和段落内的起始时间
+// 落在空白中时从下一段录像的开头开始；ts 为 0 或早于第一段时从头开始
+func (t *dayTimeline) resolve(ts int64) (RecordingInfo, int64, bool) {
+	for _, seg := range t.segments {
+		if ts < seg.EndTimestamp {
+			if ts < seg.StartTimestamp {
+				ts = seg.StartTimestamp
+			}
+			return seg, ts, true
+		}
+	}
+	return RecordingInfo{}, 0, false
+}
+
+// next 返回 fileIndex 之后的下一段录像
+func (t *dayTimeline) next(fileIndex int) (RecordingInfo, bool) {
+	for i, seg := range t.segments {
+		if seg.ID == fileIndex && i+1 < len(t.segments) {
+			return t.segments[i+1], true
+		}
+	}
+	return RecordingInfo{}, false
+}
+
+// segment 返回时间线中的段落
+func (t *dayTimeline) segment(fileIndex int) (RecordingInfo, bool) {
+	for _, seg := range t.segments {
+		if seg.ID == fileIndex {
+			return seg, true
+		}
+	}
+	return RecordingInfo{}, false
+}
+
+// gaps 相邻录像之间的空白
+func (t *dayTimeline) gaps() []timelineGap {
+	gaps := []timelineGap{}
+	end := t.segments[0].EndTimestamp
+	for _, seg := range t.segments[1:] {
+		if seg.StartTimestamp > end {
+			gaps = append(gaps, timelineGap{From: end, To: seg.StartTimestamp, Duration: seg.StartTimestamp - end})
+		}
+		if seg.EndTimestamp > end {
+			end = seg.EndTimestamp
+		}
+	}
+	return gaps
+}
+
+// playbackOffset 按时间线播放到 ts 时已播放的秒数（从第一段录像开始，空白不计时）
+// 重叠的段落只计算一次
+func (t *dayTimeline) playbackOffset(ts int64) int64 {
+	var played int64
+	end := t.segments[0].StartTimestamp
+	for _, seg := range t.segments {
+		from, to := max(seg.StartTimestamp, end), min(seg.EndTimestamp, ts)
+		if to > from {
+			played += to - from
+		}
+		end = max(end, seg.EndTimestamp)
+	}
+	return played
+}
+
+// message 时间线概览，客户端据此绘制整天的进度条和书签标记
+func (t *dayTimeline) message(bookmarks []Bookmark) map[string]interface{} {
+	segments := make([]map[string]interface{}, len(t.segments))
+	for i, seg := range t.segments {
+		segments[i] = map[string]interface{}{
+			"fileIndex": seg.ID,
+			"start":     seg.StartTimestamp,
+			"end":       seg.EndTimestamp,
+		}
+	}
+	return map[string]interface{}{
+		"type":      "timeline",
+		"date":      t.date,
+		"channel":   t.channel,
+		"start":     t.segments[0].StartTimestamp,
+		"end":       t.segments[len(t.segments)-1].EndTimestamp,
+		"segments":  segments,
+		"gaps":      t.gaps(),
+		"bookmarks": bookmarks,
+	}
+}
+
+// startTimeline 开始连续播放一天的录像
+// msg.Timestamp 非 0 时从时间线上的该时间开始
+func (s *StreamSession) startTimeline(msg WSMessage) {
+	timeline, err := buildDayTimeline(s.getDVR(), msg.Date, msg.Channel)
+	if err != nil {
+		s.sendJSON(map[string]interface{}{"error": err.Error()})
+		return
+	}
+	s.timeline = timeline
+	s.sendJSON(timeline.message(s.timelineBookmarks(timeline)))
+	s.seekTimeline(msg.Timestamp, msg.Speed)
+}
+
+// timelineBookmarks 时间线当天该通道的书签，读取失败时不影响播放
+func (s *StreamSession) timelineBookmarks(t *dayTimeline) []Bookmark {
+	dvr := s.getDVR()
+	from, to, err := dvr.dayBounds(t.date)
+	if err != nil {
+		return []Bookmark{}
+	}
+	bookmarks, err := s.handlers.bookmarks.list(dvr.GetDVRPath(), from, to, &t.channel)
+	if err != nil {
+		seetong.LogWarn("读取书签失败", "error", err)
+		return []Bookmark{}
+	}
+	return bookmarks
+}
+
+// seekTimeline 在当前时间线内定位并播放
+func (s *StreamSession) seekTimeline(ts int64, speed float64) {
+	seg, startTs, ok := s.timeline.resolve(ts)
+	if !ok {
+		s.sendJSON(map[string]interface{}{"type": "stream_end", "timeline": true})
+		return
+	}
+	fmt.Printf("[WS] 时间线播放: %s ch=%d, file_index=%d, ts=%d, speed=%.1f\n",
+		s.timeline.date, s.timeline.channel, seg.ID, startTs, speed)
+	s.launchStream(s.timeline.channel, startTs, speed, streamStart{
+		timeline:  s.timeline,
+		fileIndex: seg.ID,
+	})
+}
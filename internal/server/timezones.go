@@ -0,0 +1,154 @@
+package server
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kataras/iris/v12"
+)
+
+// 时区列表来源
+const (
+	timezoneSourceTzdata  = "tzdata"  // 系统时区数据库的 zone1970.tab / zone.tab
+	timezoneSourceCurated = "curated" // 系统没有时区表时（如 Windows）使用内置的常用时区
+)
+
+// zoneinfoDirs 查找时区表的目录，与 time 包查找时区数据的位置相同
+var zoneinfoDirs = []string{
+	"/usr/share/zoneinfo/",
+	"/usr/share/lib/zoneinfo/",
+	"/usr/lib/locale/TZ/",
+	"/etc/zoneinfo/",
+}
+
+// curatedTimezones 常用时区（系统没有时区表时使用）
+var curatedTimezones = []string{
+	"UTC",
+	"Asia/Shanghai", "Asia/Hong_Kong", "Asia/Taipei", "Asia/Tokyo", "Asia/Seoul",
+	"Asia/Singapore", "Asia/Kuala_Lumpur", "Asia/Bangkok", "Asia/Jakarta", "Asia/Manila",
+	"Asia/Ho_Chi_Minh", "Asia/Kolkata", "Asia/Karachi", "Asia/Dubai", "Asia/Riyadh",
+	"Asia/Tehran", "Europe/Istanbul", "Europe/Moscow",
+	"Europe/London", "Europe/Lisbon", "Europe/Paris", "Europe/Berlin", "Europe/Madrid",
+	"Europe/Rome", "Europe/Amsterdam", "Europe/Warsaw", "Europe/Athens", "Europe/Kyiv",
+	"Africa/Cairo", "Africa/Johannesburg", "Africa/Lagos", "Africa/Nairobi",
+	"America/New_York", "America/Chicago", "America/Denver", "America/Phoenix",
+	"America/Los_Angeles", "America/Anchorage", "Pacific/Honolulu", "America/Toronto",
+	"America/Vancouver", "America/Mexico_City", "America/Bogota", "America/Lima",
+	"America/Santiago", "America/Sao_Paulo", "America/Argentina/Buenos_Aires",
+	"Australia/Perth", "Australia/Adelaide", "Australia/Brisbane", "Australia/Sydney",
+	"Pacific/Auckland",
+}
+
+var (
+	timezoneNamesOnce   sync.Once
+	timezoneNames       []string
+	timezoneNamesSource string
+)
+
+// loadTimezoneNames 读取系统时区表中的时区名（结果在进程内缓存），没有时区表时返回内置的常用时区
+func loadTimezoneNames() ([]string, string) {
+	timezoneNamesOnce.Do(func() {
+		timezoneNames, timezoneNamesSource = curatedTimezones, timezoneSourceCurated
+		for _, dir := range zoneinfoDirs {
+			for _, table := range []string{"zone1970.tab", "zone.tab"} {
+				if names := readZoneTable(filepath.Join(dir, table)); len(names) > 0 {
+					timezoneNames, timezoneNamesSource = append(names, "UTC"), timezoneSourceTzdata
+					return
+				}
+			}
+		}
+	})
+	return timezoneNames, timezoneNamesSource
+}
+
+// readZoneTable 读取 zone.tab 格式的时区表：每行以制表符分隔，第三列为时区名，# 开头为注释
+func readZoneTable(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if fields := strings.Split(line, "\t"); len(fields) >= 3 && fields[2] != "" {
+			names = append(names, fields[2])
+		}
+	}
+	return names
+}
+
+// TimezoneInfo 可用的时区
+type TimezoneInfo struct {
+	Name          string `json:"name"`          // IANA 时区名，可直接用于 POST /config 的 timezone
+	Offset        string `json:"offset"`        // 当前 UTC 偏移，如 +08:00
+	OffsetSeconds int    `json:"offsetSeconds"` // 当前 UTC 偏移（秒），夏令时期间包含夏令时
+	Abbreviation  string `json:"abbreviation"`  // 当前时区缩写，如 CST；没有缩写时为 +08 这样的偏移
+	Current       bool   `json:"current,omitempty"`
+}
+
+// formatUTCOffset 将秒数格式化为 +08:00 / -03:30
+func formatUTCOffset(seconds int) string {
+	sign := '+'
+	if seconds < 0 {
+		sign, seconds = '-', -seconds
+	}
+	return string(sign) + time.Unix(int64(seconds), 0).UTC().Format("15:04")
+}
+
+// GetTimezones 获取服务端接受的时区
+// GET /api/v1/timezones
+//
+// 系统有时区数据库时返回其中的全部时区（zone1970.tab），否则返回内置的常用时区，
+// 只包含能够加载的时区；当前时区不在列表中时也会加入并标记 current。
+// 按当前 UTC 偏移、再按名称排序，供配置界面的下拉框使用
+func (h *Handlers) GetTimezones(ctx iris.Context) {
+	clock := h.dvr.getClock()
+	now := clock.Now()
+	current := h.dvr.GetTimezone()
+
+	names, source := loadTimezoneNames()
+	seen := make(map[string]bool, len(names)+1)
+	timezones := make([]TimezoneInfo, 0, len(names)+1)
+	// names 为共享的缓存，限制容量使 append 复制而不是写入其底层数组
+	for _, name := range append(names[:len(names):len(names)], current) {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		loc, err := clock.LoadLocation(name)
+		if err != nil {
+			continue
+		}
+		abbr, offset := now.In(loc).Zone()
+		timezones = append(timezones, TimezoneInfo{
+			Name:          name,
+			Offset:        formatUTCOffset(offset),
+			OffsetSeconds: offset,
+			Abbreviation:  abbr,
+			Current:       name == current,
+		})
+	}
+	sort.Slice(timezones, func(i, j int) bool {
+		if timezones[i].OffsetSeconds != timezones[j].OffsetSeconds {
+			return timezones[i].OffsetSeconds < timezones[j].OffsetSeconds
+		}
+		return timezones[i].Name < timezones[j].Name
+	})
+
+	ctx.JSON(iris.Map{
+		"current":   current,
+		"source":    source,
+		"timezones": timezones,
+	})
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+
+	"seetong-dvr/internal/seetong"
+
+	"github.com/kataras/iris/v12"
+)
+
+// 完整性校验阈值
+const (
+	verifyMaxGOPFrames   = 250     // 25fps 下超过 10 秒没有 I 帧视为缺失关键帧
+	verifyMaxGapUs       = 2000000 // 相邻帧时间戳间隔超过 2 秒视为断档
+	verifyMaxIssueReport = 1000    // 报告中最多列出的异常数
+)
+
+// 异常类型
+const (
+	IssueOutOfBounds     = "out_of_bounds"
+	IssueEmptyFrame      = "empty_frame"
+	IssueReadError       = "read_error"
+	IssueNoStartCode     = "no_start_code"
+	IssueMissingKeyframe = "missing_keyframe"
+	IssueTimestampGap    = "timestamp_gap"
+	IssueTimestampBack   = "timestamp_backwards"
+)
+
+// VerifyIssue 单个异常
+type VerifyIssue struct {
+	FrameIndex int    `json:"frameIndex"` // 帧索引中的条目序号（文件顺序）
+	Type       string `json:"type"`
+	Detail     string `json:"detail"`
+}
+
+// VerifyReport 录像文件完整性报告
+type VerifyReport struct {
+	FileIndex     int           `json:"fileIndex"`
+	FrameCount    int           `json:"frameCount"`
+	VideoFrames   int           `json:"videoFrames"`
+	AudioFrames   int           `json:"audioFrames"`
+	IFrames       int           `json:"iFrames"`
+	Score         float64       `json:"score"` // 0~100，无异常帧为 100
+	IssueCount    int           `json:"issueCount"`
+	Issues        []VerifyIssue `json:"issues"`
+	ProblemFrames []int         `json:"problemFrames"`
+}
+
+// channelState 每个通道的校验状态
+type channelState struct {
+	seen       bool
+	lastTsUs   uint64
+	firstFrame int
+	framesSeen int // 视频帧数
+	sinceI     int // 上一个 I 帧之后经过的视频帧数
+	seenIFrame bool
+}
+
+// buildVerifyReport 校验录像文件：偏移越界、起始码、I 帧间隔和时间戳连续性
+// 按文件顺序检查原始帧索引：GetFrameIndex 已经丢弃了时间戳重置之后的条目并按时间排序，看不到回退
+func buildVerifyReport(storage *seetong.TPSStorage, fileIndex int) (*VerifyReport, error) {
+	entries, err := seetong.ReadTRecFrameIndexEntries(storage.GetRecFile(fileIndex))
+	if err != nil {
+		return nil, err
+	}
+	report := &VerifyReport{
+		FileIndex:     fileIndex,
+		Issues:        []VerifyIssue{},
+		ProblemFrames: []int{},
+	}
+
+	problem := make(map[int]bool)
+	addIssue := func(idx int, typ, detail string) {
+		report.IssueCount++
+		if len(report.Issues) < verifyMaxIssueReport {
+			report.Issues = append(report.Issues, VerifyIssue{FrameIndex: idx, Type: typ, Detail: detail})
+		}
+		if !problem[idx] {
+			problem[idx] = true
+			report.ProblemFrames = append(report.ProblemFrames, idx)
+		}
+	}
+
+	channels := make(map[uint32]*channelState)
+	var buf []byte
+	defer func() { seetong.PutFrameBuffer(buf) }()
+	for i, frame := range entries {
+		if frame.Channel != seetong.ChannelVideo1 && frame.Channel != seetong.ChannelVideo2 && frame.Channel != seetong.ChannelAudio {
+			continue
+		}
+		report.FrameCount++
+		state := channels[frame.Channel]
+		if state == nil {
+			state = &channelState{firstFrame: i}
+			channels[frame.Channel] = state
+		}
+
+		isAudio := frame.Channel == seetong.ChannelAudio
+		if isAudio {
+			report.AudioFrames++
+		} else {
+			report.VideoFrames++
+		}
+
+		// 时间戳连续性（同通道）
+		if state.seen {
+			switch {
+			case frame.TimestampUs < state.lastTsUs:
+				addIssue(i, IssueTimestampBack,
+					fmt.Sprintf("时间戳回退 %dus", state.lastTsUs-frame.TimestampUs))
+			case frame.TimestampUs-state.lastTsUs > verifyMaxGapUs:
+				addIssue(i, IssueTimestampGap,
+					fmt.Sprintf("与前一帧间隔 %dms", (frame.TimestampUs-state.lastTsUs)/1000))
+			}
+		}
+		state.seen = true
+		state.lastTsUs = frame.TimestampUs
+
+		// I/P 帧节奏（仅视频）
+		if !isAudio {
+			state.framesSeen++
+			if frame.IsIFrame() {
+				report.IFrames++
+				state.seenIFrame = true
+				state.sinceI = 0
+			} else {
+				state.sinceI++
+				if state.sinceI == verifyMaxGOPFrames {
+					addIssue(i, IssueMissingKeyframe,
+						fmt.Sprintf("通道 %d 连续 %d 帧没有 I 帧", frame.Channel, verifyMaxGOPFrames))
+				}
+			}
+		}
+
+		// 偏移范围
+		if frame.FrameSize == 0 {
+			addIssue(i, IssueEmptyFrame, "帧大小为 0")
+			continue
+		}
+		end := int64(frame.FileOffset) + int64(frame.FrameSize)
+		if end > seetong.TRecIndexRegionStart {
+			addIssue(i, IssueOutOfBounds,
+				fmt.Sprintf("偏移 0x%X + %d 超出数据区域", frame.FileOffset, frame.FrameSize))
+			continue
+		}
+
+		// 视频帧必须以 NAL 起始码开头
+		if isAudio {
+			continue
+		}
+		var err error
+		buf, err = storage.ReadFrameInto(fileIndex, frame, buf)
+		if err != nil {
+			addIssue(i, IssueReadError, err.Error())
+			continue
+		}
+		if !bytes.HasPrefix(buf, seetong.NalStartCode4) && !bytes.HasPrefix(buf, seetong.NalStartCode3) {
+			head := buf
+			if len(head) > len(seetong.NalStartCode4) {
+				head = head[:len(seetong.NalStartCode4)]
+			}
+			addIssue(i, IssueNoStartCode, fmt.Sprintf("起始字节 % X", head))
+		}
+	}
+
+	// 整个文件都没有 I 帧的视频通道
+	for ch, state := range channels {
+		if ch != seetong.ChannelAudio && !state.seenIFrame && state.framesSeen > 0 &&
+			state.framesSeen < verifyMaxGOPFrames {
+			addIssue(state.firstFrame, IssueMissingKeyframe, fmt.Sprintf("通道 %d 没有 I 帧", ch))
+		}
+	}
+
+	if report.FrameCount > 0 {
+		report.Score = 100 * float64(report.FrameCount-len(problem)) / float64(report.FrameCount)
+	}
+	return report, nil
+}
+
+// VerifyRecording 校验录像文件完整性
+// GET /api/v1/verify/{file_index}
+func (h *Handlers) VerifyRecording(ctx iris.Context) {
+	storage := h.dvr.GetStorage()
+	if storage == nil || !h.dvr.IsLoaded() {
+		writeError(ctx, errNotLoaded)
+		return
+	}
+
+	fileIndex := ctx.Params().GetIntDefault("file_index", 0)
+	if storage.GetSegmentByFileIndex(fileIndex) == nil {
+		writeError(ctx, errSegmentNotFound)
+		return
+	}
+
+	report, err := buildVerifyReport(storage, fileIndex)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+	ctx.JSON(report)
+}
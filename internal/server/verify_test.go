@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"seetong-dvr/internal/seetong"
+)
+
+// patchEntryTimestamp 修改 TRec 文件中第 i 条帧索引条目的 TimestampUs
+func patchEntryTimestamp(t *testing.T, path string, i int, tsUs uint64) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], tsUs)
+	if _, err := f.WriteAt(buf[:], seetong.TRecIndexRegionStart+int64(i*seetong.TRecFrameIndexSize)+24); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyReportChecksFileOrder(t *testing.T) {
+	start := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	dir := writeFixtureDVR(t, fixtureSegment{Channel: 1, Start: start, End: start.Add(fixtureGOPs * time.Second)})
+	recFile := filepath.Join(dir, "TRec000000.tps")
+	records, _ := fixtureFrames(start.Unix())
+
+	// 条目按视频、音频交替写入：第 100 条是第 50 帧视频，时间戳改回第 40 帧（排序后看不出回退）
+	const backwards = 100
+	patchEntryTimestamp(t, recFile, backwards, 40*40000)
+	// 第 150 帧起的视频和音频时间戳整体后移 3 秒（断档）
+	const gap = 300
+	for i := gap; i < len(records); i++ {
+		patchEntryTimestamp(t, recFile, i, records[i].TimestampUs+3000000)
+	}
+
+	s := loadFixtureDVR(t, dir, FixedClock{Time: start.Add(time.Hour), Location: time.UTC}, "UTC")
+	report, err := buildVerifyReport(s.GetStorage(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.FrameCount != len(records) {
+		t.Fatalf("checked %d frames, want %d", report.FrameCount, len(records))
+	}
+	want := map[VerifyIssue]bool{
+		{FrameIndex: backwards, Type: IssueTimestampBack}: true,
+		{FrameIndex: gap, Type: IssueTimestampGap}:        true, // 视频
+		{FrameIndex: gap + 1, Type: IssueTimestampGap}:    true, // 音频
+	}
+	for _, issue := range report.Issues {
+		key := VerifyIssue{FrameIndex: issue.FrameIndex, Type: issue.Type}
+		if !want[key] {
+			t.Errorf("unexpected issue %+v", issue)
+		}
+		delete(want, key)
+	}
+	for issue := range want {
+		t.Errorf("missing %s at entry %d", issue.Type, issue.FrameIndex)
+	}
+	if len(report.ProblemFrames) != 3 || report.Score >= 100 {
+		t.Fatalf("problem frames %v, score %.2f", report.ProblemFrames, report.Score)
+	}
+}
@@ -6,21 +6,42 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"seetong-dvr/internal/config"
 	"seetong-dvr/internal/seetong"
 
 	"github.com/gorilla/websocket"
 	"github.com/kataras/iris/v12"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 64 * 1024,
-	CheckOrigin:     func(r *http.Request) bool { return true },
+// WebSocket 缓冲大小（wsReadBufferKb / wsWriteBufferKb 为 0 时使用），配置值不超过 wsMaxBufferKB
+const (
+	wsDefaultReadBuffer  = 1024
+	wsDefaultWriteBuffer = 64 * 1024
+	wsMaxBufferKB        = 4096
+)
+
+// newUpgrader 按配置创建 WebSocket upgrader
+// 启用压缩时只在客户端请求 permessage-deflate 时生效，每条消息是否压缩由 sendJSON / sendBytesWithID 决定
+func newUpgrader(c config.Config) *websocket.Upgrader {
+	bufferSize := func(kb, def int) int {
+		switch {
+		case kb <= 0:
+			return def
+		case kb > wsMaxBufferKB:
+			kb = wsMaxBufferKB
+		}
+		return kb * 1024
+	}
+	return &websocket.Upgrader{
+		ReadBufferSize:    bufferSize(c.WSReadBufferKB, wsDefaultReadBuffer),
+		WriteBufferSize:   bufferSize(c.WSWriteBufferKB, wsDefaultWriteBuffer),
+		EnableCompression: c.WSCompression,
+		CheckOrigin:       func(r *http.Request) bool { return true },
+	}
 }
 
 // WSMessage WebSocket 消息
@@ -29,39 +50,133 @@ type WSMessage struct {
 	Channel   int     `json:"channel"`
 	Timestamp int64   `json:"timestamp"`
 	Speed     float64 `json:"speed"`
+
+	// 按帧索引开始（优先于 timestamp），从该帧之前最近的 I 帧开始播放
+	FileIndex  *int `json:"fileIndex,omitempty"`
+	FrameIndex *int `json:"frameIndex,omitempty"`
+
+	// playTimeline 的日期（YYYY-MM-DD，显示时区）
+	Date string `json:"date,omitempty"`
+
+	// 只播放指定通道：段落中没有该通道的视频时返回 channel_unavailable 错误，
+	// 不播放段落中的其他通道
+	StrictChannel bool `json:"strictChannel,omitempty"`
+
+	// 只发送这些视频帧类型："I"（关键帧）、"P"（参考帧）、"N"（非参考帧），为空时全部发送
+	// 快速浏览时 ["I"] 或 ["I","P"] 可以减少流量，跳过的帧不参与节奏控制，也不发送音频
+	FrameTypes []string `json:"frameTypes,omitempty"`
+
+	// 发送落后超过 lagThresholdMs（0 使用服务端的 paceMaxLagMs）时的处理：
+	// "slow"（默认）重新对齐节奏、不丢帧；"skip" 跳到应播放位置之后的下一个 I 帧并发送 resync 消息
+	LagPolicy      string `json:"lagPolicy,omitempty"`
+	LagThresholdMs int    `json:"lagThresholdMs,omitempty"`
 }
 
 // StreamSession 流会话
 type StreamSession struct {
-	ws       *websocket.Conn
-	handlers *Handlers          // 引用 Handlers 以获取最新的 DVR
-	cancel   context.CancelFunc // 当前流的取消函数
-	streamID uint64             // 当前流的 ID
-	mu       sync.Mutex
-	wg       sync.WaitGroup
+	ws          *websocket.Conn
+	handlers    *Handlers          // 引用 Handlers 以获取最新的 DVR
+	conn        context.Context    // 连接的生命周期，各个流的 context 由它派生
+	disconnect  context.CancelFunc // 读写失败（客户端断开）时取消 conn
+	cancel      context.CancelFunc // 当前流的取消函数
+	streamID    uint64             // 当前流的 ID
+	audioFormat string             // 音频输出格式（g711-ulaw / aac）
+	clientIP    string             // 流配额按客户端 IP 统计
+	cursor      *streamCursor      // 暂停时保留的播放位置（只在流 goroutine 内修改，stop() 之后读取）
+	progress    streamProgress     // 当前流的播放位置和发送统计（原子访问，流运行时也可以读取）
+	mu          sync.Mutex
+	wg          sync.WaitGroup
+
+	// 断线重连：以下字段只在连接的读循环中访问
+	token        string        // 重连令牌，未启用时为空
+	closed       chan struct{} // 连接退出并保存状态后关闭
+	channel      int           // 最后一次播放的通道和速度
+	speed        float64
+	live         bool
+	freshDecoder bool         // 重连后客户端解码器是新的，继续播放时需要重新发送视频头
+	timeline     *dayTimeline // playTimeline 模式下的当天时间线，seek 在其中定位
+	strict       bool         // 最后一次 play/seek 的 strictChannel，继续播放时沿用
+	frameTypes   frameFilter  // 最后一次 play/seek 的 frameTypes，继续播放时沿用
+	lag          lagPolicy    // 最后一次 play/seek 的 lagPolicy，继续播放时沿用
 }
 
 var streamCounter uint64 // 全局流计数器
 
+// streamStart 流的起始位置（默认按时间戳）
+type streamStart struct {
+	resume     *streamCursor // 从暂停位置继续
+	byFrame    bool          // 按帧索引开始
+	fileIndex  int
+	frameIndex int
+	timeline   *dayTimeline // 非空时从 fileIndex 段落开始，结束后继续播放时间线中的下一段
+	strict     bool         // 段落中没有请求的通道时报错
+	filter     frameFilter  // 只发送这些类型的视频帧
+	lag        lagPolicy    // 发送落后时的处理方式
+}
+
+// streamCursor 流的播放位置，暂停后不带 timestamp 的 play 从这里继续
+type streamCursor struct {
+	Channel     int
+	FileIndex   int
+	StreamPos   int64 // 下一个待发送 NAL 的文件偏移
+	TimestampMs int64 // 最后发送的视频帧时间
+	AudioIdx    int   // 下一个待发送的音频帧
+}
+
 const audioSampleRate = 8000
 
 // HandleWebSocket WebSocket 处理器
+// ?audio=aac 时服务端将 G.711 转码为 AAC（需要 ffmpeg，不可用时返回 501）
 func (h *Handlers) HandleWebSocket(ctx iris.Context) {
-	ws, err := upgrader.Upgrade(ctx.ResponseWriter(), ctx.Request(), nil)
+	audioFormat := ctx.URLParamDefault("audio", AudioFormatG711)
+	switch audioFormat {
+	case AudioFormatG711:
+	case AudioFormatAAC:
+		if !AACAvailable() {
+			writeError(ctx, newAPIError(501, ReasonUnsupported, "AAC 转码需要 ffmpeg", "AAC transcoding requires ffmpeg"))
+			return
+		}
+	default:
+		writeError(ctx, errInvalidParam("不支持的音频格式", "unsupported audio format").WithDetail(audioFormat))
+		return
+	}
+
+	ws, err := h.upgrader.Upgrade(ctx.ResponseWriter(), ctx.Request(), nil)
 	if err != nil {
 		fmt.Printf("[WS] Upgrade error: %v\n", err)
 		return
 	}
 	defer ws.Close()
 
+	conn, disconnect := context.WithCancel(context.Background())
+	defer disconnect()
 	session := &StreamSession{
-		ws:       ws,
-		handlers: h,
+		ws:          ws,
+		handlers:    h,
+		conn:        conn,
+		disconnect:  disconnect,
+		audioFormat: audioFormat,
+		clientIP:    ctx.RemoteAddr(),
+		closed:      make(chan struct{}),
 	}
 
 	sessionID := fmt.Sprintf("%p", ws)
 	fmt.Printf("[WS] 新连接: %s\n", sessionID)
 
+	// 发放重连令牌；带有效令牌重连时恢复断开前的播放状态
+	connected := map[string]interface{}{"type": "connected", "resumed": false}
+	var restored *savedSession
+	if h.reconnect.enabled() {
+		session.token, restored = h.reconnect.attach(session, ctx.URLParam("sessionToken"))
+		connected["sessionToken"] = session.token
+		connected["resumed"] = restored != nil
+	}
+	session.sendJSON(connected)
+	if restored != nil {
+		fmt.Printf("[WS] 重连恢复: ch=%d, live=%v, playing=%v\n", restored.channel, restored.live, restored.playing)
+		session.restore(restored)
+	}
+
 	for {
 		_, message, err := ws.ReadMessage()
 		if err != nil {
@@ -76,6 +191,27 @@ func (h *Handlers) HandleWebSocket(ctx iris.Context) {
 			session.sendJSON(map[string]interface{}{"error": "无效的 JSON"})
 			continue
 		}
+		msg.Channel = segmentChannelFor(msg.Channel)
+		switch msg.Action {
+		case "play", "seek", "playTimeline", "playLatest":
+			filter, err := parseFrameFilter(msg.FrameTypes)
+			if err != nil {
+				session.sendJSON(map[string]interface{}{"error": err.Error(), "reason": ReasonInvalidParam})
+				continue
+			}
+			lag, err := parseLagPolicy(msg.LagPolicy, msg.LagThresholdMs)
+			if err != nil {
+				session.sendJSON(map[string]interface{}{"error": err.Error(), "reason": ReasonInvalidParam})
+				continue
+			}
+			// 之前跳过的帧类型现在需要发送时，客户端缺少参考帧，继续播放要从 I 帧重新开始
+			if filter.effective()&^session.frameTypes.effective() != 0 {
+				session.freshDecoder = true
+			}
+			session.strict = msg.StrictChannel
+			session.frameTypes = filter
+			session.lag = lag
+		}
 
 		switch msg.Action {
 		case "play":
@@ -83,10 +219,49 @@ func (h *Handlers) HandleWebSocket(ctx iris.Context) {
 			if msg.Speed == 0 {
 				msg.Speed = 1.0
 			}
+			if err := h.streams.checkSpeed(msg.Speed); err != nil {
+				session.sendJSON(map[string]interface{}{"error": err.Error()})
+				continue
+			}
+			if msg.FrameIndex != nil {
+				session.timeline = nil
+				session.startStreamAtFrame(msg, msg.Speed)
+				continue
+			}
+			// 不带 timestamp 时从暂停位置继续（时间线模式下继续时间线）
+			if msg.Timestamp == 0 && session.cursor != nil {
+				fmt.Printf("[WS] 继续播放: file_index=%d, pos=%d, speed=%.1f\n",
+					session.cursor.FileIndex, session.cursor.StreamPos, msg.Speed)
+				session.resumeStream(msg.Speed)
+				continue
+			}
 			fmt.Printf("[WS] 开始播放: ch=%d, ts=%d, speed=%.1f\n",
 				msg.Channel, msg.Timestamp, msg.Speed)
+			session.timeline = nil
 			session.startStream(msg.Channel, msg.Timestamp, msg.Speed)
 
+		case "playTimeline":
+			session.stop()
+			if msg.Speed == 0 {
+				msg.Speed = 1.0
+			}
+			if err := h.streams.checkSpeed(msg.Speed); err != nil {
+				session.sendJSON(map[string]interface{}{"error": err.Error()})
+				continue
+			}
+			session.startTimeline(msg)
+
+		case "playLatest":
+			session.stop()
+			if msg.Speed == 0 {
+				msg.Speed = 1.0
+			}
+			if err := h.streams.checkSpeed(msg.Speed); err != nil {
+				session.sendJSON(map[string]interface{}{"error": err.Error()})
+				continue
+			}
+			session.startLatest(msg)
+
 		case "pause":
 			session.stop()
 			fmt.Printf("[WS] 暂停\n")
@@ -96,18 +271,94 @@ func (h *Handlers) HandleWebSocket(ctx iris.Context) {
 			if msg.Speed == 0 {
 				msg.Speed = 1.0
 			}
+			if err := h.streams.checkSpeed(msg.Speed); err != nil {
+				session.sendJSON(map[string]interface{}{"error": err.Error()})
+				continue
+			}
+			if msg.FrameIndex != nil {
+				session.timeline = nil
+				session.startStreamAtFrame(msg, msg.Speed)
+				continue
+			}
+			if session.timeline != nil {
+				session.seekTimeline(msg.Timestamp, msg.Speed)
+				continue
+			}
 			session.startStream(msg.Channel, msg.Timestamp, msg.Speed)
 			fmt.Printf("[WS] Seek: ts=%d\n", msg.Timestamp)
 
+		case "stepForward", "stepBackward":
+			session.stop()
+			session.stepFrame(msg.Action == "stepBackward")
+
+		case "live":
+			session.stop()
+			session.cursor = nil
+			session.timeline = nil
+			fmt.Printf("[WS] 实时模式: ch=%d\n", msg.Channel)
+			session.startLive(msg.Channel)
+
 		case "speed":
 			fmt.Printf("[WS] 速度变更: %.1fx\n", msg.Speed)
+
+		case "status":
+			// 只读取状态，不影响正在运行的流
+			session.sendJSON(session.status(time.Now()))
 		}
 	}
 
+	// 先取消连接，正在读取文件或退避重试的流立即退出，不必等到下一次发送失败
+	session.disconnect()
+	playing := session.isPlaying()
 	session.stop()
+	if session.token != "" {
+		h.reconnect.detach(session, session.token, session.snapshot(playing))
+	}
+	close(session.closed)
 	fmt.Printf("[WS] 断开连接: %s\n", sessionID)
 }
 
+// isPlaying 当前是否有流在运行（或已播放到文件末尾）
+func (s *StreamSession) isPlaying() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cancel != nil
+}
+
+// snapshot 保存断开时的播放状态（在 stop() 之后调用）
+func (s *StreamSession) snapshot(playing bool) savedSession {
+	state := savedSession{
+		channel:  s.channel,
+		speed:    s.speed,
+		live:     s.live,
+		playing:  playing,
+		timeline: s.timeline,
+	}
+	if s.cursor != nil {
+		cursor := *s.cursor
+		state.cursor = &cursor
+	}
+	return state
+}
+
+// restore 恢复重连前的播放状态，断开时正在播放的立即继续
+func (s *StreamSession) restore(state *savedSession) {
+	s.channel, s.speed = state.channel, state.speed
+	s.timeline = state.timeline
+	switch {
+	case state.live:
+		if state.playing {
+			s.startLive(state.channel)
+		}
+	case state.cursor != nil:
+		s.cursor = state.cursor
+		s.freshDecoder = true
+		if state.playing {
+			s.resumeStream(state.speed)
+		}
+	}
+}
+
 // stop 停止当前流并等待完成
 func (s *StreamSession) stop() {
 	s.mu.Lock()
@@ -123,22 +374,132 @@ func (s *StreamSession) stop() {
 
 // startStream 启动新流
 func (s *StreamSession) startStream(channel int, timestamp int64, speed float64) {
+	s.launchStream(channel, timestamp, speed, streamStart{})
+}
+
+// startLatest 从最新录像的开始时间播放（与 /quickplay 的选择相同），channel 为 0 时不限通道
+func (s *StreamSession) startLatest(msg WSMessage) {
+	var channel *int
+	if msg.Channel > 0 {
+		channel = &msg.Channel
+	}
+	rec, ok := s.getDVR().QuickPlay(channel, s.handlers.cfg.Get().DefaultChannel)
+	if !ok {
+		s.sendJSON(map[string]interface{}{"error": "没有录像"})
+		return
+	}
+	fmt.Printf("[WS] 播放最新录像: ch=%d, ts=%d, speed=%.1f\n", rec.Channel, rec.StartTimestamp, msg.Speed)
+	s.timeline = nil
+	s.startStream(rec.Channel, rec.StartTimestamp, msg.Speed)
+}
+
+// startStreamAtFrame 从指定帧索引启动新流
+func (s *StreamSession) startStreamAtFrame(msg WSMessage, speed float64) {
+	if msg.FileIndex == nil {
+		s.sendJSON(map[string]interface{}{"error": "frameIndex 需要同时指定 fileIndex"})
+		return
+	}
+	fmt.Printf("[WS] 按帧播放: ch=%d, file_index=%d, frame=%d, speed=%.1f\n",
+		msg.Channel, *msg.FileIndex, *msg.FrameIndex, speed)
+	s.launchStream(msg.Channel, 0, speed, streamStart{
+		byFrame:    true,
+		fileIndex:  *msg.FileIndex,
+		frameIndex: *msg.FrameIndex,
+	})
+}
+
+// resumeStream 从暂停位置继续播放
+func (s *StreamSession) resumeStream(speed float64) {
+	cursor := *s.cursor
+	if s.freshDecoder && !audioOnlyRequested(cursor.Channel) {
+		// 重连后从覆盖暂停位置的 I 帧开始，重新发送视频头
+		if storage := s.getDVR().GetStorage(); storage != nil {
+			frameIdx := frameIndexAtOffset(storage.GetFrameIndex(cursor.FileIndex),
+				uint32(frameChannelFor(cursor.Channel)), cursor.StreamPos)
+			s.launchStream(cursor.Channel, 0, speed, streamStart{
+				byFrame:    true,
+				fileIndex:  cursor.FileIndex,
+				frameIndex: frameIdx,
+				timeline:   s.timeline,
+			})
+			return
+		}
+	}
+	s.launchStream(cursor.Channel, 0, speed, streamStart{resume: &cursor, timeline: s.timeline})
+}
+
+// launchStream 启动流 goroutine
+func (s *StreamSession) launchStream(channel int, timestamp int64, speed float64, start streamStart) {
+	if !s.acquireStream() {
+		return
+	}
+	s.channel, s.speed = channel, speed
+	s.live, s.freshDecoder = false, false
+	start.strict = s.strict
+	start.filter = s.frameTypes
+	start.lag = s.lag
+
 	// 创建新的 context 和 streamID
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(s.conn)
 	newStreamID := atomic.AddUint64(&streamCounter, 1)
 
 	s.mu.Lock()
 	s.cancel = cancel
 	s.streamID = newStreamID
 	s.mu.Unlock()
+	s.progress.reset(time.Now())
 
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
-		s.streamVideoWithAudio(ctx, newStreamID, channel, timestamp, speed)
+		defer s.handlers.streams.release(s.clientIP)
+		s.runStream(ctx, newStreamID, channel, timestamp, speed, start)
 	}()
 }
 
+// runStream 播放段落直到结束
+// 时间线模式下自动切换到下一段录像，两段之间有空白时先发送 gap 消息（空白不等待）
+func (s *StreamSession) runStream(ctx context.Context, streamID uint64, channel int, timestamp int64, speed float64, start streamStart) {
+	for {
+		fileIndex, finished := s.streamVideoWithAudio(ctx, streamID, channel, timestamp, speed, start)
+		if !finished || ctx.Err() != nil {
+			return
+		}
+		if start.timeline == nil {
+			break
+		}
+		next, ok := start.timeline.next(fileIndex)
+		if !ok {
+			break
+		}
+
+		if cur, ok := start.timeline.segment(fileIndex); ok && next.StartTimestamp > cur.EndTimestamp {
+			s.sendJSON(map[string]interface{}{
+				"type":     "gap",
+				"from":     cur.EndTimestamp,
+				"to":       next.StartTimestamp,
+				"duration": next.StartTimestamp - cur.EndTimestamp,
+			})
+		}
+		fmt.Printf("[Stream#%d] 时间线切换: file_index=%d -> %d\n", streamID, fileIndex, next.ID)
+		start = streamStart{timeline: start.timeline, fileIndex: next.ID, strict: start.strict, filter: start.filter}
+		timestamp = next.StartTimestamp
+	}
+
+	s.progress.ended.Store(true)
+	s.sendJSON(map[string]interface{}{"type": "stream_end", "timeline": start.timeline != nil})
+}
+
+// acquireStream 占用流配额，超出限制时通知客户端
+func (s *StreamSession) acquireStream() bool {
+	if err := s.handlers.streams.acquire(s.clientIP); err != nil {
+		fmt.Printf("[WS] 拒绝新流: %v\n", err)
+		s.sendJSON(map[string]interface{}{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
 // sendJSON 发送 JSON 消息（带 streamID 验证）
 func (s *StreamSession) sendJSON(v interface{}) error {
 	jsonData, err := json.Marshal(v)
@@ -148,7 +509,12 @@ func (s *StreamSession) sendJSON(v interface{}) error {
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.ws.WriteMessage(websocket.TextMessage, jsonData)
+	s.ws.EnableWriteCompression(true) // 未协商压缩时不起作用
+	if err := s.ws.WriteMessage(websocket.TextMessage, jsonData); err != nil {
+		s.disconnect()
+		return err
+	}
+	return nil
 }
 
 // sendBytesWithID 发送二进制数据（带 streamID 验证，如果 ID 不匹配则跳过）
@@ -161,19 +527,29 @@ func (s *StreamSession) sendBytesWithID(streamID uint64, data []byte) bool {
 		return false
 	}
 
-	s.ws.WriteMessage(websocket.BinaryMessage, data)
+	// 写入失败说明客户端已断开，取消连接上的所有流
+	began := time.Now()
+	s.ws.EnableWriteCompression(false) // 视频和音频帧已压缩，再压缩只增加延迟
+	if err := s.ws.WriteMessage(websocket.BinaryMessage, data); err != nil {
+		s.disconnect()
+		return false
+	}
+	s.progress.wrote(len(data), time.Since(began))
 	return true
 }
 
 // getDVR 获取当前 DVR（线程安全）
 func (s *StreamSession) getDVR() *DVRServer {
-	s.handlers.mu.RLock()
-	defer s.handlers.mu.RUnlock()
-	return s.handlers.dvr
+	return s.handlers.getDVR()
 }
 
-// streamVideoWithAudio 流式传输音视频数据
-func (s *StreamSession) streamVideoWithAudio(ctx context.Context, streamID uint64, channel int, startTimestamp int64, speed float64) {
+// streamVideoWithAudio 流式传输一个段落的音视频数据
+// 返回播放的段落；finished 表示播放到了文件末尾（而不是取消或出错）
+func (s *StreamSession) streamVideoWithAudio(ctx context.Context, streamID uint64, channel int, startTimestamp int64, speed float64, start streamStart) (fileIndex int, finished bool) {
+	if audioOnlyRequested(channel) {
+		return s.streamAudioOnly(ctx, streamID, startTimestamp, speed, start)
+	}
+
 	dvr := s.getDVR()
 	storage := dvr.GetStorage()
 	if storage == nil || !dvr.IsLoaded() {
@@ -181,74 +557,130 @@ func (s *StreamSession) streamVideoWithAudio(ctx context.Context, streamID uint6
 		return
 	}
 
-	// 1. 查找段落
-	seg := storage.FindSegmentByTime(startTimestamp, channel, true)
+	// 1. 查找段落（继续播放时沿用暂停时的段落）
+	resume := start.resume
+	var seg *seetong.SegmentRecord
+	if resume != nil {
+		seg = storage.GetSegmentByFileIndex(resume.FileIndex)
+	} else if start.byFrame || start.timeline != nil {
+		seg = storage.GetSegmentByFileIndex(start.fileIndex)
+	} else {
+		seg = storage.FindSegmentByTime(startTimestamp, channel, true)
+	}
 	if seg == nil {
-		s.sendJSON(map[string]interface{}{"error": "未找到指定时间的录像"})
+		msg := map[string]interface{}{"error": "未找到指定时间的录像"}
+		if resume == nil && !start.byFrame && start.timeline == nil {
+			if otherChannelAt(storage, startTimestamp, channel) {
+				// 其他通道有录像：明确告诉客户端是通道不可用，而不是没有录像
+				msg["error"] = "该时间没有此通道的录像"
+				msg["reason"] = ReasonChannelUnavailable
+				msg["channel"] = channel
+			} else {
+				msg = seekMissMessage(storage, startTimestamp, channel)
+			}
+		}
+		s.sendJSON(msg)
 		return
 	}
 
-	fileIndex := seg.FileIndex
+	fileIndex = seg.FileIndex
 	fmt.Printf("[Stream#%d] file_index=%d, 时间范围: %d - %d\n", streamID, fileIndex, seg.StartTime, seg.EndTime)
 
 	// 通道映射
-	frameChannel := seetong.ChannelVideo1
-	if channel == 2 {
-		frameChannel = seetong.ChannelVideo2
+	frameChannel := frameChannelFor(channel)
+	if start.strict && (seg.Channel != channel || !hasVideoChannel(storage.GetFrameIndex(fileIndex), uint32(frameChannel))) {
+		fmt.Printf("[Stream#%d] 段落 %d 没有通道 %d 的视频\n", streamID, fileIndex, channel)
+		s.sendJSON(map[string]interface{}{
+			"type":      "error",
+			"reason":    ReasonChannelUnavailable,
+			"message":   "该时间没有此通道的录像",
+			"channel":   channel,
+			"fileIndex": fileIndex,
+		})
+		return
 	}
 
-	// 获取音频帧
+	// 获取音频帧（按帧类型过滤时不发送音频，仍然按文件位置推进音频序号）
 	audioFrames := storage.GetAudioFrames(fileIndex)
+	sendAudio := start.filter == 0
 
-	// 2. 使用音频帧时间戳找到目标时间对应的字节偏移
-	var targetOffset int64 = 0
-	if len(audioFrames) > 0 {
-		for _, af := range audioFrames {
-			if int64(af.UnixTs) >= startTimestamp {
-				targetOffset = int64(af.FileOffset)
-				break
+	var header *seetong.VideoHeader
+	var streamStartPos, actualStartTime, startTimeMs int64
+	audioIdx := 0
+	clamped := false
+
+	if resume != nil {
+		// 从下一个未发送的 NAL 继续，解码器保留了暂停前的参考帧，不需要重新发送视频头
+		streamStartPos = resume.StreamPos
+		startTimeMs = resume.TimestampMs
+		actualStartTime = resume.TimestampMs / 1000
+		audioIdx = resume.AudioIdx
+		fmt.Printf("[Stream#%d] 继续播放: pos=%d, 音频索引: %d\n", streamID, streamStartPos, audioIdx)
+	} else {
+		// 2. 使用音频帧时间戳找到目标时间对应的字节偏移
+		// 按帧索引开始时直接使用该帧之前最近的 I 帧
+		var targetOffset int64 = 0
+		if start.byFrame {
+			iframe, ok := findIFrameAtOrBefore(storage.GetFrameIndex(fileIndex), start.frameIndex, uint32(frameChannel))
+			if !ok {
+				s.sendJSON(map[string]interface{}{"error": "未找到指定帧之前的 I 帧"})
+				return
+			}
+			targetOffset = int64(iframe.FileOffset)
+			startTimestamp = int64(iframe.UnixTs)
+		} else if len(audioFrames) > 0 {
+			for _, af := range audioFrames {
+				if int64(af.UnixTs) >= startTimestamp {
+					targetOffset = int64(af.FileOffset)
+					break
+				}
+			}
+			if targetOffset == 0 {
+				targetOffset = int64(audioFrames[len(audioFrames)-1].FileOffset)
 			}
 		}
-		if targetOffset == 0 {
-			targetOffset = int64(audioFrames[len(audioFrames)-1].FileOffset)
+		if !start.byFrame {
+			targetOffset, clamped = clampSeekOffset(storage.GetFrameIndex(fileIndex), targetOffset, uint32(frameChannel))
+			if clamped {
+				fmt.Printf("[Stream#%d] 目标时间之后没有 I 帧，从最后一个 I 帧开始: offset=%d\n", streamID, targetOffset)
+			}
 		}
-	}
 
-	// 3. 搜索视频头
-	header := storage.ReadVideoHeader(fileIndex, targetOffset)
-	if header == nil {
-		s.sendJSON(map[string]interface{}{"type": "error", "message": "未找到视频头"})
-		return
-	}
+		// 3. 搜索视频头
+		header = storage.ReadVideoHeader(fileIndex, targetOffset)
+		if header == nil {
+			s.sendJSON(map[string]interface{}{"type": "error", "message": "未找到视频头"})
+			return
+		}
 
-	streamStartPos := header.StreamStartPos
-	fmt.Printf("[Stream#%d] VPS=%d, SPS=%d, PPS=%d, IDR=%d, pos=%d\n",
-		streamID, len(header.VPS), len(header.SPS), len(header.PPS), len(header.IDR), streamStartPos)
+		streamStartPos = header.StreamStartPos
+		fmt.Printf("[Stream#%d] VPS=%d, SPS=%d, PPS=%d, IDR=%d, pos=%d\n",
+			streamID, len(header.VPS), len(header.SPS), len(header.PPS), len(header.IDR), streamStartPos)
 
-	// 计算精确起始时间
-	var actualStartTime int64 = 0
-	if len(audioFrames) > 0 {
-		for _, af := range audioFrames {
-			if int64(af.FileOffset) <= streamStartPos {
-				actualStartTime = int64(af.UnixTs)
-			} else {
-				break
+		// 计算精确起始时间
+		if len(audioFrames) > 0 {
+			for _, af := range audioFrames {
+				if int64(af.FileOffset) <= streamStartPos {
+					actualStartTime = int64(af.UnixTs)
+				} else {
+					break
+				}
 			}
 		}
-	}
-	if actualStartTime == 0 {
-		actualStartTime = startTimestamp
-	}
+		if actualStartTime == 0 {
+			actualStartTime = startTimestamp
+		}
 
-	// 音频帧起始索引
-	audioIdx := 0
-	for i, af := range audioFrames {
-		if int64(af.FileOffset) >= streamStartPos {
-			audioIdx = i
-			break
+		// 音频帧起始索引
+		for i, af := range audioFrames {
+			if int64(af.FileOffset) >= streamStartPos {
+				audioIdx = i
+				break
+			}
 		}
+		fmt.Printf("[Stream#%d] 音频帧: %d, 起始索引: %d\n", streamID, len(audioFrames), audioIdx)
+		startTimeMs = actualStartTime * 1000
 	}
-	fmt.Printf("[Stream#%d] 音频帧: %d, 起始索引: %d\n", streamID, len(audioFrames), audioIdx)
 
 	// 检查是否已取消
 	if ctx.Err() != nil {
@@ -256,44 +688,75 @@ func (s *StreamSession) streamVideoWithAudio(ctx context.Context, streamID uint6
 		return
 	}
 
+	audio := s.newAudioSink(streamID)
+	defer audio.Close()
+
 	// 发送 stream_start
+	s.progress.fileIndex.Store(int64(fileIndex))
 	s.sendJSON(map[string]interface{}{
 		"type":            "stream_start",
 		"channel":         channel,
 		"startTime":       seg.StartTime,
 		"endTime":         seg.EndTime,
 		"actualStartTime": actualStartTime,
-		"hasAudio":        len(audioFrames) > 0,
-		"audioFormat":     "g711-ulaw",
+		"hasAudio":        sendAudio && len(audioFrames) > 0,
+		"frameTypes":      start.filter.names(),
+		"lagPolicy":       start.lag.name(),
+		"lagThresholdMs":  start.lag.threshold(s.handlers.avSync.paceMaxLagMs),
+		"audioOnly":       false,
+		"audioFormat":     audio.Format(),
 		"audioSampleRate": audioSampleRate,
+		"resumed":         resume != nil,
+		"clamped":         clamped,
+		"fileIndex":       fileIndex,
+		"timeline":        start.timeline != nil,
 	})
 
 	// 4. 发送视频头
-	s.sendVideoFrameWithID(streamID, header.VPS, seetong.NalVPS, actualStartTime*1000)
-	s.sendVideoFrameWithID(streamID, header.SPS, seetong.NalSPS, actualStartTime*1000)
-	s.sendVideoFrameWithID(streamID, header.PPS, seetong.NalPPS, actualStartTime*1000)
-	s.sendVideoFrameWithID(streamID, header.IDR, seetong.NalIDRWRadl, actualStartTime*1000)
+	if header != nil {
+		s.sendVideoFrameWithID(streamID, header.VPS, seetong.NalVPS, actualStartTime*1000)
+		s.sendVideoFrameWithID(streamID, header.SPS, seetong.NalSPS, actualStartTime*1000)
+		s.sendVideoFrameWithID(streamID, header.PPS, seetong.NalPPS, actualStartTime*1000)
+		s.sendVideoFrameWithID(streamID, header.IDR, seetong.NalIDRWRadl, actualStartTime*1000)
+	}
+
+	// 播放位置，暂停后用于继续播放
+	cursor := &streamCursor{
+		Channel:     channel,
+		FileIndex:   fileIndex,
+		StreamPos:   streamStartPos,
+		TimestampMs: startTimeMs,
+		AudioIdx:    audioIdx,
+	}
+	s.cursor = cursor
 
 	// 5. 创建流读取器
-	streamReader := storage.CreateStreamReader(fileIndex, streamStartPos, actualStartTime*1000, frameChannel)
+	streamReader := storage.CreateStreamReader(fileIndex, streamStartPos, startTimeMs, frameChannel)
 	if streamReader == nil {
 		s.sendJSON(map[string]interface{}{"type": "error", "message": "无法创建流读取器"})
 		return
 	}
 	defer streamReader.Close()
+	streamReader.SetContext(ctx)
 
 	fps := 25.0 * speed
 	streamReader.SetFPS(fps)
 	frameInterval := time.Duration(float64(time.Second) / fps)
 
-	// 打开音频文件
-	recFile := storage.GetRecFile(fileIndex)
-	audioFile, err := os.Open(recFile)
-	if err != nil {
-		s.sendJSON(map[string]interface{}{"type": "error", "message": err.Error()})
-		return
-	}
-	defer audioFile.Close()
+	// 按设备时间戳（微秒）计算音视频时间并控制节奏，UnixTs 只有秒级精度
+	timeline := newMediaTimeline(storage.GetFrameIndex(fileIndex), uint32(frameChannel))
+	syncCfg := s.handlers.avSync
+	pacer := newStreamPacer(speed, start.lag.threshold(syncCfg.paceMaxLagMs))
+	watchdog := newAVSyncWatchdog(syncCfg.thresholdMs, syncCfg.correct, time.Now())
+
+	// 音频帧读取缓冲，音频接收端同步复制数据，可以在帧之间复用
+	var audioBuf []byte
+	defer func() { seetong.PutFrameBuffer(audioBuf) }()
+
+	// 帧间等待复用同一个定时器
+	pace := time.NewTimer(time.Hour)
+	pace.Stop()
+	defer pace.Stop()
 
 	frameCount := 0
 	totalFramesSent := 0
@@ -310,57 +773,145 @@ func (s *StreamSession) streamVideoWithAudio(ctx context.Context, streamID uint6
 		}
 
 		// 读取 NAL 单元
+		resynced := false
 		nals := streamReader.ReadNextNals()
+		if ctx.Err() != nil {
+			fmt.Printf("[Stream#%d] 读取中取消，发送了 %d 帧\n", streamID, totalFramesSent)
+			return
+		}
+		if len(nals) == 0 && !s.getDVR().checkStorage() {
+			// 读取失败不是因为文件结束，保留暂停位置，重新插入后可以继续
+			fmt.Printf("[Stream#%d] 存储已断开，停止播放\n", streamID)
+			s.sendJSON(map[string]interface{}{"type": "error", "reason": ReasonDisconnected, "message": errDisconnected.Message})
+			return fileIndex, false
+		}
 		if len(nals) == 0 {
 			fmt.Printf("[Stream#%d] 文件结束, 总共发送 %d 帧\n", streamID, totalFramesSent)
 			break
 		}
 
 		for _, nal := range nals {
+			if resynced {
+				break // 跳转后丢弃本批剩余的 NAL，从新位置重新读取
+			}
 			// 每个 NAL 前检查取消
 			if ctx.Err() != nil {
 				fmt.Printf("[Stream#%d] NAL 循环中取消\n", streamID)
 				return
 			}
 
+			if !start.filter.allows(nal.NalType) {
+				cursor.StreamPos = nal.FileOffset + int64(nal.Size)
+				continue
+			}
+
 			if seetong.IsKeyframe(nal.NalType) {
 				fmt.Printf("[Stream#%d] IDR @ offset=%d\n", streamID, nal.FileOffset)
 			}
 
+			// 视频帧使用帧索引中的精确时间，找不到对应帧时沿用读取器的估算时间
+			tsMs := nal.TimestampMs
+			precise := false
+			if seetong.IsVideoFrame(nal.NalType) {
+				if ms, ok := timeline.videoTimeMs(nal.FileOffset); ok {
+					tsMs, precise = ms, true
+				}
+			}
+
 			// 发送时验证 streamID
-			if !s.sendVideoFrameWithID(streamID, nal.Data, nal.NalType, nal.TimestampMs) {
+			if !s.sendVideoFrameWithID(streamID, nal.Data, nal.NalType, tsMs) {
 				fmt.Printf("[Stream#%d] 发送失败（ID 不匹配），退出\n", streamID)
 				return
 			}
+			cursor.StreamPos = nal.FileOffset + int64(nal.Size)
+			if seetong.IsVideoFrame(nal.NalType) {
+				cursor.TimestampMs = tsMs
+			}
 
 			if seetong.IsVideoFrame(nal.NalType) {
 				frameCount++
 				totalFramesSent++
+				watchdog.video(tsMs)
 
-				// 发送音频帧
+				// 发送音频帧（按文件位置交错，校正模式下按漂移丢弃或推迟）
 				for audioIdx < len(audioFrames) {
 					af := audioFrames[audioIdx]
-					if int64(af.FileOffset) <= nal.FileOffset {
-						audioData := make([]byte, af.FrameSize)
-						audioFile.Seek(int64(af.FileOffset), 0)
-						audioFile.Read(audioData)
+					if int64(af.FileOffset) > nal.FileOffset {
+						break
+					}
 
-						audioTsMs := int64(af.UnixTs) * 1000
-						if !s.sendAudioFrameWithID(streamID, audioData, audioTsMs) {
-							return
-						}
+					if !sendAudio {
 						audioIdx++
-					} else {
+						cursor.AudioIdx = audioIdx
+						continue
+					}
+
+					audioTsMs := timeline.timeMs(af)
+					action := watchdog.audio(streamID, audioTsMs)
+					if action == avSyncHold {
 						break
 					}
+					if action == avSyncSend {
+						var err error
+						audioBuf, err = storage.ReadFrameIntoContext(ctx, fileIndex, af, audioBuf)
+						if ctx.Err() != nil {
+							return
+						}
+						if err != nil {
+							fmt.Printf("[Stream#%d] 音频帧读取失败: %v\n", streamID, err)
+						} else if !audio.Write(audioBuf, audioTsMs) {
+							return
+						}
+					}
+					audioIdx++
+					cursor.AudioIdx = audioIdx
+				}
+
+				if msg, ok := watchdog.report(time.Now()); ok {
+					s.sendJSON(msg)
 				}
 
-				// 使用可中断的 sleep
-				select {
-				case <-ctx.Done():
-					fmt.Printf("[Stream#%d] sleep 期间取消\n", streamID)
-					return
-				case <-time.After(frameInterval):
+				// 等待到该帧的计划发送时间（可中断），按帧类型过滤时按时间戳而不是帧间隔
+				var wait time.Duration
+				if precise || start.filter != 0 {
+					wait = pacer.wait(tsMs, time.Now())
+				} else {
+					wait = pacer.waitInterval(frameInterval, time.Now())
+				}
+				s.progress.lagMs.Store(pacer.lag.Milliseconds())
+
+				// skip 策略：落后超过阈值时跳到当前应播放位置之后的下一个 I 帧
+				if start.lag.skip && pacer.realigned {
+					targetMs := tsMs + int64(float64(pacer.lag.Milliseconds())*speed)
+					if kf, ok := nextKeyframeAfter(timeline, nal.FileOffset, targetMs); ok {
+						kfMs := timeline.timeMs(kf)
+						if err := streamReader.SeekTo(int64(kf.FileOffset), kfMs); err == nil {
+							fmt.Printf("[Stream#%d] 落后 %dms，跳到 offset=%d\n", streamID, pacer.lag.Milliseconds(), kf.FileOffset)
+							s.sendJSON(map[string]interface{}{
+								"type":        "resync",
+								"skippedMs":   kfMs - tsMs,
+								"lagMs":       pacer.lag.Milliseconds(),
+								"timestampMs": kfMs,
+							})
+							for audioIdx < len(audioFrames) && audioFrames[audioIdx].FileOffset < kf.FileOffset {
+								audioIdx++
+							}
+							cursor.StreamPos, cursor.AudioIdx = int64(kf.FileOffset), audioIdx
+							pacer.reset()
+							resynced = true
+							continue
+						}
+					}
+				}
+				if wait > 0 {
+					pace.Reset(wait)
+					select {
+					case <-ctx.Done():
+						pace.Stop()
+						fmt.Printf("[Stream#%d] sleep 期间取消\n", streamID)
+						return
+					case <-pace.C:
+					}
 				}
 			}
 		}
@@ -375,24 +926,113 @@ func (s *StreamSession) streamVideoWithAudio(ctx context.Context, streamID uint6
 		}
 	}
 
-	s.sendJSON(map[string]interface{}{"type": "stream_end"})
+	s.cursor = nil // 已播放到文件末尾，没有可继续的位置
+	return fileIndex, true
+}
+
+// findIFrameAtOrBefore 从 frameIdx 向前查找指定通道最近的 I 帧
+func findIFrameAtOrBefore(frames []seetong.FrameIndexRecord, frameIdx int, frameChannel uint32) (seetong.FrameIndexRecord, bool) {
+	if frameIdx < 0 || frameIdx >= len(frames) {
+		return seetong.FrameIndexRecord{}, false
+	}
+	for i := frameIdx; i >= 0; i-- {
+		if frames[i].Channel == frameChannel && frames[i].IsIFrame() {
+			return frames[i], true
+		}
+	}
+	return seetong.FrameIndexRecord{}, false
+}
+
+// frameChannelFor 将段落通道映射为帧索引中的视频通道
+// 也接受帧索引通道 258（客户端按 /channels 的 frameChannel 选择时），不会映射到第一路
+func frameChannelFor(channel int) int {
+	if channel == 2 || channel == seetong.ChannelVideo2 {
+		return seetong.ChannelVideo2
+	}
+	return seetong.ChannelVideo1
+}
+
+// segmentChannelFor 将帧索引通道 258 映射为段落通道 2，其他值原样返回
+// 帧索引通道 2 与段落通道 2 重名，只能按段落通道理解
+func segmentChannelFor(channel int) int {
+	if channel == seetong.ChannelVideo2 {
+		return 2
+	}
+	return channel
+}
+
+// otherChannelAt 其他通道在该时间是否有已缓存的录像
+func otherChannelAt(storage *seetong.TPSStorage, timestamp int64, channel int) bool {
+	for _, seg := range storage.GetSegments() {
+		if seg.Channel != channel && seg.StartTime <= timestamp && timestamp <= seg.EndTime &&
+			storage.FindSegmentByTime(timestamp, seg.Channel, true) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// hasVideoChannel 帧索引中是否有该通道的视频帧
+func hasVideoChannel(records []seetong.FrameIndexRecord, frameChannel uint32) bool {
+	for _, r := range records {
+		if r.Channel == frameChannel {
+			return true
+		}
+	}
+	return false
 }
 
 // sendVideoFrameWithID 发送视频帧（带 ID 验证）
 func (s *StreamSession) sendVideoFrameWithID(streamID uint64, nalData []byte, nalType int, timestampMs int64) bool {
-	var frameType byte
-	switch nalType {
-	case seetong.NalVPS:
-		frameType = 2
-	case seetong.NalSPS:
-		frameType = 3
-	case seetong.NalPPS:
-		frameType = 4
-	case seetong.NalIDRWRadl, seetong.NalIDRNLP:
-		frameType = 1
+	if !s.sendBytesWithID(streamID, encodeVideoFrame(nalData, nalType, timestampMs)) {
+		return false
+	}
+	s.progress.timestampMs.Store(timestampMs)
+	return true
+}
+
+// 视频帧二进制格式中的帧类型字节
+// 0/1/2/3/4 与早期版本保持一致，客户端在负载过高时可以安全丢弃 FrameByteDroppable
+const (
+	FrameByteReference = 0 // 参考帧（TRAIL_R 等 P 帧，及 CRA/BLA）
+	FrameByteIDR       = 1 // IDR 关键帧
+	FrameByteVPS       = 2
+	FrameByteSPS       = 3
+	FrameBytePPS       = 4
+	FrameByteDroppable = 5 // 非参考帧（TRAIL_N 等），丢弃不影响后续解码
+	FrameByteSEI       = 6
+	FrameByteAUD       = 7
+	FrameByteOther     = 8 // 其他非 VCL NAL
+)
+
+// frameTypeByte NAL 类型映射为帧类型字节
+func frameTypeByte(nalType int) byte {
+	switch {
+	case nalType == seetong.NalVPS:
+		return FrameByteVPS
+	case nalType == seetong.NalSPS:
+		return FrameByteSPS
+	case nalType == seetong.NalPPS:
+		return FrameBytePPS
+	case seetong.IsKeyframe(nalType):
+		return FrameByteIDR
+	case nalType == seetong.NalSEIPrefix || nalType == seetong.NalSEISuffix:
+		return FrameByteSEI
+	case nalType == seetong.NalAUD:
+		return FrameByteAUD
+	case seetong.IsSubLayerNonReference(nalType):
+		return FrameByteDroppable
+	case nalType < seetong.NalVPS:
+		return FrameByteReference // VCL
 	default:
-		frameType = 0
+		return FrameByteOther
 	}
+}
+
+// encodeVideoFrame 编码视频帧二进制格式
+// "H265"(4) + 时间戳毫秒(8) + 帧类型(1) + 长度(4) + NAL 数据
+func encodeVideoFrame(nalData []byte, nalType int, timestampMs int64) []byte {
+	frameType := frameTypeByte(nalType)
 
 	header := make([]byte, 17)
 	copy(header[0:4], "H265")
@@ -400,7 +1040,7 @@ func (s *StreamSession) sendVideoFrameWithID(streamID uint64, nalData []byte, na
 	header[12] = frameType
 	binary.BigEndian.PutUint32(header[13:17], uint32(len(nalData)))
 
-	return s.sendBytesWithID(streamID, append(header, nalData...))
+	return append(header, nalData...)
 }
 
 // sendAudioFrameWithID 发送音频帧（带 ID 验证）
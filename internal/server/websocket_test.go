@@ -0,0 +1,498 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"seetong-dvr/internal/config"
+	"seetong-dvr/internal/seetong"
+
+	"github.com/gorilla/websocket"
+)
+
+// startStreamServer 启动 startFixtureServer，返回处理器和 /stream 的 WebSocket 地址
+func startStreamServer(t *testing.T, cfg *config.Config) (*Handlers, string) {
+	t.Helper()
+	h, srv := startFixtureServer(t, cfg)
+	return h, "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/v1/stream"
+}
+
+// dialStream 连接 /stream 并读取 connected 消息
+func dialStream(t *testing.T, dialer *websocket.Dialer, url string) *websocket.Conn {
+	t.Helper()
+	ws, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var connected map[string]interface{}
+	if err := ws.ReadJSON(&connected); err != nil || connected["type"] != "connected" {
+		t.Fatalf("first message %v (%v), want connected", connected, err)
+	}
+	return ws
+}
+
+// activeStreams 所有会话中正在运行的流
+func (h *Handlers) activeStreams() int {
+	h.streams.mu.Lock()
+	defer h.streams.mu.Unlock()
+	return h.streams.active
+}
+
+// failingStorage fail 为 true 时所有读取都返回 I/O 错误（模拟卡住的读卡器）
+type failingStorage struct {
+	fail     atomic.Bool
+	failures atomic.Int32
+}
+
+func (s *failingStorage) Open(name string) (seetong.File, error) {
+	f, err := seetong.OSStorage{}.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &failingFile{File: f, s: s}, nil
+}
+
+func (s *failingStorage) Stat(name string) (fs.FileInfo, error) {
+	return seetong.OSStorage{}.Stat(name)
+}
+
+func (s *failingStorage) ReadDir(name string) ([]fs.DirEntry, error) {
+	return seetong.OSStorage{}.ReadDir(name)
+}
+
+type failingFile struct {
+	seetong.File
+	s *failingStorage
+}
+
+func (f *failingFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.s.fail.Load() {
+		f.s.failures.Add(1)
+		return 0, errors.New("input/output error")
+	}
+	return f.File.ReadAt(p, off)
+}
+
+func TestStreamExitsWhenClientDisconnects(t *testing.T) {
+	st := &failingStorage{}
+	seetong.SetStorage(st)
+	defer seetong.SetStorage(nil)
+	// 不取消时读取失败要重试约 30 秒（2s + 4s + 8s + 16s）
+	seetong.SetReadRetry(5, 2*time.Second)
+	defer seetong.SetReadRetry(3, 50*time.Millisecond)
+
+	h, url := startStreamServer(t, config.Default())
+	ws := dialStream(t, websocket.DefaultDialer, url)
+	defer ws.Close()
+	if err := ws.WriteJSON(WSMessage{Action: "play", Channel: 1, Timestamp: streamFixtureStart.Unix(), Speed: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for frames := 0; frames < 5; {
+		kind, _, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kind == websocket.BinaryMessage {
+			frames++
+		}
+	}
+	if n := h.activeStreams(); n != 1 {
+		t.Fatalf("%d active streams while playing, want 1", n)
+	}
+
+	// 流在读取重试的退避中时断开
+	st.fail.Store(true)
+	for deadline := time.Now().Add(5 * time.Second); st.failures.Load() == 0; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the stream did not read after the storage started failing")
+		}
+	}
+	ws.Close()
+
+	const bound = time.Second
+	closed := time.Now()
+	for h.activeStreams() > 0 {
+		if time.Since(closed) > bound {
+			t.Fatalf("stream goroutine still running %v after the client disconnected", bound)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// wsFrame 服务端发送的一个 WebSocket 帧（服务端帧不带掩码）
+type wsFrame struct {
+	opcode  int
+	rsv1    bool // permessage-deflate 压缩的消息在第一个帧设置 RSV1
+	payload []byte
+}
+
+// parseServerFrames 解析 upgrade 响应之后服务端发送的原始数据，末尾不完整的帧被忽略
+func parseServerFrames(t *testing.T, raw []byte) []wsFrame {
+	t.Helper()
+	end := bytes.Index(raw, []byte("\r\n\r\n"))
+	if end < 0 {
+		t.Fatal("no upgrade response")
+	}
+	raw = raw[end+4:]
+	var frames []wsFrame
+	for len(raw) >= 2 {
+		f := wsFrame{opcode: int(raw[0] & 0x0F), rsv1: raw[0]&0x40 != 0}
+		if raw[1]&0x80 != 0 {
+			t.Fatal("masked frame from the server")
+		}
+		n, head := int(raw[1]&0x7F), 2
+		switch n {
+		case 126:
+			if len(raw) < 4 {
+				return frames
+			}
+			n, head = int(binary.BigEndian.Uint16(raw[2:4])), 4
+		case 127:
+			if len(raw) < 10 {
+				return frames
+			}
+			n, head = int(binary.BigEndian.Uint64(raw[2:10])), 10
+		}
+		if len(raw) < head+n {
+			return frames
+		}
+		f.payload = raw[head : head+n]
+		frames = append(frames, f)
+		raw = raw[head+n:]
+	}
+	return frames
+}
+
+// recordingConn 记录从服务端读到的原始数据
+type recordingConn struct {
+	net.Conn
+	mu  sync.Mutex
+	raw []byte
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.mu.Lock()
+	c.raw = append(c.raw, p[:n]...)
+	c.mu.Unlock()
+	return n, err
+}
+
+func (c *recordingConn) recorded() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]byte(nil), c.raw...)
+}
+
+// fixtureNalUnit 录像文件中的一个 NAL（不含起始码）
+type fixtureNalUnit struct {
+	offset int64 // NAL 头的文件偏移
+	data   []byte
+}
+
+// fixtureNalStream 录像文件数据区按起始码切分的 NAL，与流读取器的切分相同
+func fixtureNalStream(t *testing.T, recFile string) []fixtureNalUnit {
+	t.Helper()
+	f, err := os.Open(recFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, _ := fixtureFrames(0)
+	last := records[len(records)-1]
+	data := make([]byte, last.FileOffset+last.FrameSize)
+	if _, err := f.ReadAt(data, 0); err != nil {
+		t.Fatal(err)
+	}
+	startCode := []byte{0x00, 0x00, 0x00, 0x01}
+	var nals []fixtureNalUnit
+	for pos := fixtureHeaderSize + len(startCode); ; {
+		end := bytes.Index(data[pos:], startCode)
+		if end < 0 {
+			return append(nals, fixtureNalUnit{int64(pos), data[pos:]})
+		}
+		nals = append(nals, fixtureNalUnit{int64(pos), data[pos : pos+end]})
+		pos += end + len(startCode)
+	}
+}
+
+// findNal nal 在 nals 中的序号，不存在时为 -1
+func findNal(nals []fixtureNalUnit, nal []byte) int {
+	for i := range nals {
+		if bytes.Equal(nals[i].data, nal) {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestStreamCompressesOnlyJSON(t *testing.T) {
+	for _, compression := range []bool{true, false} {
+		t.Run(fmt.Sprintf("compression=%v", compression), func(t *testing.T) {
+			cfg := config.Default()
+			cfg.WSCompression = compression
+			h, url := startStreamServer(t, cfg)
+
+			var conn *recordingConn
+			dialer := &websocket.Dialer{
+				EnableCompression: true,
+				NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					c, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+					if err != nil {
+						return nil, err
+					}
+					conn = &recordingConn{Conn: c}
+					return conn, nil
+				},
+			}
+			ws, resp, err := dialer.Dial(url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ws.Close()
+			if negotiated := strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate"); negotiated != compression {
+				t.Fatalf("permessage-deflate negotiated: %v, want %v", negotiated, compression)
+			}
+
+			// 客户端收到的消息（已解压）
+			type message struct {
+				kind int
+				data []byte
+			}
+			var received []message
+			if err := ws.WriteJSON(WSMessage{Action: "play", Channel: 1, Timestamp: streamFixtureStart.Unix(), Speed: 4}); err != nil {
+				t.Fatal(err)
+			}
+			for binaries := 0; binaries < 40; {
+				kind, data, err := ws.ReadMessage()
+				if err != nil {
+					t.Fatal(err)
+				}
+				received = append(received, message{kind, data})
+				if kind == websocket.BinaryMessage {
+					binaries++
+				}
+			}
+			ws.Close()
+
+			// 二进制消息是录像中连续的 NAL 和原样的 G.711 音频
+			nals := fixtureNalStream(t, h.getDVR().GetStorage().GetRecFile(0))
+			next := -1
+			var texts []message
+			var binaries [][]byte
+			for _, m := range received {
+				if m.kind == websocket.TextMessage {
+					texts = append(texts, m)
+					continue
+				}
+				binaries = append(binaries, m.data)
+				switch string(m.data[:4]) {
+				case "H265":
+					nal := m.data[17:]
+					if next < 0 {
+						if next = findNal(nals, nal); next < 0 {
+							t.Fatal("first video frame is not a NAL from the recording")
+						}
+					}
+					if next >= len(nals) || !bytes.Equal(nals[next].data, nal) {
+						t.Fatalf("video frame %d differs from NAL %d of the recording", len(binaries)-1, next)
+					}
+					want := encodeVideoFrame(nals[next].data, int(nal[0]>>1)&0x3F, int64(binary.BigEndian.Uint64(m.data[4:12])))
+					if !bytes.Equal(m.data, want) {
+						t.Fatalf("video frame %d header differs from encodeVideoFrame", len(binaries)-1)
+					}
+					next++
+				case "G711":
+					if audio := m.data[18:]; int(binary.BigEndian.Uint32(m.data[14:18])) != len(audio) || !bytes.Equal(audio, make([]byte, 320)) {
+						t.Fatalf("audio frame %d differs from the recording", len(binaries)-1)
+					}
+				default:
+					t.Fatalf("unknown binary message %q", m.data[:4])
+				}
+			}
+			if len(texts) < 2 || !strings.Contains(string(texts[1].data), `"stream_start"`) {
+				t.Fatalf("text messages %d, want connected and stream_start first", len(texts))
+			}
+
+			// 网络上的帧：JSON 在协商压缩时压缩，二进制帧不压缩、与客户端收到的数据相同
+			var wireTexts, wireBinaries int
+			var kind int
+			for _, f := range parseServerFrames(t, conn.recorded()) {
+				if f.opcode >= 0x8 {
+					continue // 控制帧
+				}
+				if f.opcode != 0 {
+					kind = f.opcode
+					if kind == websocket.TextMessage {
+						if f.rsv1 != compression {
+							t.Fatalf("text message %d compressed: %v, want %v", wireTexts, f.rsv1, compression)
+						}
+						wireTexts++
+					}
+					if kind == websocket.BinaryMessage {
+						if f.rsv1 {
+							t.Fatalf("binary message %d is compressed", wireBinaries)
+						}
+						if wireBinaries < len(binaries) && !bytes.Equal(f.payload, binaries[wireBinaries][:len(f.payload)]) {
+							t.Fatalf("binary message %d on the wire differs from the received data", wireBinaries)
+						}
+						wireBinaries++
+					}
+				}
+			}
+			if wireTexts < len(texts) || wireBinaries < len(binaries) {
+				t.Fatalf("%d text and %d binary messages on the wire, received %d and %d", wireTexts, wireBinaries, len(texts), len(binaries))
+			}
+		})
+	}
+}
+
+// streamMessage 读取下一条消息，二进制消息按类型解析出时间戳和负载
+type streamMessage struct {
+	kind    string // "H265"、"G711" 或 JSON 消息的 type
+	tsMs    int64
+	payload []byte
+}
+
+func readStreamMessage(t *testing.T, ws *websocket.Conn) streamMessage {
+	t.Helper()
+	kind, data, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind == websocket.TextMessage {
+		var msg struct {
+			Type  string `json:"type"`
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(data, &msg); err != nil || msg.Error != "" {
+			t.Fatalf("message %s (%v)", data, err)
+		}
+		return streamMessage{kind: msg.Type}
+	}
+	m := streamMessage{kind: string(data[:4]), tsMs: int64(binary.BigEndian.Uint64(data[4:12]))}
+	switch m.kind {
+	case "H265":
+		m.payload = data[17:]
+	case "G711":
+		m.payload = data[18:]
+	}
+	return m
+}
+
+func TestPauseThenPlayResumesAtNextNal(t *testing.T) {
+	h, url := startStreamServer(t, config.Default())
+	nals := fixtureNalStream(t, h.getDVR().GetStorage().GetRecFile(0))
+	ws := dialStream(t, websocket.DefaultDialer, url)
+	defer ws.Close()
+
+	lastVideo, lastAudioMs := -1, int64(-1)
+	// receive 读取到 n 帧视频或出现 until 类型的消息为止，检查视频 NAL 连续、音频时间递增
+	receive := func(n int, until string) (first int) {
+		t.Helper()
+		first = -1
+		for frames := 0; frames < n; {
+			m := readStreamMessage(t, ws)
+			switch m.kind {
+			case until:
+				return first
+			case "H265":
+				idx := findNal(nals, m.payload)
+				if idx < 0 {
+					t.Fatal("video frame is not a NAL from the recording")
+				}
+				if first < 0 {
+					first = idx
+				} else if idx != lastVideo+1 {
+					t.Fatalf("NAL %d after NAL %d", idx, lastVideo)
+				}
+				lastVideo = idx
+				frames++
+			case "G711":
+				if m.tsMs <= lastAudioMs {
+					t.Fatalf("audio at %dms after %dms", m.tsMs, lastAudioMs)
+				}
+				lastAudioMs = m.tsMs
+			}
+		}
+		return first
+	}
+
+	if err := ws.WriteJSON(WSMessage{Action: "play", Channel: 1, Timestamp: streamFixtureStart.Unix(), Speed: 4}); err != nil {
+		t.Fatal(err)
+	}
+	receive(30, "")
+
+	// status 在 pause 停止流之后处理，收到 status 时暂停前发送的帧都已读完
+	for _, action := range []string{"pause", "status"} {
+		if err := ws.WriteJSON(WSMessage{Action: action}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	receive(1<<30, "status")
+	paused := lastVideo
+
+	if err := ws.WriteJSON(WSMessage{Action: "play", Speed: 4}); err != nil {
+		t.Fatal(err)
+	}
+	first := receive(10, "")
+	if first != paused+1 {
+		t.Fatalf("resumed at NAL %d, want NAL %d right after the last one sent", first, paused+1)
+	}
+	last := nals[paused]
+	if got, want := nals[first].offset, last.offset+int64(len(last.data))+4; got != want {
+		t.Fatalf("first NAL after resume at offset %d, want %d (last sent at %d + %d bytes + start code)",
+			got, want, last.offset, len(last.data))
+	}
+}
+
+func TestFrameTypeByte(t *testing.T) {
+	// 帧类型字节是线上协议的一部分，数值不能改变
+	for i, b := range []int{FrameByteReference, FrameByteIDR, FrameByteVPS, FrameByteSPS, FrameBytePPS,
+		FrameByteDroppable, FrameByteSEI, FrameByteAUD, FrameByteOther} {
+		if b != i {
+			t.Fatalf("frame type byte #%d is %d, want %d", i, b, i)
+		}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		nalType int
+		want    byte
+	}{
+		{"TRAIL_N", seetong.NalTrailN, 5},
+		{"TRAIL_R", seetong.NalTrailR, 0},
+		{"RASL_N", 8, 5},
+		{"RASL_R", 9, 0},
+		{"BLA_W_LP", 16, 0},
+		{"IDR_W_RADL", seetong.NalIDRWRadl, 1},
+		{"IDR_N_LP", seetong.NalIDRNLP, 1},
+		{"CRA", 21, 0},
+		{"reserved IRAP", 23, 0},
+		{"VPS", seetong.NalVPS, 2},
+		{"SPS", seetong.NalSPS, 3},
+		{"PPS", seetong.NalPPS, 4},
+		{"AUD", seetong.NalAUD, 7},
+		{"EOS", 36, 8},
+		{"SEI prefix", seetong.NalSEIPrefix, 6},
+		{"SEI suffix", seetong.NalSEISuffix, 6},
+		{"unspecified", 48, 8},
+		{"largest type", 63, 8},
+	} {
+		if got := frameTypeByte(tc.nalType); got != tc.want {
+			t.Errorf("%s (%d): frame type byte %d, want %d", tc.name, tc.nalType, got, tc.want)
+		}
+	}
+}
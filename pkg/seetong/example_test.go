@@ -0,0 +1,56 @@
+package seetong_test
+
+import (
+	"fmt"
+	"log"
+
+	"seetong-dvr/pkg/seetong"
+)
+
+// 打开 DVR 目录，按段落读取视频通道的帧并列出其中的 NAL 单元
+func Example() {
+	storage := seetong.NewTPSStorage("/Volumes/DVR")
+	if err := storage.Load(); err != nil {
+		log.Fatal(err)
+	}
+
+	for _, seg := range storage.GetSegments() {
+		recFile := storage.GetRecFile(seg.FileIndex)
+		if recFile == "" {
+			continue
+		}
+
+		frames, err := seetong.ParseTRecFrameIndex(recFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, frame := range frames {
+			if frame.Channel != seetong.ChannelVideo1 {
+				continue
+			}
+			data, err := storage.ReadFrame(seg.FileIndex, frame)
+			if err != nil {
+				continue
+			}
+			for _, nal := range seetong.ParseNalUnits(data) {
+				fmt.Println(frame.UnixTs, seetong.NalTypeName(nal.NalType), nal.Size)
+			}
+		}
+	}
+}
+
+// 同时支持 4 字节和 3 字节起始码，Offset 和 Size 含起始码
+func ExampleParseNalUnits() {
+	data := []byte{
+		0x00, 0x00, 0x00, 0x01, 0x40, 0x01, 0x0C, // VPS
+		0x00, 0x00, 0x01, 0x42, 0x01, 0x01, // SPS
+		0x00, 0x00, 0x00, 0x01, 0x26, 0x01, 0xAF, 0x10, 0x20, // IDR
+	}
+	for _, nal := range seetong.ParseNalUnits(data) {
+		fmt.Println(nal.Offset, nal.Size, seetong.NalTypeName(nal.NalType))
+	}
+	// Output:
+	// 0 7 VPS
+	// 7 6 SPS
+	// 13 9 IDR_W_RADL
+}
@@ -0,0 +1,167 @@
+// Package seetong 天视通 DVR TPS 格式解析公共 API
+//
+// 本包是 internal/seetong 的稳定子集，供其他 Go 程序嵌入使用。
+// 服务器相关的逻辑（HTTP/WebSocket、缓存构建进度等）保留在 internal 中，
+// 这里导出的类型和函数在版本之间保持兼容。
+//
+// 打开 DVR 目录并遍历帧的完整示例见 Example。
+package seetong
+
+import (
+	internal "seetong-dvr/internal/seetong"
+)
+
+// 文件格式常量
+const (
+	TPSIndexMagic        = internal.TPSIndexMagic
+	TRecFileSize         = internal.TRecFileSize
+	TRecIndexRegionStart = internal.TRecIndexRegionStart
+	TRecFrameIndexMagic  = internal.TRecFrameIndexMagic
+	TRecFrameIndexSize   = internal.TRecFrameIndexSize
+	MinValidTimestamp    = internal.MinValidTimestamp
+)
+
+// 通道定义
+const (
+	ChannelVideo1 = internal.ChannelVideo1
+	ChannelAudio  = internal.ChannelAudio
+	ChannelVideo2 = internal.ChannelVideo2
+)
+
+// 帧类型
+const (
+	FrameTypeI = internal.FrameTypeI
+	FrameTypeP = internal.FrameTypeP
+)
+
+// NAL 类型
+const (
+	NalTrailN    = internal.NalTrailN
+	NalTrailR    = internal.NalTrailR
+	NalIDRWRadl  = internal.NalIDRWRadl
+	NalIDRNLP    = internal.NalIDRNLP
+	NalVPS       = internal.NalVPS
+	NalSPS       = internal.NalSPS
+	NalPPS       = internal.NalPPS
+	NalAUD       = internal.NalAUD
+	NalSEIPrefix = internal.NalSEIPrefix
+	NalSEISuffix = internal.NalSEISuffix
+)
+
+// 数据结构
+type (
+	// FrameIndexRecord TRec 文件中的帧索引记录
+	FrameIndexRecord = internal.FrameIndexRecord
+	// SegmentRecord 段落索引记录
+	SegmentRecord = internal.SegmentRecord
+	// NalUnit NAL 单元信息
+	NalUnit = internal.NalUnit
+	// VideoHeader 视频头信息（VPS/SPS/PPS/IDR）
+	VideoHeader = internal.VideoHeader
+	// VPSPosition VPS 位置和时间
+	VPSPosition = internal.VPSPosition
+	// TPSStorage TPS 存储管理器
+	TPSStorage = internal.TPSStorage
+	// FrameDecryptor 帧负载解密器（加扰帧数据的固件）
+	FrameDecryptor = internal.FrameDecryptor
+	// CacheKeyer 解密器可选实现的接口，VPS 缓存按 CacheKey 区分不同的密钥
+	CacheKeyer = internal.CacheKeyer
+	// XORDecryptor 按帧循环 XOR 密钥的解密器
+	XORDecryptor = internal.XORDecryptor
+)
+
+// NewTPSStorage 创建 TPS 存储管理器
+func NewTPSStorage(dvrPath string) *TPSStorage {
+	return internal.NewTPSStorage(dvrPath)
+}
+
+// ParseTIndex 解析 TIndex00.tps 主索引文件
+// 返回段落列表、文件数和条目数；条目按文件大小全部读取并逐条校验，不依赖文件头的条目数
+func ParseTIndex(indexPath string) ([]SegmentRecord, int, int, error) {
+	return internal.ParseTIndex(indexPath)
+}
+
+// ParseTRecFrameIndex 解析 TRec 文件中的帧索引（按时间正序）
+func ParseTRecFrameIndex(recFilePath string) ([]FrameIndexRecord, error) {
+	return internal.ParseTRecFrameIndex(recFilePath)
+}
+
+// ParseTRecFrameIndexStream 按文件顺序逐条回调帧索引记录（不排序），fn 返回 false 时停止
+func ParseTRecFrameIndexStream(recFilePath string, fn func(FrameIndexRecord) bool) error {
+	return internal.ParseTRecFrameIndexStream(recFilePath, fn)
+}
+
+// ScanVPSPositions 扫描 TRec 文件数据区域中所有 VPS 位置
+func ScanVPSPositions(recFilePath string) ([]int, error) {
+	return internal.ScanVPSPositions(recFilePath)
+}
+
+// ParseNalUnits 解析 Annex B 数据中的所有 NAL 单元
+func ParseNalUnits(data []byte) []NalUnit {
+	return internal.ParseNalUnits(data)
+}
+
+// StripStartCode 去掉 NAL 起始码
+func StripStartCode(data []byte) []byte {
+	return internal.StripStartCode(data)
+}
+
+// FindVPSSPSPPSIDR 在数据中查找 VPS/SPS/PPS/IDR 序列
+func FindVPSSPSPPSIDR(data []byte) *VideoHeader {
+	return internal.FindVPSSPSPPSIDR(data)
+}
+
+// IsVideoFrame 判断是否为视频帧 NAL
+func IsVideoFrame(nalType int) bool {
+	return internal.IsVideoFrame(nalType)
+}
+
+// IsKeyframe 判断是否为关键帧
+func IsKeyframe(nalType int) bool {
+	return internal.IsKeyframe(nalType)
+}
+
+// IsSubLayerNonReference 判断是否为非参考帧（可安全丢弃）
+func IsSubLayerNonReference(nalType int) bool {
+	return internal.IsSubLayerNonReference(nalType)
+}
+
+// IsHeader 判断是否为头部 NAL
+func IsHeader(nalType int) bool {
+	return internal.IsHeader(nalType)
+}
+
+// NalTypeName 返回 NAL 类型的可读名称
+func NalTypeName(nalType int) string {
+	return internal.NalTypeName(nalType)
+}
+
+// SetFrameDecryptor 设置帧负载解密器，读出的帧数据在返回前原地解密，nil 关闭解密
+func SetFrameDecryptor(d FrameDecryptor) {
+	internal.SetFrameDecryptor(d)
+}
+
+// NewXORDecryptor 创建 XOR 解密器：帧负载的第 i 个字节与 key[i%len(key)] 异或
+func NewXORDecryptor(key []byte) (*XORDecryptor, error) {
+	return internal.NewXORDecryptor(key)
+}
+
+// SetCacheDir 设置帧索引缓存目录
+func SetCacheDir(dir string) {
+	internal.SetCacheDir(dir)
+}
+
+// SetCompressedCache 设置是否以压缩格式写入帧索引缓存（更小，加载时需要解码）
+func SetCompressedCache(enabled bool) {
+	internal.SetCompressedCache(enabled)
+}
+
+// SetMinValidTimestamp 设置有效时间戳下限（Unix 秒）
+func SetMinValidTimestamp(ts int64) {
+	internal.SetMinValidTimestamp(ts)
+}
+
+// SetRawTimestampMode 设置 raw 模式（不按时间戳下限过滤）
+func SetRawTimestampMode(enabled bool) {
+	internal.SetRawTimestampMode(enabled)
+}
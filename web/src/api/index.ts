@@ -9,6 +9,32 @@ export interface RecordingDatesResponse {
   channels: number[];
 }
 
+export interface DaySummary {
+  date: string;
+  segments: number;
+  seconds: number;
+}
+
+export interface CalendarSummary {
+  period: string;
+  days: number;
+  segments: number;
+  seconds: number;
+}
+
+export interface RecordingCalendarResponse {
+  channels: number[];
+  years?: CalendarSummary[];
+  first?: string | null;
+  last?: string | null;
+  year?: number;
+  month?: number;
+  months?: CalendarSummary[];
+  days?: DaySummary[];
+  prev?: string | null;
+  next?: string | null;
+}
+
 export interface Recording {
   id: number;
   channel: number;
@@ -112,6 +138,32 @@ export async function getRecordingDates(channel?: number): Promise<RecordingDate
   return response.json();
 }
 
+/**
+ * 按日历获取有录像的日期：不带 year 时为每年的统计，带 year 时为每月，带 year 和 month 时为每天
+ */
+export async function getRecordingCalendar(year?: number, month?: number, channel?: number): Promise<RecordingCalendarResponse> {
+  const params = new URLSearchParams();
+  if (year === undefined) {
+    params.set('summary', 'true');
+  } else {
+    params.set('year', year.toString());
+    if (month !== undefined) {
+      params.set('month', month.toString());
+    }
+  }
+  if (channel !== undefined) {
+    params.set('channel', channel.toString());
+  }
+
+  const response = await fetch(`${API_BASE}/api/v1/recordings/dates?${params}`);
+
+  if (!response.ok) {
+    throw new Error(`API 错误: ${response.status}`);
+  }
+
+  return response.json();
+}
+
 /**
  * 获取指定日期的录像列表
  */